@@ -0,0 +1,84 @@
+package config
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/models"
+)
+
+// CascadeDeleteResult counts what was removed when a project was purged
+type CascadeDeleteResult struct {
+    Documents    map[string]int64 `json:"documents"` // deleted documents per collection
+    FilesRemoved int              `json:"files_removed"`
+}
+
+// CascadeDeleteProject permanently removes a project along with its chat
+// messages, usage logs, chat users, notifications and uploaded files.
+func CascadeDeleteProject(objID primitive.ObjectID) (*CascadeDeleteResult, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    var project models.Project
+    if err := DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project); err != nil {
+        return nil, err
+    }
+
+    result := &CascadeDeleteResult{Documents: make(map[string]int64)}
+
+    for name, filter := range relatedProjectData(objID) {
+        deleted, err := DB.Collection(name).DeleteMany(ctx, filter)
+        if err != nil {
+            return result, fmt.Errorf("failed to delete %s: %v", name, err)
+        }
+        result.Documents[name] = deleted.DeletedCount
+    }
+
+    result.FilesRemoved = removeSourceFiles(project.Sources())
+
+    deleted, err := DB.Collection("projects").DeleteOne(ctx, bson.M{"_id": objID})
+    if err != nil {
+        return result, fmt.Errorf("failed to delete project: %v", err)
+    }
+    result.Documents["projects"] = deleted.DeletedCount
+
+    return result, nil
+}
+
+// relatedProjectData is the filter selecting a project's documents in each collection
+// that holds them
+func relatedProjectData(objID primitive.ObjectID) map[string]bson.M {
+    return map[string]bson.M{
+        "chat_messages":     {"project_id": objID},
+        "chat_sessions":     {"project_id": objID},
+        "kb_chunks":         {"project_id": objID},
+        "gemini_usage_logs": {"project_id": objID},
+        "notifications":     {"project_id": objID},
+        // Chat users store the project ID as a hex string
+        "chat_users": {"project_id": objID.Hex()},
+    }
+}
+
+// removeSourceFiles deletes the uploads behind knowledge sources, returning how many
+// were removed; files already gone are skipped
+func removeSourceFiles(sources []models.KnowledgeSource) int {
+    removed := 0
+    for _, file := range sources {
+        if file.FilePath == "" {
+            continue
+        }
+        if err := os.Remove(file.FilePath); err != nil {
+            if !os.IsNotExist(err) {
+                log.Printf("Failed to remove %s: %v", file.FilePath, err)
+            }
+            continue
+        }
+        removed++
+    }
+    return removed
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/models"
+)
+
+func TestRelatedProjectData(t *testing.T) {
+    objID := primitive.NewObjectID()
+    related := relatedProjectData(objID)
+
+    for _, name := range []string{"chat_messages", "chat_sessions", "kb_chunks", "gemini_usage_logs", "notifications"} {
+        if related[name]["project_id"] != objID {
+            t.Errorf("%s filter = %v, want the project's ObjectID", name, related[name])
+        }
+    }
+    if related["chat_users"]["project_id"] != objID.Hex() {
+        t.Errorf("chat_users filter = %v, want the project ID as hex", related["chat_users"])
+    }
+}
+
+func TestRemoveSourceFiles(t *testing.T) {
+    dir := t.TempDir()
+    stored := filepath.Join(dir, "guide.pdf")
+    if err := os.WriteFile(stored, []byte("%PDF-1.4"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    removed := removeSourceFiles([]models.KnowledgeSource{
+        {ID: "stored", FilePath: stored},
+        {ID: "missing", FilePath: filepath.Join(dir, "already-gone.pdf")},
+        {ID: "text", Type: models.KnowledgeSourceText},
+    })
+    if removed != 1 {
+        t.Errorf("removed = %d, want 1", removed)
+    }
+    if _, err := os.Stat(stored); !os.IsNotExist(err) {
+        t.Errorf("the uploaded file is still there: %v", err)
+    }
+}
+
+func TestCascadeDeleteProject(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    objID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+
+    upload := filepath.Join(t.TempDir(), "guide.pdf")
+    if err := os.WriteFile(upload, []byte("%PDF-1.4"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    projects := []interface{}{
+        models.Project{ID: objID, Name: "Purged", KnowledgeSources: []models.KnowledgeSource{{ID: "guide", Type: models.KnowledgeSourcePDF, FilePath: upload}}},
+        models.Project{ID: otherID, Name: "Kept"},
+    }
+    if _, err := DB.Collection("projects").InsertMany(ctx, projects); err != nil {
+        t.Fatal(err)
+    }
+    seed := map[string][]interface{}{
+        "chat_messages":     {bson.M{"project_id": objID}, bson.M{"project_id": objID}, bson.M{"project_id": otherID}},
+        "gemini_usage_logs": {bson.M{"project_id": objID}},
+        "chat_users":        {bson.M{"project_id": objID.Hex()}, bson.M{"project_id": otherID.Hex()}},
+        "notifications":     {bson.M{"project_id": objID}},
+    }
+    for name, docs := range seed {
+        if _, err := DB.Collection(name).InsertMany(ctx, docs); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    result, err := CascadeDeleteProject(objID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]int64{"projects": 1, "chat_messages": 2, "gemini_usage_logs": 1, "chat_users": 1, "notifications": 1, "chat_sessions": 0, "kb_chunks": 0}
+    for name, count := range want {
+        if result.Documents[name] != count {
+            t.Errorf("%s: deleted %d, want %d", name, result.Documents[name], count)
+        }
+    }
+    if result.FilesRemoved != 1 {
+        t.Errorf("files removed = %d, want 1", result.FilesRemoved)
+    }
+    if _, err := os.Stat(upload); !os.IsNotExist(err) {
+        t.Errorf("the uploaded file is still there: %v", err)
+    }
+
+    // Nothing of the purged project remains; the other project's data is untouched
+    for name, filter := range relatedProjectData(objID) {
+        if count, _ := DB.Collection(name).CountDocuments(ctx, filter); count != 0 {
+            t.Errorf("%s: %d documents left", name, count)
+        }
+    }
+    if count, _ := DB.Collection("projects").CountDocuments(ctx, bson.M{"_id": objID}); count != 0 {
+        t.Error("the project is still stored")
+    }
+    if count, _ := DB.Collection("chat_messages").CountDocuments(ctx, bson.M{"project_id": otherID}); count != 1 {
+        t.Errorf("other project's messages = %d, want 1", count)
+    }
+    if count, _ := DB.Collection("chat_users").CountDocuments(ctx, bson.M{"project_id": otherID.Hex()}); count != 1 {
+        t.Errorf("other project's chat users = %d, want 1", count)
+    }
+
+    if _, err := CascadeDeleteProject(objID); err == nil {
+        t.Error("purging a deleted project succeeded, want an error")
+    }
+}
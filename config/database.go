@@ -2,22 +2,39 @@ package config
 
 import (
     "context"
+    "fmt"
     "log"
     "os"
     "time"
     
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/models"
+    "jevi-chat/utils"
 )
 
 var DB *mongo.Database
 
+// DBTimeout bounds individual database operations made while serving requests.
+// Override with DB_TIMEOUT (e.g. "5s").
+var DBTimeout = 10 * time.Second
+
 func InitMongoDB() {
     uri := os.Getenv("MONGODB_URI")
     if uri == "" {
         log.Fatal("MONGODB_URI not set in environment")
     }
     
+    if value := os.Getenv("DB_TIMEOUT"); value != "" {
+        if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+            DBTimeout = timeout
+        } else {
+            log.Printf("Invalid DB_TIMEOUT %q, using %s", value, DBTimeout)
+        }
+    }
+    
     ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
     defer cancel()
     
@@ -33,6 +50,118 @@ func InitMongoDB() {
     
     DB = client.Database("jevi_chat")
     log.Println("Connected to MongoDB successfully")
+    
+    setupIndexes()
+}
+
+// setupIndexes creates the indexes queries rely on. Creating an existing index is a no-op.
+func setupIndexes() {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    indexes := map[string][]mongo.IndexModel{
+        "chat_messages": {
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "timestamp", Value: -1}}},
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "session_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+            // Realtime stats look at recent messages across all projects
+            {Keys: bson.D{{Key: "timestamp", Value: -1}}},
+            {
+                Keys:    bson.D{{Key: "message", Value: "text"}, {Key: "response", Value: "text"}},
+                Options: options.Index().SetName("message_text"),
+            },
+        },
+        "projects": {
+            {Keys: bson.D{{Key: "_id", Value: 1}, {Key: "knowledge_sources.hash", Value: 1}}},
+            {
+                Keys:    bson.D{{Key: "external_id", Value: 1}},
+                Options: options.Index().SetUnique(true).SetSparse(true),
+            },
+        },
+        "gemini_usage_logs": {
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "success", Value: 1}, {Key: "timestamp", Value: -1}}},
+            {Keys: bson.D{{Key: "timestamp", Value: -1}}},
+        },
+        "idempotency_keys": {
+            {
+                Keys:    bson.D{{Key: "created_at", Value: 1}},
+                Options: options.Index().SetExpireAfterSeconds(int32(models.IdempotencyKeyTTL.Seconds())),
+            },
+        },
+        "notifications": {
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}}},
+            {Keys: bson.D{{Key: "read", Value: 1}, {Key: "created_at", Value: -1}}},
+        },
+        "kb_chunks": {
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "file_id", Value: 1}, {Key: "index", Value: 1}}},
+        },
+        "chat_users": {
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "email", Value: 1}}},
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "normalized_email", Value: 1}}},
+        },
+        "chat_sessions": {
+            {
+                Keys:    bson.D{{Key: "project_id", Value: 1}, {Key: "session_id", Value: 1}},
+                Options: options.Index().SetUnique(true),
+            },
+            {Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "last_activity", Value: -1}}},
+        },
+    }
+
+    for name, models := range indexes {
+        if _, err := DB.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+            log.Printf("Failed to create indexes on %s: %v", name, err)
+        }
+    }
+}
+
+// CloseMongoDB disconnects the MongoDB client
+func CloseMongoDB() {
+    if DB == nil {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    if err := DB.Client().Disconnect(ctx); err != nil {
+        log.Printf("Failed to disconnect MongoDB: %v", err)
+        return
+    }
+    log.Println("MongoDB connection closed")
+}
+
+// HealthCheck pings MongoDB
+func HealthCheck() error {
+    if DB == nil {
+        return fmt.Errorf("database not initialized")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    return DB.Client().Ping(ctx, nil)
+}
+
+// GetDatabaseStats returns the main figures from MongoDB's dbStats command
+func GetDatabaseStats() (map[string]interface{}, error) {
+    if DB == nil {
+        return nil, fmt.Errorf("database not initialized")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+
+    var result bson.M
+    if err := DB.RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&result); err != nil {
+        return nil, err
+    }
+
+    stats := make(map[string]interface{})
+    for _, key := range []string{"db", "collections", "objects", "dataSize", "storageSize", "indexes", "indexSize"} {
+        if value, ok := result[key]; ok {
+            stats[key] = value
+        }
+    }
+    return stats, nil
 }
 
 // Add this function to fix the undefined error
@@ -42,3 +171,204 @@ func GetCollection(collectionName string) *mongo.Collection {
     }
     return DB.Collection(collectionName)
 }
+
+// EnsurePDFFileDefaults marks PDFs uploaded before per-file toggling existed as
+// enabled, so they keep contributing to their project's knowledge base.
+func EnsurePDFFileDefaults() {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    result, err := DB.Collection("projects").UpdateMany(ctx,
+        bson.M{"pdf_files": bson.M{"$elemMatch": bson.M{"enabled": bson.M{"$exists": false}}}},
+        bson.M{"$set": bson.M{"pdf_files.$[file].enabled": true}},
+        options.Update().SetArrayFilters(options.ArrayFilters{
+            Filters: []interface{}{bson.M{"file.enabled": bson.M{"$exists": false}}},
+        }),
+    )
+    if err != nil {
+        log.Printf("Failed to set PDF file defaults: %v", err)
+        return
+    }
+    if result.ModifiedCount > 0 {
+        log.Printf("Enabled %d legacy PDF file records", result.ModifiedCount)
+    }
+}
+
+// MigrateKnowledgeSources moves each project's legacy pdf_files into knowledge_sources.
+// pdf_files is removed once copied, so deleting every source later can't bring the old
+// records back.
+func MigrateKnowledgeSources() {
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+    defer cancel()
+
+    collection := DB.Collection("projects")
+    cursor, err := collection.Find(ctx,
+        bson.M{"pdf_files.0": bson.M{"$exists": true}},
+        options.Find().SetProjection(bson.M{"pdf_files": 1, "knowledge_sources": 1}),
+    )
+    if err != nil {
+        log.Printf("Failed to find projects to migrate to knowledge sources: %v", err)
+        return
+    }
+    defer cursor.Close(ctx)
+
+    migrated := 0
+    for cursor.Next(ctx) {
+        var project models.Project
+        if err := cursor.Decode(&project); err != nil {
+            log.Printf("Failed to decode project for knowledge source migration: %v", err)
+            continue
+        }
+        _, err := collection.UpdateOne(ctx, bson.M{"_id": project.ID}, bson.M{
+            "$set":   bson.M{"knowledge_sources": project.Sources()},
+            "$unset": bson.M{"pdf_files": ""},
+        })
+        if err != nil {
+            log.Printf("Failed to migrate knowledge sources for %s: %v", project.ID.Hex(), err)
+            continue
+        }
+        migrated++
+    }
+    if migrated > 0 {
+        log.Printf("Migrated %d projects to knowledge sources", migrated)
+    }
+}
+
+// EncryptExistingAPIKeys encrypts Gemini API keys that were stored in plaintext
+// before ENCRYPTION_KEY was configured.
+func EncryptExistingAPIKeys() {
+    if !utils.EncryptionEnabled() {
+        log.Println("⚠️ ENCRYPTION_KEY not set - Gemini API keys are stored unencrypted")
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    collection := DB.Collection("projects")
+    cursor, err := collection.Find(ctx, bson.M{"gemini_api_key": bson.M{"$nin": bson.A{"", nil}}},
+        options.Find().SetProjection(bson.M{"gemini_api_key": 1}))
+    if err != nil {
+        log.Printf("Failed to load API keys for encryption: %v", err)
+        return
+    }
+    defer cursor.Close(ctx)
+
+    migrated := 0
+    for cursor.Next(ctx) {
+        var doc struct {
+            ID     primitive.ObjectID `bson:"_id"`
+            APIKey string             `bson:"gemini_api_key"`
+        }
+        if err := cursor.Decode(&doc); err != nil || utils.IsEncrypted(doc.APIKey) {
+            continue
+        }
+
+        encrypted, err := utils.EncryptSecret(doc.APIKey)
+        if err != nil {
+            log.Printf("Failed to encrypt API key for project %s: %v", doc.ID.Hex(), err)
+            continue
+        }
+        if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"gemini_api_key": encrypted}}); err != nil {
+            log.Printf("Failed to store encrypted API key for project %s: %v", doc.ID.Hex(), err)
+            continue
+        }
+        migrated++
+    }
+    if migrated > 0 {
+        log.Printf("Encrypted %d plaintext Gemini API keys", migrated)
+    }
+}
+
+// ResetDailyMonthlyUsage zeroes gemini_usage_today for projects whose last daily
+// reset happened before today (UTC), then resets monthly counters for projects
+// whose billing period has rolled over (see ResetMonthlyTokenUsage).
+func ResetDailyMonthlyUsage() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    now := time.Now().UTC()
+    startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+    daily, err := DB.Collection("projects").UpdateMany(ctx,
+        bson.M{"$or": []bson.M{
+            {"last_daily_reset": bson.M{"$lt": startOfDay}},
+            {"last_daily_reset": bson.M{"$exists": false}},
+        }},
+        bson.M{"$set": bson.M{
+            "gemini_usage_today":   0,
+            "estimated_cost_today": 0,
+            "last_daily_reset":     now,
+        }},
+    )
+    if err != nil {
+        return err
+    }
+    if daily.ModifiedCount > 0 {
+        log.Printf("Usage reset: %d daily counters cleared", daily.ModifiedCount)
+    }
+
+    return ResetMonthlyTokenUsage(now)
+}
+
+// ResetMonthlyTokenUsage zeroes the monthly token, request and cost counters of every
+// project whose current billing period (anchored on its start_date) began after its
+// last reset. The update is conditional on last_token_reset so overlapping runs
+// can't reset a project twice.
+func ResetMonthlyTokenUsage(now time.Time) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    collection := DB.Collection("projects")
+    opts := options.Find().SetProjection(bson.M{"start_date": 1, "created_at": 1, "last_token_reset": 1})
+    cursor, err := collection.Find(ctx, bson.M{"deleted_at": bson.M{"$exists": false}}, opts)
+    if err != nil {
+        return err
+    }
+    defer cursor.Close(ctx)
+
+    reset := 0
+    for cursor.Next(ctx) {
+        var project models.Project
+        if err := cursor.Decode(&project); err != nil {
+            log.Printf("Failed to decode project for usage reset: %v", err)
+            continue
+        }
+
+        periodStart := project.BillingPeriodStart(now)
+        if !project.LastTokenReset.Before(periodStart) {
+            continue
+        }
+
+        filter := bson.M{"_id": project.ID, "last_token_reset": project.LastTokenReset}
+        if project.LastTokenReset.IsZero() {
+            filter["last_token_reset"] = bson.M{"$exists": false}
+        }
+        update := bson.M{"$set": bson.M{
+            "tokens_used_month":    0,
+            "gemini_usage_month":   0,
+            "estimated_cost_month": 0,
+            "last_token_reset":     now,
+            "last_monthly_reset":   now,
+        }, "$unset": bson.M{"token_grace_started_at": ""}}
+        if project.StartDate.IsZero() {
+            // Pin the anchor so it no longer depends on the created_at fallback
+            update["$set"].(bson.M)["start_date"] = project.CreatedAt
+        }
+
+        result, err := collection.UpdateOne(ctx, filter, update)
+        if err != nil {
+            log.Printf("Failed to reset monthly usage for %s: %v", project.ID.Hex(), err)
+            continue
+        }
+        reset += int(result.ModifiedCount)
+    }
+    if err := cursor.Err(); err != nil {
+        return err
+    }
+
+    if reset > 0 {
+        log.Printf("Usage reset: %d projects started a new billing period", reset)
+    }
+    return nil
+}
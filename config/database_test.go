@@ -0,0 +1,49 @@
+package config
+
+import (
+    "context"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/models"
+)
+
+func TestMigrateKnowledgeSources(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    legacy := models.Project{ID: primitive.NewObjectID(), PDFFiles: []models.PDFFile{
+        {ID: "a", FileName: "manual.pdf", Content: "Manual text.", Enabled: true},
+        {ID: "b", FileName: "FAQ", SourceType: models.KnowledgeSourceURL, SourceURL: "https://example.com/faq", Content: "Page text."},
+    }}
+    current := models.Project{ID: primitive.NewObjectID(), KnowledgeSources: []models.KnowledgeSource{
+        {ID: "c", Type: models.KnowledgeSourceText, Name: "notes.txt", Enabled: true},
+    }}
+    if _, err := DB.Collection("projects").InsertMany(ctx, []interface{}{legacy, current}); err != nil {
+        t.Fatal(err)
+    }
+
+    MigrateKnowledgeSources()
+
+    var migrated models.Project
+    if err := DB.Collection("projects").FindOne(ctx, bson.M{"_id": legacy.ID}).Decode(&migrated); err != nil {
+        t.Fatal(err)
+    }
+    if len(migrated.PDFFiles) != 0 || len(migrated.KnowledgeSources) != 2 {
+        t.Fatalf("pdf_files = %d, knowledge_sources = %d; want the files moved across", len(migrated.PDFFiles), len(migrated.KnowledgeSources))
+    }
+    page := migrated.KnowledgeSources[1]
+    if migrated.KnowledgeSources[0].Type != models.KnowledgeSourcePDF || page.Type != models.KnowledgeSourceURL ||
+        page.Origin != "https://example.com/faq" || page.Content != "Page text." || page.Enabled {
+        t.Errorf("knowledge_sources = %+v, want each file's type, origin, content and state kept", migrated.KnowledgeSources)
+    }
+
+    var untouched models.Project
+    if err := DB.Collection("projects").FindOne(ctx, bson.M{"_id": current.ID}).Decode(&untouched); err != nil {
+        t.Fatal(err)
+    }
+    if len(untouched.KnowledgeSources) != 1 || untouched.KnowledgeSources[0].ID != "c" {
+        t.Errorf("knowledge_sources = %+v, want a migrated project left alone", untouched.KnowledgeSources)
+    }
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+    "fmt"
+    "log"
+    "net/smtp"
+    "os"
+    "strings"
+)
+
+// EmailSender delivers plain-text emails
+type EmailSender interface {
+    Send(to []string, subject, body string) error
+}
+
+// Mailer is the configured email sender; nil when SMTP is not configured
+var Mailer EmailSender
+
+// SMTPSender sends mail through an SMTP server with PLAIN auth
+type SMTPSender struct {
+    Host     string
+    Port     string
+    Username string
+    Password string
+    From     string
+
+    // sendMail is swappable so delivery can be exercised without a server
+    sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// InitEmail configures Mailer from SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS and SMTP_FROM
+func InitEmail() {
+    host := os.Getenv("SMTP_HOST")
+    if host == "" {
+        log.Println("SMTP not configured, email delivery disabled")
+        return
+    }
+
+    port := os.Getenv("SMTP_PORT")
+    if port == "" {
+        port = "587"
+    }
+
+    from := os.Getenv("SMTP_FROM")
+    if from == "" {
+        from = os.Getenv("SMTP_USER")
+    }
+
+    Mailer = &SMTPSender{
+        Host:     host,
+        Port:     port,
+        Username: os.Getenv("SMTP_USER"),
+        Password: os.Getenv("SMTP_PASS"),
+        From:     from,
+        sendMail: smtp.SendMail,
+    }
+    log.Printf("SMTP email configured via %s:%s", host, port)
+}
+
+// Send delivers a plain-text email to the given recipients
+func (s *SMTPSender) Send(to []string, subject, body string) error {
+    if len(to) == 0 {
+        return fmt.Errorf("no recipients")
+    }
+
+    var auth smtp.Auth
+    if s.Username != "" {
+        auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+    }
+
+    msg := strings.Join([]string{
+        "From: " + s.From,
+        "To: " + strings.Join(to, ", "),
+        "Subject: " + subject,
+        "MIME-Version: 1.0",
+        "Content-Type: text/plain; charset=UTF-8",
+        "",
+        body,
+    }, "\r\n")
+
+    send := s.sendMail
+    if send == nil {
+        send = smtp.SendMail
+    }
+    return send(s.Host+":"+s.Port, auth, s.From, to, []byte(msg))
+}
+
+// SendEmail sends through Mailer, reporting an error when email is not configured
+func SendEmail(to []string, subject, body string) error {
+    if Mailer == nil {
+        return fmt.Errorf("email delivery is not configured")
+    }
+    return Mailer.Send(to, subject, body)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+    "net/smtp"
+    "strings"
+    "testing"
+
+    "jevi-chat/models"
+)
+
+func TestSMTPSenderSend(t *testing.T) {
+    var gotAddr, gotFrom, gotMsg string
+    var gotTo []string
+    sender := &SMTPSender{
+        Host: "smtp.example.com", Port: "587", Username: "mailer", Password: "pw", From: "noreply@example.com",
+        sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+            gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, string(msg)
+            return nil
+        },
+    }
+
+    if err := sender.Send([]string{"owner@example.com"}, "Project expiring", "Renew soon."); err != nil {
+        t.Fatalf("Send: %v", err)
+    }
+    if gotAddr != "smtp.example.com:587" || gotFrom != "noreply@example.com" || len(gotTo) != 1 {
+        t.Errorf("sent via %s from %s to %v", gotAddr, gotFrom, gotTo)
+    }
+    for _, want := range []string{"To: owner@example.com\r\n", "Subject: Project expiring\r\n", "\r\n\r\nRenew soon."} {
+        if !strings.Contains(gotMsg, want) {
+            t.Errorf("message is missing %q:\n%s", want, gotMsg)
+        }
+    }
+
+    if err := sender.Send(nil, "subject", "body"); err == nil {
+        t.Error("Send without recipients should fail")
+    }
+}
+
+func TestSendEmailWithoutSMTP(t *testing.T) {
+    previous := Mailer
+    Mailer = nil
+    t.Cleanup(func() { Mailer = previous })
+
+    if err := SendEmail([]string{"owner@example.com"}, "s", "b"); err == nil {
+        t.Error("SendEmail should report that email isn't configured")
+    }
+}
+
+func TestExpiryRecipients(t *testing.T) {
+    t.Setenv("ADMIN_EMAIL", "admin@example.com")
+    if got := expiryRecipients(models.Project{}); len(got) != 1 || got[0] != "admin@example.com" {
+        t.Errorf("expiryRecipients = %v, want the admin", got)
+    }
+    t.Setenv("ADMIN_EMAIL", "")
+    if got := expiryRecipients(models.Project{}); got != nil {
+        t.Errorf("expiryRecipients = %v, want none", got)
+    }
+}
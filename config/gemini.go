@@ -2,15 +2,58 @@ package config
 
 import (
     "context"
+    "fmt"
     "log"
     "os"
+    "strings"
+    "sync"
+    "time"
     
     "github.com/google/generative-ai-go/genai"
+    "google.golang.org/api/iterator"
     "google.golang.org/api/option"
+    "jevi-chat/models"
 )
 
 var GeminiClient *genai.Client
 
+// defaultGeminiModels are the chat models projects may use unless GEMINI_MODELS lists others
+var defaultGeminiModels = []string{
+    models.GeminiModelFlash,
+    models.GeminiModelPro,
+    "gemini-pro",
+    models.GeminiModel20Flash,
+    models.GeminiModel20FlashLite,
+    models.GeminiModel25Flash,
+    models.GeminiModel25FlashLite,
+    models.GeminiModel25Pro,
+}
+
+// SupportedGeminiModels returns the chat models projects may be configured with:
+// the comma-separated GEMINI_MODELS when set, otherwise defaultGeminiModels
+func SupportedGeminiModels() []string {
+    var supported []string
+    for _, model := range strings.Split(os.Getenv("GEMINI_MODELS"), ",") {
+        if model = strings.TrimSpace(model); model != "" {
+            supported = append(supported, model)
+        }
+    }
+    if len(supported) == 0 {
+        return append([]string{}, defaultGeminiModels...)
+    }
+    return supported
+}
+
+// IsSupportedGeminiModel reports whether model is in SupportedGeminiModels
+func IsSupportedGeminiModel(model string) bool {
+    for _, supported := range SupportedGeminiModels() {
+        if model == supported {
+            return true
+        }
+    }
+    return false
+}
+
 func InitGemini() {
     apiKey := os.Getenv("GEMINI_API_KEY")
     if apiKey == "" {
@@ -27,6 +70,68 @@ func InitGemini() {
     log.Println("Gemini client initialized successfully")
 }
 
+// ValidateGeminiKey checks that an API key is accepted by Gemini by listing a single
+// model with it, which costs no tokens
+func ValidateGeminiKey(ctx context.Context, apiKey string) error {
+    client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+    if err != nil {
+        return err
+    }
+    defer client.Close()
+
+    if _, err := client.ListModels(ctx).Next(); err != nil && err != iterator.Done {
+        return err
+    }
+    return nil
+}
+
+// geminiHealthTTL keeps health probes from calling the Gemini API on every request
+const geminiHealthTTL = 30 * time.Second
+
+var (
+    geminiHealthMu      sync.Mutex
+    geminiHealthErr     error
+    geminiHealthChecked time.Time
+)
+
+// GeminiHealthCheck verifies the Gemini API is reachable by listing a single model.
+// Results are cached briefly.
+func GeminiHealthCheck() error {
+    geminiHealthMu.Lock()
+    defer geminiHealthMu.Unlock()
+
+    if time.Since(geminiHealthChecked) < geminiHealthTTL {
+        return geminiHealthErr
+    }
+
+    if GeminiClient == nil {
+        geminiHealthErr = fmt.Errorf("gemini client not initialized")
+    } else {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        _, err := GeminiClient.ListModels(ctx).Next()
+        cancel()
+        if err == iterator.Done {
+            err = nil
+        }
+        geminiHealthErr = err
+    }
+    geminiHealthChecked = time.Now()
+    return geminiHealthErr
+}
+
+// CloseGemini releases the shared Gemini client
+func CloseGemini() {
+    closeGeminiClients()
+    if GeminiClient == nil {
+        return
+    }
+    if err := GeminiClient.Close(); err != nil {
+        log.Printf("Failed to close Gemini client: %v", err)
+        return
+    }
+    log.Println("Gemini client closed")
+}
+
 func GenerateResponse(prompt string, pdfContext string) (string, error) {
     ctx := context.Background()
     model := GeminiClient.GenerativeModel("gemini-1.5-flash")
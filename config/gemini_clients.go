@@ -0,0 +1,99 @@
+package config
+
+import (
+    "context"
+    "log"
+    "sync"
+    "time"
+
+    "github.com/google/generative-ai-go/genai"
+    "google.golang.org/api/option"
+)
+
+// geminiClientTTL is how long an unused client stays cached
+const geminiClientTTL = 30 * time.Minute
+
+// geminiClients caches one client per API key so requests for the same project
+// share a connection instead of dialing Gemini every time
+var (
+    geminiClientsMu    sync.Mutex
+    geminiClients      = make(map[string]*cachedGeminiClient)
+    geminiClientsSwept time.Time
+)
+
+type cachedGeminiClient struct {
+    client   *genai.Client
+    inUse    int
+    lastUsed time.Time
+}
+
+// AcquireGeminiClient returns a cached client for apiKey, creating it on first use.
+// Call release once the request is done; clients are never closed while in use.
+func AcquireGeminiClient(apiKey string) (*genai.Client, func(), error) {
+    geminiClientsMu.Lock()
+    evictIdleGeminiClients()
+    entry, cached := geminiClients[apiKey]
+    if cached {
+        entry.inUse++
+    }
+    geminiClientsMu.Unlock()
+
+    if !cached {
+        client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
+        if err != nil {
+            return nil, nil, err
+        }
+
+        geminiClientsMu.Lock()
+        if existing, raced := geminiClients[apiKey]; raced {
+            // Another request created one first
+            client.Close()
+            entry = existing
+        } else {
+            entry = &cachedGeminiClient{client: client}
+            geminiClients[apiKey] = entry
+        }
+        entry.inUse++
+        geminiClientsMu.Unlock()
+    }
+
+    var once sync.Once
+    release := func() {
+        once.Do(func() {
+            geminiClientsMu.Lock()
+            entry.inUse--
+            entry.lastUsed = time.Now()
+            geminiClientsMu.Unlock()
+        })
+    }
+    return entry.client, release, nil
+}
+
+// evictIdleGeminiClients closes clients unused for geminiClientTTL, scanning at most
+// once a minute. The caller must hold geminiClientsMu.
+func evictIdleGeminiClients() {
+    if time.Since(geminiClientsSwept) < time.Minute {
+        return
+    }
+    geminiClientsSwept = time.Now()
+
+    for apiKey, entry := range geminiClients {
+        if entry.inUse == 0 && time.Since(entry.lastUsed) > geminiClientTTL {
+            delete(geminiClients, apiKey)
+            entry.client.Close()
+        }
+    }
+}
+
+// closeGeminiClients closes every cached client on shutdown
+func closeGeminiClients() {
+    geminiClientsMu.Lock()
+    defer geminiClientsMu.Unlock()
+
+    for apiKey, entry := range geminiClients {
+        if err := entry.client.Close(); err != nil {
+            log.Printf("Failed to close cached Gemini client: %v", err)
+        }
+        delete(geminiClients, apiKey)
+    }
+}
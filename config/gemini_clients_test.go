@@ -0,0 +1,70 @@
+package config
+
+import (
+    "testing"
+    "time"
+)
+
+func TestAcquireGeminiClientReusesClients(t *testing.T) {
+    t.Cleanup(closeGeminiClients)
+
+    first, releaseFirst, err := AcquireGeminiClient("key-a")
+    if err != nil {
+        t.Fatalf("AcquireGeminiClient: %v", err)
+    }
+    second, releaseSecond, err := AcquireGeminiClient("key-a")
+    if err != nil {
+        t.Fatalf("AcquireGeminiClient: %v", err)
+    }
+    if first != second {
+        t.Error("requests with the same key must share a client")
+    }
+    other, releaseOther, err := AcquireGeminiClient("key-b")
+    if err != nil {
+        t.Fatalf("AcquireGeminiClient: %v", err)
+    }
+    if other == first {
+        t.Error("different keys must not share a client")
+    }
+
+    releaseFirst()
+    releaseFirst() // releasing twice counts once
+    geminiClientsMu.Lock()
+    inUse := geminiClients["key-a"].inUse
+    geminiClientsMu.Unlock()
+    if inUse != 1 {
+        t.Errorf("inUse = %d, want 1 while the second request still holds the client", inUse)
+    }
+
+    releaseSecond()
+    releaseOther()
+}
+
+func TestEvictIdleGeminiClients(t *testing.T) {
+    t.Cleanup(closeGeminiClients)
+
+    _, releaseIdle, err := AcquireGeminiClient("idle-key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    releaseIdle()
+    _, releaseBusy, err := AcquireGeminiClient("busy-key")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer releaseBusy()
+
+    geminiClientsMu.Lock()
+    defer geminiClientsMu.Unlock()
+    geminiClients["idle-key"].lastUsed = time.Now().Add(-2 * geminiClientTTL)
+    geminiClients["busy-key"].lastUsed = time.Now().Add(-2 * geminiClientTTL)
+    geminiClientsSwept = time.Time{}
+
+    evictIdleGeminiClients()
+    if _, ok := geminiClients["idle-key"]; ok {
+        t.Error("an idle client past its TTL must be closed")
+    }
+    if _, ok := geminiClients["busy-key"]; !ok {
+        t.Error("a client in use must never be closed")
+    }
+}
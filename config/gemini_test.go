@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestSupportedGeminiModels(t *testing.T) {
+    t.Setenv("GEMINI_MODELS", "")
+    for _, model := range []string{"gemini-1.5-flash", "gemini-2.0-flash", "gemini-2.5-pro"} {
+        if !IsSupportedGeminiModel(model) {
+            t.Errorf("%s should be supported by default", model)
+        }
+    }
+    if IsSupportedGeminiModel("gemini-ultra") {
+        t.Error("an unknown model must not be supported")
+    }
+
+    t.Setenv("GEMINI_MODELS", " gemini-2.5-flash , ,gemini-3.0-pro")
+    if got := SupportedGeminiModels(); len(got) != 2 || got[0] != "gemini-2.5-flash" || got[1] != "gemini-3.0-pro" {
+        t.Errorf("SupportedGeminiModels = %v", got)
+    }
+    if IsSupportedGeminiModel("gemini-1.5-flash") {
+        t.Error("GEMINI_MODELS replaces the default list")
+    }
+}
+
+func TestDefaultModelsArePriced(t *testing.T) {
+    for _, model := range defaultGeminiModels {
+        if _, ok := defaultGeminiPricing[model]; !ok {
+            t.Errorf("%s is supported but has no built-in price", model)
+        }
+    }
+}
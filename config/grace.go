@@ -0,0 +1,33 @@
+package config
+
+import (
+    "log"
+    "os"
+    "strconv"
+)
+
+// TokenGracePercent is how far past its monthly token limit a project may go, as a
+// percentage of the limit, before requests are refused. Within the grace allowance
+// responses still succeed but carry a warning. Override with TOKEN_GRACE_PERCENT; 0
+// blocks as soon as the limit is reached.
+var TokenGracePercent = 10
+
+// InitTokenGrace reads the grace allowance from the environment
+func InitTokenGrace() {
+    value := os.Getenv("TOKEN_GRACE_PERCENT")
+    if value == "" {
+        return
+    }
+    percent, err := strconv.Atoi(value)
+    if err != nil || percent < 0 || percent > 100 {
+        log.Printf("Invalid TOKEN_GRACE_PERCENT %q, allowing %d%% over the token limit", value, TokenGracePercent)
+        return
+    }
+    TokenGracePercent = percent
+}
+
+// TokenGraceCeiling returns the tokens a project with the given monthly limit may use
+// before it is hard-blocked
+func TokenGraceCeiling(limit int) int {
+    return limit + limit*TokenGracePercent/100
+}
@@ -0,0 +1,49 @@
+package config
+
+import "testing"
+
+// useTokenGrace sets TokenGracePercent for the length of a test
+func useTokenGrace(t *testing.T, percent int) {
+    t.Helper()
+    previous := TokenGracePercent
+    TokenGracePercent = percent
+    t.Cleanup(func() { TokenGracePercent = previous })
+}
+
+func TestInitTokenGrace(t *testing.T) {
+    cases := []struct {
+        value string
+        want  int
+    }{
+        {"", 10},
+        {"25", 25},
+        {"0", 0},
+        {"100", 100},
+        {"101", 10},
+        {"-1", 10},
+        {"ten", 10},
+    }
+    for _, tc := range cases {
+        useTokenGrace(t, 10)
+        t.Setenv("TOKEN_GRACE_PERCENT", tc.value)
+        InitTokenGrace()
+        if TokenGracePercent != tc.want {
+            t.Errorf("TOKEN_GRACE_PERCENT=%q: percent = %d, want %d", tc.value, TokenGracePercent, tc.want)
+        }
+    }
+}
+
+func TestTokenGraceCeiling(t *testing.T) {
+    useTokenGrace(t, 10)
+    if got := TokenGraceCeiling(1000); got != 1100 {
+        t.Errorf("TokenGraceCeiling(1000) = %d, want 1100", got)
+    }
+    if got := TokenGraceCeiling(0); got != 0 {
+        t.Errorf("TokenGraceCeiling(0) = %d, want 0", got)
+    }
+
+    useTokenGrace(t, 0)
+    if got := TokenGraceCeiling(1000); got != 1000 {
+        t.Errorf("without grace: TokenGraceCeiling(1000) = %d, want the limit", got)
+    }
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "time"
+
+    "github.com/golang-jwt/jwt/v4"
+)
+
+// JWTExpiry is how long dashboard access tokens stay valid. Override with JWT_EXPIRY
+// as a Go duration such as "12h" or "90m".
+var JWTExpiry = 24 * time.Hour
+
+// InitJWT reads the access token lifetime from the environment and warns when a
+// previous secret is still accepted
+func InitJWT() {
+    if value := os.Getenv("JWT_EXPIRY"); value != "" {
+        expiry, err := time.ParseDuration(value)
+        if err != nil || expiry < time.Minute {
+            log.Printf("Invalid JWT_EXPIRY %q, access tokens last %s", value, JWTExpiry)
+        } else {
+            JWTExpiry = expiry
+        }
+    }
+    if os.Getenv("JWT_PREVIOUS_SECRET") != "" {
+        log.Println("🔑 JWT_PREVIOUS_SECRET is set - tokens signed with it stay valid until they expire")
+    }
+}
+
+// SignJWT signs claims with the current JWT_SECRET
+func SignJWT(claims jwt.Claims) (string, error) {
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ParseJWT verifies a token against JWT_SECRET, then JWT_PREVIOUS_SECRET, so tokens
+// issued before a secret rotation keep working until they expire. New tokens are always
+// signed with the current secret; drop the previous one once the longest-lived tokens
+// signed with it have expired.
+func ParseJWT(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+    var lastErr error
+    for _, secret := range []string{os.Getenv("JWT_SECRET"), os.Getenv("JWT_PREVIOUS_SECRET")} {
+        if secret == "" {
+            continue
+        }
+        token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+            if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+                return nil, fmt.Errorf("unexpected signing method")
+            }
+            return []byte(secret), nil
+        })
+        if err == nil && token.Valid {
+            return token, nil
+        }
+        lastErr = err
+        // Only a bad signature is worth retrying with the other secret
+        if validationErr, ok := err.(*jwt.ValidationError); !ok || validationErr.Errors&jwt.ValidationErrorSignatureInvalid == 0 {
+            break
+        }
+    }
+    if lastErr == nil {
+        lastErr = fmt.Errorf("no JWT secret configured")
+    }
+    return nil, lastErr
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+    "testing"
+    "time"
+
+    "github.com/golang-jwt/jwt/v4"
+)
+
+func TestInitJWT(t *testing.T) {
+    previous := JWTExpiry
+    t.Cleanup(func() { JWTExpiry = previous })
+
+    cases := []struct {
+        value string
+        want  time.Duration
+    }{
+        {"", 24 * time.Hour},
+        {"12h", 12 * time.Hour},
+        {"90m", 90 * time.Minute},
+        {"30s", 24 * time.Hour},
+        {"-1h", 24 * time.Hour},
+        {"a day", 24 * time.Hour},
+    }
+    for _, tc := range cases {
+        JWTExpiry = 24 * time.Hour
+        t.Setenv("JWT_EXPIRY", tc.value)
+        InitJWT()
+        if JWTExpiry != tc.want {
+            t.Errorf("JWT_EXPIRY=%q: expiry = %s, want %s", tc.value, JWTExpiry, tc.want)
+        }
+    }
+}
+
+// signedWith signs claims for user u1 with secret, expiring after ttl
+func signedWith(t *testing.T, secret string, ttl time.Duration) string {
+    t.Helper()
+    token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id": "u1",
+        "exp":     time.Now().Add(ttl).Unix(),
+    }).SignedString([]byte(secret))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return token
+}
+
+func TestParseJWTDuringRotation(t *testing.T) {
+    cases := []struct {
+        name     string
+        current  string
+        previous string
+        token    string
+        valid    bool
+    }{
+        {"current secret", "new", "old", signedWith(t, "new", time.Hour), true},
+        {"previous secret", "new", "old", signedWith(t, "old", time.Hour), true},
+        {"previous secret dropped", "new", "", signedWith(t, "old", time.Hour), false},
+        {"unknown secret", "new", "old", signedWith(t, "other", time.Hour), false},
+        {"expired", "new", "old", signedWith(t, "new", -time.Hour), false},
+        {"expired under previous secret", "new", "old", signedWith(t, "old", -time.Hour), false},
+        {"no secret configured", "", "", signedWith(t, "new", time.Hour), false},
+        {"malformed", "new", "old", "not-a-jwt", false},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            t.Setenv("JWT_SECRET", tc.current)
+            t.Setenv("JWT_PREVIOUS_SECRET", tc.previous)
+            claims := jwt.MapClaims{}
+            _, err := ParseJWT(tc.token, claims)
+            if tc.valid && (err != nil || claims["user_id"] != "u1") {
+                t.Errorf("ParseJWT = %v, claims %v; want the token accepted", err, claims)
+            }
+            if !tc.valid && err == nil {
+                t.Error("ParseJWT accepted the token")
+            }
+        })
+    }
+}
+
+func TestParseJWTRejectsOtherSigningMethods(t *testing.T) {
+    t.Setenv("JWT_SECRET", "new")
+    token, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": "u1"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ParseJWT(token, jwt.MapClaims{}); err == nil {
+        t.Error("ParseJWT accepted an unsigned token")
+    }
+}
+
+func TestSignJWTUsesCurrentSecret(t *testing.T) {
+    t.Setenv("JWT_SECRET", "new")
+    t.Setenv("JWT_PREVIOUS_SECRET", "old")
+    token, err := SignJWT(jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Still valid once the previous secret is dropped
+    t.Setenv("JWT_PREVIOUS_SECRET", "")
+    if _, err := ParseJWT(token, jwt.MapClaims{}); err != nil {
+        t.Errorf("ParseJWT = %v, want tokens signed with JWT_SECRET", err)
+    }
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+    "log"
+    "os"
+    "strconv"
+    "strings"
+
+    "jevi-chat/utils"
+)
+
+// KnowledgeMaxChars is the most knowledge base text sent with one prompt. Larger
+// knowledge bases are narrowed to the chunks most relevant to the question, and
+// whatever still exceeds it is cut with KnowledgeTruncation. Override with
+// KNOWLEDGE_MAX_CHARS and KNOWLEDGE_TRUNCATION.
+var (
+    KnowledgeMaxChars   = 12000
+    KnowledgeTruncation = utils.TruncateHead
+)
+
+// How chat handles a Gemini-enabled project whose knowledge base is empty or holds only
+// placeholder text
+const (
+    EmptyKnowledgeGeneral = "general" // answer as a general assistant without documents
+    EmptyKnowledgeMessage = "message" // reply with EmptyKnowledgeReply instead of calling Gemini
+)
+
+// EmptyKnowledgeMode and EmptyKnowledgeReply pick the behavior above. Override with
+// KNOWLEDGE_EMPTY_MODE and KNOWLEDGE_EMPTY_MESSAGE.
+var (
+    EmptyKnowledgeMode  = EmptyKnowledgeGeneral
+    EmptyKnowledgeReply = "I'm still being set up and don't have my reference material yet. Please check back soon."
+)
+
+// InitKnowledgeLimits reads the knowledge base budget and truncation strategy from the environment
+func InitKnowledgeLimits() {
+    if value := os.Getenv("KNOWLEDGE_MAX_CHARS"); value != "" {
+        chars, err := strconv.Atoi(value)
+        if err != nil || chars <= 0 {
+            log.Printf("Invalid KNOWLEDGE_MAX_CHARS %q, using %d characters", value, KnowledgeMaxChars)
+        } else {
+            KnowledgeMaxChars = chars
+        }
+    }
+
+    switch strategy := os.Getenv("KNOWLEDGE_TRUNCATION"); strategy {
+    case "":
+    case utils.TruncateHead, utils.TruncateTail, utils.TruncateMiddleOut:
+        KnowledgeTruncation = strategy
+    default:
+        log.Printf("Invalid KNOWLEDGE_TRUNCATION %q, using %s", strategy, KnowledgeTruncation)
+    }
+
+    switch mode := os.Getenv("KNOWLEDGE_EMPTY_MODE"); mode {
+    case "":
+    case EmptyKnowledgeGeneral, EmptyKnowledgeMessage:
+        EmptyKnowledgeMode = mode
+    default:
+        log.Printf("Invalid KNOWLEDGE_EMPTY_MODE %q, using %s", mode, EmptyKnowledgeMode)
+    }
+    if reply := strings.TrimSpace(os.Getenv("KNOWLEDGE_EMPTY_MESSAGE")); reply != "" {
+        EmptyKnowledgeReply = reply
+    }
+}
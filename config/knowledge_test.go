@@ -0,0 +1,59 @@
+package config
+
+import (
+    "testing"
+
+    "jevi-chat/utils"
+)
+
+// restoreKnowledgeLimits puts the knowledge settings back after a test changes them
+func restoreKnowledgeLimits(t *testing.T) {
+    t.Helper()
+    maxChars, truncation := KnowledgeMaxChars, KnowledgeTruncation
+    emptyMode, emptyReply := EmptyKnowledgeMode, EmptyKnowledgeReply
+    t.Cleanup(func() {
+        KnowledgeMaxChars, KnowledgeTruncation = maxChars, truncation
+        EmptyKnowledgeMode, EmptyKnowledgeReply = emptyMode, emptyReply
+    })
+}
+
+func TestInitKnowledgeLimits(t *testing.T) {
+    restoreKnowledgeLimits(t)
+    t.Setenv("KNOWLEDGE_MAX_CHARS", "5000")
+    t.Setenv("KNOWLEDGE_TRUNCATION", utils.TruncateMiddleOut)
+    InitKnowledgeLimits()
+    if KnowledgeMaxChars != 5000 || KnowledgeTruncation != utils.TruncateMiddleOut {
+        t.Errorf("limits = %d, %s; want 5000, middle-out", KnowledgeMaxChars, KnowledgeTruncation)
+    }
+}
+
+func TestInitKnowledgeLimitsIgnoresBadValues(t *testing.T) {
+    restoreKnowledgeLimits(t)
+    for _, value := range []string{"0", "-10", "lots"} {
+        KnowledgeMaxChars, KnowledgeTruncation = 12000, utils.TruncateHead
+        t.Setenv("KNOWLEDGE_MAX_CHARS", value)
+        t.Setenv("KNOWLEDGE_TRUNCATION", "random")
+        InitKnowledgeLimits()
+        if KnowledgeMaxChars != 12000 || KnowledgeTruncation != utils.TruncateHead {
+            t.Errorf("KNOWLEDGE_MAX_CHARS=%q: limits = %d, %s; want the defaults", value, KnowledgeMaxChars, KnowledgeTruncation)
+        }
+    }
+}
+
+func TestInitKnowledgeLimitsEmptyKnowledge(t *testing.T) {
+    restoreKnowledgeLimits(t)
+    t.Setenv("KNOWLEDGE_EMPTY_MODE", EmptyKnowledgeMessage)
+    t.Setenv("KNOWLEDGE_EMPTY_MESSAGE", "  Back soon!  ")
+    InitKnowledgeLimits()
+    if EmptyKnowledgeMode != EmptyKnowledgeMessage || EmptyKnowledgeReply != "Back soon!" {
+        t.Errorf("mode = %s, reply = %q; want message mode with the trimmed reply", EmptyKnowledgeMode, EmptyKnowledgeReply)
+    }
+
+    // Unknown modes and blank replies keep the current settings
+    t.Setenv("KNOWLEDGE_EMPTY_MODE", "silent")
+    t.Setenv("KNOWLEDGE_EMPTY_MESSAGE", "   ")
+    InitKnowledgeLimits()
+    if EmptyKnowledgeMode != EmptyKnowledgeMessage || EmptyKnowledgeReply != "Back soon!" {
+        t.Errorf("mode = %s, reply = %q; want the previous settings kept", EmptyKnowledgeMode, EmptyKnowledgeReply)
+    }
+}
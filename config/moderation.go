@@ -0,0 +1,18 @@
+package config
+
+import (
+    "os"
+    "strings"
+)
+
+// BlockedWords returns the server-wide moderation word list from the comma-separated
+// MODERATION_BLOCKED_WORDS. It applies to every project with moderation enabled.
+func BlockedWords() []string {
+    var words []string
+    for _, word := range strings.Split(os.Getenv("MODERATION_BLOCKED_WORDS"), ",") {
+        if word = strings.TrimSpace(word); word != "" {
+            words = append(words, word)
+        }
+    }
+    return words
+}
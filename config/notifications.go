@@ -0,0 +1,305 @@
+package config
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "syscall"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/models"
+)
+
+// webhookClient delivers notification payloads; kept short so a slow endpoint can't pile up
+// goroutines. It only connects to public addresses, so neither a hostname resolving to an
+// internal address nor a redirect can aim a webhook at the server's own network.
+var webhookClient = &http.Client{
+    Timeout: 5 * time.Second,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: 5 * time.Second,
+            Control: rejectNonPublicAddress,
+        }).DialContext,
+        TLSHandshakeTimeout: 5 * time.Second,
+    },
+    CheckRedirect: func(req *http.Request, via []*http.Request) error {
+        if len(via) >= 3 {
+            return fmt.Errorf("too many webhook redirects")
+        }
+        return models.ValidateWebhookURL(req.URL.String())
+    },
+}
+
+// rejectNonPublicAddress is a dialer hook refusing connections to internal addresses
+func rejectNonPublicAddress(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    if ip := net.ParseIP(host); ip == nil || !models.IsPublicIP(ip) {
+        return fmt.Errorf("webhook address %s is not public", host)
+    }
+    return nil
+}
+
+// WebhookPayload is the JSON body POSTed to a project's webhook
+type WebhookPayload struct {
+    Type      string    `json:"type"`
+    Message   string    `json:"message"`
+    ProjectID string    `json:"project_id"`
+    Timestamp time.Time `json:"timestamp"`
+}
+
+// LogNotification stores a notification for a project and, when the project has a
+// webhook configured, delivers it in the background and records the delivery status.
+func LogNotification(projectID primitive.ObjectID, notificationType, message string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    var project models.Project
+    err := DB.Collection("projects").FindOne(ctx, bson.M{"_id": projectID}).Decode(&project)
+    if err != nil {
+        return fmt.Errorf("project not found: %v", err)
+    }
+
+    notification := models.Notification{
+        ProjectID: projectID,
+        Type:      notificationType,
+        Message:   message,
+        CreatedAt: time.Now(),
+    }
+    deliverToWebhook := project.WebhookURL != "" &&
+        project.NotificationSettings.ChannelEnabled(models.NotificationChannelWebhook)
+    if deliverToWebhook {
+        notification.DeliveryStatus = models.DeliveryStatusPending
+    }
+
+    result, err := DB.Collection("notifications").InsertOne(ctx, notification)
+    if err != nil {
+        return fmt.Errorf("failed to store notification: %v", err)
+    }
+    notification.ID = result.InsertedID.(primitive.ObjectID)
+
+    if deliverToWebhook {
+        go deliverWebhook(project.WebhookURL, notification)
+    }
+    return nil
+}
+
+// WasNotificationRecentlySent reports whether a notification of the given type was
+// already logged for the project within the window, to avoid repeated alerts.
+func WasNotificationRecentlySent(projectID primitive.ObjectID, notificationType string, window time.Duration) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    count, err := DB.Collection("notifications").CountDocuments(ctx, bson.M{
+        "project_id": projectID,
+        "type":       notificationType,
+        "created_at": bson.M{"$gte": time.Now().Add(-window)},
+    })
+    return err == nil && count > 0
+}
+
+// deliverWebhook POSTs the notification, retrying once, and records the outcome
+func deliverWebhook(url string, notification models.Notification) {
+    payload := WebhookPayload{
+        Type:      notification.Type,
+        Message:   notification.Message,
+        ProjectID: notification.ProjectID.Hex(),
+        Timestamp: notification.CreatedAt,
+    }
+
+    var deliveryErr error
+    attempts := 0
+    for attempts < 2 {
+        attempts++
+        if deliveryErr = postWebhook(url, payload); deliveryErr == nil {
+            break
+        }
+        if attempts < 2 {
+            time.Sleep(2 * time.Second)
+        }
+    }
+
+    update := bson.M{"delivery_attempts": attempts}
+    if deliveryErr != nil {
+        log.Printf("Webhook delivery failed for notification %s: %v", notification.ID.Hex(), deliveryErr)
+        update["delivery_status"] = models.DeliveryStatusFailed
+        update["delivery_error"] = deliveryErr.Error()
+    } else {
+        update["delivery_status"] = models.DeliveryStatusDelivered
+        update["delivered_at"] = time.Now()
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if _, err := DB.Collection("notifications").UpdateOne(ctx, bson.M{"_id": notification.ID}, bson.M{"$set": update}); err != nil {
+        log.Printf("Failed to record webhook delivery status: %v", err)
+    }
+}
+
+// postWebhook sends a single webhook request, treating non-2xx responses as failures
+func postWebhook(url string, payload WebhookPayload) error {
+    // Webhooks saved before URLs were validated may still point somewhere internal
+    if err := models.ValidateWebhookURL(url); err != nil {
+        return err
+    }
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+    }
+    return nil
+}
+
+// CheckUsageNotifications raises warning and limit-reached (100%) notifications for
+// projects' daily and monthly Gemini usage, at most once per day per type. Each project's
+// notification settings choose the warning threshold and which types are raised.
+func CheckUsageNotifications() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    cursor, err := DB.Collection("projects").Find(ctx, bson.M{"is_active": true, "gemini_enabled": true})
+    if err != nil {
+        return err
+    }
+    var projects []models.Project
+    if err := cursor.All(ctx, &projects); err != nil {
+        return err
+    }
+
+    for _, project := range projects {
+        checkUsageThreshold(project, project.GeminiUsageToday, project.GeminiDailyLimit, "daily",
+            models.NotificationDailyLimitWarning, models.NotificationDailyLimitReached)
+        checkUsageThreshold(project, project.GeminiUsageMonth, project.GeminiMonthlyLimit, "monthly",
+            models.NotificationMonthlyLimitWarning, models.NotificationMonthlyLimitReached)
+    }
+    return nil
+}
+
+func checkUsageThreshold(project models.Project, usage, limit int, period, warningType, reachedType string) {
+    if limit <= 0 {
+        return
+    }
+
+    settings := project.NotificationSettings
+    percent := float64(usage) / float64(limit) * 100
+    notificationType := ""
+    message := ""
+    switch {
+    case percent >= 100:
+        notificationType = reachedType
+        message = fmt.Sprintf("Project %s has reached its %s AI usage limit (%d/%d)", project.Name, period, usage, limit)
+    case percent >= float64(settings.WarningPercent()):
+        notificationType = warningType
+        message = fmt.Sprintf("Project %s has used %.0f%% of its %s AI usage limit (%d/%d)", project.Name, percent, period, usage, limit)
+    default:
+        return
+    }
+    if !settings.TypeEnabled(notificationType) {
+        return
+    }
+
+    if WasNotificationRecentlySent(project.ID, notificationType, 24*time.Hour) {
+        return
+    }
+    if err := LogNotification(project.ID, notificationType, message); err != nil {
+        log.Printf("Failed to log notification for project %s: %v", project.ID.Hex(), err)
+    }
+}
+
+// ExpireProjects marks projects whose subscription expiry date has passed as expired
+// and deactivates them.
+func ExpireProjects() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    result, err := DB.Collection("projects").UpdateMany(ctx,
+        bson.M{
+            "expiry_date": bson.M{"$gt": time.Time{}, "$lt": time.Now()},
+            "status":      bson.M{"$ne": models.ProjectStatusExpired},
+        },
+        bson.M{"$set": bson.M{
+            "status":     models.ProjectStatusExpired,
+            "is_active":  false,
+            "updated_at": time.Now(),
+        }},
+    )
+    if err != nil {
+        return err
+    }
+    if result.ModifiedCount > 0 {
+        log.Printf("Marked %d projects as expired", result.ModifiedCount)
+    }
+    return nil
+}
+
+// NotifyExpiringProjects emails the administrator about projects whose subscription
+// expires within 7 days, at most once per 24 hours per project.
+func NotifyExpiringProjects() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    now := time.Now()
+    cursor, err := DB.Collection("projects").Find(ctx, bson.M{
+        "expiry_date": bson.M{"$gte": now, "$lte": now.Add(7 * 24 * time.Hour)},
+        "status":      bson.M{"$ne": models.ProjectStatusExpired},
+    })
+    if err != nil {
+        return err
+    }
+    var projects []models.Project
+    if err := cursor.All(ctx, &projects); err != nil {
+        return err
+    }
+
+    for _, project := range projects {
+        settings := project.NotificationSettings
+        if !settings.TypeEnabled(models.NotificationExpiryWarning) ||
+            WasNotificationRecentlySent(project.ID, models.NotificationExpiryWarning, 24*time.Hour) {
+            continue
+        }
+
+        daysLeft := int(time.Until(project.ExpiryDate).Hours() / 24)
+        message := fmt.Sprintf("Project %s expires on %s (%d days left)",
+            project.Name, project.ExpiryDate.Format("2006-01-02"), daysLeft)
+
+        recipients := expiryRecipients(project)
+        if len(recipients) > 0 && Mailer != nil && settings.ChannelEnabled(models.NotificationChannelEmail) {
+            body := message + ".\n\nRenew the subscription to keep the chat widget available."
+            if err := Mailer.Send(recipients, "Subscription expiring: "+project.Name, body); err != nil {
+                log.Printf("Failed to email expiry warning for project %s: %v", project.ID.Hex(), err)
+                continue
+            }
+        }
+
+        if err := LogNotification(project.ID, models.NotificationExpiryWarning, message); err != nil {
+            log.Printf("Failed to log expiry warning for project %s: %v", project.ID.Hex(), err)
+        }
+    }
+    return nil
+}
+
+// expiryRecipients returns who should be told about a project's upcoming expiry
+func expiryRecipients(project models.Project) []string {
+    if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+        return []string{adminEmail}
+    }
+    return nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestRejectNonPublicAddress(t *testing.T) {
+    for _, address := range []string{"127.0.0.1:443", "10.0.0.1:443", "169.254.169.254:80", "[::1]:443"} {
+        if err := rejectNonPublicAddress("tcp", address, nil); err == nil {
+            t.Errorf("rejectNonPublicAddress(%s) allowed an internal address", address)
+        }
+    }
+    if err := rejectNonPublicAddress("tcp", "93.184.216.34:443", nil); err != nil {
+        t.Errorf("rejectNonPublicAddress(public) = %v, want allowed", err)
+    }
+}
+
+func TestPostWebhookRefusesInternalTargets(t *testing.T) {
+    called := false
+    server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        called = true
+    }))
+    defer server.Close()
+
+    // The test server listens on loopback
+    if err := postWebhook(server.URL, WebhookPayload{Type: "test"}); err == nil {
+        t.Error("postWebhook delivered to a loopback address")
+    }
+    // A stored plain http URL is refused too
+    if err := postWebhook(strings.Replace(server.URL, "https://", "http://", 1), WebhookPayload{Type: "test"}); err == nil {
+        t.Error("postWebhook delivered over plain http")
+    }
+    if called {
+        t.Error("the internal endpoint received a webhook")
+    }
+}
+
+// roundTripFunc stands in for the network in webhook tests
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func useWebhookTransport(t *testing.T, status int, received *WebhookPayload) {
+    t.Helper()
+    previous := webhookClient
+    webhookClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+        if received != nil {
+            json.NewDecoder(req.Body).Decode(received)
+        }
+        return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+    })}
+    t.Cleanup(func() { webhookClient = previous })
+}
+
+func TestPostWebhookDeliversPayload(t *testing.T) {
+    var received WebhookPayload
+    useWebhookTransport(t, http.StatusNoContent, &received)
+
+    sent := WebhookPayload{Type: "usage_warning", Message: "80% used", ProjectID: "p1", Timestamp: time.Now().UTC().Truncate(time.Second)}
+    if err := postWebhook("https://hooks.example.com/notify", sent); err != nil {
+        t.Fatalf("postWebhook: %v", err)
+    }
+    if received != sent {
+        t.Errorf("received %+v, want %+v", received, sent)
+    }
+}
+
+func TestPostWebhookFailsOnErrorStatus(t *testing.T) {
+    useWebhookTransport(t, http.StatusInternalServerError, nil)
+    if err := postWebhook("https://hooks.example.com/notify", WebhookPayload{Type: "test"}); err == nil {
+        t.Error("a 500 from the webhook was treated as delivered")
+    }
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "sync"
+)
+
+// ModelPricing is what a Gemini model costs in USD per 1K tokens
+type ModelPricing struct {
+    InputPer1K  float64 `json:"input_per_1k"`
+    OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// fallbackPricingModel prices models missing from the table
+const fallbackPricingModel = "gemini-1.5-flash"
+
+// defaultGeminiPricing applies until overridden by GEMINI_PRICING_FILE or GEMINI_PRICING
+var defaultGeminiPricing = map[string]ModelPricing{
+    "gemini-1.5-flash": {InputPer1K: 0.000075, OutputPer1K: 0.0003},
+    "gemini-1.5-pro":   {InputPer1K: 0.00125, OutputPer1K: 0.005},
+    "gemini-pro":       {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+
+    "gemini-2.0-flash":      {InputPer1K: 0.0001, OutputPer1K: 0.0004},
+    "gemini-2.0-flash-lite": {InputPer1K: 0.000075, OutputPer1K: 0.0003},
+    "gemini-2.5-flash":      {InputPer1K: 0.0003, OutputPer1K: 0.0025},
+    "gemini-2.5-flash-lite": {InputPer1K: 0.0001, OutputPer1K: 0.0004},
+    "gemini-2.5-pro":        {InputPer1K: 0.00125, OutputPer1K: 0.01},
+}
+
+var (
+    geminiPricingMu      sync.RWMutex
+    geminiPricing        = copyPricing(defaultGeminiPricing)
+    unpricedModelsWarned = make(map[string]bool)
+)
+
+// LoadGeminiPricing reads per-model prices from the JSON file named by GEMINI_PRICING_FILE,
+// or from GEMINI_PRICING itself, as {"model": {"input_per_1k": ..., "output_per_1k": ...}}.
+// Listed models override the built-in prices; others keep them. It can be called again
+// to pick up a changed table.
+func LoadGeminiPricing() error {
+    data := []byte(os.Getenv("GEMINI_PRICING"))
+    if path := os.Getenv("GEMINI_PRICING_FILE"); path != "" {
+        var err error
+        if data, err = os.ReadFile(path); err != nil {
+            return fmt.Errorf("reading Gemini pricing: %w", err)
+        }
+    }
+
+    pricing := copyPricing(defaultGeminiPricing)
+    if len(data) > 0 {
+        var custom map[string]ModelPricing
+        if err := json.Unmarshal(data, &custom); err != nil {
+            return fmt.Errorf("parsing Gemini pricing: %w", err)
+        }
+        for model, price := range custom {
+            if price.InputPer1K < 0 || price.OutputPer1K < 0 {
+                return fmt.Errorf("negative price for model %q", model)
+            }
+            pricing[model] = price
+        }
+    }
+
+    geminiPricingMu.Lock()
+    geminiPricing = pricing
+    unpricedModelsWarned = make(map[string]bool)
+    geminiPricingMu.Unlock()
+
+    log.Printf("Loaded Gemini pricing for %d models", len(pricing))
+    return nil
+}
+
+// GeminiPricing returns the prices for model. Models missing from the table are priced
+// as fallbackPricingModel, with a warning logged the first time each one is seen.
+func GeminiPricing(model string) ModelPricing {
+    geminiPricingMu.RLock()
+    price, known := geminiPricing[model]
+    warned := unpricedModelsWarned[model]
+    fallback := geminiPricing[fallbackPricingModel]
+    geminiPricingMu.RUnlock()
+
+    if known {
+        return price
+    }
+    if !warned {
+        geminiPricingMu.Lock()
+        unpricedModelsWarned[model] = true
+        geminiPricingMu.Unlock()
+        log.Printf("⚠️ No pricing configured for Gemini model %q, using %s prices", model, fallbackPricingModel)
+    }
+    return fallback
+}
+
+// GeminiPricingTable returns a copy of the current pricing table
+func GeminiPricingTable() map[string]ModelPricing {
+    geminiPricingMu.RLock()
+    defer geminiPricingMu.RUnlock()
+    return copyPricing(geminiPricing)
+}
+
+func copyPricing(pricing map[string]ModelPricing) map[string]ModelPricing {
+    copied := make(map[string]ModelPricing, len(pricing))
+    for model, price := range pricing {
+        copied[model] = price
+    }
+    return copied
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// restorePricing reloads the built-in table once a test is done with custom prices.
+// It runs after t.Setenv has put the environment back.
+func restorePricing(t *testing.T) {
+    t.Cleanup(func() { LoadGeminiPricing() })
+}
+
+func TestLoadGeminiPricingFromEnv(t *testing.T) {
+    restorePricing(t)
+    t.Setenv("GEMINI_PRICING", `{"gemini-2.5-pro": {"input_per_1k": 0.002, "output_per_1k": 0.02}, "custom-model": {"input_per_1k": 1, "output_per_1k": 2}}`)
+
+    if err := LoadGeminiPricing(); err != nil {
+        t.Fatalf("LoadGeminiPricing: %v", err)
+    }
+    if price := GeminiPricing("gemini-2.5-pro"); price.InputPer1K != 0.002 || price.OutputPer1K != 0.02 {
+        t.Errorf("overridden price = %+v", price)
+    }
+    if price := GeminiPricing("custom-model"); price.InputPer1K != 1 {
+        t.Errorf("added model price = %+v", price)
+    }
+    // Models not listed keep their built-in price
+    if price := GeminiPricing("gemini-1.5-pro"); price != defaultGeminiPricing["gemini-1.5-pro"] {
+        t.Errorf("unlisted model price = %+v, want the default", price)
+    }
+}
+
+func TestLoadGeminiPricingFromFile(t *testing.T) {
+    restorePricing(t)
+    path := filepath.Join(t.TempDir(), "pricing.json")
+    if err := os.WriteFile(path, []byte(`{"gemini-1.5-flash": {"input_per_1k": 0.5, "output_per_1k": 0.5}}`), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("GEMINI_PRICING_FILE", path)
+    t.Setenv("GEMINI_PRICING", `{"gemini-1.5-flash": {"input_per_1k": 9, "output_per_1k": 9}}`)
+
+    if err := LoadGeminiPricing(); err != nil {
+        t.Fatalf("LoadGeminiPricing: %v", err)
+    }
+    if price := GeminiPricing("gemini-1.5-flash"); price.InputPer1K != 0.5 {
+        t.Errorf("price = %+v, want the file to take precedence", price)
+    }
+}
+
+func TestLoadGeminiPricingRejectsBadInput(t *testing.T) {
+    restorePricing(t)
+    before := GeminiPricingTable()
+
+    for _, value := range []string{`not json`, `{"gemini-pro": {"input_per_1k": -1, "output_per_1k": 0}}`} {
+        t.Setenv("GEMINI_PRICING", value)
+        if err := LoadGeminiPricing(); err == nil {
+            t.Errorf("GEMINI_PRICING %s: expected an error", value)
+        }
+    }
+    if GeminiPricing("gemini-pro") != before["gemini-pro"] {
+        t.Error("a rejected table must leave the current prices in place")
+    }
+
+    t.Setenv("GEMINI_PRICING", "")
+    t.Setenv("GEMINI_PRICING_FILE", filepath.Join(t.TempDir(), "missing.json"))
+    if err := LoadGeminiPricing(); err == nil {
+        t.Error("a missing pricing file must be reported")
+    }
+}
+
+func TestGeminiPricingFallsBackForUnknownModels(t *testing.T) {
+    if price := GeminiPricing("gemini-unknown"); price != GeminiPricing(fallbackPricingModel) {
+        t.Errorf("unknown model price = %+v, want the %s price", price, fallbackPricingModel)
+    }
+}
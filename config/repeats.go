@@ -0,0 +1,39 @@
+package config
+
+import (
+    "log"
+    "os"
+    "strconv"
+    "time"
+)
+
+// RepeatWindow is how far back chat looks for a session asking the same question again,
+// and RepeatThreshold how many earlier identical messages within it make the next one
+// a repeat. A repeat is answered with the last successful reply instead of calling
+// Gemini, so asking once more after an error still gets a fresh answer. Override with
+// REPEAT_MESSAGE_WINDOW (e.g. "10m") and REPEAT_MESSAGE_THRESHOLD; a threshold of 0
+// turns the check off.
+var (
+    RepeatWindow    = 10 * time.Minute
+    RepeatThreshold = 2
+)
+
+// InitRepeatDetection reads the repeated-message settings from the environment
+func InitRepeatDetection() {
+    if value := os.Getenv("REPEAT_MESSAGE_WINDOW"); value != "" {
+        window, err := time.ParseDuration(value)
+        if err != nil || window <= 0 {
+            log.Printf("Invalid REPEAT_MESSAGE_WINDOW %q, using %s", value, RepeatWindow)
+        } else {
+            RepeatWindow = window
+        }
+    }
+    if value := os.Getenv("REPEAT_MESSAGE_THRESHOLD"); value != "" {
+        threshold, err := strconv.Atoi(value)
+        if err != nil || threshold < 0 {
+            log.Printf("Invalid REPEAT_MESSAGE_THRESHOLD %q, using %d", value, RepeatThreshold)
+        } else {
+            RepeatThreshold = threshold
+        }
+    }
+}
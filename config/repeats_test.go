@@ -0,0 +1,30 @@
+package config
+
+import (
+    "testing"
+    "time"
+)
+
+func TestInitRepeatDetection(t *testing.T) {
+    defer func(window time.Duration, threshold int) {
+        RepeatWindow, RepeatThreshold = window, threshold
+    }(RepeatWindow, RepeatThreshold)
+
+    if RepeatThreshold < 2 {
+        t.Fatalf("default RepeatThreshold = %d, want at least 2", RepeatThreshold)
+    }
+
+    t.Setenv("REPEAT_MESSAGE_WINDOW", "90s")
+    t.Setenv("REPEAT_MESSAGE_THRESHOLD", "0")
+    InitRepeatDetection()
+    if RepeatWindow != 90*time.Second || RepeatThreshold != 0 {
+        t.Fatalf("got window %s threshold %d, want 90s and 0", RepeatWindow, RepeatThreshold)
+    }
+
+    t.Setenv("REPEAT_MESSAGE_WINDOW", "soon")
+    t.Setenv("REPEAT_MESSAGE_THRESHOLD", "-1")
+    InitRepeatDetection()
+    if RepeatWindow != 90*time.Second || RepeatThreshold != 0 {
+        t.Fatalf("invalid values changed the settings to %s and %d", RepeatWindow, RepeatThreshold)
+    }
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+    "context"
+    "log"
+    "os"
+    "strconv"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/models"
+)
+
+// DataRetentionDays is how long chat messages and Gemini usage logs are kept. Override
+// with DATA_RETENTION_DAYS; 0 keeps them forever. Projects can set their own period.
+var DataRetentionDays = 180
+
+// retentionCollections are cleaned up by CleanupExpiredData, keyed on their timestamp field
+var retentionCollections = []string{"chat_messages", "gemini_usage_logs"}
+
+// InitDataRetention reads the retention period from the environment
+func InitDataRetention() {
+    value := os.Getenv("DATA_RETENTION_DAYS")
+    if value == "" {
+        return
+    }
+    days, err := strconv.Atoi(value)
+    if err != nil || days < 0 {
+        log.Printf("Invalid DATA_RETENTION_DAYS %q, keeping data for %d days", value, DataRetentionDays)
+        return
+    }
+    DataRetentionDays = days
+}
+
+// CleanupExpiredData deletes chat messages and usage logs older than the retention period:
+// each project's own retention_days when set, DataRetentionDays otherwise.
+func CleanupExpiredData(now time.Time) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+    defer cancel()
+
+    cursor, err := DB.Collection("projects").Find(ctx,
+        bson.M{"retention_days": bson.M{"$gt": 0}},
+        options.Find().SetProjection(bson.M{"_id": 1, "retention_days": 1}))
+    if err != nil {
+        return err
+    }
+    var overrides []models.Project
+    if err := cursor.All(ctx, &overrides); err != nil {
+        return err
+    }
+
+    overrideIDs := make([]primitive.ObjectID, 0, len(overrides))
+    for _, project := range overrides {
+        overrideIDs = append(overrideIDs, project.ID)
+    }
+
+    for _, name := range retentionCollections {
+        collection := DB.Collection(name)
+        var removed int64
+
+        for _, project := range overrides {
+            result, err := collection.DeleteMany(ctx, bson.M{
+                "project_id": project.ID,
+                "timestamp":  bson.M{"$lt": retentionCutoff(now, project.RetentionDays)},
+            })
+            if err != nil {
+                return err
+            }
+            removed += result.DeletedCount
+        }
+
+        if DataRetentionDays > 0 {
+            result, err := collection.DeleteMany(ctx, bson.M{
+                "project_id": bson.M{"$nin": overrideIDs},
+                "timestamp":  bson.M{"$lt": retentionCutoff(now, DataRetentionDays)},
+            })
+            if err != nil {
+                return err
+            }
+            removed += result.DeletedCount
+        }
+
+        if removed > 0 {
+            log.Printf("Removed %d expired documents from %s", removed, name)
+        }
+    }
+    return nil
+}
+
+// retentionCutoff returns the time before which data kept for days is expired
+func retentionCutoff(now time.Time, days int) time.Time {
+    return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+    "context"
+    "os"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/models"
+)
+
+func TestInitDataRetention(t *testing.T) {
+    previous := DataRetentionDays
+    t.Cleanup(func() { DataRetentionDays = previous })
+
+    cases := []struct {
+        value string
+        want  int
+    }{
+        {"", 180},
+        {"30", 30},
+        {"0", 0},
+        {"-5", 180},
+        {"a month", 180},
+    }
+    for _, tc := range cases {
+        DataRetentionDays = 180
+        t.Setenv("DATA_RETENTION_DAYS", tc.value)
+        InitDataRetention()
+        if DataRetentionDays != tc.want {
+            t.Errorf("DATA_RETENTION_DAYS=%q: days = %d, want %d", tc.value, DataRetentionDays, tc.want)
+        }
+    }
+}
+
+func TestRetentionCutoff(t *testing.T) {
+    now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+    if got := retentionCutoff(now, 30); !got.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+        t.Errorf("retentionCutoff(30) = %v", got)
+    }
+}
+
+// testDatabase points DB at a throwaway database on MONGODB_TEST_URI, skipping
+// the test when no MongoDB is available
+func testDatabase(t *testing.T) {
+    t.Helper()
+    uri := os.Getenv("MONGODB_TEST_URI")
+    if uri == "" {
+        t.Skip("set MONGODB_TEST_URI to run against MongoDB")
+    }
+
+    ctx := context.Background()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connect: %v", err)
+    }
+    previous := DB
+    DB = client.Database("jevi_chat_test_" + primitive.NewObjectID().Hex())
+    t.Cleanup(func() {
+        DB.Drop(ctx)
+        DB = previous
+        client.Disconnect(ctx)
+    })
+}
+
+func TestCleanupExpiredDataHonoursProjectRetention(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    previous := DataRetentionDays
+    DataRetentionDays = 90
+    t.Cleanup(func() { DataRetentionDays = previous })
+
+    short := models.Project{ID: primitive.NewObjectID(), RetentionDays: 7}
+    standard := models.Project{ID: primitive.NewObjectID()}
+    if _, err := DB.Collection("projects").InsertMany(ctx, []interface{}{short, standard}); err != nil {
+        t.Fatal(err)
+    }
+
+    now := time.Now()
+    messages := []interface{}{
+        models.ChatMessage{ProjectID: short.ID, Timestamp: now.AddDate(0, 0, -3)},
+        models.ChatMessage{ProjectID: short.ID, Timestamp: now.AddDate(0, 0, -10)},
+        models.ChatMessage{ProjectID: standard.ID, Timestamp: now.AddDate(0, 0, -10)},
+        models.ChatMessage{ProjectID: standard.ID, Timestamp: now.AddDate(0, 0, -100)},
+    }
+    if _, err := DB.Collection("chat_messages").InsertMany(ctx, messages); err != nil {
+        t.Fatal(err)
+    }
+    logs := []interface{}{
+        models.GeminiUsageLog{ProjectID: standard.ID, Timestamp: now.AddDate(0, 0, -100)},
+    }
+    if _, err := DB.Collection("gemini_usage_logs").InsertMany(ctx, logs); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := CleanupExpiredData(now); err != nil {
+        t.Fatalf("CleanupExpiredData: %v", err)
+    }
+
+    for _, tc := range []struct {
+        project primitive.ObjectID
+        want    int64
+    }{{short.ID, 1}, {standard.ID, 1}} {
+        count, err := DB.Collection("chat_messages").CountDocuments(ctx, bson.M{"project_id": tc.project})
+        if err != nil || count != tc.want {
+            t.Errorf("project %s kept %d messages, err = %v; want %d", tc.project.Hex(), count, err, tc.want)
+        }
+    }
+    if count, _ := DB.Collection("gemini_usage_logs").CountDocuments(ctx, bson.M{}); count != 0 {
+        t.Errorf("kept %d expired usage logs, want 0", count)
+    }
+}
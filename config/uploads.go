@@ -0,0 +1,42 @@
+package config
+
+import (
+    "log"
+    "os"
+    "strconv"
+)
+
+// Upload size limits in bytes. Override with MAX_PDF_SIZE (per file) and
+// MAX_TOTAL_UPLOAD (all files in one request). MaxRequestBody caps every other
+// request body; override with MAX_REQUEST_BODY.
+var (
+    MaxPDFSize     int64 = 10 << 20
+    MaxTotalUpload int64 = 32 << 20
+    MaxRequestBody int64 = 1 << 20
+)
+
+// InitUploadLimits reads the upload limits from the environment
+func InitUploadLimits() {
+    MaxPDFSize = envBytes("MAX_PDF_SIZE", MaxPDFSize)
+    MaxTotalUpload = envBytes("MAX_TOTAL_UPLOAD", MaxTotalUpload)
+    MaxRequestBody = envBytes("MAX_REQUEST_BODY", MaxRequestBody)
+
+    if MaxPDFSize > MaxTotalUpload {
+        log.Printf("MAX_PDF_SIZE exceeds MAX_TOTAL_UPLOAD, capping it at %d bytes", MaxTotalUpload)
+        MaxPDFSize = MaxTotalUpload
+    }
+}
+
+// envBytes parses a positive byte count from the environment, falling back to def
+func envBytes(key string, def int64) int64 {
+    value := os.Getenv(key)
+    if value == "" {
+        return def
+    }
+    size, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || size <= 0 {
+        log.Printf("Invalid %s %q, using %d bytes", key, value, def)
+        return def
+    }
+    return size
+}
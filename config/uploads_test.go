@@ -0,0 +1,53 @@
+package config
+
+import "testing"
+
+func TestEnvBytes(t *testing.T) {
+    cases := map[string]int64{
+        "":         100,
+        "2048":     2048,
+        "0":        100,
+        "-5":       100,
+        "10MB":     100,
+        "99999999": 99999999,
+    }
+    for value, want := range cases {
+        t.Setenv("MAX_PDF_SIZE", value)
+        if got := envBytes("MAX_PDF_SIZE", 100); got != want {
+            t.Errorf("envBytes(%q) = %d, want %d", value, got, want)
+        }
+    }
+}
+
+func TestInitUploadLimitsCapsPerFileSize(t *testing.T) {
+    pdf, total, body := MaxPDFSize, MaxTotalUpload, MaxRequestBody
+    t.Cleanup(func() { MaxPDFSize, MaxTotalUpload, MaxRequestBody = pdf, total, body })
+
+    t.Setenv("MAX_PDF_SIZE", "5000")
+    t.Setenv("MAX_TOTAL_UPLOAD", "3000")
+    t.Setenv("MAX_REQUEST_BODY", "")
+    InitUploadLimits()
+
+    if MaxTotalUpload != 3000 {
+        t.Errorf("MaxTotalUpload = %d, want 3000", MaxTotalUpload)
+    }
+    if MaxPDFSize != 3000 {
+        t.Errorf("MaxPDFSize = %d, want it capped at the total upload limit", MaxPDFSize)
+    }
+    if MaxRequestBody != body {
+        t.Errorf("MaxRequestBody = %d, want the default %d", MaxRequestBody, body)
+    }
+}
+
+func TestInitUploadLimitsRequestBody(t *testing.T) {
+    pdf, total, body := MaxPDFSize, MaxTotalUpload, MaxRequestBody
+    t.Cleanup(func() { MaxPDFSize, MaxTotalUpload, MaxRequestBody = pdf, total, body })
+
+    t.Setenv("MAX_PDF_SIZE", "")
+    t.Setenv("MAX_TOTAL_UPLOAD", "")
+    t.Setenv("MAX_REQUEST_BODY", "65536")
+    InitUploadLimits()
+    if MaxRequestBody != 65536 || MaxTotalUpload != total {
+        t.Errorf("MaxRequestBody = %d, MaxTotalUpload = %d; want only the body limit changed", MaxRequestBody, MaxTotalUpload)
+    }
+}
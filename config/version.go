@@ -0,0 +1,44 @@
+package config
+
+import "runtime"
+
+// Build information, injected at build time:
+//
+//	go build -ldflags "-X jevi-chat/config.Version=1.4.0 \
+//	    -X jevi-chat/config.GitCommit=$(git rev-parse --short HEAD) \
+//	    -X jevi-chat/config.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without the flags report "dev" and "unknown".
+var (
+    Version   = "dev"
+    GitCommit = "unknown"
+    BuildTime = "unknown"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+    Version   string `json:"version"`
+    GitCommit string `json:"git_commit"`
+    BuildTime string `json:"build_time"`
+    GoVersion string `json:"go_version"`
+}
+
+// GetBuildInfo returns the injected build information, with empty values reported as unknown
+func GetBuildInfo() BuildInfo {
+    info := BuildInfo{
+        Version:   Version,
+        GitCommit: GitCommit,
+        BuildTime: BuildTime,
+        GoVersion: runtime.Version(),
+    }
+    if info.Version == "" {
+        info.Version = "dev"
+    }
+    if info.GitCommit == "" {
+        info.GitCommit = "unknown"
+    }
+    if info.BuildTime == "" {
+        info.BuildTime = "unknown"
+    }
+    return info
+}
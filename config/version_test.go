@@ -0,0 +1,24 @@
+package config
+
+import (
+    "runtime"
+    "testing"
+)
+
+func TestGetBuildInfo(t *testing.T) {
+    previous := [3]string{Version, GitCommit, BuildTime}
+    t.Cleanup(func() { Version, GitCommit, BuildTime = previous[0], previous[1], previous[2] })
+
+    Version, GitCommit, BuildTime = "1.4.0", "abc1234", "2026-05-01T09:00:00Z"
+    want := BuildInfo{Version: "1.4.0", GitCommit: "abc1234", BuildTime: "2026-05-01T09:00:00Z", GoVersion: runtime.Version()}
+    if info := GetBuildInfo(); info != want {
+        t.Errorf("GetBuildInfo = %+v, want %+v", info, want)
+    }
+
+    // -X with an empty value blanks the variable
+    Version, GitCommit, BuildTime = "", "", ""
+    want = BuildInfo{Version: "dev", GitCommit: "unknown", BuildTime: "unknown", GoVersion: runtime.Version()}
+    if info := GetBuildInfo(); info != want {
+        t.Errorf("GetBuildInfo = %+v, want %+v", info, want)
+    }
+}
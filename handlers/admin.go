@@ -1,25 +1,37 @@
 package handlers
 
 import (
-
-    "math/rand"
-   
-        "context"
+    "context"
+    "encoding/json"
     "fmt"
     "io/ioutil"
+    "log"
+    "math"
     "net/http"
+    "regexp"
+    "runtime"
+    "sort"
+    "strconv"
     "strings"
     "time"
+    "unicode/utf8"
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
     "jevi-chat/config"
+    "jevi-chat/middleware"
     "jevi-chat/models"
+    "jevi-chat/utils"
 )
 
 // In handlers/admin.go
 func AdminDashboard(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     stats := map[string]interface{}{
         "total_users": 0,
         "total_projects": 0,
@@ -29,14 +41,14 @@ func AdminDashboard(c *gin.Context) {
     
     // Get actual stats from database
     if userCollection := config.DB.Collection("users"); userCollection != nil {
-        userCount, _ := userCollection.CountDocuments(context.Background(), bson.M{})
-        activeUserCount, _ := userCollection.CountDocuments(context.Background(), bson.M{"is_active": true})
+        userCount, _ := userCollection.CountDocuments(ctx, bson.M{})
+        activeUserCount, _ := userCollection.CountDocuments(ctx, bson.M{"is_active": true})
         stats["total_users"] = userCount
         stats["active_users"] = activeUserCount
     }
     
     if projectCollection := config.DB.Collection("projects"); projectCollection != nil {
-        projectCount, _ := projectCollection.CountDocuments(context.Background(), bson.M{})
+        projectCount, _ := projectCollection.CountDocuments(ctx, bson.M{})
         stats["total_projects"] = projectCount
     }
     
@@ -47,59 +59,116 @@ func AdminDashboard(c *gin.Context) {
     })
 }
 
+// AdminProjects - List projects with pagination, search, status filter and sorting.
+// Query params: page, limit, search (name/description), status (active, inactive, expired),
+// sort (created_at, name, total_tokens_used) and order (asc, desc).
 func AdminProjects(c *gin.Context) {
-    fmt.Println("AdminProjects handler called - DEBUG")
-    
-    // Make sure this matches your actual MongoDB collection name
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    filter, err := projectListFilter(c.Query("search"), c.Query("status"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+        return
+    }
+    sortOrder, err := projectListSort(c.DefaultQuery("sort", "created_at"), c.DefaultQuery("order", "desc"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort field"})
+        return
+    }
+
     collection := config.DB.Collection("projects")
-    
-    // Add debug logging to check collection existence
-    count, err := collection.CountDocuments(context.Background(), bson.M{})
-    fmt.Printf("Total documents in projects collection: %d\n", count)
-    
+    total, err := collection.CountDocuments(ctx, filter)
     if err != nil {
-        fmt.Printf("Error counting documents: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
         return
     }
-    
-    cursor, err := collection.Find(context.Background(), bson.M{})
+
+    opts := options.Find().
+        SetSort(sortOrder).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
     if err != nil {
-        fmt.Printf("Error finding projects: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
         return
     }
-    
+
     var projects []models.Project
-    if err := cursor.All(context.Background(), &projects); err != nil {
-        fmt.Printf("Error decoding projects: %v\n", err)
+    if err := cursor.All(ctx, &projects); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode projects"})
         return
     }
-    
-    fmt.Printf("Successfully fetched %d projects from database\n", len(projects))
-    
-    // Always return an array, even if empty
-    if projects == nil {
-        projects = []models.Project{}
-    }
-    
+
     c.JSON(http.StatusOK, gin.H{
         "success": true,
-        "projects": projects,
+        "projects": models.NewProjectResponses(projects),
         "count": len(projects),
-        "total_in_db": count, // Add this for debugging
+        "total": total,
+        "page": page,
+        "limit": limit,
+        "total_pages": (total + int64(limit) - 1) / int64(limit),
     })
 }
 
+// projectListFilter - The AdminProjects filter: live projects, optionally matching search
+// in the name or description and narrowed to a status (active, inactive or expired)
+func projectListFilter(search, status string) (bson.M, error) {
+    // Soft-deleted projects are hidden from listings
+    filter := bson.M{"deleted_at": bson.M{"$exists": false}}
+
+    if search = strings.TrimSpace(search); search != "" {
+        pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+        filter["$or"] = []bson.M{
+            {"name": pattern},
+            {"description": pattern},
+        }
+    }
+
+    switch status {
+    case "":
+    case "active":
+        filter["is_active"] = true
+    case "inactive":
+        filter["is_active"] = false
+    case models.ProjectStatusExpired:
+        filter["status"] = models.ProjectStatusExpired
+    default:
+        return nil, fmt.Errorf("unknown status %q", status)
+    }
+    return filter, nil
+}
+
+// projectListSort - The AdminProjects sort order; _id breaks ties so pages don't overlap
+func projectListSort(field, order string) (bson.D, error) {
+    if field != "created_at" && field != "name" && field != "total_tokens_used" {
+        return nil, fmt.Errorf("unknown sort field %q", field)
+    }
+    direction := -1
+    if order == "asc" {
+        direction = 1
+    }
+    return bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}, nil
+}
+
 func CreateProject(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     fmt.Println("CreateProject handler called")
     
     var project models.Project
     
-    // Log the raw request body for debugging
     body, _ := c.GetRawData()
-    fmt.Printf("Raw request body: %s\n", string(body))
     
     // Reset the body for binding
     c.Request.Body = ioutil.NopCloser(strings.NewReader(string(body)))
@@ -113,47 +182,65 @@ func CreateProject(c *gin.Context) {
         return
     }
     
-    fmt.Printf("Parsed project: %+v\n", project)
+    // The API key is excluded from the model's JSON, so read it separately
+    var keyInput struct {
+        GeminiAPIKey string `json:"gemini_api_key"`
+    }
+    json.Unmarshal(body, &keyInput)
+    project.GeminiAPIKey = strings.TrimSpace(keyInput.GeminiAPIKey)
     
-    // Initialize all required fields based on your struct
-    project.ID = primitive.NewObjectID()
-    project.IsActive = true
-    project.CreatedAt = time.Now()
-    project.UpdatedAt = time.Now()
+    clearServerOwnedFields(&project)
+    applyNewProjectDefaults(&project)
     
-    // Set default values for optional fields
-    if project.WelcomeMessage == "" {
-        project.WelcomeMessage = "Hello! How can I help you today?"
+    // Owner defaults to the creating user; admins can assign one with owner_id
+    if project.OwnerID.IsZero() {
+        if userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id")); err == nil {
+            project.OwnerID = userObjID
+        }
+    } else if !userExists(ctx, project.OwnerID) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Owner not found"})
+        return
     }
     
-    if project.Category == "" {
-        project.Category = "General"
+    project.Name = strings.TrimSpace(project.Name)
+    project.ExternalID = strings.TrimSpace(project.ExternalID)
+    if err := project.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
     }
-    
-    // Initialize Gemini settings with defaults
-    if project.GeminiModel == "" {
-        project.GeminiModel = "gemini-1.5-flash"
+    if err := validateGeminiModel(project.GeminiModel); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
     }
     
-    if project.GeminiLimit == 0 {
-        project.GeminiLimit = 1000 // Default daily limit
-    }
+    collection := config.DB.Collection("projects")
     
-    // Initialize arrays to prevent null values
-    if project.PDFFiles == nil {
-        project.PDFFiles = []models.PDFFile{}
+    // Retries with a known external ID get the project created the first time
+    if project.ExternalID != "" && respondWithExistingProject(c, project.ExternalID) {
+        return
     }
     
-    // Initialize analytics fields
-    project.TotalQuestions = 0
-    project.GeminiUsage = 0
-    project.LastUsed = time.Now()
+    // Project names are unique, ignoring case
+    exists, err := projectNameExists(ctx, project.Name, primitive.NilObjectID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+        return
+    }
+    if exists {
+        c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A project named %q already exists", project.Name)})
+        return
+    }
     
-    fmt.Printf("Project before insertion: %+v\n", project)
+    if project.GeminiAPIKey, err = encryptAPIKey(project.GeminiAPIKey); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure API key"})
+        return
+    }
     
     // Insert into database
-    collection := config.DB.Collection("projects")
-    result, err := collection.InsertOne(context.Background(), project)
+    result, err := collection.InsertOne(ctx, project)
+    if mongo.IsDuplicateKeyError(err) && project.ExternalID != "" && respondWithExistingProject(c, project.ExternalID) {
+        return
+    }
     if err != nil {
         fmt.Printf("Database insertion error: %v\n", err)
         c.JSON(http.StatusInternalServerError, gin.H{
@@ -168,12 +255,35 @@ func CreateProject(c *gin.Context) {
     c.JSON(http.StatusCreated, gin.H{
         "success": true,
         "message": "Project created successfully",
-        "project": project,
+        "project": models.NewProjectResponse(project),
         "inserted_id": result.InsertedID,
     })
 }
 
+// respondWithExistingProject - Respond 200 with the project already created under externalID.
+// Returns false, without responding, when there is none.
+func respondWithExistingProject(c *gin.Context, externalID string) bool {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var existing models.Project
+    err := config.DB.Collection("projects").FindOne(ctx, bson.M{"external_id": externalID}).Decode(&existing)
+    if err != nil {
+        return false
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "message": "Project already exists",
+        "project": models.NewProjectResponse(existing),
+        "existing": true,
+    })
+    return true
+}
+
 func ProjectDetails(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -183,18 +293,189 @@ func ProjectDetails(c *gin.Context) {
     
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
     }
     
+    c.Header("ETag", projectETag(project.Version))
     c.JSON(http.StatusOK, gin.H{
-        "project": project,
+        "project": models.NewProjectResponse(project),
     })
 }
 
+// applyProjectUpdate overlays the update fields on a copy of the project
+func applyProjectUpdate(project models.Project, updateData bson.M) (models.Project, error) {
+    current, err := json.Marshal(project)
+    if err != nil {
+        return project, err
+    }
+    var merged map[string]interface{}
+    if err := json.Unmarshal(current, &merged); err != nil {
+        return project, err
+    }
+    for key, value := range updateData {
+        merged[key] = value
+    }
+
+    data, err := json.Marshal(merged)
+    if err != nil {
+        return project, err
+    }
+    var candidate models.Project
+    if err := json.Unmarshal(data, &candidate); err != nil {
+        return project, err
+    }
+
+    // The API key is not part of the JSON representation and is changed through RotateGeminiKey
+    candidate.GeminiAPIKey = project.GeminiAPIKey
+    return candidate, nil
+}
+
+// editableProjectFields are the fields UpdateProject may set. Usage counters, billing,
+// the API key and the knowledge base are managed by their own endpoints or by the server.
+var editableProjectFields = map[string]bool{
+    "name":                 true,
+    "description":          true,
+    "category":             true,
+    "is_active":            true,
+    "owner_id":             true,
+    "welcome_message":      true,
+    "system_prompt":        true,
+    "gemini_enabled":       true,
+    "gemini_model":         true,
+    "webhook_url":          true,
+    "allowed_domains":      true,
+    "forced_language":      true,
+    "retention_days":       true,
+    "max_session_messages": true,
+    "monthly_cost_budget":  true,
+}
+
+// protectedProjectFields returns the update's fields that UpdateProject may not set, sorted
+func protectedProjectFields(updateData bson.M) []string {
+    var fields []string
+    for field := range updateData {
+        if !editableProjectFields[field] {
+            fields = append(fields, field)
+        }
+    }
+    sort.Strings(fields)
+    return fields
+}
+
+// clearServerOwnedFields - Drop fields a create request may not set: usage counters,
+// billing state and knowledge, which only the server and the upload endpoints write
+func clearServerOwnedFields(project *models.Project) {
+    project.KnowledgeSources = nil
+    project.PDFFiles = nil
+    project.PDFContent = ""
+    project.GeminiUsage = 0
+    project.GeminiUsageToday = 0
+    project.GeminiUsageMonth = 0
+    project.LastDailyReset = time.Time{}
+    project.LastMonthlyReset = time.Time{}
+    project.EstimatedCostToday = 0
+    project.EstimatedCostMonth = 0
+    project.TokensUsedMonth = 0
+    project.TokenGraceStartedAt = time.Time{}
+    project.ExpiryDate = time.Time{}
+    project.DeletedAt = time.Time{}
+    project.TotalQuestions = 0
+    project.TotalTokensUsed = 0
+    project.ChatUserCount = 0
+}
+
+// applyNewProjectDefaults - Initialize system fields and defaults for a project about to be created
+func applyNewProjectDefaults(project *models.Project) {
+    // Initialize all required fields based on your struct
+    project.ID = primitive.NewObjectID()
+    project.IsActive = true
+    project.CreatedAt = time.Now()
+    project.UpdatedAt = time.Now()
+    project.Version = 1
+    
+    // Set default values for optional fields
+    if project.WelcomeMessage == "" {
+        project.WelcomeMessage = "Hello! How can I help you today?"
+    }
+    
+    if project.Category == "" {
+        project.Category = "General"
+    }
+    
+    project.Status = models.ProjectStatusActive
+    project.StartDate = project.CreatedAt
+    project.LastTokenReset = project.CreatedAt
+    
+    // Initialize Gemini settings with defaults
+    if project.GeminiModel == "" {
+        project.GeminiModel = models.DefaultGeminiModel
+    }
+    
+    // Limits come from the chosen plan; explicit values given at creation override it
+    plan, ok := models.FindPlan(project.PlanID)
+    if !ok {
+        plan, _ = models.FindPlan(models.DefaultPlanID)
+    }
+    overrides := *project
+    project.ApplyPlan(plan)
+    if overrides.GeminiLimit > 0 {
+        project.GeminiLimit = overrides.GeminiLimit
+    }
+    if overrides.GeminiDailyLimit > 0 {
+        project.GeminiDailyLimit = overrides.GeminiDailyLimit
+    }
+    if overrides.GeminiMonthlyLimit > 0 {
+        project.GeminiMonthlyLimit = overrides.GeminiMonthlyLimit
+    }
+    if overrides.RateLimitPerMinute > 0 {
+        project.RateLimitPerMinute = overrides.RateLimitPerMinute
+    }
+    if overrides.MonthlyTokenLimit > 0 {
+        project.MonthlyTokenLimit = overrides.MonthlyTokenLimit
+    }
+    
+    // Initialize arrays to prevent null values
+    if project.KnowledgeSources == nil {
+        project.KnowledgeSources = []models.KnowledgeSource{}
+    }
+    
+    // Initialize analytics fields
+    project.TotalQuestions = 0
+    project.GeminiUsage = 0
+    project.LastUsed = time.Now()
+}
+
+// userExists reports whether a user with the given ID exists
+func userExists(ctx context.Context, userID primitive.ObjectID) bool {
+    count, err := config.DB.Collection("users").CountDocuments(ctx, bson.M{"_id": userID})
+    return err == nil && count > 0
+}
+
+// projectNameExists reports whether another non-deleted project already uses name (case-insensitive)
+func projectNameExists(ctx context.Context, name string, excludeID primitive.ObjectID) (bool, error) {
+    count, err := config.DB.Collection("projects").CountDocuments(ctx, projectNameFilter(name, excludeID))
+    return count > 0, err
+}
+
+// projectNameFilter matches other live projects named name, ignoring case
+func projectNameFilter(name string, excludeID primitive.ObjectID) bson.M {
+    filter := bson.M{
+        "name":       primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name) + "$", Options: "i"},
+        "deleted_at": bson.M{"$exists": false},
+    }
+    if !excludeID.IsZero() {
+        filter["_id"] = bson.M{"$ne": excludeID}
+    }
+    return filter
+}
+
 func UpdateProject(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -207,28 +488,153 @@ func UpdateProject(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid update data"})
         return
     }
+    delete(updateData, "has_api_key") // derived, not stored
+    expectedVersion, versioned, err := expectedProjectVersion(c, updateData)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if fields := protectedProjectFields(updateData); len(fields) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":  "These fields cannot be updated here",
+            "fields": fields,
+        })
+        return
+    }
+    if len(updateData) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+        return
+    }
     
-    updateData["updated_at"] = time.Now()
+    // owner_id must be stored as an ObjectID for ownership checks to match
+    if owner, ok := updateData["owner_id"]; ok {
+        ownerHex, _ := owner.(string)
+        ownerID, err := primitive.ObjectIDFromHex(ownerHex)
+        if err != nil || !userExists(ctx, ownerID) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Owner not found"})
+            return
+        }
+        updateData["owner_id"] = ownerID
+    }
     
     collection := config.DB.Collection("projects")
-    _, err = collection.UpdateOne(
-        context.Background(),
-        bson.M{"_id": objID},
-        bson.M{"$set": updateData},
+    var existing models.Project
+    if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&existing); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if versioned && existing.Version != expectedVersion {
+        respondProjectVersionConflict(c, existing.Version)
+        return
+    }
+    
+    // Validate the project as it would look after the update
+    candidate, err := applyProjectUpdate(existing, updateData)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid update data", "details": err.Error()})
+        return
+    }
+    if err := candidate.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if _, ok := updateData["gemini_model"]; ok {
+        if err := validateGeminiModel(candidate.GeminiModel); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+    }
+    if name, ok := updateData["name"]; ok && name != existing.Name {
+        exists, err := projectNameExists(ctx, candidate.Name, objID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+            return
+        }
+        if exists {
+            c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A project named %q already exists", candidate.Name)})
+            return
+        }
+    }
+    
+    updateData["updated_at"] = time.Now()
+    
+    // Matching on the version read above makes the check atomic with the write
+    result, err := collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID, "version": versionFilter(existing.Version)},
+        bson.M{"$set": updateData, "$inc": bson.M{"version": 1}},
     )
     
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
         return
     }
+    if result.MatchedCount == 0 {
+        var current models.Project
+        collection.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(bson.M{"version": 1})).Decode(&current)
+        respondProjectVersionConflict(c, current.Version)
+        return
+    }
     
+    c.Header("ETag", projectETag(existing.Version+1))
     c.JSON(http.StatusOK, gin.H{
         "message": "Project updated successfully",
         "project_id": projectID,
+        "version": existing.Version + 1,
+    })
+}
+
+// expectedProjectVersion - The version the client last saw, from an If-Match header
+// ("3" or "\"3\"") or a "version" field in the update, which is removed from it.
+// Reports false when the client sent neither and the update applies unconditionally.
+func expectedProjectVersion(c *gin.Context, updateData bson.M) (int, bool, error) {
+    raw, fromBody := updateData["version"]
+    delete(updateData, "version")
+
+    if header := strings.TrimSpace(c.GetHeader("If-Match")); header != "" && header != "*" {
+        version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+        if err != nil || version < 0 {
+            return 0, false, fmt.Errorf("If-Match must be a project version")
+        }
+        return version, true, nil
+    }
+    if !fromBody {
+        return 0, false, nil
+    }
+    number, ok := raw.(float64)
+    if !ok || number < 0 || number != math.Trunc(number) {
+        return 0, false, fmt.Errorf("version must be a non-negative integer")
+    }
+    return int(number), true, nil
+}
+
+// versionFilter - Matches a stored project version; projects created before versioning have none
+func versionFilter(version int) interface{} {
+    if version == 0 {
+        return bson.M{"$in": bson.A{0, nil}}
+    }
+    return version
+}
+
+// projectETag - The ETag for a project version, usable as If-Match
+func projectETag(version int) string {
+    return fmt.Sprintf(`"%d"`, version)
+}
+
+// respondProjectVersionConflict - 409 for an update based on an outdated version
+func respondProjectVersionConflict(c *gin.Context, current int) {
+    c.Header("ETag", projectETag(current))
+    c.JSON(http.StatusConflict, gin.H{
+        "error":           "Project was modified by someone else; reload it and try again",
+        "current_version": current,
     })
 }
 
+// DeleteProject - Soft delete a project so it can be restored later
 func DeleteProject(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -237,11 +643,22 @@ func DeleteProject(c *gin.Context) {
     }
     
     collection := config.DB.Collection("projects")
-    _, err = collection.DeleteOne(context.Background(), bson.M{"_id": objID})
+    result, err := collection.UpdateOne(ctx,
+        bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}},
+        bson.M{"$set": bson.M{
+            "deleted_at": time.Now(),
+            "is_active":  false,
+            "updated_at": time.Now(),
+        }, "$inc": bson.M{"version": 1}},
+    )
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
         return
     }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
     
     c.JSON(http.StatusOK, gin.H{
         "message": "Project deleted successfully",
@@ -249,57 +666,170 @@ func DeleteProject(c *gin.Context) {
     })
 }
 
-func AdminUsers(c *gin.Context) {
-    // Get all users from database
-    collection := config.DB.Collection("users")
-    cursor, err := collection.Find(context.Background(), bson.M{})
+// RestoreProject - Bring back a soft-deleted project
+func RestoreProject(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
         return
     }
-    
-    var users []models.User
-    cursor.All(context.Background(), &users)
-    
-    // Remove password from response
-    for i := range users {
-        users[i].Password = ""
+
+    collection := config.DB.Collection("projects")
+    result, err := collection.UpdateOne(ctx,
+        bson.M{"_id": objID, "deleted_at": bson.M{"$exists": true}},
+        bson.M{
+            "$set":   bson.M{"is_active": true, "updated_at": time.Now()},
+            "$unset": bson.M{"deleted_at": ""},
+            "$inc":   bson.M{"version": 1},
+        },
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore project"})
+        return
     }
-    
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Deleted project not found"})
+        return
+    }
+
     c.JSON(http.StatusOK, gin.H{
-        "title": "Users - Admin",
-        "users": users,
-        "count": len(users),
+        "message": "Project restored successfully",
+        "project_id": projectID,
     })
-    
-    // Uncomment when you have the template:
-    // c.HTML(http.StatusOK, "admin/users.html", gin.H{
-    //     "title": "Users - Admin",
-    //     "users": users,
-    // })
 }
 
-func AdminAnalytics(c *gin.Context) {
-    analytics := getAnalyticsData()
-    
+// PurgeProject - Permanently delete a project and everything related to it
+func PurgeProject(c *gin.Context) {
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    result, err := config.CascadeDeleteProject(objID)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if err != nil {
+        log.Printf("Failed to purge project %s: %v", projectID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+        return
+    }
+
     c.JSON(http.StatusOK, gin.H{
-        "title": "Analytics - Admin",
-        "analytics": analytics,
+        "message": "Project permanently deleted",
+        "project_id": projectID,
+        "removed": result,
     })
 }
 
-func GetAnalyticsData(c *gin.Context) {
-    analytics := getAnalyticsData()
-    c.JSON(http.StatusOK, gin.H{"data": analytics})
-}
-
+// AdminUsers - List users with pagination, search and filters.
+// Query params: page, limit, search (username/email), role (admin, user) and is_active (true, false).
+func AdminUsers(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    collection := config.DB.Collection("users")
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    filter := bson.M{}
+    if search := strings.TrimSpace(c.Query("search")); search != "" {
+        pattern := primitive.Regex{Pattern: regexp.QuoteMeta(search), Options: "i"}
+        filter["$or"] = []bson.M{
+            {"username": pattern},
+            {"email": pattern},
+        }
+    }
+    if role := c.Query("role"); role != "" {
+        if role != models.RoleAdmin && role != models.RoleUser {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role filter"})
+            return
+        }
+        filter["role"] = role
+    }
+    if value := c.Query("is_active"); value != "" {
+        active, err := strconv.ParseBool(value)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid is_active filter"})
+            return
+        }
+        filter["is_active"] = active
+    }
+
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+        return
+    }
+
+    // Credentials never leave the database
+    opts := options.Find().
+        SetProjection(bson.M{"password": 0, "reset_token_hash": 0, "reset_token_expires": 0}).
+        SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+        return
+    }
+    
+    var users []models.User
+    if err := cursor.All(ctx, &users); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
+        return
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "title": "Users - Admin",
+        "users": models.NewUserResponses(users),
+        "count": len(users),
+        "total": total,
+        "page": page,
+        "limit": limit,
+        "total_pages": (total + int64(limit) - 1) / int64(limit),
+    })
+}
+
+func AdminAnalytics(c *gin.Context) {
+    analytics := getAnalyticsData()
+    
+    c.JSON(http.StatusOK, gin.H{
+        "title": "Analytics - Admin",
+        "analytics": analytics,
+    })
+}
+
+func GetAnalyticsData(c *gin.Context) {
+    analytics := getAnalyticsData()
+    c.JSON(http.StatusOK, gin.H{"data": analytics})
+}
+
 func AdminSettings(c *gin.Context) {
     settings := map[string]interface{}{
         "app_name": "Jevi Chat",
-        "version": "1.0.0",
+        "version": config.GetBuildInfo().Version,
         "maintenance_mode": false,
-        "max_file_size": "10MB",
+        "max_file_size": formatFileSize(config.MaxPDFSize),
+        "max_total_upload": formatFileSize(config.MaxTotalUpload),
         "allowed_file_types": []string{"pdf", "txt", "doc"},
+        "gemini_models": config.SupportedGeminiModels(),
+        "data_retention_days": config.DataRetentionDays,
+        "token_grace_percent": config.TokenGracePercent,
     }
     
     c.JSON(http.StatusOK, gin.H{
@@ -322,6 +852,9 @@ func UpdateSettings(c *gin.Context) {
 }
 
 func GetUserDetails(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     userID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(userID)
     if err != nil {
@@ -331,20 +864,21 @@ func GetUserDetails(c *gin.Context) {
     
     collection := config.DB.Collection("users")
     var user models.User
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
         return
     }
     
-    user.Password = "" // Remove password from response
-    
     c.JSON(http.StatusOK, gin.H{
-        "user": user,
+        "user": models.NewUserResponse(user),
     })
 }
 
 func UpdateUser(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     userID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(userID)
     if err != nil {
@@ -363,7 +897,7 @@ func UpdateUser(c *gin.Context) {
     
     collection := config.DB.Collection("users")
     _, err = collection.UpdateOne(
-        context.Background(),
+        ctx,
         bson.M{"_id": objID},
         bson.M{"$set": updateData},
     )
@@ -373,6 +907,8 @@ func UpdateUser(c *gin.Context) {
         return
     }
     
+    middleware.InvalidateUserStatus(userID)
+    
     c.JSON(http.StatusOK, gin.H{
         "message": "User updated successfully",
         "user_id": userID,
@@ -380,6 +916,9 @@ func UpdateUser(c *gin.Context) {
 }
 
 func DeleteUser(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     userID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(userID)
     if err != nil {
@@ -388,12 +927,14 @@ func DeleteUser(c *gin.Context) {
     }
     
     collection := config.DB.Collection("users")
-    _, err = collection.DeleteOne(context.Background(), bson.M{"_id": objID})
+    _, err = collection.DeleteOne(ctx, bson.M{"_id": objID})
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
         return
     }
     
+    middleware.InvalidateUserStatus(userID)
+    
     c.JSON(http.StatusOK, gin.H{
         "message": "User deleted successfully",
         "user_id": userID,
@@ -401,173 +942,574 @@ func DeleteUser(c *gin.Context) {
 }
 
 func ToggleUserStatus(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     userID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(userID)
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
         return
     }
-    
-    // Get current user status
-    collection := config.DB.Collection("users")
-    var user models.User
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
-    if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+    
+    // Get current user status
+    collection := config.DB.Collection("users")
+    var user models.User
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+    
+    // Toggle status
+    newStatus := !user.IsActive
+    _, err = collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"is_active": newStatus, "updated_at": time.Now()}},
+    )
+    
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle user status"})
+        return
+    }
+    
+    middleware.InvalidateUserStatus(userID)
+    
+    status := "activated"
+    if !newStatus {
+        status = "deactivated"
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "message": "User " + status + " successfully",
+        "user_id": userID,
+        "new_status": newStatus,
+    })
+}
+
+func ToggleProjectStatus(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+    
+    // Get current project status
+    collection := config.DB.Collection("projects")
+    var project models.Project
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    
+    // Toggle status
+    newStatus := !project.IsActive
+    _, err = collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"is_active": newStatus, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+    
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle project status"})
+        return
+    }
+    
+    status := "activated"
+    if !newStatus {
+        status = "deactivated"
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Project " + status + " successfully",
+        "project_id": projectID,
+        "new_status": newStatus,
+    })
+}
+
+// Helper functions
+func getAdminStats() map[string]interface{} {
+    stats := map[string]interface{}{
+        "total_users": 0,
+        "total_projects": 0,
+        "total_messages": 0,
+        "active_users": 0,
+    }
+    
+    // Get user count
+    if userCollection := config.DB.Collection("users"); userCollection != nil {
+        userCount, _ := userCollection.CountDocuments(context.Background(), bson.M{})
+        activeUserCount, _ := userCollection.CountDocuments(context.Background(), bson.M{"is_active": true})
+        stats["total_users"] = userCount
+        stats["active_users"] = activeUserCount
+    }
+    
+    // Get project count
+    if projectCollection := config.DB.Collection("projects"); projectCollection != nil {
+        projectCount, _ := projectCollection.CountDocuments(context.Background(), bson.M{})
+        stats["total_projects"] = projectCount
+    }
+    
+    // Get message count
+    if messageCollection := config.DB.Collection("chat_messages"); messageCollection != nil {
+        messageCount, _ := messageCollection.CountDocuments(context.Background(), bson.M{})
+        stats["total_messages"] = messageCount
+    }
+    
+    return stats
+}
+
+func getAnalyticsData() map[string]interface{} {
+    return map[string]interface{}{
+        "daily_users": 150,
+        "daily_messages": 1200,
+        "response_time": "1.2s",
+        "satisfaction_rate": "94%",
+        "popular_features": []string{"PDF Chat", "Project Management", "User Dashboard"},
+    }
+}
+
+
+func SetGeminiLimit(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        Limit int `json:"limit"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+
+    if input.Limit < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be non-negative"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    _, err = collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"gemini_limit": input.Limit, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Gemini usage limit updated",
+        "limit":   input.Limit,
+    })
+}
+
+// GetPlans - List the subscription plans and their limits
+func GetPlans(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{
+        "plans":        models.Plans,
+        "default_plan": models.DefaultPlanID,
+    })
+}
+
+// SetProjectPlan - Move a project to another plan, replacing all of its limits in one update
+func SetProjectPlan(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        PlanID string `json:"plan_id" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+
+    plan, ok := models.FindPlan(input.PlanID)
+    if !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown plan %q", input.PlanID)})
+        return
+    }
+
+    set := bson.M{"updated_at": time.Now()}
+    for field, value := range plan.LimitFields() {
+        set[field] = value
+    }
+
+    var project models.Project
+    opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+    err = config.DB.Collection("projects").FindOneAndUpdate(
+        ctx,
+        bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}},
+        bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+        opts,
+    ).Decode(&project)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": fmt.Sprintf("Project moved to the %s plan", plan.Name),
+        "plan":    plan,
+        "project": models.NewProjectResponse(project),
+    })
+}
+
+// SetSystemPrompt - Set the custom system prompt used when answering for a project
+func SetSystemPrompt(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        SystemPrompt string `json:"system_prompt"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+
+    input.SystemPrompt = strings.TrimSpace(input.SystemPrompt)
+    if utf8.RuneCountInString(input.SystemPrompt) > models.MaxSystemPromptLength {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":      fmt.Sprintf("System prompt must be at most %d characters", models.MaxSystemPromptLength),
+            "max_length": models.MaxSystemPromptLength,
+        })
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    result, err := collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"system_prompt": input.SystemPrompt, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":       "System prompt updated",
+        "system_prompt": input.SystemPrompt,
+    })
+}
+
+// SetResponseDelay - Configure the artificial pause before a project's replies (0 disables it)
+func SetResponseDelay(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        DelayMs int `json:"delay_ms"`
+    }
+
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+
+    if input.DelayMs < 0 || input.DelayMs > models.MaxResponseDelayMs {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("Delay must be between 0 and %d milliseconds", models.MaxResponseDelayMs),
+        })
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    result, err := collection.UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"response_delay_ms": input.DelayMs, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Response delay updated",
+        "delay_ms": input.DelayMs,
+    })
+}
+
+// SetNotificationSettings - Choose which notification types a project receives, the
+// usage percentage that raises a limit warning, and the delivery channels
+func SetNotificationSettings(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var settings models.NotificationSettings
+    if err := c.ShouldBindJSON(&settings); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+    if err := settings.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    result, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"notification_settings": settings, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":               "Notification settings updated",
+        "notification_settings": settings,
+    })
+}
+
+// SetModerationSettings - Turn inbound message moderation on or off for a project and
+// choose its blocked words, whether they are masked or refused, and Gemini's safety filter
+func SetModerationSettings(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var settings models.ModerationSettings
+    if err := c.ShouldBindJSON(&settings); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+    if err := settings.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    
-    // Toggle status
-    newStatus := !user.IsActive
-    _, err = collection.UpdateOne(
-        context.Background(),
+
+    result, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
         bson.M{"_id": objID},
-        bson.M{"$set": bson.M{"is_active": newStatus, "updated_at": time.Now()}},
+        bson.M{"$set": bson.M{"moderation": settings, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
     )
-    
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle user status"})
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
         return
     }
-    
-    status := "activated"
-    if !newStatus {
-        status = "deactivated"
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
     }
-    
+
     c.JSON(http.StatusOK, gin.H{
-        "message": "User " + status + " successfully",
-        "user_id": userID,
-        "new_status": newStatus,
+        "message":    "Moderation settings updated",
+        "moderation": settings,
     })
 }
 
-func ToggleProjectStatus(c *gin.Context) {
-    projectID := c.Param("id")
-    objID, err := primitive.ObjectIDFromHex(projectID)
+// SetWidgetConfig - Set the colors, bot name, avatar, header text and position of a
+// project's chat widget. Empty fields fall back to the defaults.
+func SetWidgetConfig(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
         return
     }
-    
-    // Get current project status
-    collection := config.DB.Collection("projects")
-    var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
-    if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+
+    var widget models.WidgetConfig
+    if err := c.ShouldBindJSON(&widget); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
         return
     }
-    
-    // Toggle status
-    newStatus := !project.IsActive
-    _, err = collection.UpdateOne(
-        context.Background(),
+    widget.PrimaryColor = strings.TrimSpace(widget.PrimaryColor)
+    widget.BotName = strings.TrimSpace(widget.BotName)
+    widget.AvatarURL = strings.TrimSpace(widget.AvatarURL)
+    widget.HeaderText = strings.TrimSpace(widget.HeaderText)
+    if err := widget.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    result, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
         bson.M{"_id": objID},
-        bson.M{"$set": bson.M{"is_active": newStatus, "updated_at": time.Now()}},
+        bson.M{"$set": bson.M{"widget_config": widget, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
     )
-    
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle project status"})
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
         return
     }
-    
-    status := "activated"
-    if !newStatus {
-        status = "deactivated"
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
     }
-    
+
     c.JSON(http.StatusOK, gin.H{
-        "message": "Project " + status + " successfully",
-        "project_id": projectID,
-        "new_status": newStatus,
+        "message":       "Widget settings updated",
+        "widget_config": widget,
     })
 }
 
-// Helper functions
-func getAdminStats() map[string]interface{} {
-    stats := map[string]interface{}{
-        "total_users": 0,
-        "total_projects": 0,
-        "total_messages": 0,
-        "active_users": 0,
-    }
-    
-    // Get user count
-    if userCollection := config.DB.Collection("users"); userCollection != nil {
-        userCount, _ := userCollection.CountDocuments(context.Background(), bson.M{})
-        activeUserCount, _ := userCollection.CountDocuments(context.Background(), bson.M{"is_active": true})
-        stats["total_users"] = userCount
-        stats["active_users"] = activeUserCount
+// SetRegistrationSettings - Cap how many chat users can register for a project and
+// whether they must confirm their email first
+func SetRegistrationSettings(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
     }
-    
-    // Get project count
-    if projectCollection := config.DB.Collection("projects"); projectCollection != nil {
-        projectCount, _ := projectCollection.CountDocuments(context.Background(), bson.M{})
-        stats["total_projects"] = projectCount
+
+    var settings models.RegistrationSettings
+    if err := c.ShouldBindJSON(&settings); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
     }
-    
-    // Get message count
-    if messageCollection := config.DB.Collection("chat_messages"); messageCollection != nil {
-        messageCount, _ := messageCollection.CountDocuments(context.Background(), bson.M{})
-        stats["total_messages"] = messageCount
+    if err := settings.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
     }
-    
-    return stats
-}
 
-func getAnalyticsData() map[string]interface{} {
-    return map[string]interface{}{
-        "daily_users": 150,
-        "daily_messages": 1200,
-        "response_time": "1.2s",
-        "satisfaction_rate": "94%",
-        "popular_features": []string{"PDF Chat", "Project Management", "User Dashboard"},
+    result, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"registration": settings, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
     }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":      "Registration settings updated",
+        "registration": settings,
+    })
 }
 
+// SetSafetySettings - Set how readily Gemini blocks each harm category for a project.
+// An empty list restores Gemini's defaults.
+func SetSafetySettings(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
 
-func SetGeminiLimit(c *gin.Context) {
-    projectID := c.Param("id")
-    objID, err := primitive.ObjectIDFromHex(projectID)
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
     if err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
         return
     }
 
     var input struct {
-        Limit int `json:"limit"`
+        SafetySettings []models.SafetySetting `json:"safety_settings"`
     }
-
     if err := c.ShouldBindJSON(&input); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
         return
     }
-
-    if input.Limit < 0 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Limit must be non-negative"})
+    if err := models.ValidateSafetySettings(input.SafetySettings); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":      err.Error(),
+            "categories": models.SafetyCategories,
+            "thresholds": models.SafetyThresholds,
+        })
         return
     }
+    if input.SafetySettings == nil {
+        input.SafetySettings = []models.SafetySetting{}
+    }
 
-    collection := config.DB.Collection("projects")
-    _, err = collection.UpdateOne(
-        context.Background(),
+    result, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
         bson.M{"_id": objID},
-        bson.M{"$set": bson.M{"gemini_limit": input.Limit, "updated_at": time.Now()}},
+        bson.M{"$set": bson.M{"safety_settings": input.SafetySettings, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
     )
-
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
         return
     }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
 
     c.JSON(http.StatusOK, gin.H{
-        "message": "Gemini usage limit updated",
-        "limit":   input.Limit,
+        "message":         "Safety settings updated",
+        "safety_settings": input.SafetySettings,
     })
 }
 
 func ResetGeminiUsage(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -577,9 +1519,9 @@ func ResetGeminiUsage(c *gin.Context) {
 
     collection := config.DB.Collection("projects")
     _, err = collection.UpdateOne(
-        context.Background(),
+        ctx,
         bson.M{"_id": objID},
-        bson.M{"$set": bson.M{"gemini_usage": 0, "updated_at": time.Now()}},
+        bson.M{"$set": bson.M{"gemini_usage": 0, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}},
     )
 
     if err != nil {
@@ -592,104 +1534,300 @@ func ResetGeminiUsage(c *gin.Context) {
 
 
 
-// GetNotifications handles GET /api/admin/notifications
+// GetNotifications - List stored notifications, newest first, with the number still
+// unread. Optional filters: project_id and unread=true.
 func GetNotifications(c *gin.Context) {
-    // Sample notifications - replace with your database logic
-    notifications := []map[string]interface{}{
-        {
-            "id":         1,
-            "type":       "success",
-            "message":    "System backup completed successfully",
-            "time":       "2 min ago",
-            "created_at": time.Now().Add(-2 * time.Minute),
-        },
-        {
-            "id":         2,
-            "type":       "info",
-            "message":    "New user registered",
-            "time":       "5 min ago",
-            "created_at": time.Now().Add(-5 * time.Minute),
-        },
-        {
-            "id":         3,
-            "type":       "warning",
-            "message":    "High API usage detected",
-            "time":       "1 hour ago",
-            "created_at": time.Now().Add(-1 * time.Hour),
-        },
-        {
-            "id":         4,
-            "type":       "success",
-            "message":    "New project created successfully",
-            "time":       "3 hours ago",
-            "created_at": time.Now().Add(-3 * time.Hour),
-        },
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    filter := bson.M{}
+    if projectID := c.Query("project_id"); projectID != "" {
+        objID, err := primitive.ObjectIDFromHex(projectID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+            return
+        }
+        filter["project_id"] = objID
+    }
+
+    collection := config.DB.Collection("notifications")
+    unreadFilter := bson.M{"read": bson.M{"$ne": true}}
+    for key, value := range filter {
+        unreadFilter[key] = value
+    }
+    unreadCount, err := collection.CountDocuments(ctx, unreadFilter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+        return
+    }
+    if c.Query("unread") == "true" {
+        filter = unreadFilter
+    }
+
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+        return
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "created_at", Value: -1}}).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+        return
+    }
+
+    var notifications []models.Notification
+    if err := cursor.All(ctx, &notifications); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse notifications"})
+        return
+    }
+    if notifications == nil {
+        notifications = []models.Notification{}
     }
 
     c.JSON(http.StatusOK, gin.H{
         "success":       true,
         "notifications": notifications,
+        "unread_count":  unreadCount,
+        "total":         total,
+        "page":          page,
+        "limit":         limit,
+        "total_pages":   (total + int64(limit) - 1) / int64(limit),
+    })
+}
+
+// MarkNotificationRead - Mark one notification as read
+func MarkNotificationRead(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+        return
+    }
+
+    // read_at keeps the first time it was read
+    result, err := config.DB.Collection("notifications").UpdateOne(ctx,
+        bson.M{"_id": objID},
+        bson.A{bson.M{"$set": bson.M{
+            "read":    true,
+            "read_at": bson.M{"$ifNull": bson.A{"$read_at", time.Now()}},
+        }}},
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"success": true, "message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead - Mark every unread notification as read, optionally only a project's
+func MarkAllNotificationsRead(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    filter := bson.M{"read": bson.M{"$ne": true}}
+    if projectID := c.Query("project_id"); projectID != "" {
+        objID, err := primitive.ObjectIDFromHex(projectID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+            return
+        }
+        filter["project_id"] = objID
+    }
+
+    result, err := config.DB.Collection("notifications").UpdateMany(ctx, filter,
+        bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":     true,
+        "marked_read": result.ModifiedCount,
     })
 }
 
+// Windows used by the realtime stats
+const (
+    activeSessionWindow = 5 * time.Minute
+    messageRateWindow   = time.Minute
+)
+
 // GetRealtimeStats handles GET /api/admin/realtime-stats
 func GetRealtimeStats(c *gin.Context) {
-    // Generate real-time statistics
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    now := time.Now()
+    activeUsers, err := getCurrentActiveUsers(ctx, now)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch active users"})
+        return
+    }
+    messagesPerMinute, err := getMessagesPerMinute(ctx, now)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message rate"})
+        return
+    }
+
     stats := map[string]interface{}{
-        "activeUsers":       getCurrentActiveUsers(),
-        "messagesPerMinute": getMessagesPerMinute(),
-        "serverLoad":        getServerLoad(),
+        "activeUsers":       activeUsers,
+        "messagesPerMinute": messagesPerMinute,
         "apiCalls":          getAPICallsCount(),
-        "timestamp":         time.Now(),
+        "runtime":           getRuntimeStats(),
+        "timestamp":         now,
     }
 
     c.JSON(http.StatusOK, stats)
 }
 
-// Helper functions for real-time stats
-func getCurrentActiveUsers() int {
-    // Query your database for active users
-    collection := config.GetCollection("users")
-    count, err := collection.CountDocuments(context.TODO(), bson.M{
-        "is_active": true,
-        "last_active": bson.M{"$gte": time.Now().Add(-5 * time.Minute)},
+// getCurrentActiveUsers counts chat sessions that exchanged a message recently.
+// Messages saved without a session ID can't be attributed and are left out.
+func getCurrentActiveUsers(ctx context.Context, now time.Time) (int, error) {
+    sessions, err := config.DB.Collection("chat_messages").Distinct(ctx, "session_id", bson.M{
+        "timestamp":  bson.M{"$gte": now.Add(-activeSessionWindow)},
+        "session_id": bson.M{"$nin": bson.A{"", nil}},
     })
-    
     if err != nil {
-        // Return sample data if database query fails
-        return rand.Intn(50) + 25
+        return 0, err
     }
-    
-    return int(count)
+    return len(sessions), nil
 }
 
-func getMessagesPerMinute() int {
-    // Calculate messages per minute from your chat system
-    collection := config.GetCollection("messages")
-    count, err := collection.CountDocuments(context.TODO(), bson.M{
-        "created_at": bson.M{"$gte": time.Now().Add(-1 * time.Minute)},
+// getMessagesPerMinute counts chat messages over the last messageRateWindow, scaled to a minute
+func getMessagesPerMinute(ctx context.Context, now time.Time) (float64, error) {
+    count, err := config.DB.Collection("chat_messages").CountDocuments(ctx, bson.M{
+        "timestamp": bson.M{"$gte": now.Add(-messageRateWindow)},
     })
-    
     if err != nil {
-        return rand.Intn(30) + 5
+        return 0, err
     }
-    
-    return int(count)
+    return messageRate(count, messageRateWindow), nil
+}
+
+// messageRate converts a message count over window into messages per minute
+func messageRate(count int64, window time.Duration) float64 {
+    if window <= 0 {
+        return 0
+    }
+    return math.Round(float64(count)/window.Minutes()*100) / 100
 }
 
-func getServerLoad() int {
-    // Get server load percentage (0-100)
-    // You can implement actual system monitoring here
-    return rand.Intn(100)
+// getAPICallsCount returns the requests served since startup, as counted by MetricsMiddleware
+func getAPICallsCount() int64 {
+    return int64(utils.CounterTotal(utils.HTTPRequestsTotal))
 }
 
-func getAPICallsCount() int {
-    // Count API calls - you might want to implement request logging
-    return rand.Intn(1000) + 200
+// getRuntimeStats reports the server process's goroutines and memory use
+func getRuntimeStats() gin.H {
+    var mem runtime.MemStats
+    runtime.ReadMemStats(&mem)
+
+    const mb = 1024 * 1024
+    return gin.H{
+        "goroutines":  runtime.NumGoroutine(),
+        "heapAllocMB": math.Round(float64(mem.HeapAlloc)/mb*100) / 100,
+        "sysMB":       math.Round(float64(mem.Sys)/mb*100) / 100,
+        "gcCycles":    mem.NumGC,
+    }
+}
+
+// validateGeminiKey checks a new API key against Gemini; replaceable for tests
+var validateGeminiKey = config.ValidateGeminiKey
+
+// RotateGeminiKey - Replace a project's Gemini API key. The new key is only stored
+// after Gemini accepts it.
+func RotateGeminiKey(c *gin.Context) {
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        GeminiAPIKey string `json:"gemini_api_key"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+    input.GeminiAPIKey = strings.TrimSpace(input.GeminiAPIKey)
+    if input.GeminiAPIKey == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Gemini API key is required"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    ctx, cancel := requestContext(c)
+    count, err := collection.CountDocuments(ctx, bson.M{"_id": objID})
+    cancel()
+    if err != nil || count == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    validateCtx, validateCancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+    err = validateGeminiKey(validateCtx, input.GeminiAPIKey)
+    validateCancel()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "Gemini rejected the API key",
+            "details": err.Error(),
+        })
+        return
+    }
+
+    encrypted, err := encryptAPIKey(input.GeminiAPIKey)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure API key"})
+        return
+    }
+
+    ctx, cancel = requestContext(c)
+    defer cancel()
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+        "$set": bson.M{"gemini_api_key": encrypted, "updated_at": time.Now()},
+        "$inc": bson.M{"version": 1},
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":     true,
+        "message":     "Gemini API key updated",
+        "has_api_key": true,
+    })
 }
 
 // Enhanced ToggleGeminiStatus with usage validation
 func ToggleGeminiStatus(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -710,7 +1848,7 @@ func ToggleGeminiStatus(c *gin.Context) {
     
     // Get current project
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -731,9 +1869,10 @@ func ToggleGeminiStatus(c *gin.Context) {
             "gemini_enabled": input.Enabled,
             "updated_at":     time.Now(),
         },
+        "$inc": bson.M{"version": 1},
     }
 
-    _, err = collection.UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
         return
@@ -759,6 +1898,9 @@ func ToggleGeminiStatus(c *gin.Context) {
 
 // Enhanced GetGeminiAnalytics with detailed tracking
 func GetGeminiAnalytics(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -769,7 +1911,7 @@ func GetGeminiAnalytics(c *gin.Context) {
     // Get project details
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -780,7 +1922,7 @@ func GetGeminiAnalytics(c *gin.Context) {
     
     // Get today's successful requests
     today := time.Now().Truncate(24 * time.Hour)
-    todayCount, _ := logsCollection.CountDocuments(context.Background(), bson.M{
+    todayCount, _ := logsCollection.CountDocuments(ctx, bson.M{
         "project_id": objID,
         "timestamp": bson.M{"$gte": today},
         "success": true,
@@ -788,7 +1930,7 @@ func GetGeminiAnalytics(c *gin.Context) {
 
     // Get this month's successful requests
     thisMonth := time.Date(time.Now().Year(), time.Now().Month(), 1, 0, 0, 0, 0, time.UTC)
-    monthCount, _ := logsCollection.CountDocuments(context.Background(), bson.M{
+    monthCount, _ := logsCollection.CountDocuments(ctx, bson.M{
         "project_id": objID,
         "timestamp": bson.M{"$gte": thisMonth},
         "success": true,
@@ -825,18 +1967,17 @@ func GetGeminiAnalytics(c *gin.Context) {
     })
 }
 
-// Add usage tracking helper function
+// Add usage tracking helper function. genErr is the generation error, nil on success.
 func trackGeminiUsage(projectID primitive.ObjectID, question, response, model string, 
-                     inputTokens, outputTokens int, responseTime int64, userIP string, success bool) {
+                     inputTokens, outputTokens int, responseTime int64, userIP string, genErr error, reservedCost float64) {
+    success := genErr == nil
     
-    // Calculate cost (simplified pricing)
-    var costPer1K float64 = 0.000075 // Gemini Flash pricing
-    if model == "gemini-1.5-pro" {
-        costPer1K = 0.00125
-    }
+    // Calculate cost from the actual input/output split
+    estimatedCost := calculateGeminiCost(model, inputTokens, outputTokens)
     
-    totalTokens := inputTokens + outputTokens
-    estimatedCost := (float64(totalTokens) / 1000.0) * costPer1K
+    utils.GeminiRequestsTotal.WithLabelValues(model, strconv.FormatBool(success)).Inc()
+    utils.GeminiTokensTotal.WithLabelValues(model, "input").Add(float64(inputTokens))
+    utils.GeminiTokensTotal.WithLabelValues(model, "output").Add(float64(outputTokens))
     
     // Save usage log
     usageLog := models.GeminiUsageLog{
@@ -852,20 +1993,27 @@ func trackGeminiUsage(projectID primitive.ObjectID, question, response, model st
         Timestamp:     time.Now(),
         Success:       success,
     }
+    if genErr != nil {
+        usageLog.Error = genErr.Error()
+        usageLog.BlockedBySafety = isBlockedBySafety(genErr)
+        usageLog.BlockReason = safetyBlockReason(genErr)
+    }
     
     logCollection := config.DB.Collection("gemini_usage_logs")
     logCollection.InsertOne(context.Background(), usageLog)
     
-    // Update project counters if successful
+    // Update project counters if successful; the daily and monthly request counts and
+    // reservedCost were already taken by reserveGeminiUsage, so the spend moves by the
+    // difference to the real cost
     if success {
         projectCollection := config.DB.Collection("projects")
         update := bson.M{
             "$inc": bson.M{
-                "gemini_usage_today": 1,
-                "gemini_usage_month": 1,
                 "total_questions": 1,
-                "estimated_cost_today": estimatedCost,
-                "estimated_cost_month": estimatedCost,
+                "total_tokens_used": inputTokens + outputTokens,
+                "tokens_used_month": inputTokens + outputTokens,
+                "estimated_cost_today": estimatedCost - reservedCost,
+                "estimated_cost_month": estimatedCost - reservedCost,
             },
             "$set": bson.M{
                 "last_used": time.Now(),
@@ -873,5 +2021,13 @@ func trackGeminiUsage(projectID primitive.ObjectID, question, response, model st
             },
         }
         projectCollection.UpdateOne(context.Background(), bson.M{"_id": projectID}, update)
+        
+        // Note when this request carried the project past its token limit into the grace allowance
+        projectCollection.UpdateOne(context.Background(), bson.M{
+            "_id":                    projectID,
+            "monthly_token_limit":    bson.M{"$gt": 0},
+            "token_grace_started_at": bson.M{"$exists": false},
+            "$expr":                  bson.M{"$gte": bson.A{"$tokens_used_month", "$monthly_token_limit"}},
+        }, bson.M{"$set": bson.M{"token_grace_started_at": time.Now()}})
     }
 }
\ No newline at end of file
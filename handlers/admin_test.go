@@ -0,0 +1,708 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestSetResponseDelayRejectsOutOfRange(t *testing.T) {
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/delay"
+    for _, delay := range []int{-1, models.MaxResponseDelayMs + 1} {
+        body := fmt.Sprintf(`{"delay_ms":%d}`, delay)
+        if w := serveRoute(http.MethodPut, "/projects/:id/delay", path, SetResponseDelay, body); w.Code != http.StatusBadRequest {
+            t.Errorf("delay %d: status = %d, want 400", delay, w.Code)
+        }
+    }
+}
+
+func TestApplyResponseDelay(t *testing.T) {
+    start := time.Now()
+    applyResponseDelay(models.Project{ResponseDelayMs: 0})
+    if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+        t.Errorf("a zero delay paused for %v", elapsed)
+    }
+
+    start = time.Now()
+    applyResponseDelay(models.Project{ResponseDelayMs: 30})
+    if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+        t.Errorf("a 30ms delay paused for only %v", elapsed)
+    }
+}
+
+func TestProjectListFilter(t *testing.T) {
+    filter, err := projectListFilter("  a.b (test)  ", "active")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if filter["is_active"] != true {
+        t.Errorf("is_active = %v, want true", filter["is_active"])
+    }
+    if _, ok := filter["deleted_at"]; !ok {
+        t.Error("soft-deleted projects must be excluded")
+    }
+    match := filter["$or"].([]bson.M)[0]["name"].(primitive.Regex)
+    if match.Pattern != `a\.b \(test\)` || match.Options != "i" {
+        t.Errorf("search pattern = %+v, want the escaped, case-insensitive search", match)
+    }
+
+    expired, _ := projectListFilter("", models.ProjectStatusExpired)
+    if expired["status"] != models.ProjectStatusExpired || expired["$or"] != nil {
+        t.Errorf("expired filter = %v", expired)
+    }
+    if _, err := projectListFilter("", "archived"); err == nil {
+        t.Error("an unknown status was accepted")
+    }
+}
+
+func TestProjectListSort(t *testing.T) {
+    sortOrder, err := projectListSort("name", "asc")
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}
+    if fmt.Sprint(sortOrder) != fmt.Sprint(want) {
+        t.Errorf("sort = %v, want %v", sortOrder, want)
+    }
+    if sortOrder, _ := projectListSort("created_at", ""); sortOrder[0].Value != -1 {
+        t.Errorf("default order = %v, want descending", sortOrder)
+    }
+    if _, err := projectListSort("password", "asc"); err == nil {
+        t.Error("an unknown sort field was accepted")
+    }
+}
+
+// listProjectNames runs AdminProjects with query and returns the listed names in order
+func listProjectNames(t *testing.T, query string) []string {
+    t.Helper()
+    w := serveRoute(http.MethodGet, "/projects", "/projects?"+query, AdminProjects, "")
+    var body struct {
+        Projects []models.ProjectResponse `json:"projects"`
+        Total    int64                    `json:"total"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("AdminProjects?%s = %d %s", query, w.Code, w.Body)
+    }
+    names := make([]string, len(body.Projects))
+    for i, project := range body.Projects {
+        names[i] = project.Name
+    }
+    if body.Total != int64(len(names)) {
+        t.Errorf("%s: total = %d, want %d", query, body.Total, len(names))
+    }
+    return names
+}
+
+func TestAdminProjectsSearchAndSort(t *testing.T) {
+    testDatabase(t)
+    now := time.Now()
+    projects := []interface{}{
+        models.Project{ID: primitive.NewObjectID(), Name: "Billing Bot", Description: "Invoices", IsActive: true, TotalTokensUsed: 300, CreatedAt: now.Add(-3 * time.Hour)},
+        models.Project{ID: primitive.NewObjectID(), Name: "acme support", Description: "Help desk", IsActive: true, TotalTokensUsed: 100, CreatedAt: now.Add(-2 * time.Hour)},
+        models.Project{ID: primitive.NewObjectID(), Name: "Sales", Description: "Leads for ACME", IsActive: false, TotalTokensUsed: 200, CreatedAt: now.Add(-time.Hour)},
+        models.Project{ID: primitive.NewObjectID(), Name: "Acme Archive", IsActive: true, CreatedAt: now, DeletedAt: now},
+    }
+    if _, err := config.DB.Collection("projects").InsertMany(context.Background(), projects); err != nil {
+        t.Fatal(err)
+    }
+
+    cases := []struct {
+        query string
+        want  string
+    }{
+        {"", "Sales,acme support,Billing Bot"},
+        {"sort=name&order=asc", "Billing Bot,Sales,acme support"},
+        {"sort=total_tokens_used&order=desc", "Billing Bot,Sales,acme support"},
+        // Search matches the name or the description, ignoring case; deleted projects never show
+        {"search=acme", "Sales,acme support"},
+        {"search=ACME&sort=name&order=asc", "Sales,acme support"},
+        {"search=invoice", "Billing Bot"},
+        {"search=acme&status=active", "acme support"},
+        {"status=inactive", "Sales"},
+        {"search=a.c", ""},
+    }
+    for _, tc := range cases {
+        if got := strings.Join(listProjectNames(t, tc.query), ","); got != tc.want {
+            t.Errorf("%q: projects = %s, want %s", tc.query, got, tc.want)
+        }
+    }
+}
+
+func TestProjectNameFilter(t *testing.T) {
+    filter := projectNameFilter("Acme (EU)", primitive.NilObjectID)
+    if _, ok := filter["_id"]; ok {
+        t.Error("a new project shouldn't exclude any ID")
+    }
+
+    // The stored pattern must match the same name in any case, and nothing else
+    pattern := regexp.MustCompile("(?i)" + filter["name"].(primitive.Regex).Pattern)
+    for name, want := range map[string]bool{
+        "Acme (EU)":     true,
+        "ACME (eu)":     true,
+        "Acme EU":       false,
+        "Acme (EU) Ltd": false,
+        "The Acme (EU)": false,
+    } {
+        if pattern.MatchString(name) != want {
+            t.Errorf("%q matched = %v, want %v", name, !want, want)
+        }
+    }
+
+    self := primitive.NewObjectID()
+    if got := projectNameFilter("Acme", self)["_id"]; fmt.Sprint(got) != fmt.Sprint(bson.M{"$ne": self}) {
+        t.Errorf("_id filter = %v, want the project itself excluded", got)
+    }
+}
+
+func TestApplyProjectUpdate(t *testing.T) {
+    existing := models.Project{Name: "Support", GeminiAPIKey: "key", GeminiLimit: 100}
+
+    candidate, err := applyProjectUpdate(existing, bson.M{"gemini_limit": 0})
+    if err != nil {
+        t.Fatalf("applyProjectUpdate: %v", err)
+    }
+    if candidate.Validate() == nil {
+        t.Error("zeroing the usage limit must fail validation")
+    }
+    if candidate.GeminiAPIKey != "key" {
+        t.Error("the API key must carry over from the stored project")
+    }
+    if candidate.Name != "Support" {
+        t.Errorf("Name = %q, fields not in the update must keep their stored value", candidate.Name)
+    }
+
+    candidate, err = applyProjectUpdate(existing, bson.M{"name": "Sales"})
+    if err != nil || candidate.Validate() != nil {
+        t.Fatalf("renaming: err = %v, validate = %v", err, candidate.Validate())
+    }
+    if candidate.Name != "Sales" || existing.Name != "Support" {
+        t.Errorf("Name = %q, stored = %q; the update must apply to a copy", candidate.Name, existing.Name)
+    }
+
+    if _, err := applyProjectUpdate(existing, bson.M{"gemini_limit": "lots"}); err == nil {
+        t.Error("a wrongly typed field must be rejected")
+    }
+}
+
+func TestRotateGeminiKeyRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/gemini/key"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/gemini/key"
+    cases := []struct {
+        name, path, body string
+    }{
+        {"invalid project", "/projects/bad/gemini/key", `{"gemini_api_key":"AIza-new"}`},
+        {"blank key", path, `{"gemini_api_key":"   "}`},
+        {"malformed body", path, `{`},
+    }
+    for _, tc := range cases {
+        // Rejected before the project is looked up or the key is sent to Gemini
+        if w := serveRoute(http.MethodPut, route, tc.path, RotateGeminiKey, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+func TestAPIKeyEncryptionRoundTrip(t *testing.T) {
+    t.Setenv("ENCRYPTION_KEY", "")
+    if stored, err := encryptAPIKey("AIza-new"); err != nil || stored != "AIza-new" {
+        t.Errorf("without a key: stored = %q, err = %v; want plaintext", stored, err)
+    }
+
+    t.Setenv("ENCRYPTION_KEY", strings.Repeat("k", 32))
+    stored, err := encryptAPIKey("AIza-new")
+    if err != nil || stored == "AIza-new" {
+        t.Fatalf("stored = %q, err = %v; want an encrypted key", stored, err)
+    }
+    if key := decryptAPIKey(stored); key != "AIza-new" {
+        t.Errorf("decryptAPIKey = %q, want the rotated key", key)
+    }
+}
+
+func TestValidateGeminiModel(t *testing.T) {
+    t.Setenv("GEMINI_MODELS", "")
+    if err := validateGeminiModel("gemini-2.5-flash"); err != nil {
+        t.Errorf("gemini-2.5-flash: %v", err)
+    }
+    if err := validateGeminiModel(""); err != nil {
+        t.Errorf("empty model should fall back to the default: %v", err)
+    }
+    err := validateGeminiModel("gemini-ultra")
+    if err == nil || !strings.Contains(err.Error(), "gemini-2.5-pro") {
+        t.Errorf("err = %v, want it to list the supported models", err)
+    }
+
+    if model := getGeminiModel("gemini-ultra"); model != models.DefaultGeminiModel {
+        t.Errorf("getGeminiModel = %q, want the default for unsupported models", model)
+    }
+}
+
+func TestMessageRate(t *testing.T) {
+    cases := []struct {
+        count  int64
+        window time.Duration
+        want   float64
+    }{
+        {12, time.Minute, 12},
+        {12, 5 * time.Minute, 2.4},
+        {1, 3 * time.Minute, 0.33},
+        {0, time.Minute, 0},
+        {5, 0, 0},
+    }
+    for _, tc := range cases {
+        if got := messageRate(tc.count, tc.window); got != tc.want {
+            t.Errorf("messageRate(%d, %v) = %v, want %v", tc.count, tc.window, got, tc.want)
+        }
+    }
+}
+
+func TestRealtimeStatsFromMessages(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    projectID := primitive.NewObjectID()
+    messages := []interface{}{
+        models.ChatMessage{ProjectID: projectID, SessionID: "a", Timestamp: now.Add(-30 * time.Second)},
+        models.ChatMessage{ProjectID: projectID, SessionID: "a", Timestamp: now.Add(-2 * time.Minute)},
+        models.ChatMessage{ProjectID: projectID, SessionID: "b", Timestamp: now.Add(-4 * time.Minute)},
+        // Sessionless messages count towards the rate but not the active users
+        models.ChatMessage{ProjectID: projectID, Timestamp: now.Add(-10 * time.Second)},
+        // Outside both windows
+        models.ChatMessage{ProjectID: projectID, SessionID: "c", Timestamp: now.Add(-time.Hour)},
+    }
+    if _, err := config.DB.Collection("chat_messages").InsertMany(ctx, messages); err != nil {
+        t.Fatalf("insert messages: %v", err)
+    }
+
+    if active, err := getCurrentActiveUsers(ctx, now); err != nil || active != 2 {
+        t.Errorf("active users = %d, err = %v; want 2", active, err)
+    }
+    if rate, err := getMessagesPerMinute(ctx, now); err != nil || rate != 2 {
+        t.Errorf("messages per minute = %v, err = %v; want 2", rate, err)
+    }
+}
+
+func TestSetNotificationSettingsRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/notifications/settings"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/notifications/settings"
+    cases := []struct {
+        name string
+        path string
+        body string
+    }{
+        {"invalid project ID", "/projects/not-an-id/notifications/settings", `{}`},
+        {"unknown type", path, `{"disabled_types":["daily_digest"]}`},
+        {"unknown channel", path, `{"channels":["sms"]}`},
+        {"threshold out of range", path, `{"warning_threshold":150}`},
+    }
+    for _, tc := range cases {
+        // Rejected before the project is updated
+        if w := serveRoute(http.MethodPut, route, tc.path, SetNotificationSettings, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+func TestCreateProjectWithKnownExternalID(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("ENCRYPTION_KEY", "")
+    t.Setenv("GEMINI_MODELS", "")
+
+    create := func(name string) (int, models.ProjectResponse, bool) {
+        body := `{"name":"` + name + `","gemini_api_key":"key","external_id":" crm-42 "}`
+        w := serveRoute(http.MethodPost, "/projects", "/projects", CreateProject, body)
+        var response struct {
+            Project  models.ProjectResponse `json:"project"`
+            Existing bool                   `json:"existing"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &response)
+        return w.Code, response.Project, response.Existing
+    }
+
+    code, first, existing := create("Acme")
+    if code != http.StatusCreated || existing || first.ExternalID != "crm-42" {
+        t.Fatalf("first create = %d, existing = %v, external ID = %q; want 201 with the trimmed ID", code, existing, first.ExternalID)
+    }
+
+    // A retry, even with a different name, returns the first project rather than a conflict
+    code, second, existing := create("Acme retry")
+    if code != http.StatusOK || !existing || second.ID != first.ID {
+        t.Errorf("retry = %d, existing = %v, ID = %s; want 200 with project %s", code, existing, second.ID.Hex(), first.ID.Hex())
+    }
+    count, _ := config.DB.Collection("projects").CountDocuments(context.Background(), bson.M{})
+    if count != 1 {
+        t.Errorf("%d projects stored, want 1", count)
+    }
+}
+
+func TestClearServerOwnedFields(t *testing.T) {
+    now := time.Now()
+    project := models.Project{
+        Name:                "Support",
+        SystemPrompt:        "Be brief",
+        RetentionDays:       30,
+        KnowledgeSources:    []models.KnowledgeSource{{ID: "s", Name: "faq.txt", Content: "injected", Status: models.PDFStatusCompleted}},
+        PDFContent:          "injected",
+        GeminiUsage:         5,
+        GeminiUsageMonth:    5,
+        EstimatedCostMonth:  12.5,
+        TokensUsedMonth:     900,
+        TokenGraceStartedAt: now,
+        DeletedAt:           now,
+        TotalTokensUsed:     900,
+        ChatUserCount:       3,
+    }
+    clearServerOwnedFields(&project)
+
+    if project.KnowledgeSources != nil || project.PDFContent != "" || project.GeminiUsage != 0 ||
+        project.GeminiUsageMonth != 0 || project.EstimatedCostMonth != 0 || project.TokensUsedMonth != 0 ||
+        !project.TokenGraceStartedAt.IsZero() || !project.DeletedAt.IsZero() || project.TotalTokensUsed != 0 ||
+        project.ChatUserCount != 0 {
+        t.Errorf("project = %+v, want server-owned fields cleared", project)
+    }
+    if project.Name != "Support" || project.SystemPrompt != "Be brief" || project.RetentionDays != 30 {
+        t.Errorf("project = %+v, want the configuration kept", project)
+    }
+}
+
+func TestCreateProjectIgnoresServerFields(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("ENCRYPTION_KEY", "")
+    t.Setenv("GEMINI_MODELS", "")
+
+    body := `{"name":"Acme","gemini_api_key":"key","retention_days":30,` +
+        `"gemini_usage_month":50,"estimated_cost_month":99.5,"total_tokens_used":1000,` +
+        `"deleted_at":"2026-01-01T00:00:00Z","token_grace_started_at":"2026-01-01T00:00:00Z",` +
+        `"pdf_content":"injected","knowledge_sources":[{"id":"x","name":"faq.txt","content":"injected","status":"completed","enabled":true}]}`
+    w := serveRoute(http.MethodPost, "/projects", "/projects", CreateProject, body)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("CreateProject = %d %s", w.Code, w.Body)
+    }
+
+    var stored models.Project
+    if err := config.DB.Collection("projects").FindOne(context.Background(), bson.M{"name": "Acme"}).Decode(&stored); err != nil {
+        t.Fatal(err)
+    }
+    if len(stored.KnowledgeSources) != 0 || stored.PDFContent != "" || stored.GeminiUsageMonth != 0 ||
+        stored.EstimatedCostMonth != 0 || stored.TotalTokensUsed != 0 || !stored.DeletedAt.IsZero() ||
+        !stored.TokenGraceStartedAt.IsZero() {
+        t.Errorf("stored = %+v, want server-owned fields ignored", stored)
+    }
+    if stored.RetentionDays != 30 {
+        t.Errorf("retention days = %d, want the requested 30", stored.RetentionDays)
+    }
+}
+
+func TestProjectResponsesHideAPIKey(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("ENCRYPTION_KEY", "")
+    t.Setenv("GEMINI_MODELS", "")
+
+    w := serveRoute(http.MethodPost, "/projects", "/projects", CreateProject, `{"name":"Acme","gemini_api_key":"secret-key"}`)
+    var created struct {
+        Project models.ProjectResponse `json:"project"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+        t.Fatalf("CreateProject = %d %s", w.Code, w.Body)
+    }
+    path := "/projects/" + created.Project.ID.Hex()
+
+    responses := []struct {
+        name       string
+        w          *httptest.ResponseRecorder
+        hasKeyFlag bool
+    }{
+        {"CreateProject", w, true},
+        {"AdminProjects", serveRoute(http.MethodGet, "/projects", "/projects", AdminProjects, ""), true},
+        {"ProjectDetails", serveRoute(http.MethodGet, "/projects/:id", path, ProjectDetails, ""), true},
+        {"GetGeminiAnalytics", serveRoute(http.MethodGet, "/projects/:id/gemini/analytics", path+"/gemini/analytics", GetGeminiAnalytics, ""), false},
+    }
+    for _, tc := range responses {
+        body := tc.w.Body.String()
+        if tc.w.Code != http.StatusOK && tc.w.Code != http.StatusCreated {
+            t.Errorf("%s = %d %s", tc.name, tc.w.Code, body)
+            continue
+        }
+        if strings.Contains(body, "secret-key") || strings.Contains(body, "gemini_api_key") {
+            t.Errorf("%s leaks the API key: %s", tc.name, body)
+        }
+        if tc.hasKeyFlag && !strings.Contains(body, `"has_api_key":true`) {
+            t.Errorf("%s doesn't report has_api_key: %s", tc.name, body)
+        }
+    }
+}
+
+func TestAdminUsersFiltersAndPages(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    now := time.Now()
+    users := []interface{}{
+        models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleAdmin, IsActive: true, CreatedAt: now},
+        models.User{Username: "bob", Email: "bob@acme.io", Role: models.RoleUser, IsActive: true, CreatedAt: now.Add(-time.Minute)},
+        models.User{Username: "carol", Email: "carol@acme.io", Role: models.RoleUser, IsActive: false, CreatedAt: now.Add(-2 * time.Minute)},
+        models.User{Username: "a.c.m.e", Email: "dave@example.com", Role: models.RoleUser, IsActive: true, CreatedAt: now.Add(-3 * time.Minute)},
+    }
+    if _, err := config.DB.Collection("users").InsertMany(ctx, users); err != nil {
+        t.Fatal(err)
+    }
+
+    list := func(query string) (names []string, total int64) {
+        t.Helper()
+        w := serveRoute(http.MethodGet, "/users", "/users"+query, AdminUsers, "")
+        var body struct {
+            Users []models.UserResponse `json:"users"`
+            Total int64                 `json:"total"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+            t.Fatalf("AdminUsers%s = %d %s", query, w.Code, w.Body)
+        }
+        for _, user := range body.Users {
+            names = append(names, user.Username)
+        }
+        return names, body.Total
+    }
+
+    cases := []struct {
+        query string
+        want  string
+        total int64
+    }{
+        // The search is literal, so "acme" doesn't match the dotted username
+        {"?search=ACME", "bob,carol", 2},
+        {"?role=admin", "alice", 1},
+        {"?is_active=false", "carol", 1},
+        {"?role=user&is_active=true", "bob,a.c.m.e", 2},
+        {"?limit=2&page=2", "carol,a.c.m.e", 4},
+    }
+    for _, tc := range cases {
+        names, total := list(tc.query)
+        if strings.Join(names, ",") != tc.want || total != tc.total {
+            t.Errorf("%s: users = %v (total %d), want %s (total %d)", tc.query, names, total, tc.want, tc.total)
+        }
+    }
+
+    for _, query := range []string{"?role=owner", "?is_active=sometimes"} {
+        if w := serveRoute(http.MethodGet, "/users", "/users"+query, AdminUsers, ""); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", query, w.Code)
+        }
+    }
+}
+
+func TestProtectedProjectFields(t *testing.T) {
+    update := bson.M{
+        "name":               "Sales",
+        "welcome_message":    "Hi",
+        "gemini_usage_today": 0,
+        "pdf_content":        "injected",
+        "gemini_api_key":     "AIza-new",
+        "plan_id":            "enterprise",
+    }
+    want := []string{"gemini_api_key", "gemini_usage_today", "pdf_content", "plan_id"}
+    if got := protectedProjectFields(update); strings.Join(got, ",") != strings.Join(want, ",") {
+        t.Errorf("protectedProjectFields = %v, want %v", got, want)
+    }
+    if got := protectedProjectFields(bson.M{"name": "Sales", "retention_days": 30}); len(got) != 0 {
+        t.Errorf("protectedProjectFields = %v, want none for editable fields", got)
+    }
+}
+
+func TestUpdateProjectRejectsProtectedFields(t *testing.T) {
+    route := "/projects/:id"
+    path := "/projects/" + primitive.NewObjectID().Hex()
+
+    // Rejected before the project is loaded, so nothing is written
+    w := serveRoute(http.MethodPut, route, path, UpdateProject, `{"name":"Sales","tokens_used_month":0,"knowledge_sources":[]}`)
+    var body struct {
+        Fields []string `json:"fields"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusBadRequest {
+        t.Fatalf("UpdateProject = %d %s, want 400", w.Code, w.Body)
+    }
+    if strings.Join(body.Fields, ",") != "knowledge_sources,tokens_used_month" {
+        t.Errorf("fields = %v, want the protected fields listed", body.Fields)
+    }
+
+    // has_api_key is derived and dropped, leaving nothing to update
+    if w := serveRoute(http.MethodPut, route, path, UpdateProject, `{"has_api_key":true}`); w.Code != http.StatusBadRequest {
+        t.Errorf("derived field only: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodPut, route, "/projects/bad", UpdateProject, `{"name":"Sales"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project: status = %d, want 400", w.Code)
+    }
+}
+
+func TestUpdateProjectLeavesServerFieldsAlone(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    project := models.Project{
+        ID:               primitive.NewObjectID(),
+        Name:             "Support",
+        GeminiAPIKey:     "key",
+        GeminiLimit:      100,
+        GeminiUsageToday: 40,
+        Version:          1,
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+
+    path := "/projects/" + project.ID.Hex()
+    w := serveRoute(http.MethodPut, "/projects/:id", path, UpdateProject, `{"name":"Sales","welcome_message":"Hi there","has_api_key":false}`)
+    if w.Code != http.StatusOK {
+        t.Fatalf("UpdateProject = %d %s", w.Code, w.Body)
+    }
+    w = serveRoute(http.MethodPut, "/projects/:id", path, UpdateProject, `{"gemini_usage_today":0}`)
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("resetting usage = %d, want 400", w.Code)
+    }
+
+    var stored models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored); err != nil {
+        t.Fatal(err)
+    }
+    if stored.Name != "Sales" || stored.WelcomeMessage != "Hi there" {
+        t.Errorf("name = %q, welcome = %q; want the editable fields updated", stored.Name, stored.WelcomeMessage)
+    }
+    if stored.GeminiUsageToday != 40 || stored.GeminiAPIKey != "key" {
+        t.Errorf("usage = %d, key = %q; want server-managed fields unchanged", stored.GeminiUsageToday, stored.GeminiAPIKey)
+    }
+}
+
+func TestExpectedProjectVersion(t *testing.T) {
+    cases := []struct {
+        name      string
+        ifMatch   string
+        body      bson.M
+        want      int
+        versioned bool
+        valid     bool
+    }{
+        {"unversioned", "", bson.M{"name": "Sales"}, 0, false, true},
+        {"body version", "", bson.M{"version": float64(3)}, 3, true, true},
+        {"ETag", `"4"`, bson.M{}, 4, true, true},
+        {"weak ETag", `W/"4"`, bson.M{}, 4, true, true},
+        {"header wins over body", `"4"`, bson.M{"version": float64(3)}, 4, true, true},
+        {"any version", "*", bson.M{"version": float64(3)}, 3, true, true},
+        {"legacy project", "", bson.M{"version": float64(0)}, 0, true, true},
+        {"bad ETag", `"four"`, bson.M{}, 0, false, false},
+        {"negative ETag", `"-1"`, bson.M{}, 0, false, false},
+        {"fractional version", "", bson.M{"version": 2.5}, 0, false, false},
+        {"string version", "", bson.M{"version": "3"}, 0, false, false},
+    }
+    for _, tc := range cases {
+        c, _ := gin.CreateTestContext(httptest.NewRecorder())
+        c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+        if tc.ifMatch != "" {
+            c.Request.Header.Set("If-Match", tc.ifMatch)
+        }
+        version, versioned, err := expectedProjectVersion(c, tc.body)
+        if (err == nil) != tc.valid || version != tc.want || versioned != tc.versioned {
+            t.Errorf("%s: = %d, %v, %v; want %d, %v, valid %v", tc.name, version, versioned, err, tc.want, tc.versioned, tc.valid)
+        }
+        if _, ok := tc.body["version"]; ok {
+            t.Errorf("%s: version was left in the update", tc.name)
+        }
+    }
+}
+
+func TestVersionFilterAndETag(t *testing.T) {
+    if got := versionFilter(3); got != 3 {
+        t.Errorf("versionFilter(3) = %v, want 3", got)
+    }
+    // Projects created before versioning have no version field
+    if got := fmt.Sprint(versionFilter(0)); got != "map[$in:[0 <nil>]]" {
+        t.Errorf("versionFilter(0) = %s, want 0 or missing", got)
+    }
+    if got := projectETag(7); got != `"7"` {
+        t.Errorf("projectETag(7) = %s", got)
+    }
+}
+
+// updateProjectIfMatch sends UpdateProject a body with an optional If-Match header
+func updateProjectIfMatch(projectID, ifMatch, body string) *httptest.ResponseRecorder {
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.PUT("/projects/:id", UpdateProject)
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodPut, "/projects/"+projectID, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    if ifMatch != "" {
+        req.Header.Set("If-Match", ifMatch)
+    }
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestUpdateProjectRejectsBadVersion(t *testing.T) {
+    // Checked before the project is loaded
+    if w := updateProjectIfMatch(primitive.NewObjectID().Hex(), `"latest"`, `{"name":"Sales"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("bad If-Match: status = %d, want 400", w.Code)
+    }
+    if w := updateProjectIfMatch(primitive.NewObjectID().Hex(), "", `{"name":"Sales","version":1.5}`); w.Code != http.StatusBadRequest {
+        t.Errorf("bad version: status = %d, want 400", w.Code)
+    }
+}
+
+func TestUpdateProjectRejectsStaleVersion(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("GEMINI_MODELS", "")
+    ctx := context.Background()
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Support", GeminiAPIKey: "key", GeminiLimit: 100, Version: 2}
+    legacy := models.Project{ID: primitive.NewObjectID(), Name: "Legacy", GeminiAPIKey: "key", GeminiLimit: 100}
+    if _, err := config.DB.Collection("projects").InsertMany(ctx, []interface{}{project, legacy}); err != nil {
+        t.Fatal(err)
+    }
+    // Projects stored before versioning have no version field at all
+    config.DB.Collection("projects").UpdateOne(ctx, bson.M{"_id": legacy.ID}, bson.M{"$unset": bson.M{"version": ""}})
+    id := project.ID.Hex()
+
+    w := serveRoute(http.MethodGet, "/projects/:id", "/projects/"+id, ProjectDetails, "")
+    if etag := w.Header().Get("ETag"); etag != `"2"` {
+        t.Fatalf("ProjectDetails ETag = %q, want \"2\"", etag)
+    }
+
+    w = updateProjectIfMatch(id, `"2"`, `{"name":"Sales"}`)
+    if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+        t.Fatalf("update at the current version = %d, ETag %q; want 200 and \"3\"", w.Code, w.Header().Get("ETag"))
+    }
+
+    // A second editor still holding version 2 is turned away
+    w = updateProjectIfMatch(id, `"2"`, `{"name":"Marketing"}`)
+    var conflict struct {
+        CurrentVersion int `json:"current_version"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &conflict)
+    if w.Code != http.StatusConflict || conflict.CurrentVersion != 3 || w.Header().Get("ETag") != `"3"` {
+        t.Errorf("stale update = %d, current_version %d, ETag %q; want 409 at version 3", w.Code, conflict.CurrentVersion, w.Header().Get("ETag"))
+    }
+    if w := updateProjectIfMatch(id, "", `{"name":"Marketing","version":2}`); w.Code != http.StatusConflict {
+        t.Errorf("stale body version = %d, want 409", w.Code)
+    }
+    // Clients that don't send a version keep last-write-wins behaviour
+    if w := updateProjectIfMatch(id, "", `{"welcome_message":"Hi"}`); w.Code != http.StatusOK {
+        t.Errorf("unversioned update = %d, want 200", w.Code)
+    }
+
+    if w := updateProjectIfMatch(legacy.ID.Hex(), `"0"`, `{"name":"Legacy 2"}`); w.Code != http.StatusOK {
+        t.Errorf("legacy project at version 0 = %d %s, want 200", w.Code, w.Body)
+    }
+
+    var stored models.Project
+    config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored)
+    if stored.Name != "Sales" || stored.Version != 4 {
+        t.Errorf("stored name %q at version %d, want Sales at version 4", stored.Name, stored.Version)
+    }
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+)
+
+// defaultUsageAnalyticsDays is the window used when no 'from' date is given
+const defaultUsageAnalyticsDays = 30
+
+// usageTotals is one group of Gemini usage in the analytics pipeline
+type usageTotals struct {
+    Requests     int64   `bson:"requests" json:"requests"`
+    Successful   int64   `bson:"successful" json:"successful"`
+    Failed       int64   `bson:"failed" json:"failed"`
+    InputTokens  int64   `bson:"input_tokens" json:"input_tokens"`
+    OutputTokens int64   `bson:"output_tokens" json:"output_tokens"`
+    TotalTokens  int64   `bson:"total_tokens" json:"total_tokens"`
+    Cost         float64 `bson:"cost" json:"cost"`
+}
+
+type projectUsage struct {
+    ProjectID   primitive.ObjectID `bson:"_id" json:"project_id"`
+    ProjectName string             `bson:"project_name" json:"project_name"`
+    usageTotals `bson:",inline"`
+}
+
+type dailyUsage struct {
+    Date        string `bson:"_id" json:"date"`
+    usageTotals `bson:",inline"`
+}
+
+// GetUsageAnalytics - Gemini usage across all projects between 'from' and 'to' (RFC3339
+// or YYYY-MM-DD, defaulting to the last 30 days): overall totals, a per-project breakdown
+// ordered by cost, and a daily series for charting
+func GetUsageAnalytics(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    to := time.Now()
+    if value := c.Query("to"); value != "" {
+        parsed, err := parseExportDate(value, true)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date, use RFC3339 or YYYY-MM-DD"})
+            return
+        }
+        to = parsed
+    }
+    from := to.AddDate(0, 0, -defaultUsageAnalyticsDays)
+    if value := c.Query("from"); value != "" {
+        parsed, err := parseExportDate(value, false)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date, use RFC3339 or YYYY-MM-DD"})
+            return
+        }
+        from = parsed
+    }
+    if from.After(to) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+        return
+    }
+
+    sums := bson.M{
+        "requests":      bson.M{"$sum": 1},
+        "successful":    bson.M{"$sum": bson.M{"$cond": bson.A{"$success", 1, 0}}},
+        "failed":        bson.M{"$sum": bson.M{"$cond": bson.A{"$success", 0, 1}}},
+        "input_tokens":  bson.M{"$sum": "$input_tokens"},
+        "output_tokens": bson.M{"$sum": "$output_tokens"},
+        "total_tokens":  bson.M{"$sum": bson.M{"$add": bson.A{"$input_tokens", "$output_tokens"}}},
+        "cost":          bson.M{"$sum": "$estimated_cost"},
+    }
+    group := func(id interface{}) bson.M {
+        stage := bson.M{"_id": id}
+        for field, accumulator := range sums {
+            stage[field] = accumulator
+        }
+        return bson.M{"$group": stage}
+    }
+
+    pipeline := []bson.M{
+        {"$match": bson.M{"timestamp": bson.M{"$gte": from, "$lte": to}}},
+        {"$facet": bson.M{
+            "totals": bson.A{group(nil)},
+            "by_project": bson.A{
+                group("$project_id"),
+                bson.M{"$sort": bson.M{"cost": -1}},
+                bson.M{"$lookup": bson.M{
+                    "from":         "projects",
+                    "localField":   "_id",
+                    "foreignField": "_id",
+                    "as":           "project",
+                }},
+                bson.M{"$set": bson.M{"project_name": bson.M{"$first": "$project.name"}}},
+                bson.M{"$unset": "project"},
+            },
+            "daily": bson.A{
+                group(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$timestamp"}}),
+                bson.M{"$sort": bson.M{"_id": 1}},
+            },
+        }},
+    }
+
+    cursor, err := config.DB.Collection("gemini_usage_logs").Aggregate(ctx, pipeline)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage analytics"})
+        return
+    }
+    var results []struct {
+        Totals    []usageTotals  `bson:"totals"`
+        ByProject []projectUsage `bson:"by_project"`
+        Daily     []dailyUsage   `bson:"daily"`
+    }
+    if err := cursor.All(ctx, &results); err != nil || len(results) == 0 {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse usage analytics"})
+        return
+    }
+
+    result := results[0]
+    var totals usageTotals
+    if len(result.Totals) > 0 {
+        totals = result.Totals[0]
+    }
+    if result.ByProject == nil {
+        result.ByProject = []projectUsage{}
+    }
+    if result.Daily == nil {
+        result.Daily = []dailyUsage{}
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":    true,
+        "from":       from.Format(time.RFC3339),
+        "to":         to.Format(time.RFC3339),
+        "totals":     totals,
+        "by_project": result.ByProject,
+        "daily":      result.Daily,
+    })
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestGetUsageAnalyticsRejectsBadDates(t *testing.T) {
+    cases := []string{
+        "?from=yesterday",
+        "?to=2026-13-01",
+        "?from=2026-06-10&to=2026-06-01",
+    }
+    for _, query := range cases {
+        // Rejected before the database is touched
+        if w := serveRoute(http.MethodGet, "/analytics/usage", "/analytics/usage"+query, GetUsageAnalytics, ""); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", query, w.Code)
+        }
+    }
+}
+
+func TestGetUsageAnalyticsAcrossProjects(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    cheap := models.Project{ID: primitive.NewObjectID(), Name: "Cheap"}
+    costly := models.Project{ID: primitive.NewObjectID(), Name: "Costly"}
+    if _, err := config.DB.Collection("projects").InsertMany(ctx, []interface{}{cheap, costly}); err != nil {
+        t.Fatal(err)
+    }
+    day := time.Date(2026, 6, 2, 12, 0, 0, 0, time.UTC)
+    logs := []interface{}{
+        models.GeminiUsageLog{ProjectID: cheap.ID, Success: true, InputTokens: 100, OutputTokens: 50, EstimatedCost: 0.01, Timestamp: day},
+        models.GeminiUsageLog{ProjectID: costly.ID, Success: true, InputTokens: 1000, OutputTokens: 500, EstimatedCost: 0.5, Timestamp: day},
+        models.GeminiUsageLog{ProjectID: costly.ID, Success: false, Timestamp: day.AddDate(0, 0, 1)},
+        // Outside the requested range
+        models.GeminiUsageLog{ProjectID: cheap.ID, Success: true, EstimatedCost: 9, Timestamp: day.AddDate(0, -2, 0)},
+    }
+    if _, err := config.DB.Collection("gemini_usage_logs").InsertMany(ctx, logs); err != nil {
+        t.Fatal(err)
+    }
+
+    w := serveRoute(http.MethodGet, "/analytics/usage", "/analytics/usage?from=2026-06-01&to=2026-06-30", GetUsageAnalytics, "")
+    var body struct {
+        Totals    usageTotals    `json:"totals"`
+        ByProject []projectUsage `json:"by_project"`
+        Daily     []dailyUsage   `json:"daily"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetUsageAnalytics = %d %s", w.Code, w.Body)
+    }
+
+    if body.Totals.Requests != 3 || body.Totals.Failed != 1 || body.Totals.TotalTokens != 1650 {
+        t.Errorf("totals = %+v, want 3 requests, 1 failed, 1650 tokens", body.Totals)
+    }
+    if len(body.ByProject) != 2 || body.ByProject[0].ProjectName != "Costly" {
+        t.Errorf("by_project = %+v, want both projects, costliest first", body.ByProject)
+    }
+    if len(body.Daily) != 2 || body.Daily[0].Date != "2026-06-02" {
+        t.Errorf("daily = %+v, want two days in order", body.Daily)
+    }
+}
@@ -2,19 +2,37 @@ package handlers
 
 import (
     "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
     "net/http"
     "os"
+    "strings"
     "time"
     
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v4"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
     "golang.org/x/crypto/bcrypt"
     "jevi-chat/config"
+    "jevi-chat/middleware"
     "jevi-chat/models"
 )
 
+const (
+    // Refresh tokens outlive access tokens so clients can renew without logging in again
+    refreshTokenTTL = 30 * 24 * time.Hour
+
+    passwordResetTTL  = time.Hour
+    minPasswordLength = 8
+)
+
 func Home(c *gin.Context) {
     c.HTML(http.StatusOK, "auth/login.html", gin.H{
         "title": "Welcome to Jevi Chat",
@@ -28,6 +46,9 @@ func RegisterPage(c *gin.Context) {
 }
 
 func Register(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     var user models.User
     var registerData struct {
         Username string `json:"username" form:"username"`
@@ -59,14 +80,14 @@ func Register(c *gin.Context) {
     // Check if user already exists
     collection := config.DB.Collection("users")
     var existingUser models.User
-    err = collection.FindOne(context.Background(), bson.M{"email": user.Email}).Decode(&existingUser)
+    err = collection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existingUser)
     if err == nil {
         c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
         return
     }
     
     // Insert user
-    result, err := collection.InsertOne(context.Background(), user)
+    result, err := collection.InsertOne(ctx, user)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
         return
@@ -76,8 +97,15 @@ func Register(c *gin.Context) {
     
     // Generate JWT token
     token := generateJWT(user.ID.Hex(), false)
+    refreshToken, err := issueRefreshToken(ctx, user.ID.Hex(), false)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+        return
+    }
     
-    c.SetCookie("token", token, 3600*24, "/", "", false, true)
+    c.SetCookie("token", token, int(config.JWTExpiry.Seconds()), "/", "", false, true)
+    c.SetCookie("refresh_token", refreshToken, int(refreshTokenTTL.Seconds()), "/", "", false, true)
+    csrfToken := middleware.IssueCSRFToken(c, int(refreshTokenTTL.Seconds()))
     
     // Return JSON response for AJAX requests
     if c.GetHeader("Content-Type") == "application/json" {
@@ -85,6 +113,8 @@ func Register(c *gin.Context) {
             "success": true,
             "message": "Registration successful",
             "redirect": "/user/dashboard",
+            "refresh_token": refreshToken,
+            "csrf_token": csrfToken,
         })
         return
     }
@@ -113,42 +143,114 @@ func Login(c *gin.Context) {
         return
     }
     
+    // Locked-out emails are refused before their password is checked
+    if !middleware.CheckLoginLockout(c, loginData.Email) {
+        return
+    }
+    
     // Check admin credentials
     adminEmail := os.Getenv("ADMIN_EMAIL")
     adminPassword := os.Getenv("ADMIN_PASSWORD")
     
-    if loginData.Email == adminEmail && loginData.Password == adminPassword {
-        // Generate admin JWT token
-        token := generateJWT("admin", true)
-        c.SetCookie("token", token, 3600*24, "/", "", false, true)
-        
-        // Always return JSON for AJAX requests
-        c.JSON(http.StatusOK, gin.H{
-            "success": true,
-            "message": "Admin login successful",
-            "redirect": "/admin",
-        })
+    if middleware.AdminAccountConfigured() && loginData.Email == adminEmail && loginData.Password == adminPassword {
+        startSession(c, loginData.Email, middleware.AdminUserID, true, "Admin login successful", "/admin")
         return
     }
     
-    // Check regular user credentials (if needed)
-    // ... user login logic here
+    // Check regular user credentials
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    user, err := findLoginUser(ctx, loginData.Email, loginData.Password)
+    if err == nil {
+        redirect := "/user/dashboard"
+        if user.IsAdmin() {
+            redirect = "/admin"
+        }
+        startSession(c, loginData.Email, user.ID.Hex(), user.IsAdmin(), "Login successful", redirect)
+        return
+    }
+    if err != errInvalidCredentials {
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "success": false,
+            "error": "Failed to sign in",
+        })
+        return
+    }
     
-    // Invalid credentials
+    // Invalid credentials; enough of them in a row lock the email out
+    if !middleware.RecordLoginFailure(c, loginData.Email) {
+        return
+    }
     c.JSON(http.StatusUnauthorized, gin.H{
         "success": false,
         "error": "Invalid email or password",
     })
 }
 
+// errInvalidCredentials - No active user has the email and password given to Login
+var errInvalidCredentials = errors.New("invalid email or password")
+
+// findLoginUser - The active user with email whose bcrypt password hash matches password
+func findLoginUser(ctx context.Context, email, password string) (models.User, error) {
+    var user models.User
+    email = strings.TrimSpace(email)
+    if config.DB == nil || email == "" || password == "" {
+        // Without a database only the admin account can sign in
+        return user, errInvalidCredentials
+    }
+    err := config.DB.Collection("users").FindOne(ctx, bson.M{"email": email, "is_active": true}).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        return user, errInvalidCredentials
+    }
+    if err != nil {
+        return user, err
+    }
+    if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+        return user, errInvalidCredentials
+    }
+    return user, nil
+}
+
+// startSession - Respond to a successful login with an access token, a refresh token and
+// a CSRF token, and clear the email's failed attempts
+func startSession(c *gin.Context, email, userID string, isAdmin bool, message, redirect string) {
+    token := generateJWT(userID, isAdmin)
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    refreshToken, err := issueRefreshToken(ctx, userID, isAdmin)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "success": false,
+            "error": "Failed to create session",
+        })
+        return
+    }
+    middleware.ResetLoginFailures(c, email)
+    c.SetCookie("token", token, int(config.JWTExpiry.Seconds()), "/", "", false, true)
+    c.SetCookie("refresh_token", refreshToken, int(refreshTokenTTL.Seconds()), "/", "", false, true)
+    csrfToken := middleware.IssueCSRFToken(c, int(refreshTokenTTL.Seconds()))
+    
+    // Always return JSON for AJAX requests
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "message": message,
+        "redirect": redirect,
+        "refresh_token": refreshToken,
+        "csrf_token": csrfToken,
+    })
+}
+
 func UserDashboard(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     userID := c.GetString("user_id")
     
     // Get user details
     collection := config.DB.Collection("users")
     var user models.User
     objID, _ := primitive.ObjectIDFromHex(userID)
-    err := collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&user)
+    err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
         return
@@ -156,14 +258,17 @@ func UserDashboard(c *gin.Context) {
     
     // Get user's projects
     projectCollection := config.DB.Collection("projects")
-    cursor, err := projectCollection.Find(context.Background(), bson.M{"user_id": objID})
+    cursor, err := projectCollection.Find(ctx, bson.M{
+        "owner_id":   objID,
+        "deleted_at": bson.M{"$exists": false},
+    })
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
         return
     }
     
     var projects []models.Project
-    cursor.All(context.Background(), &projects)
+    cursor.All(ctx, &projects)
     
     c.HTML(http.StatusOK, "user/dashboard.html", gin.H{
         "title": "User Dashboard - Jevi Chat",
@@ -172,8 +277,218 @@ func UserDashboard(c *gin.Context) {
     })
 }
 
+// RefreshAccessToken - Exchange a valid refresh token for a new access token and a new
+// refresh token; the presented one is revoked, so each refresh token works once.
+// The refresh token is read from the JSON body or the refresh_token cookie.
+func RefreshAccessToken(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    refreshToken := requestRefreshToken(c)
+    if refreshToken == "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+        return
+    }
+
+    tokens := config.DB.Collection("refresh_tokens")
+    var stored models.RefreshToken
+    err := tokens.FindOne(ctx, bson.M{
+        "token_hash": hashToken(refreshToken),
+        "expires_at": bson.M{"$gt": time.Now()},
+    }).Decode(&stored)
+    if err != nil {
+        c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+        return
+    }
+
+    active, err := sessionOwnerActive(ctx, stored.UserID, stored.IsAdmin)
+    if err != nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify account"})
+        return
+    }
+
+    // Consume the token; of two requests racing with the same token only one deletes it
+    result, err := tokens.DeleteOne(ctx, bson.M{"_id": stored.ID})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+        return
+    }
+    if result.DeletedCount == 0 || !active {
+        c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+        return
+    }
+
+    newRefreshToken, err := issueRefreshToken(ctx, stored.UserID, stored.IsAdmin)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+        return
+    }
+    c.SetCookie("refresh_token", newRefreshToken, int(refreshTokenTTL.Seconds()), "/", "", false, true)
+
+    token := generateJWT(stored.UserID, stored.IsAdmin)
+    if token == "" {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        return
+    }
+    c.SetCookie("token", token, int(config.JWTExpiry.Seconds()), "/", "", false, true)
+
+    // Sessions that started before CSRF protection get their token here
+    csrfToken, err := c.Cookie(middleware.CSRFCookieName)
+    if err != nil || csrfToken == "" {
+        csrfToken = middleware.IssueCSRFToken(c, int(refreshTokenTTL.Seconds()))
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":       true,
+        "token":         token,
+        "refresh_token": newRefreshToken,
+        "csrf_token":    csrfToken,
+    })
+}
+
+// ForgotPassword - Email a single-use password reset link. Always responds 200 so
+// callers can't tell which emails are registered.
+func ForgotPassword(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    var input struct {
+        Email string `json:"email" form:"email"`
+    }
+    if err := c.ShouldBind(&input); err != nil || strings.TrimSpace(input.Email) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+        return
+    }
+
+    response := gin.H{
+        "success": true,
+        "message": "If an account exists for this email, a reset link has been sent",
+    }
+
+    collection := config.DB.Collection("users")
+    var user models.User
+    err := collection.FindOne(ctx, bson.M{
+        "email":     strings.TrimSpace(input.Email),
+        "is_active": true,
+    }).Decode(&user)
+    if err != nil {
+        c.JSON(http.StatusOK, response)
+        return
+    }
+
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        log.Printf("Failed to generate reset token: %v", err)
+        c.JSON(http.StatusOK, response)
+        return
+    }
+    resetToken := hex.EncodeToString(raw)
+
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+        "reset_token_hash":    hashToken(resetToken),
+        "reset_token_expires": time.Now().Add(passwordResetTTL),
+    }})
+    if err != nil {
+        log.Printf("Failed to store reset token for %s: %v", user.Email, err)
+        c.JSON(http.StatusOK, response)
+        return
+    }
+
+    appURL := os.Getenv("APP_URL")
+    if appURL == "" {
+        appURL = "http://localhost:3000"
+    }
+    resetLink := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(appURL, "/"), resetToken)
+
+    if config.Mailer == nil {
+        // Development mode: no SMTP, so surface the link in the server log
+        log.Printf("Password reset link for %s: %s", user.Email, resetLink)
+    } else {
+        body := fmt.Sprintf("Hello %s,\n\nUse the link below to reset your Jevi Chat password. It expires in %d minutes.\n\n%s\n\nIf you didn't request this, you can ignore this email.",
+            user.Username, int(passwordResetTTL.Minutes()), resetLink)
+        if err := config.SendEmail([]string{user.Email}, "Reset your Jevi Chat password", body); err != nil {
+            log.Printf("Failed to send reset email to %s: %v", user.Email, err)
+        }
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword - Set a new password using a reset token. Tokens work once.
+func ResetPassword(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    var input struct {
+        Token    string `json:"token" form:"token"`
+        Password string `json:"password" form:"password"`
+    }
+    if err := c.ShouldBind(&input); err != nil || input.Token == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Token and password are required"})
+        return
+    }
+    if len(input.Password) < minPasswordLength {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", minPasswordLength)})
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+        return
+    }
+
+    // Match and clear the token in one step so it can't be reused
+    var user models.User
+    err = config.DB.Collection("users").FindOneAndUpdate(ctx,
+        bson.M{
+            "reset_token_hash":    hashToken(input.Token),
+            "reset_token_expires": bson.M{"$gt": time.Now()},
+        },
+        bson.M{
+            "$set":   bson.M{"password": string(hashedPassword), "updated_at": time.Now()},
+            "$unset": bson.M{"reset_token_hash": "", "reset_token_expires": ""},
+        },
+        options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1}),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+        return
+    }
+
+    // Whoever knew the old password may hold a session; end them all
+    if err := revokeRefreshTokens(ctx, user.ID.Hex()); err != nil {
+        log.Printf("Failed to revoke sessions for user %s after password reset: %v", user.ID.Hex(), err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Password was reset but existing sessions could not be signed out"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "message": "Password has been reset",
+    })
+}
+
 func Logout(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    // Revoke the refresh token so it can't be used to log back in
+    if refreshToken := requestRefreshToken(c); refreshToken != "" {
+        config.DB.Collection("refresh_tokens").DeleteOne(ctx, bson.M{
+            "token_hash": hashToken(refreshToken),
+        })
+    }
+    
     c.SetCookie("token", "", -1, "/", "", false, true)
+    c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+    middleware.ClearCSRFToken(c)
     
     // Return JSON response for AJAX requests
     if c.GetHeader("Content-Type") == "application/json" || c.Query("format") == "json" {
@@ -192,18 +507,78 @@ func generateJWT(userID string, isAdmin bool) string {
     claims := jwt.MapClaims{
         "user_id": userID,
         "is_admin": isAdmin,
-        "exp": time.Now().Add(time.Hour * 24).Unix(),
+        "exp": time.Now().Add(config.JWTExpiry).Unix(),
         "iat": time.Now().Unix(),
     }
     
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+    tokenString, err := config.SignJWT(claims)
     if err != nil {
         return ""
     }
     return tokenString
 }
 
+// issueRefreshToken creates a random refresh token and stores its hash
+func issueRefreshToken(ctx context.Context, userID string, isAdmin bool) (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+    refreshToken := hex.EncodeToString(raw)
+
+    _, err := config.DB.Collection("refresh_tokens").InsertOne(ctx, models.RefreshToken{
+        UserID:    userID,
+        IsAdmin:   isAdmin,
+        TokenHash: hashToken(refreshToken),
+        ExpiresAt: time.Now().Add(refreshTokenTTL),
+        CreatedAt: time.Now(),
+    })
+    if err != nil {
+        return "", err
+    }
+    return refreshToken, nil
+}
+
+// sessionOwnerActive reports whether the account a refresh token was issued to still
+// exists and is active
+func sessionOwnerActive(ctx context.Context, userID string, isAdmin bool) (bool, error) {
+    if isAdmin && userID == middleware.AdminUserID {
+        return middleware.AdminAccountConfigured(), nil
+    }
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        return false, nil
+    }
+    count, err := config.DB.Collection("users").CountDocuments(ctx, bson.M{"_id": objID, "is_active": true})
+    if err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
+// revokeRefreshTokens deletes every refresh token issued to a user, signing out all their sessions
+func revokeRefreshTokens(ctx context.Context, userID string) error {
+    _, err := config.DB.Collection("refresh_tokens").DeleteMany(ctx, bson.M{"user_id": userID})
+    return err
+}
+
+// requestRefreshToken reads the refresh token from the JSON body, falling back to the cookie
+func requestRefreshToken(c *gin.Context) string {
+    var body struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    if c.ShouldBindJSON(&body) == nil && body.RefreshToken != "" {
+        return body.RefreshToken
+    }
+    refreshToken, _ := c.Cookie("refresh_token")
+    return refreshToken
+}
+
+// hashToken hashes a refresh or password reset token for storage
+func hashToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
 
 func GetUserProfile(c *gin.Context) {
     userID := c.GetString("user_id")
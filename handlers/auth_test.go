@@ -0,0 +1,320 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "regexp"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "golang.org/x/crypto/bcrypt"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func postJSON(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+    c.Request.Header.Set("Content-Type", "application/json")
+    handler(c)
+    return w
+}
+
+func TestResetPasswordRejectsBadInput(t *testing.T) {
+    cases := []struct {
+        name string
+        body string
+    }{
+        {"missing token", `{"password":"long-enough-password"}`},
+        {"short password", `{"token":"abc","password":"short"}`},
+        {"malformed body", `{`},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            // Rejected before the database is touched
+            if w := postJSON(ResetPassword, tc.body); w.Code != http.StatusBadRequest {
+                t.Errorf("status = %d, want 400", w.Code)
+            }
+        })
+    }
+}
+
+func TestHashToken(t *testing.T) {
+    if hashToken("abc") != hashToken("abc") {
+        t.Error("hashToken must be deterministic so stored hashes can be looked up")
+    }
+    if hashToken("abc") == hashToken("abd") {
+        t.Error("different tokens must not share a hash")
+    }
+    if strings.Contains(hashToken("secret-token"), "secret-token") {
+        t.Error("the hash must not contain the raw token")
+    }
+}
+
+func TestRefreshAccessTokenRequiresToken(t *testing.T) {
+    if w := postJSON(RefreshAccessToken, `{}`); w.Code != http.StatusUnauthorized {
+        t.Errorf("status = %d, want 401", w.Code)
+    }
+}
+
+func TestSessionOwnerActiveEnvAdmin(t *testing.T) {
+    ctx := context.Background()
+
+    t.Setenv("ADMIN_EMAIL", "admin@example.com")
+    t.Setenv("ADMIN_PASSWORD", "secret")
+    if active, err := sessionOwnerActive(ctx, "admin", true); err != nil || !active {
+        t.Errorf("configured admin: active = %v, err = %v; want active", active, err)
+    }
+
+    t.Setenv("ADMIN_PASSWORD", "")
+    if active, _ := sessionOwnerActive(ctx, "admin", true); active {
+        t.Error("an admin whose credentials were removed must not refresh")
+    }
+}
+
+func TestSessionOwnerActiveInvalidUserID(t *testing.T) {
+    // Not an ObjectID, so there's no account to look up
+    if active, err := sessionOwnerActive(context.Background(), "admin", false); err != nil || active {
+        t.Errorf("active = %v, err = %v; want inactive without error", active, err)
+    }
+}
+
+func TestLoginLocksOutRepeatedFailures(t *testing.T) {
+    t.Setenv("ADMIN_EMAIL", "lockout-admin@example.com")
+    t.Setenv("ADMIN_PASSWORD", "correct")
+
+    var w *httptest.ResponseRecorder
+    for i := 0; i < 5; i++ {
+        w = postJSON(Login, `{"email":"lockout-admin@example.com","password":"wrong"}`)
+    }
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("fifth failure = %d, want 429 with Retry-After", w.Code)
+    }
+    // The right password is refused too until the lockout runs out
+    if w := postJSON(Login, `{"email":"lockout-admin@example.com","password":"correct"}`); w.Code != http.StatusTooManyRequests {
+        t.Errorf("correct password while locked out = %d, want 429", w.Code)
+    }
+    if w := postJSON(Login, `{"email":"someone@example.com","password":"wrong"}`); w.Code != http.StatusUnauthorized {
+        t.Errorf("other email = %d, want 401", w.Code)
+    }
+}
+
+func TestLoginWithoutAdminAccount(t *testing.T) {
+    t.Setenv("ADMIN_EMAIL", "")
+    t.Setenv("ADMIN_PASSWORD", "")
+    // Blank credentials must not match an unconfigured admin account
+    if w := postJSON(Login, `{"email":"","password":""}`); w.Code != http.StatusUnauthorized {
+        t.Errorf("blank credentials = %d, want 401", w.Code)
+    }
+}
+
+// insertUser stores an account with a bcrypt hash of password
+func insertUser(t *testing.T, email, password, role string, active bool) models.User {
+    t.Helper()
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+    if err != nil {
+        t.Fatal(err)
+    }
+    user := models.User{ID: primitive.NewObjectID(), Username: strings.Split(email, "@")[0], Email: email,
+        Password: string(hash), Role: role, IsActive: active, CreatedAt: time.Now()}
+    if _, err := config.DB.Collection("users").InsertOne(context.Background(), user); err != nil {
+        t.Fatal(err)
+    }
+    return user
+}
+
+// loginResult posts credentials to Login and decodes the response
+func loginResult(t *testing.T, email, password string) (int, string, string) {
+    t.Helper()
+    body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+    w := postJSON(Login, string(body))
+    var response struct {
+        Redirect     string `json:"redirect"`
+        RefreshToken string `json:"refresh_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &response)
+    return w.Code, response.Redirect, response.RefreshToken
+}
+
+func TestLoginWithUserAccount(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("ADMIN_EMAIL", "admin@example.com")
+    t.Setenv("ADMIN_PASSWORD", "admin-password")
+    user := insertUser(t, "user@example.com", "user-password", models.RoleUser, true)
+    insertUser(t, "admin-user@example.com", "admin-user-password", models.RoleAdmin, true)
+    insertUser(t, "inactive@example.com", "inactive-password", models.RoleUser, false)
+
+    code, redirect, refreshToken := loginResult(t, "user@example.com", "user-password")
+    if code != http.StatusOK || redirect != "/user/dashboard" || refreshToken == "" {
+        t.Fatalf("user login = %d, redirect %q; want 200 to the dashboard with a refresh token", code, redirect)
+    }
+    var stored models.RefreshToken
+    if err := config.DB.Collection("refresh_tokens").FindOne(context.Background(), bson.M{"token_hash": hashToken(refreshToken)}).Decode(&stored); err != nil {
+        t.Fatalf("refresh token not stored: %v", err)
+    }
+    if stored.UserID != user.ID.Hex() || stored.IsAdmin {
+        t.Errorf("refresh token for %q (admin %v), want %s", stored.UserID, stored.IsAdmin, user.ID.Hex())
+    }
+
+    if code, redirect, _ := loginResult(t, "admin-user@example.com", "admin-user-password"); code != http.StatusOK || redirect != "/admin" {
+        t.Errorf("admin user login = %d, redirect %q; want 200 to /admin", code, redirect)
+    }
+    for _, tc := range []struct{ email, password string }{
+        {"user@example.com", "wrong-password"},
+        {"inactive@example.com", "inactive-password"},
+        {"nobody@example.com", "user-password"},
+    } {
+        if code, _, _ := loginResult(t, tc.email, tc.password); code != http.StatusUnauthorized {
+            t.Errorf("%s: status = %d, want 401", tc.email, code)
+        }
+    }
+}
+
+// capturedResetToken runs ForgotPassword for email and returns the token from the reset
+// link it logs when no mailer is configured
+func capturedResetToken(t *testing.T, email string) string {
+    t.Helper()
+    previous := config.Mailer
+    config.Mailer = nil
+    defer func() { config.Mailer = previous }()
+    var logs bytes.Buffer
+    output := log.Writer()
+    log.SetOutput(&logs)
+    defer log.SetOutput(output)
+
+    if w := postJSON(ForgotPassword, `{"email":"`+email+`"}`); w.Code != http.StatusOK {
+        t.Fatalf("ForgotPassword = %d %s", w.Code, w.Body)
+    }
+    match := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(logs.String())
+    if match == nil {
+        t.Fatalf("no reset link logged: %q", logs.String())
+    }
+    return match[1]
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+    testDatabase(t)
+    insertUser(t, "reset@example.com", "old-password", models.RoleUser, true)
+
+    token := capturedResetToken(t, "reset@example.com")
+    if w := postJSON(ResetPassword, `{"token":"`+token+`","password":"new-password"}`); w.Code != http.StatusOK {
+        t.Fatalf("ResetPassword = %d %s", w.Code, w.Body)
+    }
+    if code, _, _ := loginResult(t, "reset@example.com", "new-password"); code != http.StatusOK {
+        t.Errorf("login with the new password = %d, want 200", code)
+    }
+    if code, _, _ := loginResult(t, "reset@example.com", "old-password"); code != http.StatusUnauthorized {
+        t.Errorf("login with the old password = %d, want 401", code)
+    }
+
+    // The token was cleared when it was used
+    if w := postJSON(ResetPassword, `{"token":"`+token+`","password":"another-password"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("reused token = %d, want 400", w.Code)
+    }
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+    testDatabase(t)
+    user := insertUser(t, "expired@example.com", "old-password", models.RoleUser, true)
+    _, err := config.DB.Collection("users").UpdateOne(context.Background(), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+        "reset_token_hash":    hashToken("expired-token"),
+        "reset_token_expires": time.Now().Add(-time.Minute),
+    }})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if w := postJSON(ResetPassword, `{"token":"expired-token","password":"new-password"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("expired token = %d, want 400", w.Code)
+    }
+    if code, _, _ := loginResult(t, "expired@example.com", "old-password"); code != http.StatusOK {
+        t.Errorf("login with the unchanged password = %d, want 200", code)
+    }
+}
+
+// refreshWith posts refreshToken to RefreshAccessToken, returning the status and the new refresh token
+func refreshWith(t *testing.T, refreshToken string) (int, string) {
+    t.Helper()
+    w := postJSON(RefreshAccessToken, `{"refresh_token":"`+refreshToken+`"}`)
+    var response struct {
+        Token        string `json:"token"`
+        RefreshToken string `json:"refresh_token"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &response)
+    if w.Code == http.StatusOK && response.Token == "" {
+        t.Errorf("refresh succeeded without an access token: %s", w.Body)
+    }
+    return w.Code, response.RefreshToken
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("JWT_SECRET", "test-secret")
+    ctx := context.Background()
+    user := insertUser(t, "refresh@example.com", "user-password", models.RoleUser, true)
+
+    issued, err := issueRefreshToken(ctx, user.ID.Hex(), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    code, rotated := refreshWith(t, issued)
+    if code != http.StatusOK || rotated == "" || rotated == issued {
+        t.Fatalf("refresh = %d with %q, want 200 and a new refresh token", code, rotated)
+    }
+
+    // Each refresh token works once: replaying the rotated one fails, the new one works
+    if code, _ := refreshWith(t, issued); code != http.StatusUnauthorized {
+        t.Errorf("replayed refresh token = %d, want 401", code)
+    }
+    if code, _ := refreshWith(t, rotated); code != http.StatusOK {
+        t.Errorf("rotated refresh token = %d, want 200", code)
+    }
+}
+
+func TestRefreshAccessTokenRejectsExpiredToken(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("JWT_SECRET", "test-secret")
+    ctx := context.Background()
+    user := insertUser(t, "expired-refresh@example.com", "user-password", models.RoleUser, true)
+
+    issued, err := issueRefreshToken(ctx, user.ID.Hex(), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = config.DB.Collection("refresh_tokens").UpdateOne(ctx, bson.M{"token_hash": hashToken(issued)},
+        bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if code, _ := refreshWith(t, issued); code != http.StatusUnauthorized {
+        t.Errorf("expired refresh token = %d, want 401", code)
+    }
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("JWT_SECRET", "test-secret")
+    ctx := context.Background()
+    user := insertUser(t, "logout@example.com", "user-password", models.RoleUser, true)
+
+    issued, err := issueRefreshToken(ctx, user.ID.Hex(), false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if w := postJSON(Logout, `{"refresh_token":"`+issued+`"}`); w.Code != http.StatusOK {
+        t.Fatalf("Logout = %d %s", w.Code, w.Body)
+    }
+    if code, _ := refreshWith(t, issued); code != http.StatusUnauthorized {
+        t.Errorf("refresh after logout = %d, want 401", code)
+    }
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "sync"
+    "sync/atomic"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func budgetProject(spent, budget float64) models.Project {
+    return models.Project{
+        GeminiModel:        "gemini-1.5-flash",
+        GeminiDailyLimit:   100,
+        GeminiMonthlyLimit: 1000,
+        EstimatedCostMonth: spent,
+        MonthlyCostBudget:  budget,
+    }
+}
+
+func TestOverCostBudget(t *testing.T) {
+    cost := reservedGeminiCost("gemini-1.5-flash")
+    if cost <= 0 {
+        t.Fatalf("reservedGeminiCost = %v, want a positive reservation", cost)
+    }
+
+    cases := []struct {
+        name    string
+        project models.Project
+        want    bool
+    }{
+        {"no budget", budgetProject(50, 0), false},
+        {"well under budget", budgetProject(1, 10), false},
+        {"exactly reaches budget", budgetProject(10-cost, 10), false},
+        {"would exceed budget", budgetProject(10-cost/2, 10), true},
+        {"at budget", budgetProject(10, 10), true},
+        {"over budget", budgetProject(12, 10), true},
+    }
+    for _, tc := range cases {
+        if got := overCostBudget(tc.project, cost); got != tc.want {
+            t.Errorf("%s: overCostBudget = %v, want %v", tc.name, got, tc.want)
+        }
+    }
+}
+
+func TestRejectOverUsageLimitBlocksProjectAtBudget(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    if !rejectOverUsageLimit(c, budgetProject(10, 10)) {
+        t.Fatal("a project at its budget should be rejected")
+    }
+    var body map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if w.Code != http.StatusTooManyRequests || body["status"] != "budget_exceeded" {
+        t.Errorf("got %d %v, want 429 budget_exceeded", w.Code, body["status"])
+    }
+
+    w = httptest.NewRecorder()
+    c, _ = gin.CreateTestContext(w)
+    if rejectOverUsageLimit(c, budgetProject(1, 10)) {
+        t.Fatalf("a project under budget was rejected: %s", w.Body.String())
+    }
+}
+
+// testDatabase points config.DB at a throwaway database on MONGODB_TEST_URI, skipping
+// the test when no server is configured
+func testDatabase(t *testing.T) {
+    t.Helper()
+    uri := os.Getenv("MONGODB_TEST_URI")
+    if uri == "" {
+        t.Skip("set MONGODB_TEST_URI to run against MongoDB")
+    }
+
+    ctx := context.Background()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatalf("connect: %v", err)
+    }
+    previous := config.DB
+    config.DB = client.Database("jevi_chat_test_" + primitive.NewObjectID().Hex())
+    t.Cleanup(func() {
+        config.DB.Drop(ctx)
+        config.DB = previous
+        client.Disconnect(ctx)
+    })
+}
+
+func TestReserveGeminiUsageNeverOvershoots(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    project := models.Project{
+        ID:                 primitive.NewObjectID(),
+        Name:               "At the limit",
+        GeminiDailyLimit:   5,
+        GeminiMonthlyLimit: 1000,
+        GeminiUsageToday:   3,
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+
+    var accepted int32
+    var wg sync.WaitGroup
+    for i := 0; i < 50; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := reserveGeminiUsage(ctx, project.ID, 0.001)
+            if err == nil {
+                atomic.AddInt32(&accepted, 1)
+            } else if err != mongo.ErrNoDocuments {
+                t.Errorf("reserveGeminiUsage: %v", err)
+            }
+        }()
+    }
+    wg.Wait()
+
+    if accepted != 2 {
+        t.Errorf("accepted %d requests, want the 2 left under the daily limit", accepted)
+    }
+    var stored models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored); err != nil {
+        t.Fatal(err)
+    }
+    if stored.GeminiUsageToday != project.GeminiDailyLimit {
+        t.Errorf("gemini_usage_today = %d, want exactly the limit %d", stored.GeminiUsageToday, project.GeminiDailyLimit)
+    }
+}
+
+func TestCalculateGeminiCost(t *testing.T) {
+    price := config.GeminiPricing("gemini-2.5-pro")
+    want := 2*price.InputPer1K + 0.5*price.OutputPer1K
+    if got := calculateGeminiCost("gemini-2.5-pro", 2000, 500); math.Abs(got-want) > 0.00001 {
+        t.Errorf("calculateGeminiCost = %v, want %v", got, want)
+    }
+    if calculateGeminiCost("gemini-2.5-pro", 1000, 1000) <= calculateGeminiCost("gemini-2.0-flash-lite", 1000, 1000) {
+        t.Error("a pro model must cost more than a lite one")
+    }
+    if got := calculateGeminiCost("gemini-1.5-flash", 0, 0); got != 0 {
+        t.Errorf("no tokens cost %v, want 0", got)
+    }
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// Bulk project actions
+const (
+    bulkActionActivate   = "activate"
+    bulkActionDeactivate = "deactivate"
+    bulkActionRenew      = "renew"
+    bulkActionDelete     = "delete"
+)
+
+// Bulk request bounds
+const (
+    maxBulkProjects      = 100
+    defaultBulkRenewDays = 30
+    maxBulkRenewDays     = 3650
+)
+
+// Per-project outcomes of a bulk action
+const (
+    bulkResultUpdated   = "updated"
+    bulkResultNotFound  = "not_found"
+    bulkResultInvalidID = "invalid_id"
+)
+
+// BulkProjectAction - Activate, deactivate, renew or delete several projects at once.
+// Renewing extends each project's expiry by days (default 30) from its current expiry,
+// or from now when it has already lapsed. Deleted projects are only matched by delete,
+// which soft-deletes like DeleteProject. The response reports the outcome per ID.
+func BulkProjectAction(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var input struct {
+        Action     string   `json:"action"`
+        ProjectIDs []string `json:"project_ids"`
+        Days       int      `json:"days"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+        return
+    }
+    if len(input.ProjectIDs) == 0 || len(input.ProjectIDs) > maxBulkProjects {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Provide between 1 and 100 project IDs"})
+        return
+    }
+    if input.Days == 0 {
+        input.Days = defaultBulkRenewDays
+    }
+
+    now := time.Now()
+    var update interface{}
+    switch input.Action {
+    case bulkActionActivate:
+        update = bson.M{"$set": bson.M{"is_active": true, "updated_at": now}, "$inc": bson.M{"version": 1}}
+    case bulkActionDeactivate:
+        update = bson.M{"$set": bson.M{"is_active": false, "updated_at": now}, "$inc": bson.M{"version": 1}}
+    case bulkActionRenew:
+        if input.Days < 1 || input.Days > maxBulkRenewDays {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Days must be between 1 and 3650"})
+            return
+        }
+        // A pipeline update so each project extends from its own expiry
+        update = bson.A{bson.M{"$set": bson.M{
+            "expiry_date": bson.M{"$add": bson.A{
+                bson.M{"$max": bson.A{"$expiry_date", now}},
+                int64(input.Days) * int64(24*time.Hour/time.Millisecond),
+            }},
+            "status":     models.ProjectStatusActive,
+            "is_active":  true,
+            "updated_at": now,
+            "version":    bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+        }}}
+    case bulkActionDelete:
+        update = bson.M{"$set": bson.M{"deleted_at": now, "is_active": false, "updated_at": now}, "$inc": bson.M{"version": 1}}
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "Unknown action",
+            "actions": []string{bulkActionActivate, bulkActionDeactivate, bulkActionRenew, bulkActionDelete},
+        })
+        return
+    }
+
+    results, objIDs := initialBulkResults(input.ProjectIDs)
+
+    var modified int64
+    if len(objIDs) > 0 {
+        // Only live projects can be changed; deleting skips ones already deleted
+        filter := bson.M{"_id": bson.M{"$in": objIDs}, "deleted_at": bson.M{"$exists": false}}
+
+        collection := config.DB.Collection("projects")
+        cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update projects"})
+            return
+        }
+        var matched []struct {
+            ID primitive.ObjectID `bson:"_id"`
+        }
+        if err := cursor.All(ctx, &matched); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update projects"})
+            return
+        }
+
+        matchedIDs := make([]primitive.ObjectID, 0, len(matched))
+        for _, project := range matched {
+            matchedIDs = append(matchedIDs, project.ID)
+        }
+        if len(matchedIDs) > 0 {
+            result, err := collection.UpdateMany(ctx,
+                bson.M{"_id": bson.M{"$in": matchedIDs}, "deleted_at": bson.M{"$exists": false}}, update)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update projects"})
+                return
+            }
+            modified = result.ModifiedCount
+        }
+        for _, id := range matchedIDs {
+            results[id.Hex()] = bulkResultUpdated
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":  true,
+        "action":   input.Action,
+        "results":  results,
+        "modified": modified,
+    })
+}
+
+// initialBulkResults parses the requested project IDs, marking each not found until it's
+// updated. Valid IDs are keyed by their canonical hex, so an ID given in upper case or
+// more than once reports a single outcome.
+func initialBulkResults(ids []string) (map[string]string, []primitive.ObjectID) {
+    results := make(map[string]string, len(ids))
+    var objIDs []primitive.ObjectID
+    for _, id := range ids {
+        objID, err := primitive.ObjectIDFromHex(id)
+        if err != nil {
+            results[id] = bulkResultInvalidID
+            continue
+        }
+        if _, seen := results[objID.Hex()]; seen {
+            continue
+        }
+        results[objID.Hex()] = bulkResultNotFound
+        objIDs = append(objIDs, objID)
+    }
+    return results, objIDs
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInitialBulkResultsCanonicalKeys(t *testing.T) {
+    id := primitive.NewObjectID()
+    upper := strings.ToUpper(id.Hex())
+
+    results, objIDs := initialBulkResults([]string{upper, id.Hex(), "not-an-id"})
+
+    if len(objIDs) != 1 || objIDs[0] != id {
+        t.Errorf("objIDs = %v, want just %s", objIDs, id.Hex())
+    }
+    if results[id.Hex()] != bulkResultNotFound {
+        t.Errorf("results[%s] = %q, want %q", id.Hex(), results[id.Hex()], bulkResultNotFound)
+    }
+    if _, ok := results[upper]; ok {
+        t.Error("the upper-case spelling got its own result")
+    }
+    if results["not-an-id"] != bulkResultInvalidID {
+        t.Errorf("results[not-an-id] = %q, want %q", results["not-an-id"], bulkResultInvalidID)
+    }
+    if len(results) != 2 {
+        t.Errorf("results = %v, want one entry per distinct project", results)
+    }
+}
+
+func TestBulkProjectActionRejectsBadInput(t *testing.T) {
+    cases := []struct {
+        name string
+        body string
+    }{
+        {"no ids", `{"action":"activate","project_ids":[]}`},
+        {"unknown action", `{"action":"explode","project_ids":["` + primitive.NewObjectID().Hex() + `"]}`},
+        {"renew too long", `{"action":"renew","days":4000,"project_ids":["` + primitive.NewObjectID().Hex() + `"]}`},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if w := postJSON(BulkProjectAction, tc.body); w.Code != http.StatusBadRequest {
+                t.Errorf("status = %d, want 400", w.Code)
+            }
+        })
+    }
+}
@@ -2,19 +2,28 @@ package handlers
 
 import (
     "context"
+    "crypto/rand"
+    "encoding/hex"
     "fmt"
     "html"
     "net/http"
+    "os"
+    "strconv"
     "strings"
     "time"
+    "unicode"
+    "unicode/utf8"
     "math"
     "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v4"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
     "jevi-chat/config"
+    "jevi-chat/middleware"
     "jevi-chat/models"
-    "google.golang.org/api/option"
+    "jevi-chat/utils"
     "github.com/google/generative-ai-go/genai"
 )
 
@@ -23,9 +32,12 @@ import (
 // SendMessage - For authenticated users in the main dashboard
 func SendMessage(c *gin.Context) {
     projectID := c.Param("id")
+    started := time.Now()
+    defer observeChatLatency("dashboard", started)
     var messageData struct {
-        Message   string `json:"message"`
-        SessionID string `json:"session_id"`
+        Message        string `json:"message"`
+        SessionID      string `json:"session_id"`
+        IdempotencyKey string `json:"idempotency_key"`
     }
     
     if err := c.ShouldBindJSON(&messageData); err != nil {
@@ -33,18 +45,19 @@ func SendMessage(c *gin.Context) {
         return
     }
     
-    // Sanitize input
-    messageData.Message = sanitizeInput(messageData.Message)
-    if messageData.Message == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+    // A retried submission gets the original response instead of a second answer
+    replayed, finish := beginIdempotentRequest(c, projectID, idempotencyKey(c, messageData.IdempotencyKey))
+    if replayed {
         return
     }
+    defer finish()
     
-    // Check rate limit
-    if !checkRateLimit(c.ClientIP()) {
-        c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded. Please wait before sending another message."})
+    // Validate and sanitize input
+    message, ok := validateMessageInput(c, messageData.Message)
+    if !ok {
         return
     }
+    messageData.Message = message
     
     // Get project with PDF content
     objID, err := primitive.ObjectIDFromHex(projectID)
@@ -55,7 +68,9 @@ func SendMessage(c *gin.Context) {
     
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -67,43 +82,95 @@ func SendMessage(c *gin.Context) {
         return
     }
     
+    // Check the project's rate limit
+    if !checkRateLimit(c, project) {
+        return
+    }
+    // A widget that sent no session id gets one, returned below for it to keep
+    if messageData.SessionID, err = ensureSessionID(messageData.SessionID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start chat session"})
+        return
+    }
+    if rejectFullSession(c, project, messageData.SessionID) {
+        return
+    }
+    if messageData.Message, ok = rejectModeratedMessage(c, project, messageData.Message); !ok {
+        return
+    }
+    
     var response string
     var err2 error
+    var inputTokens, outputTokens int
+    var calledGemini bool
+    var reservedCost float64
+    status := models.ChatReplySuccess
     
-    // Check if Gemini is enabled and within limits
-    if project.GeminiEnabled && project.GeminiUsage < project.GeminiLimit && project.GeminiAPIKey != "" {
-        // First-message greeting logic + 4-second human-like delay
+    // Check if Gemini is enabled and configured
+    if project.GeminiEnabled && project.GeminiAPIKey != "" {
+        // First-message greeting logic + configurable human-like delay
         if isFirstMessage(objID, messageData.SessionID) {
-            time.Sleep(4 * time.Second)
+            applyResponseDelay(project)
             response = project.WelcomeMessage
+        } else if reply, notReady := knowledgeNotReadyReply(project); notReady {
+            applyResponseDelay(project)
+            response = reply
+            status = "knowledge_base_not_ready"
+        } else if reply, repeated := repeatedMessageReply(objID, messageData.SessionID, messageData.Message); repeated {
+            // Same question again in this session: answer as before without new usage
+            applyResponseDelay(project)
+            response = reply
+            status = "repeated_message"
         } else {
-            time.Sleep(4 * time.Second) // keep the same pause for regular replies
-            response, err2 = generateAIResponse(
-                messageData.Message,
-                project.PDFContent,
-                project.GeminiAPIKey,
-                project.Name,
-                project.GeminiModel,
-            )
+            // Count the request against the limits and budget before calling Gemini,
+            // as IframeSendMessage does, so concurrent requests can't overshoot them
+            ctx, cancel := requestContext(c)
+            reservedCost = reservedGeminiCost(project.GeminiModel)
+            reserved, err := reserveGeminiUsage(ctx, objID, reservedCost)
+            cancel()
+            if err == mongo.ErrNoDocuments {
+                if !rejectOverUsageLimit(c, reserved) {
+                    c.JSON(http.StatusTooManyRequests, gin.H{
+                        "error":  "AI usage limit reached for this project",
+                        "status": "limit_exceeded",
+                    })
+                }
+                return
+            } else if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check usage limits"})
+                return
+            }
+            project.GeminiUsageToday = reserved.GeminiUsageToday - 1
+            project.GeminiUsageMonth = reserved.GeminiUsageMonth - 1
+            
+            applyResponseDelay(project) // keep the same pause for regular replies
+            calledGemini = true
+            response, inputTokens, outputTokens, err2 = generateGeminiResponseWithTracking(project, messageData.Message, c.ClientIP(), models.ChatUser{}, nil)
             if err2 != nil {
+                go releaseGeminiUsage(objID, reservedCost)
+            }
+            if isBlockedBySafety(err2) {
+                status = "content_blocked"
+                response = blockedReply(err2)
+            } else if err2 != nil {
                 // Fallback response
+                status = "error"
                 response = fmt.Sprintf("I apologize, but I'm experiencing technical difficulties with my AI system. However, I received your message about %s and will help you as best I can. Please try rephrasing your question.", project.Name)
-            } else {
-                // Update usage counter asynchronously
-                go updateGeminiUsage(objID)
             }
         }
     } else {
-        // Gemini disabled, limit reached, or no API key
-        time.Sleep(4 * time.Second) // consistent delay even for error messages
+        // Gemini disabled or no API key
+        applyResponseDelay(project) // consistent delay even for error messages
+        status = "error"
         if !project.GeminiEnabled {
             response = "AI responses are currently disabled for this project."
-        } else if project.GeminiAPIKey == "" {
-            response = "AI configuration is incomplete. Please contact the administrator."
         } else {
-            response = "AI usage limit reached for this project. Please contact the administrator to increase the limit."
+            response = "AI configuration is incomplete. Please contact the administrator."
         }
     }
+    if calledGemini {
+        go trackGeminiUsage(objID, messageData.Message, response, getGeminiModel(project.GeminiModel),
+            inputTokens, outputTokens, time.Since(started).Milliseconds(), c.ClientIP(), err2, reservedCost)
+    }
     
     // Save chat message to database
     chatMessage := models.ChatMessage{
@@ -114,34 +181,53 @@ func SendMessage(c *gin.Context) {
         IsUser:    false,
         Timestamp: time.Now(),
         IPAddress: c.ClientIP(),
+        Status:    status,
     }
     
     chatCollection := config.DB.Collection("chat_messages")
-    result, err := chatCollection.InsertOne(context.Background(), chatMessage)
+    ctx, cancel = requestContext(c)
+    result, err := chatCollection.InsertOne(ctx, chatMessage)
+    cancel()
     if err != nil {
         // Log error but still return response
         fmt.Printf("Failed to save chat message: %v\n", err)
     } else {
         chatMessage.ID = result.InsertedID.(primitive.ObjectID)
+        recordSessionActivity(objID, messageData.SessionID, chatMessage.IPAddress, primitive.NilObjectID)
     }
     
     c.JSON(http.StatusOK, gin.H{
         "response":    response,
+        "status":      status,
         "message_id":  chatMessage.ID,
         "timestamp":   chatMessage.Timestamp,
         "session_id":  messageData.SessionID,
-        "usage_info": gin.H{
-            "current_usage": project.GeminiUsage + 1,
-            "limit":         project.GeminiLimit,
-            "remaining":     project.GeminiLimit - project.GeminiUsage - 1,
-        },
+        "usage_info": dashboardUsageInfo(project, calledGemini && err2 == nil),
     })
 }
 
+// dashboardUsageInfo - The usage_info SendMessage reports. The request only counts when
+// it was answered by Gemini: greetings, repeats and failed calls leave usage unchanged.
+func dashboardUsageInfo(project models.Project, counted bool) gin.H {
+    used := 0
+    if counted {
+        used = 1
+    }
+    return gin.H{
+        "daily_usage":       project.GeminiUsageToday + used,
+        "daily_limit":       project.GeminiDailyLimit,
+        "daily_remaining":   project.GeminiDailyLimit - project.GeminiUsageToday - used,
+        "monthly_usage":     project.GeminiUsageMonth + used,
+        "monthly_limit":     project.GeminiMonthlyLimit,
+        "monthly_remaining": project.GeminiMonthlyLimit - project.GeminiUsageMonth - used,
+    }
+}
+
 // IframeSendMessage - For embed widget users with enhanced features
 func IframeSendMessage(c *gin.Context) {
     projectID := c.Param("projectId")
     startTime := time.Now() // Track response time
+    defer observeChatLatency("embed", startTime)
     
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -150,9 +236,10 @@ func IframeSendMessage(c *gin.Context) {
     }
 
     var messageData struct {
-        Message   string `json:"message"`
-        SessionID string `json:"session_id"`
-        UserToken string `json:"user_token"`
+        Message        string `json:"message"`
+        SessionID      string `json:"session_id"`
+        UserToken      string `json:"user_token"`
+        IdempotencyKey string `json:"idempotency_key"`
     }
 
     if err := c.ShouldBindJSON(&messageData); err != nil {
@@ -160,23 +247,26 @@ func IframeSendMessage(c *gin.Context) {
         return
     }
 
-    // Sanitize and validate input
-    messageData.Message = sanitizeInput(messageData.Message)
-    if messageData.Message == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+    // A retried submission gets the original response instead of a second answer
+    replayed, finish := beginIdempotentRequest(c, projectID, idempotencyKey(c, messageData.IdempotencyKey))
+    if replayed {
         return
     }
+    defer finish()
 
-    // Check rate limit
-    if !checkRateLimit(c.ClientIP()) {
-        c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before sending another message"})
+    // Validate and sanitize input
+    message, ok := validateMessageInput(c, messageData.Message)
+    if !ok {
         return
     }
+    messageData.Message = message
 
     // Get project details
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -188,51 +278,55 @@ func IframeSendMessage(c *gin.Context) {
         return
     }
 
-    // Enhanced: Check if Gemini is enabled
-    if !project.GeminiEnabled {
+    // Only allow the widget on the project's configured domains
+    if !embedOriginAllowed(c, project.AllowedDomains) {
         c.JSON(http.StatusForbidden, gin.H{
-            "error": "AI responses are currently disabled for this project",
-            "status": "gemini_disabled",
+            "error":  "This chat is not available on this website",
+            "status": "origin_not_allowed",
         })
         return
     }
 
-    // Enhanced: Check daily usage limits
-    if project.GeminiUsageToday >= project.GeminiDailyLimit {
-        c.JSON(http.StatusTooManyRequests, gin.H{
-            "error": "Daily AI usage limit reached for this project",
-            "status": "daily_limit_exceeded",
-            "usage_info": gin.H{
-                "daily_usage": project.GeminiUsageToday,
-                "daily_limit": project.GeminiDailyLimit,
-                "resets_at": getNextDailyReset(),
-            },
-        })
+    // Check the project's rate limit
+    if !checkRateLimit(c, project) {
+        return
+    }
+    // A widget that sent no session id gets one, returned below for it to keep
+    if messageData.SessionID, err = ensureSessionID(messageData.SessionID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start chat session"})
+        return
+    }
+    if rejectFullSession(c, project, messageData.SessionID) {
+        return
+    }
+    if messageData.Message, ok = rejectModeratedMessage(c, project, messageData.Message); !ok {
         return
     }
 
-    // Enhanced: Check monthly usage limits
-    if project.GeminiUsageMonth >= project.GeminiMonthlyLimit {
-        c.JSON(http.StatusTooManyRequests, gin.H{
-            "error": "Monthly AI usage limit reached for this project",
-            "status": "monthly_limit_exceeded",
-            "usage_info": gin.H{
-                "monthly_usage": project.GeminiUsageMonth,
-                "monthly_limit": project.GeminiMonthlyLimit,
-                "resets_at": getNextMonthlyReset(),
-            },
+    // Enhanced: Check if Gemini is enabled
+    if !project.GeminiEnabled {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error": "AI responses are currently disabled for this project",
+            "status": "gemini_disabled",
         })
         return
     }
 
+    // Enhanced: Check daily and monthly usage limits
+    if rejectOverUsageLimit(c, project) {
+        return
+    }
+
     // Get user info if token provided
     var user models.ChatUser
     if messageData.UserToken != "" {
-        userID, err := validateUserToken(messageData.UserToken)
+        userID, err := validateUserToken(messageData.UserToken, projectID)
         if err == nil {
             userCollection := config.DB.Collection("chat_users")
             userObjID, _ := primitive.ObjectIDFromHex(userID)
-            userCollection.FindOne(context.Background(), bson.M{"_id": userObjID}).Decode(&user)
+            ctx, cancel := requestContext(c)
+            userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+            cancel()
         }
     }
 
@@ -240,19 +334,53 @@ func IframeSendMessage(c *gin.Context) {
     var inputTokens, outputTokens int
     var success bool = true
     var errorMsg string
+    var genErr error
+    var calledGemini bool
+    var reservedCost float64
 
-    // First-message greeting logic + 4-second delay for all responses
-    time.Sleep(4 * time.Second) // uniform delay for all replies
+    // First-message greeting logic + configurable delay for all responses
+    applyResponseDelay(project) // uniform delay for all replies
 
+    knowledgeNotReady, repeated := false, false
     if isFirstMessage(objID, messageData.SessionID) {
         response = project.WelcomeMessage
+    } else if reply, notReady := knowledgeNotReadyReply(project); notReady {
+        response, knowledgeNotReady = reply, true
+    } else if reply, isRepeat := repeatedMessageReply(objID, messageData.SessionID, messageData.Message); isRepeat {
+        response, repeated = reply, true
     } else if project.GeminiAPIKey != "" {
+        // Count the request against the limits before calling Gemini so concurrent
+        // requests can't all pass the check above and overshoot
+        ctx, cancel := requestContext(c)
+        reservedCost = reservedGeminiCost(project.GeminiModel)
+        reserved, err := reserveGeminiUsage(ctx, objID, reservedCost)
+        cancel()
+        if err == mongo.ErrNoDocuments {
+            if !rejectOverUsageLimit(c, reserved) {
+                c.JSON(http.StatusTooManyRequests, gin.H{
+                    "error":  "AI usage limit reached for this project",
+                    "status": "limit_exceeded",
+                })
+            }
+            return
+        } else if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check usage limits"})
+            return
+        }
+        project.GeminiUsageToday = reserved.GeminiUsageToday - 1
+        project.GeminiUsageMonth = reserved.GeminiUsageMonth - 1
+
+        calledGemini = true
         response, inputTokens, outputTokens, err = generateGeminiResponseWithTracking(
-            project, messageData.Message, c.ClientIP(), user)
+            project, messageData.Message, c.ClientIP(), user, nil)
         if err != nil {
+            go releaseGeminiUsage(objID, reservedCost)
             success = false
+            genErr = err
             errorMsg = err.Error()
-            if user.Name != "" {
+            if isBlockedBySafety(err) {
+                response = blockedReply(err)
+            } else if user.Name != "" {
                 response = fmt.Sprintf("Hello %s! I'm having trouble answering just now. Please try again later.", user.Name)
             } else {
                 response = "I'm having trouble answering just now. Please try again later."
@@ -266,15 +394,33 @@ func IframeSendMessage(c *gin.Context) {
 
     // Enhanced: Calculate response time and track usage
     responseTime := time.Since(startTime).Milliseconds()
+    if calledGemini {
+        go trackGeminiUsage(objID, messageData.Message, response, getGeminiModel(project.GeminiModel),
+            inputTokens, outputTokens, responseTime, c.ClientIP(), genErr, reservedCost)
+    }
+
+    status := models.ChatReplySuccess
+    if knowledgeNotReady {
+        status = "knowledge_base_not_ready"
+    } else if repeated {
+        status = "repeated_message"
+    }
+    if !success {
+        status = "error"
+        if isBlockedBySafety(genErr) {
+            status = "content_blocked"
+        }
+    }
 
     // Save message to database with user info
-    saveMessage(objID, messageData.Message, response, messageData.SessionID, c.ClientIP(), user)
+    saveMessage(objID, messageData.Message, response, messageData.SessionID, c.ClientIP(), status, user)
 
     // Enhanced: Prepare response with detailed usage information
     responseData := gin.H{
         "response":   response,
         "project_id": projectID,
-        "status":     "success",
+        "session_id": messageData.SessionID,
+        "status":     status,
         "timestamp":  time.Now().Format(time.RFC3339),
         "user_name":  user.Name,
         "usage_info": gin.H{
@@ -287,9 +433,9 @@ func IframeSendMessage(c *gin.Context) {
             "tokens_used":     inputTokens + outputTokens,
         },
     }
+    addUsageOutlook(responseData["usage_info"].(gin.H), project, inputTokens+outputTokens, time.Now())
 
     if !success {
-        responseData["status"] = "error"
         responseData["error_details"] = errorMsg
     }
 
@@ -298,86 +444,26 @@ func IframeSendMessage(c *gin.Context) {
 
 // ===== AI RESPONSE GENERATION =====
 
-// generateAIResponse - Enhanced AI response generation for authenticated users
-func generateAIResponse(userMessage, pdfContent, geminiKey, projectName, geminiModel string) (string, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-    defer cancel()
-    
-    client, err := genai.NewClient(ctx, option.WithAPIKey(geminiKey))
-    if err != nil {
-        return "", fmt.Errorf("failed to create Gemini client: %v", err)
-    }
-    defer client.Close()
-    
-    // Use specified model or default
-    modelName := geminiModel
-    if modelName == "" {
-        modelName = "gemini-1.5-flash"
-    }
-    
-    model := client.GenerativeModel(modelName)
-    
-    // Configure model for better responses
-    model.SetTemperature(0.85)
-    model.SetTopP(0.9)
-    model.SetTopK(40)
-    
-    // Enhanced prompt with natural tone and anti-repetition
-    prompt := fmt.Sprintf(`
-You are a helpful AI assistant for %s. Respond naturally and conversationally without repeating phrases.
-
-KNOWLEDGE BASE:
-%s
-
-USER QUESTION:
-%s
-
-GUIDELINES:
-– Base the answer on the knowledge-base content when possible  
-– Use a warm, friendly tone (avoid robotic phrases)  
-– Keep it short: 2-3 well-formed sentences unless detail is essential  
-– **Never** repeat any word, phrase, or sentence in the same reply  
-– Vary your wording and sentence structure  
-– If the docs don't contain the answer, say so politely and offer general help  
-– End the reply naturally without filler or repetition.
-
-Answer:`, projectName, pdfContent, userMessage)
-    
-    resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-    if err != nil {
-        return "", fmt.Errorf("failed to generate content: %v", err)
-    }
-    
-    if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-        return fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]), nil
-    }
-    
-    return "I'm sorry, I couldn't generate a response at the moment. Please try again.", nil
-}
-
 // generateGeminiResponse - Enhanced response generation for embed users
 func generateGeminiResponse(project models.Project, userMessage, userIP string, user models.ChatUser) (string, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
     defer cancel()
     
-    client, err := genai.NewClient(ctx, option.WithAPIKey(project.GeminiAPIKey))
+    client, release, err := config.AcquireGeminiClient(decryptAPIKey(project.GeminiAPIKey))
     if err != nil {
         return "", err
     }
-    defer client.Close()
+    defer release()
 
     // Use specified model or default
     modelName := project.GeminiModel
     if modelName == "" {
-        modelName = "gemini-1.5-flash"
+        modelName = models.DefaultGeminiModel
     }
     
     model := client.GenerativeModel(modelName)
     
-    // Configure model for better responses
-    model.SetTemperature(0.85)
-    model.SetTopP(0.9)
-    model.SetTopK(40)
+    configureChatModel(model, project, defaultChatTemperature)
     
     // Personalized greeting if user is known
     userContext := ""
@@ -385,67 +471,75 @@ func generateGeminiResponse(project models.Project, userMessage, userIP string,
         userContext = fmt.Sprintf("The user's name is %s. ", user.Name)
     }
     
-    // Enhanced prompt with natural tone
-    prompt := fmt.Sprintf(`
-You are a helpful AI assistant for %s. %sRespond naturally and conversationally without repeating phrases.
-
-KNOWLEDGE BASE:
-%s
-
-USER QUESTION:
-%s
-
-GUIDELINES:
-– Base the answer on the knowledge-base content when possible  
-– Use a warm, friendly tone (avoid robotic phrases)  
-– Keep it short: 2-3 well-formed sentences unless detail is essential  
-– **Never** repeat any word, phrase, or sentence in the same reply  
-– Vary your wording and sentence structure  
-– If the docs don't contain the answer, say so politely and offer general help  
-– End the reply naturally without filler or repetition.
-
-Answer:`, project.Name, userContext, project.PDFContent, userMessage)
+    prompt := buildChatPrompt(buildSystemPrompt(project.SystemPrompt, project.Name, userContext), knowledgeContext(project, userMessage), userMessage, project.ForcedLanguage)
 
     resp, err := model.GenerateContent(ctx, genai.Text(prompt))
     if err != nil {
         return "", err
     }
 
-    if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-        response := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-        
-        // Log usage asynchronously
-        go logGeminiUsage(project.ID, userMessage, response, userIP, user)
-        
-        return response, nil
+    response, err := responseText(resp)
+    if err != nil {
+        return "", err
     }
 
-    return "", fmt.Errorf("no response generated")
+    // Log usage asynchronously
+    go logGeminiUsage(project.ID, userMessage, response, userIP, user)
+
+    return response, nil
+}
+
+// Progress events reported to streaming clients while a reply is generated
+const (
+    chatEventThinking  = "thinking"
+    chatEventSearching = "searching_knowledge_base"
+    chatEventTyping    = "typing"
+)
+
+// defaultChatTemperature is the sampling temperature for chat replies
+const defaultChatTemperature = 0.85
+
+// configureChatModel - Apply the sampling parameters and the project's safety settings
+// shared by every chat reply, so no path generates without the project's moderation
+func configureChatModel(model *genai.GenerativeModel, project models.Project, temperature float32) {
+    model.SetTemperature(temperature)
+    model.SetTopP(0.9)
+    model.SetTopK(40)
+    model.SafetySettings = geminiSafetySettings(project)
+}
+
+// generateGeminiResponseWithTracking - Enhanced AI response generation with token tracking.
+// onProgress, when set, is called with each chat event as generation moves along.
+func generateGeminiResponseWithTracking(project models.Project, userMessage, userIP string, user models.ChatUser, onProgress func(event string)) (string, int, int, error) {
+    return generateGeminiResponseWithTemperature(project, userMessage, userIP, user, onProgress, defaultChatTemperature)
 }
 
-// generateGeminiResponseWithTracking - Enhanced AI response generation with token tracking
-func generateGeminiResponseWithTracking(project models.Project, userMessage, userIP string, user models.ChatUser) (string, int, int, error) {
+// generateGeminiResponseWithTemperature - generateGeminiResponseWithTracking with a chosen sampling temperature
+func generateGeminiResponseWithTemperature(project models.Project, userMessage, userIP string, user models.ChatUser, onProgress func(event string), temperature float32) (string, int, int, error) {
+    progress := func(event string) {
+        if onProgress != nil {
+            onProgress(event)
+        }
+    }
+
     ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
     defer cancel()
     
-    client, err := genai.NewClient(ctx, option.WithAPIKey(project.GeminiAPIKey))
+    client, release, err := config.AcquireGeminiClient(decryptAPIKey(project.GeminiAPIKey))
     if err != nil {
         return "", 0, 0, fmt.Errorf("failed to create Gemini client: %v", err)
     }
-    defer client.Close()
+    defer release()
 
     // Use specified model or default
     modelName := project.GeminiModel
     if modelName == "" {
-        modelName = "gemini-1.5-flash"
+        modelName = models.DefaultGeminiModel
     }
     
     model := client.GenerativeModel(modelName)
     
-    // Configure model for better responses
-    model.SetTemperature(0.85)
-    model.SetTopP(0.9)
-    model.SetTopK(40)
+    configureChatModel(model, project, temperature)
     
     // Personalized greeting if user is known
     userContext := ""
@@ -453,9 +547,36 @@ func generateGeminiResponseWithTracking(project models.Project, userMessage, use
         userContext = fmt.Sprintf("The user's name is %s. ", user.Name)
     }
     
-    // Enhanced prompt with anti-repetition and natural tone instructions
-    prompt := fmt.Sprintf(`
-You are a helpful AI assistant for %s. %sRespond naturally and conversationally without repeating phrases.
+    progress(chatEventSearching)
+    knowledgeBase := knowledgeContext(project, userMessage)
+    prompt := buildChatPrompt(buildSystemPrompt(project.SystemPrompt, project.Name, userContext), knowledgeBase, userMessage, project.ForcedLanguage)
+
+    progress(chatEventTyping)
+    resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+    if err != nil {
+        return "", 0, 0, fmt.Errorf("failed to generate content: %w", err)
+    }
+
+    response, err := responseText(resp)
+    if err != nil {
+        return "", 0, 0, err
+    }
+
+    // Prefer the exact counts Gemini reports, estimate only when metadata is missing
+    inputTokens, outputTokens := tokenCountsFromResponse(resp, prompt, response)
+
+    return response, inputTokens, outputTokens, nil
+}
+
+// buildChatPrompt - Full prompt sent to Gemini: instructions, knowledge base, the
+// user's question and the tone guidelines. Without a knowledge base the model is told
+// to answer as a general assistant.
+func buildChatPrompt(instructions, knowledgeBase, userMessage, forcedLanguage string) string {
+    if strings.TrimSpace(knowledgeBase) == "" {
+        return buildGeneralChatPrompt(instructions, userMessage, forcedLanguage)
+    }
+    return fmt.Sprintf(`
+%s
 
 KNOWLEDGE BASE:
 %s
@@ -470,32 +591,59 @@ GUIDELINES:
 – **Never** repeat any word, phrase, or sentence in the same reply  
 – Vary your wording and sentence structure  
 – If the docs don't contain the answer, say so politely and offer general help  
-– End the reply naturally without filler or repetition.
+– End the reply naturally without filler or repetition.%s
 
-Answer:`, project.Name, userContext, project.PDFContent, userMessage)
+Answer:`, instructions, knowledgeBase, userMessage, languageGuideline(forcedLanguage, userMessage))
+}
 
-    resp, err := model.GenerateContent(ctx, genai.Text(prompt))
-    if err != nil {
-        return "", 0, 0, fmt.Errorf("failed to generate content: %v", err)
-    }
+// buildGeneralChatPrompt - buildChatPrompt for a project with no usable knowledge base
+func buildGeneralChatPrompt(instructions, userMessage, forcedLanguage string) string {
+    return fmt.Sprintf(`
+%s
+
+USER QUESTION:
+%s
+
+GUIDELINES:
+– No reference documents are available yet, so answer from general knowledge  
+– If the question needs details only the business's own documents would have, say politely that you don't have that information yet  
+– Never invent prices, policies, contact details or other specifics  
+– Use a warm, friendly tone (avoid robotic phrases)  
+– Keep it short: 2-3 well-formed sentences unless detail is essential  
+– End the reply naturally without filler or repetition.%s
+
+Answer:`, instructions, userMessage, languageGuideline(forcedLanguage, userMessage))
+}
 
-    if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-        response := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-        
-        // Estimate token usage (approximate values since Gemini API doesn't return exact counts)
-        inputTokens := estimateTokens(prompt)
-        outputTokens := estimateTokens(response)
-        
-        return response, inputTokens, outputTokens, nil
+// languageGuideline - Extra guideline telling the model which language to answer in.
+// The project's forced language wins; otherwise non-English questions are answered
+// in the language they were asked in.
+func languageGuideline(forcedLanguage, userMessage string) string {
+    if language := strings.TrimSpace(forcedLanguage); language != "" {
+        return fmt.Sprintf("\n– Always reply in %s", language)
     }
+    if language := utils.DetectLanguage(html.UnescapeString(userMessage)); language != "" && language != "English" {
+        return fmt.Sprintf("\n– The user wrote in %s: reply in %s", language, language)
+    }
+    return ""
+}
 
-    return "", 0, 0, fmt.Errorf("no response generated")
+// buildSystemPrompt - Opening instructions for the prompt; uses the project's own
+// system prompt when configured and the default assistant persona otherwise
+func buildSystemPrompt(systemPrompt, projectName, userContext string) string {
+    if strings.TrimSpace(systemPrompt) != "" {
+        return strings.TrimSpace(systemPrompt + " " + userContext)
+    }
+    return fmt.Sprintf("You are a helpful AI assistant for %s. %sRespond naturally and conversationally without repeating phrases.", projectName, userContext)
 }
 
 // ===== CHAT HISTORY AND ANALYTICS =====
 
 // GetChatHistory - Retrieve chat history with enhanced filtering
 func GetChatHistory(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     sessionID := c.Query("session_id")
     limit := c.DefaultQuery("limit", "50")
@@ -511,28 +659,31 @@ func GetChatHistory(c *gin.Context) {
     if sessionID != "" {
         filter["session_id"] = sessionID
     }
+    if !addHistoryFilters(c, filter) {
+        return
+    }
     
     // Pagination options
     opts := options.Find().
-        SetSort(bson.D{{"timestamp", -1}}).
+        SetSort(bson.D{{Key: "timestamp", Value: -1}}).
         SetLimit(50) // Max 50 messages per request
     
     collection := config.DB.Collection("chat_messages")
-    cursor, err := collection.Find(context.Background(), filter, opts)
+    cursor, err := collection.Find(ctx, filter, opts)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chat history"})
         return
     }
-    defer cursor.Close(context.Background())
+    defer cursor.Close(ctx)
     
     var messages []models.ChatMessage
-    if err := cursor.All(context.Background(), &messages); err != nil {
+    if err := cursor.All(ctx, &messages); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse chat history"})
         return
     }
     
     // Get total count
-    totalCount, _ := collection.CountDocuments(context.Background(), filter)
+    totalCount, _ := collection.CountDocuments(ctx, filter)
     
     c.JSON(http.StatusOK, gin.H{
         "messages":    messages,
@@ -543,8 +694,68 @@ func GetChatHistory(c *gin.Context) {
     })
 }
 
+// addHistoryFilters - Narrow a chat history query by the min_rating, max_rating (1-5),
+// from, to (RFC3339 or YYYY-MM-DD) and has_feedback=true query parameters. Writes a
+// 400 and returns false when one is invalid.
+func addHistoryFilters(c *gin.Context, filter bson.M) bool {
+    rating := bson.M{}
+    for param, operator := range map[string]string{"min_rating": "$gte", "max_rating": "$lte"} {
+        value := c.Query(param)
+        if value == "" {
+            continue
+        }
+        bound, err := strconv.Atoi(value)
+        if err != nil || bound < 1 || bound > 5 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be between 1 and 5", param)})
+            return false
+        }
+        rating[operator] = bound
+    }
+    if minRating, ok := rating["$gte"].(int); ok {
+        if maxRating, ok := rating["$lte"].(int); ok && minRating > maxRating {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "min_rating cannot be greater than max_rating"})
+            return false
+        }
+    } else if len(rating) > 0 {
+        // Unrated messages have no rating, so an upper bound alone still needs one
+        rating["$gte"] = 1
+    }
+    if len(rating) > 0 {
+        filter["rating"] = rating
+    }
+
+    timestamp := bson.M{}
+    if from := c.Query("from"); from != "" {
+        fromTime, err := parseExportDate(from, false)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date"})
+            return false
+        }
+        timestamp["$gte"] = fromTime
+    }
+    if to := c.Query("to"); to != "" {
+        toTime, err := parseExportDate(to, true)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date"})
+            return false
+        }
+        timestamp["$lte"] = toTime
+    }
+    if len(timestamp) > 0 {
+        filter["timestamp"] = timestamp
+    }
+
+    if c.Query("has_feedback") == "true" {
+        filter["feedback"] = bson.M{"$exists": true, "$ne": ""}
+    }
+    return true
+}
+
 // GetChatAnalytics - Get chat analytics for a project
 func GetChatAnalytics(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -555,11 +766,11 @@ func GetChatAnalytics(c *gin.Context) {
     collection := config.DB.Collection("chat_messages")
     
     // Get total messages count
-    totalMessages, _ := collection.CountDocuments(context.Background(), bson.M{"project_id": objID})
+    totalMessages, _ := collection.CountDocuments(ctx, bson.M{"project_id": objID})
     
     // Get messages from last 7 days
     weekAgo := time.Now().AddDate(0, 0, -7)
-    recentMessages, _ := collection.CountDocuments(context.Background(), bson.M{
+    recentMessages, _ := collection.CountDocuments(ctx, bson.M{
         "project_id": objID,
         "timestamp":  bson.M{"$gte": weekAgo},
     })
@@ -571,9 +782,9 @@ func GetChatAnalytics(c *gin.Context) {
         {"$count": "unique_sessions"},
     }
     
-    cursor, _ := collection.Aggregate(context.Background(), pipeline)
+    cursor, _ := collection.Aggregate(ctx, pipeline)
     var result []bson.M
-    cursor.All(context.Background(), &result)
+    cursor.All(ctx, &result)
     
     uniqueSessions := int64(0)
     if len(result) > 0 {
@@ -582,14 +793,178 @@ func GetChatAnalytics(c *gin.Context) {
         }
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    response := gin.H{
         "total_messages":  totalMessages,
         "recent_messages": recentMessages,
         "unique_sessions": uniqueSessions,
         "period":          "last_7_days",
+    }
+    if ratings, err := getRatingSummary(ctx, objID, totalMessages); err == nil {
+        response["ratings"] = ratings
+    }
+    if helpful, err := getHelpfulSummary(ctx, objID); err == nil {
+        response["helpful"] = helpful
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// GetRatingAnalytics - Rating statistics and the latest written feedback for a project
+func GetRatingAnalytics(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    limit, _ := strconv.Atoi(c.DefaultQuery("feedback_limit", "10"))
+    if limit < 1 || limit > 100 {
+        limit = 10
+    }
+
+    collection := config.DB.Collection("chat_messages")
+    totalMessages, err := collection.CountDocuments(ctx, bson.M{"project_id": objID})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rating analytics"})
+        return
+    }
+
+    ratings, err := getRatingSummary(ctx, objID, totalMessages)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rating analytics"})
+        return
+    }
+
+    // Most recent ratings that came with written feedback
+    opts := options.Find().
+        SetSort(bson.D{{Key: "rated_at", Value: -1}}).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, bson.M{
+        "project_id": objID,
+        "rating":     bson.M{"$gte": 1},
+        "feedback":   bson.M{"$exists": true, "$ne": ""},
+    }, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback"})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    var messages []models.ChatMessage
+    if err := cursor.All(ctx, &messages); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse feedback"})
+        return
+    }
+
+    recentFeedback := make([]gin.H, 0, len(messages))
+    for _, message := range messages {
+        recentFeedback = append(recentFeedback, gin.H{
+            "message_id": message.ID,
+            "session_id": message.SessionID,
+            "user_name":  message.UserName,
+            "message":    message.Message,
+            "response":   message.Response,
+            "rating":     message.Rating,
+            "feedback":   message.Feedback,
+            "rated_at":   message.RatedAt,
+        })
+    }
+
+    helpful, err := getHelpfulSummary(ctx, objID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rating analytics"})
+        return
+    }
+
+    ratings["recent_feedback"] = recentFeedback
+    ratings["total_messages"] = totalMessages
+    c.JSON(http.StatusOK, gin.H{
+        "success":    true,
+        "project_id": projectID,
+        "ratings":    ratings,
+        "helpful":    helpful,
     })
 }
 
+// getHelpfulSummary - Thumbs up/down counts for a project
+func getHelpfulSummary(ctx context.Context, projectID primitive.ObjectID) (gin.H, error) {
+    collection := config.DB.Collection("chat_messages")
+    helpful, err := collection.CountDocuments(ctx, bson.M{"project_id": projectID, "helpful": true})
+    if err != nil {
+        return nil, err
+    }
+    unhelpful, err := collection.CountDocuments(ctx, bson.M{"project_id": projectID, "helpful": false})
+    if err != nil {
+        return nil, err
+    }
+
+    helpfulPercentage := 0.0
+    if total := helpful + unhelpful; total > 0 {
+        helpfulPercentage = math.Round(float64(helpful)/float64(total)*10000) / 100
+    }
+
+    return gin.H{
+        "helpful_count":      helpful,
+        "unhelpful_count":    unhelpful,
+        "helpful_percentage": helpfulPercentage,
+    }, nil
+}
+
+// getRatingSummary - Average rating, per-star distribution and share of rated messages
+func getRatingSummary(ctx context.Context, projectID primitive.ObjectID, totalMessages int64) (gin.H, error) {
+    pipeline := []bson.M{
+        {"$match": bson.M{"project_id": projectID, "rating": bson.M{"$gte": 1, "$lte": 5}}},
+        {"$group": bson.M{"_id": "$rating", "count": bson.M{"$sum": 1}}},
+    }
+
+    cursor, err := config.DB.Collection("chat_messages").Aggregate(ctx, pipeline)
+    if err != nil {
+        return nil, err
+    }
+    var groups []ratingGroup
+    if err := cursor.All(ctx, &groups); err != nil {
+        return nil, err
+    }
+    return summarizeRatings(groups, totalMessages), nil
+}
+
+// ratingGroup - Number of messages given one star rating
+type ratingGroup struct {
+    Rating int   `bson:"_id"`
+    Count  int64 `bson:"count"`
+}
+
+// summarizeRatings - Average, per-star distribution and rated share from per-rating counts
+func summarizeRatings(groups []ratingGroup, totalMessages int64) gin.H {
+    distribution := gin.H{"1": int64(0), "2": int64(0), "3": int64(0), "4": int64(0), "5": int64(0)}
+    var ratedMessages, ratingSum int64
+    for _, group := range groups {
+        distribution[strconv.Itoa(group.Rating)] = group.Count
+        ratedMessages += group.Count
+        ratingSum += int64(group.Rating) * group.Count
+    }
+
+    averageRating := 0.0
+    if ratedMessages > 0 {
+        averageRating = math.Round(float64(ratingSum)/float64(ratedMessages)*100) / 100
+    }
+    ratedPercentage := 0.0
+    if totalMessages > 0 {
+        ratedPercentage = math.Round(float64(ratedMessages)/float64(totalMessages)*10000) / 100
+    }
+
+    return gin.H{
+        "average_rating":   averageRating,
+        "rated_messages":   ratedMessages,
+        "rated_percentage": ratedPercentage,
+        "distribution":     distribution,
+    }
+}
+
 // ===== UTILITY FUNCTIONS =====
 
 // isFirstMessage returns true the very first time a given session_id
@@ -603,8 +978,34 @@ func isFirstMessage(projectID primitive.ObjectID, sessionID string) bool {
     return count == 0
 }
 
-// saveMessage - Save chat message with user context
-func saveMessage(projectID primitive.ObjectID, message, response, sessionID, userIP string, user models.ChatUser) {
+// ensureSessionID - The client's session id, or a new random one when it sent none, so
+// the conversation's history and isFirstMessage aren't shared with every other
+// client that left it out
+func ensureSessionID(sessionID string) (string, error) {
+    if sessionID = strings.TrimSpace(sessionID); sessionID != "" {
+        return sessionID, nil
+    }
+    raw := make([]byte, 16)
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+    return "sess_" + hex.EncodeToString(raw), nil
+}
+
+// observeChatLatency records how long a chat message request took
+func observeChatLatency(endpoint string, start time.Time) {
+    utils.ChatResponseLatency.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+}
+
+// applyResponseDelay - Pause for the project's configured human-like delay (none when 0)
+func applyResponseDelay(project models.Project) {
+    if project.ResponseDelayMs > 0 {
+        time.Sleep(time.Duration(project.ResponseDelayMs) * time.Millisecond)
+    }
+}
+
+// saveMessage - Save chat message with user context and the reply's status
+func saveMessage(projectID primitive.ObjectID, message, response, sessionID, userIP, status string, user models.ChatUser) {
     chatMessage := models.ChatMessage{
         ProjectID: projectID,
         SessionID: sessionID,
@@ -613,6 +1014,7 @@ func saveMessage(projectID primitive.ObjectID, message, response, sessionID, use
         IsUser:    false,
         Timestamp: time.Now(),
         IPAddress: userIP,
+        Status:    status,
     }
     
     // Add user info if available
@@ -626,22 +1028,39 @@ func saveMessage(projectID primitive.ObjectID, message, response, sessionID, use
     _, err := chatCollection.InsertOne(context.Background(), chatMessage)
     if err != nil {
         fmt.Printf("Failed to save chat message: %v\n", err)
+        return
     }
+    recordSessionActivity(projectID, sessionID, userIP, user.ID)
 }
 
-// updateGeminiUsage - Update usage counters
-func updateGeminiUsage(projectID primitive.ObjectID) {
-    collection := config.DB.Collection("projects")
-    _, err := collection.UpdateOne(
-        context.Background(),
-        bson.M{"_id": projectID},
+// recordSessionActivity - Create the chat session on its first message and keep its
+// activity and message count current. A message on an ended session reopens it.
+func recordSessionActivity(projectID primitive.ObjectID, sessionID, userIP string, userID primitive.ObjectID) {
+    if sessionID == "" {
+        return
+    }
+
+    now := time.Now()
+    onInsert := bson.M{"start_time": now, "ip_address": userIP}
+    if !userID.IsZero() {
+        onInsert["user_id"] = userID
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    defer cancel()
+    _, err := config.DB.Collection("chat_sessions").UpdateOne(
+        ctx,
+        bson.M{"project_id": projectID, "session_id": sessionID},
         bson.M{
-            "$inc": bson.M{"gemini_usage": 1, "total_questions": 1},
-            "$set": bson.M{"last_used": time.Now()},
+            "$setOnInsert": onInsert,
+            "$set":         bson.M{"is_active": true, "last_activity": now},
+            "$unset":       bson.M{"end_time": ""},
+            "$inc":         bson.M{"message_count": 1},
         },
+        options.Update().SetUpsert(true),
     )
     if err != nil {
-        fmt.Printf("Failed to update Gemini usage: %v\n", err)
+        fmt.Printf("Failed to record chat session: %v\n", err)
     }
 }
 
@@ -668,47 +1087,352 @@ func logGeminiUsage(projectID primitive.ObjectID, question, response, userIP str
     }
 }
 
-// sanitizeInput - Clean and validate user input
-func sanitizeInput(input string) string {
-    // Remove HTML tags and trim whitespace
-    cleaned := html.EscapeString(strings.TrimSpace(input))
-    
-    // Limit message length
-    if len(cleaned) > 1000 {
-        cleaned = cleaned[:1000]
+// maxMessageLength - Longest accepted chat message in characters, from MAX_MESSAGE_LENGTH
+func maxMessageLength() int {
+    if value, err := strconv.Atoi(os.Getenv("MAX_MESSAGE_LENGTH")); err == nil && value > 0 {
+        return value
     }
-    
-    return cleaned
+    return models.DefaultMaxMessageLength
 }
 
-// checkRateLimit - Simple rate limiting (implement with Redis for production)
-func checkRateLimit(userIP string) bool {
-    // For now, return true. In production, implement Redis-based rate limiting
-    // Allow max 10 messages per minute per IP
+// validateMessageInput - Trim, validate and HTML-escape a chat message.
+// Writes a structured error and returns false when the message is empty or too long.
+func validateMessageInput(c *gin.Context, input string) (string, bool) {
+    trimmed := trimMessageInput(input)
+    if trimmed == "" {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":  "Message cannot be empty",
+            "status": "empty_message",
+        })
+        return "", false
+    }
+
+    // The limit applies to what the user typed, before escaping
+    maxLength := maxMessageLength()
+    if length := utf8.RuneCountInString(trimmed); length > maxLength {
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+            "error":      fmt.Sprintf("Message must be at most %d characters", maxLength),
+            "status":     "message_too_long",
+            "length":     length,
+            "max_length": maxLength,
+        })
+        return "", false
+    }
+
+    return html.EscapeString(trimmed), true
+}
+
+// trimMessageInput - Strip surrounding whitespace from a chat message. Invisible format
+// characters (zero-width spaces etc.) count as blank.
+func trimMessageInput(input string) string {
+    return strings.TrimFunc(input, func(r rune) bool {
+        return unicode.IsSpace(r) || unicode.In(r, unicode.Cc, unicode.Cf)
+    })
+}
+
+// sessionLimitMessage is the reply once a session holds the project's maximum number of messages
+const sessionLimitMessage = "This conversation has reached its length limit. Please start a new chat to continue."
+
+// sessionAtMessageLimit - Whether the session already holds the project's maximum number
+// of messages. Only that session's messages count; sessions without an ID are never capped.
+func sessionAtMessageLimit(ctx context.Context, project models.Project, sessionID string) bool {
+    if project.MaxSessionMessages <= 0 || sessionID == "" {
+        return false
+    }
+    count, err := config.DB.Collection("chat_messages").CountDocuments(ctx,
+        bson.M{"project_id": project.ID, "session_id": sessionID},
+        options.Count().SetLimit(int64(project.MaxSessionMessages)))
+    return err == nil && count >= int64(project.MaxSessionMessages)
+}
+
+// rejectFullSession - Reply asking the user to start a new chat when the session is at
+// the project's message cap. Returns true when the response has been written.
+func rejectFullSession(c *gin.Context, project models.Project, sessionID string) bool {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    if !sessionAtMessageLimit(ctx, project, sessionID) {
+        return false
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "response":             sessionLimitMessage,
+        "status":               "session_limit_reached",
+        "session_id":           sessionID,
+        "max_session_messages": project.MaxSessionMessages,
+    })
     return true
 }
 
-// validateUserToken - Validate user authentication token
-func validateUserToken(token string) (string, error) {
-    // Simple token validation - implement proper JWT validation in production
-    if len(token) < 24 {
+// checkRateLimit - Apply the project's per-minute message limit to the client IP.
+// The 429 response is written when the limit is exceeded.
+func checkRateLimit(c *gin.Context, project models.Project) bool {
+    return middleware.ProjectRateLimit(c, project.ID.Hex(), project.RateLimitPerMinute)
+}
+
+// rejectOverUsageLimit - Respond 429 when the project has used up its daily or monthly
+// Gemini allowance. Returns true when the response has been written.
+func rejectOverUsageLimit(c *gin.Context, project models.Project) bool {
+    if project.GeminiUsageToday >= project.GeminiDailyLimit {
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error": "Daily AI usage limit reached for this project",
+            "status": "daily_limit_exceeded",
+            "usage_info": gin.H{
+                "daily_usage": project.GeminiUsageToday,
+                "daily_limit": project.GeminiDailyLimit,
+                "resets_at": getNextDailyReset(),
+            },
+        })
+        return true
+    }
+
+    if project.GeminiUsageMonth >= project.GeminiMonthlyLimit {
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error": "Monthly AI usage limit reached for this project",
+            "status": "monthly_limit_exceeded",
+            "usage_info": gin.H{
+                "monthly_usage": project.GeminiUsageMonth,
+                "monthly_limit": project.GeminiMonthlyLimit,
+                "resets_at": getNextMonthlyReset(project),
+            },
+        })
+        return true
+    }
+
+    if overCostBudget(project, reservedGeminiCost(project.GeminiModel)) {
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error": "Monthly AI budget used up for this project",
+            "status": "budget_exceeded",
+            "usage_info": gin.H{
+                "estimated_cost_month": project.EstimatedCostMonth,
+                "monthly_cost_budget": project.MonthlyCostBudget,
+                "resets_at": getNextMonthlyReset(project),
+            },
+        })
+        return true
+    }
+
+    // Past the token limit requests carry on with a warning until the grace allowance is used up too
+    if project.MonthlyTokenLimit > 0 && project.TokensUsedMonth >= config.TokenGraceCeiling(project.MonthlyTokenLimit) {
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error": "Monthly token allowance used up for this project",
+            "status": "token_limit_exceeded",
+            "usage_info": gin.H{
+                "tokens_used": project.TokensUsedMonth,
+                "token_limit": project.MonthlyTokenLimit,
+                "grace_limit": config.TokenGraceCeiling(project.MonthlyTokenLimit),
+                "resets_at": getNextMonthlyReset(project),
+            },
+        })
+        return true
+    }
+    return false
+}
+
+// Thresholds at which the widget is warned about running out of service
+const (
+    usageWarningPercent = 80
+    expiryWarningDays   = 7
+)
+
+// addUsageOutlook - Add the remaining token allowance, days until expiry and, when the
+// project is close to a limit or to expiring, a warning for the widget to show.
+// tokensUsed counts this request, which isn't reflected in project yet.
+func addUsageOutlook(usageInfo gin.H, project models.Project, tokensUsed int, now time.Time) {
+    var warnings []string
+
+    // Highest share of any allowance, including this request
+    percent := func(used, limit int) float64 {
+        if limit <= 0 {
+            return 0
+        }
+        return float64(used) / float64(limit) * 100
+    }
+    usage := percent(project.GeminiUsageToday+1, project.GeminiDailyLimit)
+    if monthly := percent(project.GeminiUsageMonth+1, project.GeminiMonthlyLimit); monthly > usage {
+        usage = monthly
+    }
+
+    if project.MonthlyTokenLimit > 0 {
+        used := project.TokensUsedMonth + tokensUsed
+        remaining := project.MonthlyTokenLimit - used
+        if remaining < 0 {
+            remaining = 0
+        }
+        usageInfo["tokens_remaining"] = remaining
+        if tokens := percent(used, project.MonthlyTokenLimit); tokens > usage {
+            usage = tokens
+        }
+        if used >= project.MonthlyTokenLimit {
+            // In the grace allowance: still answering, but not for long
+            graceRemaining := config.TokenGraceCeiling(project.MonthlyTokenLimit) - used
+            if graceRemaining < 0 {
+                graceRemaining = 0
+            }
+            usageInfo["in_grace_period"] = true
+            usageInfo["grace_tokens_remaining"] = graceRemaining
+            warnings = append(warnings, "This service has used its monthly token allowance and will stop answering soon")
+        }
+    }
+    if project.MonthlyCostBudget > 0 {
+        if spent := project.EstimatedCostMonth / project.MonthlyCostBudget * 100; spent > usage {
+            usage = spent
+        }
+    }
+    if usage > usageWarningPercent {
+        warnings = append(warnings, fmt.Sprintf("This service has used %.0f%% of its allowance", usage))
+    }
+
+    if !project.ExpiryDate.IsZero() {
+        days := int(math.Ceil(project.ExpiryDate.Sub(now).Hours() / 24))
+        if days < 0 {
+            days = 0
+        }
+        usageInfo["days_until_expiry"] = days
+        if days <= expiryWarningDays {
+            warnings = append(warnings, fmt.Sprintf("This service expires in %d day(s)", days))
+        }
+    }
+
+    if len(warnings) > 0 {
+        usageInfo["warning"] = strings.Join(warnings, ". ")
+    }
+}
+
+// Tokens assumed for a request whose real usage isn't known yet: about a full knowledge
+// context and question in, a long answer out
+const (
+    reservedInputTokens  = 4000
+    reservedOutputTokens = 1000
+)
+
+// reservedGeminiCost - The cost held against a project's budget while a request to model runs
+func reservedGeminiCost(model string) float64 {
+    return calculateGeminiCost(getGeminiModel(model), reservedInputTokens, reservedOutputTokens)
+}
+
+// overCostBudget - Whether a request costing cost would take the project past its monthly
+// budget; reserveGeminiUsage applies the same rule atomically
+func overCostBudget(project models.Project, cost float64) bool {
+    return project.MonthlyCostBudget > 0 && project.EstimatedCostMonth+cost > project.MonthlyCostBudget
+}
+
+// reserveGeminiUsage - Atomically count one Gemini request against the daily and monthly
+// limits and add its estimated cost to the month's spend, returning the updated project.
+// The same update refuses the request when that cost would take the project past its
+// monthly budget, so concurrent requests can't all start once it is spent. The caller
+// gives the cost back with releaseGeminiUsage on failure, or corrects it to the real
+// cost through trackGeminiUsage. When a limit is already reached nothing is changed,
+// mongo.ErrNoDocuments is returned and the project holds the current counters.
+func reserveGeminiUsage(ctx context.Context, projectID primitive.ObjectID, cost float64) (models.Project, error) {
+    collection := config.DB.Collection("projects")
+
+    var project models.Project
+    err := collection.FindOneAndUpdate(
+        ctx,
+        bson.M{
+            "_id": projectID,
+            "$expr": bson.M{"$and": bson.A{
+                bson.M{"$lt": bson.A{"$gemini_usage_today", "$gemini_daily_limit"}},
+                bson.M{"$lt": bson.A{"$gemini_usage_month", "$gemini_monthly_limit"}},
+                bson.M{"$or": bson.A{
+                    bson.M{"$lte": bson.A{bson.M{"$ifNull": bson.A{"$monthly_cost_budget", 0}}, 0}},
+                    bson.M{"$lte": bson.A{
+                        bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$estimated_cost_month", 0}}, cost}},
+                        "$monthly_cost_budget",
+                    }},
+                }},
+            }},
+        },
+        bson.M{"$inc": bson.M{
+            "gemini_usage_today":   1,
+            "gemini_usage_month":   1,
+            "estimated_cost_today": cost,
+            "estimated_cost_month": cost,
+        }},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&project)
+    if err == mongo.ErrNoDocuments {
+        if findErr := collection.FindOne(ctx, bson.M{"_id": projectID}).Decode(&project); findErr != nil {
+            return project, findErr
+        }
+    }
+    return project, err
+}
+
+// releaseGeminiUsage - Return a reservation and its reserved cost after a failed Gemini
+// call, since only successful responses count towards the limits
+func releaseGeminiUsage(projectID primitive.ObjectID, cost float64) {
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    defer cancel()
+    _, err := config.DB.Collection("projects").UpdateOne(
+        ctx,
+        bson.M{"_id": projectID},
+        bson.M{"$inc": bson.M{
+            "gemini_usage_today":   -1,
+            "gemini_usage_month":   -1,
+            "estimated_cost_today": -cost,
+            "estimated_cost_month": -cost,
+        }},
+    )
+    if err != nil {
+        fmt.Printf("Failed to release Gemini usage: %v\n", err)
+    }
+}
+
+// validateUserToken - Verify a chat user's signed token and return the user ID.
+// Tokens issued for another project are rejected.
+func validateUserToken(token, projectID string) (string, error) {
+    claims := jwt.MapClaims{}
+    if _, err := config.ParseJWT(token, claims); err != nil {
+        if userID, legacyErr := validateLegacyUserToken(token); legacyErr == nil {
+            return userID, nil
+        }
         return "", fmt.Errorf("invalid token")
     }
     
-    // Extract user ID from token (first 24 characters should be ObjectID)
-    userID := token[:24]
+    if tokenType, _ := claims["type"].(string); tokenType != chatUserTokenType {
+        return "", fmt.Errorf("invalid token type")
+    }
+    if tokenProject, _ := claims["project_id"].(string); tokenProject != projectID {
+        return "", fmt.Errorf("token not valid for this project")
+    }
     
-    // Validate if it's a valid ObjectID
-    _, err := primitive.ObjectIDFromHex(userID)
-    if err != nil {
+    userID, _ := claims["user_id"].(string)
+    if _, err := primitive.ObjectIDFromHex(userID); err != nil {
         return "", fmt.Errorf("invalid user ID in token")
     }
     
     return userID, nil
 }
 
+// validateLegacyUserToken - Accept pre-JWT "userID_random_unixtime" tokens while
+// ALLOW_LEGACY_CHAT_TOKENS is enabled and the token is younger than the JWT lifetime
+func validateLegacyUserToken(token string) (string, error) {
+    if os.Getenv("ALLOW_LEGACY_CHAT_TOKENS") != "true" {
+        return "", fmt.Errorf("legacy tokens are not accepted")
+    }
+    
+    parts := strings.Split(token, "_")
+    if len(parts) != 3 {
+        return "", fmt.Errorf("invalid token")
+    }
+    
+    if _, err := primitive.ObjectIDFromHex(parts[0]); err != nil {
+        return "", fmt.Errorf("invalid user ID in token")
+    }
+    
+    issuedAt, err := strconv.ParseInt(parts[2], 10, 64)
+    if err != nil || time.Since(time.Unix(issuedAt, 0)) > chatUserTokenTTL {
+        return "", fmt.Errorf("token expired")
+    }
+    
+    return parts[0], nil
+}
+
 // RateMessage - Allow users to rate responses
 func RateMessage(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     messageID := c.Param("messageId")
     objID, err := primitive.ObjectIDFromHex(messageID)
     if err != nil {
@@ -734,7 +1458,7 @@ func RateMessage(c *gin.Context) {
     // Update message with rating
     collection := config.DB.Collection("chat_messages")
     _, err = collection.UpdateOne(
-        context.Background(),
+        ctx,
         bson.M{"_id": objID},
         bson.M{"$set": bson.M{
             "rating":          rating.Rating,
@@ -751,24 +1475,155 @@ func RateMessage(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"message": "Rating saved successfully"})
 }
 
-// calculateGeminiCost - Cost calculation function
-func calculateGeminiCost(model string, inputTokens, outputTokens int) float64 {
-    var inputCostPer1K, outputCostPer1K float64
-    
-    switch model {
-    case "gemini-1.5-flash":
-        inputCostPer1K = 0.000075   // $0.075 per 1K input tokens
-        outputCostPer1K = 0.0003    // $0.30 per 1K output tokens
-    case "gemini-1.5-pro":
-        inputCostPer1K = 0.00125    // $1.25 per 1K input tokens
-        outputCostPer1K = 0.005     // $5.00 per 1K output tokens
-    default:
-        inputCostPer1K = 0.000075   // Default to Flash pricing
-        outputCostPer1K = 0.0003
+// MessageFeedback - Record thumbs up/down on a response from the embed widget.
+// Sending again replaces the previous value.
+func MessageFeedback(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID, err := primitive.ObjectIDFromHex(c.Param("projectId"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+    messageID, err := primitive.ObjectIDFromHex(c.Param("messageId"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+        return
+    }
+
+    var feedback struct {
+        Helpful *bool `json:"helpful"`
+    }
+    if err := c.ShouldBindJSON(&feedback); err != nil || feedback.Helpful == nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "helpful must be true or false"})
+        return
+    }
+
+    // Matching on project_id as well keeps feedback scoped to the project's own messages
+    result, err := config.DB.Collection("chat_messages").UpdateOne(
+        ctx,
+        bson.M{"_id": messageID, "project_id": projectID},
+        bson.M{"$set": bson.M{
+            "helpful":    *feedback.Helpful,
+            "helpful_at": time.Now(),
+        }},
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":    true,
+        "message_id": messageID,
+        "helpful":    *feedback.Helpful,
+    })
+}
+
+// TestChat - Run a message through the project's full prompt against Gemini without
+// saving it or counting usage, returning the exact prompt for debugging
+func TestChat(c *gin.Context) {
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        Message  string `json:"message"`
+        UserName string `json:"user_name"` // optional, to preview personalized replies
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message data"})
+        return
+    }
+    message, ok := validateMessageInput(c, input.Message)
+    if !ok {
+        return
+    }
+
+    var project models.Project
+    ctx, cancel := requestContext(c)
+    err = config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if project.GeminiAPIKey == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no Gemini API key configured"})
+        return
+    }
+
+    userContext := ""
+    if input.UserName != "" {
+        userContext = fmt.Sprintf("The user's name is %s. ", input.UserName)
+    }
+    prompt := buildChatPrompt(buildSystemPrompt(project.SystemPrompt, project.Name, userContext), knowledgeContext(project, message), message, project.ForcedLanguage)
+
+    modelName := project.GeminiModel
+    if modelName == "" {
+        modelName = models.DefaultGeminiModel
+    }
+
+    genCtx, genCancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+    defer genCancel()
+
+    client, release, err := config.AcquireGeminiClient(decryptAPIKey(project.GeminiAPIKey))
+    if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create Gemini client", "details": err.Error(), "prompt": prompt})
+        return
     }
+    defer release()
+
+    model := client.GenerativeModel(modelName)
+    configureChatModel(model, project, defaultChatTemperature)
+
+    startTime := time.Now()
+    resp, err := model.GenerateContent(genCtx, genai.Text(prompt))
+    responseTime := time.Since(startTime).Milliseconds()
+    var response string
+    if err == nil {
+        response, err = responseText(resp)
+    }
+    if isBlockedBySafety(err) {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{
+            "error":        blockedReply(err),
+            "status":       "content_blocked",
+            "block_reason": safetyBlockReason(err),
+            "prompt":       prompt,
+        })
+        return
+    } else if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": "Gemini request failed", "details": err.Error(), "prompt": prompt})
+        return
+    }
+    inputTokens, outputTokens := tokenCountsFromResponse(resp, prompt, response)
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":          true,
+        "dry_run":          true,
+        "response":         response,
+        "prompt":           prompt,
+        "model":            modelName,
+        "input_tokens":     inputTokens,
+        "output_tokens":    outputTokens,
+        "estimated_cost":   calculateGeminiCost(modelName, inputTokens, outputTokens),
+        "response_time_ms": responseTime,
+    })
+}
+
+// calculateGeminiCost - Cost of a request in USD from the configured model pricing
+func calculateGeminiCost(model string, inputTokens, outputTokens int) float64 {
+    pricing := config.GeminiPricing(model)
     
-    inputCost := (float64(inputTokens) / 1000.0) * inputCostPer1K
-    outputCost := (float64(outputTokens) / 1000.0) * outputCostPer1K
+    inputCost := (float64(inputTokens) / 1000.0) * pricing.InputPer1K
+    outputCost := (float64(outputTokens) / 1000.0) * pricing.OutputPer1K
     
     return math.Round((inputCost+outputCost)*100000) / 100000
 }
@@ -780,10 +1635,24 @@ func getNextDailyReset() string {
 }
 
 // getNextMonthlyReset - Monthly reset helper
-func getNextMonthlyReset() string {
-    now := time.Now()
-    nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
-    return nextMonth.Format(time.RFC3339)
+func getNextMonthlyReset(project models.Project) string {
+    return project.NextBillingReset(time.Now()).Format(time.RFC3339)
+}
+
+// tokenCountsFromResponse - Read input/output token counts from Gemini usage metadata,
+// falling back to the character-based estimate when the API didn't return any
+func tokenCountsFromResponse(resp *genai.GenerateContentResponse, prompt, response string) (int, int) {
+    if resp == nil || resp.UsageMetadata == nil {
+        return estimateTokens(prompt), estimateTokens(response)
+    }
+    
+    inputTokens := int(resp.UsageMetadata.PromptTokenCount)
+    outputTokens := int(resp.UsageMetadata.CandidatesTokenCount)
+    if outputTokens == 0 && resp.UsageMetadata.TotalTokenCount > 0 {
+        outputTokens = int(resp.UsageMetadata.TotalTokenCount) - inputTokens
+    }
+    
+    return inputTokens, outputTokens
 }
 
 // estimateTokens - Helper function to estimate token count
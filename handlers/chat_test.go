@@ -0,0 +1,476 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/generative-ai-go/genai"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// serveRoute sends one JSON request through a router holding only handler at route
+func serveRoute(method, route, path string, handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.Handle(method, route, handler)
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(method, path, strings.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestTokenCountsFromResponse(t *testing.T) {
+    resp := &genai.GenerateContentResponse{UsageMetadata: &genai.UsageMetadata{
+        PromptTokenCount:     120,
+        CandidatesTokenCount: 35,
+        TotalTokenCount:      155,
+    }}
+    if in, out := tokenCountsFromResponse(resp, "prompt", "reply"); in != 120 || out != 35 {
+        t.Errorf("counts = %d, %d; want the API's 120, 35", in, out)
+    }
+
+    // Some responses only report the total
+    resp.UsageMetadata.CandidatesTokenCount = 0
+    if in, out := tokenCountsFromResponse(resp, "prompt", "reply"); in != 120 || out != 35 {
+        t.Errorf("counts from total = %d, %d; want 120, 35", in, out)
+    }
+}
+
+func TestTokenCountsFromResponseFallsBackToEstimate(t *testing.T) {
+    prompt, reply := "twelve chars", "eight ch"
+    for _, resp := range []*genai.GenerateContentResponse{nil, {}} {
+        in, out := tokenCountsFromResponse(resp, prompt, reply)
+        if in != estimateTokens(prompt) || out != estimateTokens(reply) {
+            t.Errorf("counts = %d, %d; want the estimates %d, %d", in, out, estimateTokens(prompt), estimateTokens(reply))
+        }
+    }
+    if estimateTokens("twelve chars") != 3 {
+        t.Errorf("estimateTokens = %d, want 3 (one token per four characters)", estimateTokens("twelve chars"))
+    }
+}
+
+func TestBuildSystemPrompt(t *testing.T) {
+    custom := buildSystemPrompt("You are Acme's support agent.", "Acme", "The user's name is Ana. ")
+    if custom != "You are Acme's support agent. The user's name is Ana." {
+        t.Errorf("custom prompt = %q", custom)
+    }
+
+    fallback := buildSystemPrompt("   ", "Acme", "")
+    if !strings.Contains(fallback, "assistant for Acme") {
+        t.Errorf("default prompt = %q, want the default persona for the project", fallback)
+    }
+}
+
+func TestSetSystemPromptRejectsLongPrompts(t *testing.T) {
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/prompt"
+    body := `{"system_prompt":"` + strings.Repeat("a", models.MaxSystemPromptLength+1) + `"}`
+
+    // Rejected before the database is touched
+    w := serveRoute(http.MethodPut, "/projects/:id/prompt", path, SetSystemPrompt, body)
+    if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "max_length") {
+        t.Errorf("status = %d, body = %s; want 400 with the maximum length", w.Code, w.Body.String())
+    }
+}
+
+func usageLimitStatus(t *testing.T, project models.Project) (bool, int, string) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    rejected := rejectOverUsageLimit(c, project)
+    var body struct {
+        Status string `json:"status"`
+    }
+    if rejected {
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return rejected, w.Code, body.Status
+}
+
+func TestRejectOverUsageLimitDailyAndMonthly(t *testing.T) {
+    limits := models.Project{GeminiDailyLimit: 10, GeminiMonthlyLimit: 100}
+
+    cases := []struct {
+        name       string
+        today      int
+        month      int
+        wantStatus string
+    }{
+        {"under both", 9, 99, ""},
+        {"daily reached", 10, 50, "daily_limit_exceeded"},
+        {"monthly reached", 3, 100, "monthly_limit_exceeded"},
+        {"both reached", 10, 100, "daily_limit_exceeded"},
+    }
+    for _, tc := range cases {
+        project := limits
+        project.GeminiUsageToday, project.GeminiUsageMonth = tc.today, tc.month
+        rejected, code, status := usageLimitStatus(t, project)
+        if tc.wantStatus == "" {
+            if rejected {
+                t.Errorf("%s: rejected with %s", tc.name, status)
+            }
+            continue
+        }
+        if !rejected || code != http.StatusTooManyRequests || status != tc.wantStatus {
+            t.Errorf("%s: got %v %d %q, want 429 %q", tc.name, rejected, code, status, tc.wantStatus)
+        }
+    }
+}
+
+func TestTrimMessageInput(t *testing.T) {
+    cases := map[string]string{
+        "  hello  ":            "hello",
+        "\u200b\u200b":         "",
+        "\t\n":                 "",
+        "\u200bhi there\ufeff": "hi there",
+    }
+    for input, want := range cases {
+        if got := trimMessageInput(input); got != want {
+            t.Errorf("trimMessageInput(%q) = %q, want %q", input, got, want)
+        }
+    }
+}
+
+func TestValidateMessageInput(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    t.Setenv("MAX_MESSAGE_LENGTH", "10")
+
+    validate := func(input string) (string, bool, *httptest.ResponseRecorder) {
+        w := httptest.NewRecorder()
+        c, _ := gin.CreateTestContext(w)
+        message, ok := validateMessageInput(c, input)
+        return message, ok, w
+    }
+
+    message, ok, _ := validate(" <b>hi</b> ")
+    if !ok || message != "&lt;b&gt;hi&lt;/b&gt;" {
+        t.Errorf("message = %q, ok = %v; want it trimmed and escaped", message, ok)
+    }
+
+    // The limit counts characters as typed, not bytes or escaped output
+    if _, ok, _ := validate("ééééééééé<"); !ok {
+        t.Error("a 10-character message must be accepted")
+    }
+
+    _, ok, w := validate("\u200b ")
+    if ok || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "empty_message") {
+        t.Errorf("blank message: ok = %v, status = %d, body = %s", ok, w.Code, w.Body)
+    }
+
+    _, ok, w = validate("hello world")
+    var body struct {
+        Status    string `json:"status"`
+        Length    int    `json:"length"`
+        MaxLength int    `json:"max_length"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &body)
+    if ok || w.Code != http.StatusRequestEntityTooLarge || body.Status != "message_too_long" || body.Length != 11 || body.MaxLength != 10 {
+        t.Errorf("long message: ok = %v, status = %d, body = %+v", ok, w.Code, body)
+    }
+}
+
+func TestTestChatRejectsBadInput(t *testing.T) {
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/test-chat"
+    cases := []struct {
+        name, path, body string
+        want             int
+    }{
+        {"invalid project", "/projects/bad/test-chat", `{"message":"hi"}`, http.StatusBadRequest},
+        {"malformed body", path, `{`, http.StatusBadRequest},
+        {"blank message", path, `{"message":"   "}`, http.StatusBadRequest},
+    }
+    for _, tc := range cases {
+        // Rejected before the project is loaded or Gemini is called
+        if w := serveRoute(http.MethodPost, "/projects/:id/test-chat", tc.path, TestChat, tc.body); w.Code != tc.want {
+            t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+        }
+    }
+}
+
+func TestLanguageGuideline(t *testing.T) {
+    if got := languageGuideline(" Spanish ", "What are your opening hours?"); got != "\n– Always reply in Spanish" {
+        t.Errorf("forced language guideline = %q", got)
+    }
+    if got := languageGuideline("", "Bonjour, je voudrais savoir comment payer"); got != "\n– The user wrote in French: reply in French" {
+        t.Errorf("detected language guideline = %q", got)
+    }
+    // English is the default, so no hint is needed
+    if got := languageGuideline("", "What are your opening hours and can I book online?"); got != "" {
+        t.Errorf("English guideline = %q, want none", got)
+    }
+    // Messages are stored escaped; detection runs on the text as typed
+    if got := languageGuideline("", "Je voudrais savoir c&#39;est quoi le prix"); got != "\n– The user wrote in French: reply in French" {
+        t.Errorf("escaped message guideline = %q", got)
+    }
+}
+
+func TestAddUsageOutlook(t *testing.T) {
+    now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+    usageInfo := gin.H{}
+    addUsageOutlook(usageInfo, models.Project{
+        GeminiDailyLimit:   100,
+        GeminiMonthlyLimit: 1000,
+        GeminiUsageToday:   10,
+        MonthlyTokenLimit:  10000,
+        TokensUsedMonth:    2000,
+        ExpiryDate:         now.Add(60 * 24 * time.Hour),
+    }, 500, now)
+    if usageInfo["tokens_remaining"] != 7500 {
+        t.Errorf("tokens_remaining = %v, want 7500", usageInfo["tokens_remaining"])
+    }
+    if usageInfo["days_until_expiry"] != 60 {
+        t.Errorf("days_until_expiry = %v, want 60", usageInfo["days_until_expiry"])
+    }
+    if _, ok := usageInfo["warning"]; ok {
+        t.Errorf("warning = %v, want none under 80%% and far from expiry", usageInfo["warning"])
+    }
+}
+
+func TestAddUsageOutlookWarnings(t *testing.T) {
+    now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+    cases := []struct {
+        name    string
+        project models.Project
+        want    string
+    }{
+        {"daily usage over 80%", models.Project{GeminiDailyLimit: 10, GeminiUsageToday: 8}, "used 90% of its allowance"},
+        {"budget over 80%", models.Project{MonthlyCostBudget: 10, EstimatedCostMonth: 8.5}, "used 85% of its allowance"},
+        {"expires within a week", models.Project{ExpiryDate: now.Add(36 * time.Hour)}, "expires in 2 day(s)"},
+        {"token allowance spent", models.Project{MonthlyTokenLimit: 1000, TokensUsedMonth: 1000}, "will stop answering soon"},
+    }
+    for _, tc := range cases {
+        usageInfo := gin.H{}
+        addUsageOutlook(usageInfo, tc.project, 0, now)
+        warning, _ := usageInfo["warning"].(string)
+        if !strings.Contains(warning, tc.want) {
+            t.Errorf("%s: warning = %q, want it to mention %q", tc.name, warning, tc.want)
+        }
+    }
+
+    // Expired projects report zero days rather than a negative count
+    usageInfo := gin.H{}
+    addUsageOutlook(usageInfo, models.Project{ExpiryDate: now.Add(-48 * time.Hour)}, 0, now)
+    if usageInfo["days_until_expiry"] != 0 {
+        t.Errorf("days_until_expiry = %v, want 0", usageInfo["days_until_expiry"])
+    }
+}
+
+func TestTokenGraceAllowance(t *testing.T) {
+    previous := config.TokenGracePercent
+    config.TokenGracePercent = 10
+    t.Cleanup(func() { config.TokenGracePercent = previous })
+
+    project := models.Project{GeminiDailyLimit: 100, GeminiMonthlyLimit: 1000, MonthlyTokenLimit: 1000}
+    rejected := func(tokensUsed int) (bool, int) {
+        w := httptest.NewRecorder()
+        c, _ := gin.CreateTestContext(w)
+        project.TokensUsedMonth = tokensUsed
+        return rejectOverUsageLimit(c, project), w.Code
+    }
+    if over, _ := rejected(1050); over {
+        t.Error("a project within its grace allowance was refused")
+    }
+    if over, code := rejected(1100); !over || code != http.StatusTooManyRequests {
+        t.Errorf("past the grace allowance: rejected = %v, status = %d; want a 429", over, code)
+    }
+
+    usageInfo := gin.H{}
+    project.TokensUsedMonth = 1000
+    addUsageOutlook(usageInfo, project, 30, time.Now())
+    if usageInfo["in_grace_period"] != true || usageInfo["grace_tokens_remaining"] != 70 || usageInfo["tokens_remaining"] != 0 {
+        t.Errorf("usage info = %v, want 70 grace tokens left", usageInfo)
+    }
+}
+
+// historyFilter runs addHistoryFilters over query on a fresh context
+func historyFilter(query string) (bson.M, bool, int) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodGet, "/history?"+query, nil)
+    filter := bson.M{"project_id": "p"}
+    ok := addHistoryFilters(c, filter)
+    return filter, ok, w.Code
+}
+
+func TestAddHistoryFilters(t *testing.T) {
+    filter, ok, _ := historyFilter("min_rating=4&has_feedback=true&from=2026-03-01&to=2026-03-31")
+    if !ok {
+        t.Fatal("valid filters were rejected")
+    }
+    if rating := filter["rating"].(bson.M); rating["$gte"] != 4 || rating["$lte"] != nil {
+        t.Errorf("rating = %v, want at least 4", rating)
+    }
+    timestamp := filter["timestamp"].(bson.M)
+    if from := timestamp["$gte"].(time.Time); !from.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+        t.Errorf("from = %v", from)
+    }
+    if to := timestamp["$lte"].(time.Time); to.Day() != 31 || to.Hour() != 23 {
+        t.Errorf("to = %v, want the end of the day", to)
+    }
+    if _, ok := filter["feedback"]; !ok {
+        t.Error("has_feedback=true didn't filter on feedback")
+    }
+
+    // An upper bound alone still leaves out unrated messages
+    filter, _, _ = historyFilter("max_rating=2")
+    if rating := filter["rating"].(bson.M); rating["$gte"] != 1 || rating["$lte"] != 2 {
+        t.Errorf("rating = %v, want 1 to 2", rating)
+    }
+
+    filter, _, _ = historyFilter("")
+    if len(filter) != 1 {
+        t.Errorf("filter = %v, want only the project", filter)
+    }
+}
+
+func TestAddHistoryFiltersRejectsBadInput(t *testing.T) {
+    for _, query := range []string{
+        "min_rating=0",
+        "max_rating=6",
+        "min_rating=high",
+        "min_rating=4&max_rating=2",
+        "from=last-week",
+        "to=2026-02-30",
+    } {
+        if _, ok, code := historyFilter(query); ok || code != http.StatusBadRequest {
+            t.Errorf("%s: ok = %v, status = %d; want a 400", query, ok, code)
+        }
+    }
+}
+
+func TestEnsureSessionID(t *testing.T) {
+    if id, err := ensureSessionID("  s1 "); err != nil || id != "s1" {
+        t.Errorf("ensureSessionID(s1) = %q, %v; want the client's id trimmed", id, err)
+    }
+
+    seen := map[string]bool{}
+    for _, blank := range []string{"", "   ", ""} {
+        id, err := ensureSessionID(blank)
+        if err != nil || !strings.HasPrefix(id, "sess_") || len(id) != len("sess_")+32 {
+            t.Fatalf("ensureSessionID(%q) = %q, %v; want a generated sess_ id", blank, id, err)
+        }
+        if seen[id] {
+            t.Errorf("ensureSessionID repeated %q", id)
+        }
+        seen[id] = true
+    }
+}
+
+func TestIframeSendMessageWithoutSessionID(t *testing.T) {
+    testDatabase(t)
+    project := models.Project{
+        ID:                 primitive.NewObjectID(),
+        IsActive:           true,
+        GeminiEnabled:      true,
+        GeminiAPIKey:       "key",
+        GeminiLimit:        100,
+        GeminiDailyLimit:   100,
+        GeminiMonthlyLimit: 1000,
+        WelcomeMessage:     "Welcome!",
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+
+    // Each widget that leaves the session out starts its own conversation, so both
+    // get the greeting instead of sharing one empty-id history
+    path := "/chat/" + project.ID.Hex() + "/message"
+    var sessions []string
+    for i := 0; i < 2; i++ {
+        w := serveRoute(http.MethodPost, "/chat/:projectId/message", path, IframeSendMessage, `{"message":"Hello"}`)
+        var body struct {
+            Response  string `json:"response"`
+            SessionID string `json:"session_id"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+            t.Fatalf("IframeSendMessage = %d %s", w.Code, w.Body)
+        }
+        if !strings.HasPrefix(body.SessionID, "sess_") || body.Response != "Welcome!" {
+            t.Errorf("reply = %q in session %q, want the greeting in a new session", body.Response, body.SessionID)
+        }
+        sessions = append(sessions, body.SessionID)
+    }
+    if sessions[0] == sessions[1] {
+        t.Errorf("both widgets were given session %q", sessions[0])
+    }
+    if count, _ := config.DB.Collection("chat_messages").CountDocuments(context.Background(), bson.M{"session_id": ""}); count != 0 {
+        t.Errorf("%d messages saved without a session", count)
+    }
+}
+
+func TestDashboardUsageInfo(t *testing.T) {
+    project := models.Project{GeminiUsageToday: 4, GeminiDailyLimit: 10, GeminiUsageMonth: 40, GeminiMonthlyLimit: 100}
+
+    counted := dashboardUsageInfo(project, true)
+    if counted["daily_usage"] != 5 || counted["daily_remaining"] != 5 || counted["monthly_usage"] != 41 || counted["monthly_remaining"] != 59 {
+        t.Errorf("answered by Gemini: usage_info = %v, want this request counted", counted)
+    }
+    free := dashboardUsageInfo(project, false)
+    if free["daily_usage"] != 4 || free["daily_remaining"] != 6 || free["monthly_usage"] != 40 || free["monthly_remaining"] != 60 {
+        t.Errorf("not answered by Gemini: usage_info = %v, want usage unchanged", free)
+    }
+}
+
+func TestSendMessageReservesUsage(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    project := models.Project{
+        ID:                 primitive.NewObjectID(),
+        Name:               "Acme",
+        IsActive:           true,
+        GeminiEnabled:      true,
+        GeminiAPIKey:       "key",
+        GeminiLimit:        100,
+        GeminiUsageToday:   5,
+        GeminiDailyLimit:   5,
+        GeminiMonthlyLimit: 1000,
+        WelcomeMessage:     "Welcome!",
+        PDFContent:         "Opening hours are nine to five on weekdays and ten to two on Saturdays.",
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    route := "/chat/:id/message"
+    path := "/chat/" + project.ID.Hex() + "/message"
+
+    // The greeting doesn't reach Gemini, so it is answered and not counted
+    w := serveRoute(http.MethodPost, route, path, SendMessage, `{"message":"Hi","session_id":"s1"}`)
+    var body struct {
+        Response  string                 `json:"response"`
+        UsageInfo map[string]interface{} `json:"usage_info"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("greeting = %d %s", w.Code, w.Body)
+    }
+    if body.Response != "Welcome!" || body.UsageInfo["daily_usage"] != float64(5) {
+        t.Errorf("greeting = %q, usage_info = %v; want the welcome message and usage unchanged", body.Response, body.UsageInfo)
+    }
+
+    // A real question is refused before Gemini is called, since the daily limit is used up
+    w = serveRoute(http.MethodPost, route, path, SendMessage, `{"message":"What are your hours?","session_id":"s1"}`)
+    if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "daily_limit_exceeded") {
+        t.Errorf("question over the daily limit = %d %s, want 429", w.Code, w.Body)
+    }
+    var stored models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored); err != nil {
+        t.Fatal(err)
+    }
+    if stored.GeminiUsageToday != 5 || stored.GeminiUsageMonth != 0 || stored.EstimatedCostMonth != 0 {
+        t.Errorf("stored usage = %d today, %d this month, $%v; want nothing reserved",
+            stored.GeminiUsageToday, stored.GeminiUsageMonth, stored.EstimatedCostMonth)
+    }
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// maxCloneNameAttempts bounds the "(copy N)" suffixes tried when picking a free name
+const maxCloneNameAttempts = 20
+
+// CloneProject - Create a new project with another project's configuration: prompts,
+// model, limits, widget, moderation and notification settings. Usage, analytics and
+// chat data start fresh. The knowledge base is copied only with "copy_knowledge": true.
+func CloneProject(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        Name          string `json:"name"`
+        CopyKnowledge bool   `json:"copy_knowledge"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid clone options"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    var source models.Project
+    err = collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&source)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    clone := cloneProjectConfig(source)
+    applyNewProjectDefaults(&clone)
+
+    if name := strings.TrimSpace(input.Name); name != "" {
+        exists, err := projectNameExists(ctx, name, primitive.NilObjectID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone project"})
+            return
+        }
+        if exists {
+            c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A project named %q already exists", name)})
+            return
+        }
+        clone.Name = name
+    } else if clone.Name, err = freeCloneName(c, source.Name); err != nil {
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+        return
+    }
+
+    if input.CopyKnowledge {
+        clone.KnowledgeSources = cloneKnowledgeSources(source.Sources())
+        clone.PDFContent = aggregatePDFContent(clone.KnowledgeSources)
+    }
+
+    if err := clone.Validate(); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if _, err := collection.InsertOne(ctx, clone); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone project"})
+        return
+    }
+    if input.CopyKnowledge && len(clone.KnowledgeSources) > 0 {
+        go refreshKnowledgeBase(clone.ID)
+    }
+
+    c.JSON(http.StatusCreated, gin.H{
+        "success":           true,
+        "message":           "Project cloned successfully",
+        "source_project_id": source.ID.Hex(),
+        "knowledge_copied":  input.CopyKnowledge,
+        "project":           models.NewProjectResponse(clone),
+    })
+}
+
+// cloneProjectConfig - The configuration fields of a project, without its identity,
+// usage, subscription dates, analytics or knowledge base
+func cloneProjectConfig(source models.Project) models.Project {
+    return models.Project{
+        Name:                 source.Name,
+        Description:          source.Description,
+        Category:             source.Category,
+        OwnerID:              source.OwnerID,
+        GeminiEnabled:        source.GeminiEnabled,
+        GeminiAPIKey:         source.GeminiAPIKey, // already encrypted
+        GeminiModel:          source.GeminiModel,
+        GeminiLimit:          source.GeminiLimit,
+        GeminiDailyLimit:     source.GeminiDailyLimit,
+        GeminiMonthlyLimit:   source.GeminiMonthlyLimit,
+        MonthlyCostBudget:    source.MonthlyCostBudget,
+        PlanID:               source.PlanID,
+        MonthlyTokenLimit:    source.MonthlyTokenLimit,
+        WelcomeMessage:       source.WelcomeMessage,
+        SystemPrompt:         source.SystemPrompt,
+        ResponseDelayMs:      source.ResponseDelayMs,
+        WebhookURL:           source.WebhookURL,
+        NotificationSettings: source.NotificationSettings,
+        Moderation:           source.Moderation,
+        WidgetConfig:         source.WidgetConfig,
+        Registration:         source.Registration,
+        SafetySettings:       source.SafetySettings,
+        RateLimitPerMinute:   source.RateLimitPerMinute,
+        AllowedDomains:       source.AllowedDomains,
+        ForcedLanguage:       source.ForcedLanguage,
+        RetentionDays:        source.RetentionDays,
+        MaxSessionMessages:   source.MaxSessionMessages,
+    }
+}
+
+// freeCloneName - "<name> (copy)", or "<name> (copy N)" when that is taken
+func freeCloneName(c *gin.Context, name string) (string, error) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    for i := 1; i <= maxCloneNameAttempts; i++ {
+        candidate := name + " (copy)"
+        if i > 1 {
+            candidate = fmt.Sprintf("%s (copy %d)", name, i)
+        }
+        exists, err := projectNameExists(ctx, candidate, primitive.NilObjectID)
+        if err != nil {
+            return "", fmt.Errorf("failed to check project names")
+        }
+        if !exists {
+            return candidate, nil
+        }
+    }
+    return "", fmt.Errorf("too many copies of %q; pass a name for the clone", name)
+}
+
+// cloneKnowledgeSources - Copies of the sources under new IDs. Stored PDFs are copied too,
+// so deleting a source from one project leaves the other's file in place.
+func cloneKnowledgeSources(sources []models.KnowledgeSource) []models.KnowledgeSource {
+    cloned := make([]models.KnowledgeSource, 0, len(sources))
+    for _, source := range sources {
+        source.ID = primitive.NewObjectID().Hex()
+        if source.FilePath != "" {
+            filePath := fmt.Sprintf("./static/uploads/%s_%s", source.ID, source.Name)
+            if err := copyFile(source.FilePath, filePath); err != nil {
+                log.Printf("Failed to copy %s for cloned project: %v", source.FilePath, err)
+                filePath = ""
+            }
+            source.FilePath = filePath
+        }
+        cloned = append(cloned, source)
+    }
+    return cloned
+}
+
+// copyFile - Copy src to a new file at dst
+func copyFile(src, dst string) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+
+    out, err := os.Create(dst)
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        os.Remove(dst)
+        return err
+    }
+    return out.Close()
+}
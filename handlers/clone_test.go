@@ -0,0 +1,172 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestCloneProjectConfig(t *testing.T) {
+    source := models.Project{
+        ID:               primitive.NewObjectID(),
+        Name:             "Support",
+        SystemPrompt:     "Be brief.",
+        GeminiAPIKey:     "encrypted-key",
+        GeminiDailyLimit: 50,
+        AllowedDomains:   []string{"example.com"},
+        RetentionDays:    30,
+        GeminiUsageToday: 12,
+        TotalTokensUsed:  9000,
+        TotalQuestions:   40,
+        Version:          7,
+        PDFContent:       "knowledge",
+        KnowledgeSources: []models.KnowledgeSource{{ID: "a", Name: "faq.txt"}},
+        CreatedAt:        time.Now().AddDate(-1, 0, 0),
+    }
+
+    clone := cloneProjectConfig(source)
+    if clone.Name != "Support" || clone.SystemPrompt != "Be brief." || clone.GeminiAPIKey != "encrypted-key" ||
+        clone.GeminiDailyLimit != 50 || len(clone.AllowedDomains) != 1 || clone.RetentionDays != 30 {
+        t.Errorf("clone = %+v, want the configuration copied", clone)
+    }
+    if !clone.ID.IsZero() || clone.GeminiUsageToday != 0 || clone.TotalTokensUsed != 0 || clone.TotalQuestions != 0 ||
+        clone.Version != 0 || !clone.CreatedAt.IsZero() {
+        t.Errorf("clone = %+v, want no identity, usage or analytics", clone)
+    }
+    if clone.PDFContent != "" || len(clone.KnowledgeSources) != 0 {
+        t.Error("the knowledge base is only copied on request")
+    }
+}
+
+func TestCloneKnowledgeSources(t *testing.T) {
+    // Stored uploads live under ./static/uploads
+    dir := t.TempDir()
+    if err := os.MkdirAll(filepath.Join(dir, "static", "uploads"), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    wd, _ := os.Getwd()
+    if err := os.Chdir(dir); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.Chdir(wd) })
+    stored := filepath.Join("static", "uploads", "a_manual.pdf")
+    if err := os.WriteFile(stored, []byte("%PDF-1.4 manual"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    sources := []models.KnowledgeSource{
+        {ID: "a", Type: models.KnowledgeSourcePDF, Name: "manual.pdf", FilePath: stored, Content: "Manual.", Enabled: true},
+        {ID: "b", Type: models.KnowledgeSourceURL, Name: "FAQ", Origin: "https://example.com/faq", Content: "Page.", Enabled: false},
+        {ID: "c", Type: models.KnowledgeSourcePDF, Name: "lost.pdf", FilePath: "static/uploads/missing.pdf"},
+    }
+    cloned := cloneKnowledgeSources(sources)
+    if len(cloned) != len(sources) {
+        t.Fatalf("cloned %d sources, want %d", len(cloned), len(sources))
+    }
+    for i, source := range cloned {
+        if source.ID == sources[i].ID || source.Name != sources[i].Name || source.Content != sources[i].Content || source.Enabled != sources[i].Enabled {
+            t.Errorf("source %d = %+v, want a copy of %+v under a new ID", i, source, sources[i])
+        }
+    }
+
+    copied := cloned[0].FilePath
+    if copied == "" || copied == stored {
+        t.Fatalf("FilePath = %q, want a copy of the stored PDF", copied)
+    }
+    if data, err := os.ReadFile(copied); err != nil || string(data) != "%PDF-1.4 manual" {
+        t.Errorf("copied file = %q, %v", data, err)
+    }
+    // Deleting the original leaves the clone's file in place
+    os.Remove(stored)
+    if _, err := os.Stat(copied); err != nil {
+        t.Errorf("clone's file went with the original: %v", err)
+    }
+    if cloned[1].FilePath != "" || cloned[1].Origin != "https://example.com/faq" {
+        t.Errorf("URL source = %+v, want its origin and no file", cloned[1])
+    }
+    if cloned[2].FilePath != "" {
+        t.Errorf("FilePath = %q, want none when the stored file is missing", cloned[2].FilePath)
+    }
+}
+
+func TestCloneProjectRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/clone"
+    if w := serveRoute(http.MethodPost, route, "/projects/bad/clone", CloneProject, `{}`); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project: status = %d, want 400", w.Code)
+    }
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/clone"
+    if w := serveRoute(http.MethodPost, route, path, CloneProject, `{"copy_knowledge":"yes"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("malformed options: status = %d, want 400", w.Code)
+    }
+}
+
+func TestCloneProject(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    source := models.Project{
+        ID:               primitive.NewObjectID(),
+        Name:             "Support",
+        GeminiAPIKey:     "key",
+        GeminiLimit:      100,
+        GeminiUsageToday: 12,
+        KnowledgeSources: []models.KnowledgeSource{
+            {ID: "a", Type: models.KnowledgeSourceText, Name: "faq.txt", Content: "Open 9am to 5pm.", Status: models.PDFStatusCompleted, Enabled: true},
+        },
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, source); err != nil {
+        t.Fatal(err)
+    }
+
+    route := "/projects/:id/clone"
+    path := "/projects/" + source.ID.Hex() + "/clone"
+    clone := func(body string) (int, models.ProjectResponse) {
+        w := serveRoute(http.MethodPost, route, path, CloneProject, body)
+        var response struct {
+            Project models.ProjectResponse `json:"project"`
+        }
+        json.Unmarshal(w.Body.Bytes(), &response)
+        return w.Code, response.Project
+    }
+
+    // An empty body clones the configuration under the next free name
+    for _, want := range []string{"Support (copy)", "Support (copy 2)"} {
+        code, project := clone("")
+        if code != http.StatusCreated || project.Name != want || project.ID == source.ID {
+            t.Errorf("clone = %d, %q; want 201 named %q", code, project.Name, want)
+        }
+        if project.GeminiUsageToday != 0 || len(project.KnowledgeSources) != 0 {
+            t.Errorf("clone %q = %+v, want no usage and no knowledge base", project.Name, project)
+        }
+    }
+    if code, _ := clone(`{"name":"support (COPY)"}`); code != http.StatusConflict {
+        t.Errorf("taken name = %d, want 409", code)
+    }
+    missing := "/projects/" + primitive.NewObjectID().Hex() + "/clone"
+    if w := serveRoute(http.MethodPost, route, missing, CloneProject, `{}`); w.Code != http.StatusNotFound {
+        t.Errorf("unknown project = %d, want 404", w.Code)
+    }
+
+    code, project := clone(`{"name":"Sales","copy_knowledge":true}`)
+    if code != http.StatusCreated || len(project.KnowledgeSources) != 1 || project.KnowledgeSources[0].ID == "a" {
+        t.Fatalf("clone with knowledge = %d %+v, want the source copied under a new ID", code, project.KnowledgeSources)
+    }
+    stored := waitForKnowledgeRefresh(t, project.ID)
+    if stored.PDFContent == "" || stored.Name != "Sales" {
+        t.Errorf("stored clone = %q with content %q", stored.Name, stored.PDFContent)
+    }
+
+    var original models.Project
+    config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": source.ID}).Decode(&original)
+    if original.GeminiUsageToday != 12 || len(original.KnowledgeSources) != 1 || original.KnowledgeSources[0].ID != "a" {
+        t.Errorf("source project changed: %+v", original)
+    }
+}
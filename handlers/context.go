@@ -0,0 +1,14 @@
+package handlers
+
+import (
+    "context"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/config"
+)
+
+// requestContext - Context for database work done while serving a request. It is
+// canceled when the client disconnects or after config.DBTimeout.
+func requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+    return context.WithTimeout(c.Request.Context(), config.DBTimeout)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/config"
+)
+
+func TestRequestContextBoundsDatabaseCalls(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    deadline, ok := ctx.Deadline()
+    if !ok {
+        t.Fatal("requestContext has no deadline")
+    }
+    if remaining := time.Until(deadline); remaining <= 0 || remaining > config.DBTimeout {
+        t.Errorf("deadline in %s, want within %s", remaining, config.DBTimeout)
+    }
+}
+
+func TestRequestContextFollowsClientCancel(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    clientCtx, disconnect := context.WithCancel(context.Background())
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(clientCtx)
+
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    disconnect()
+    select {
+    case <-ctx.Done():
+    case <-time.After(time.Second):
+        t.Fatal("a disconnected client must cancel its database calls")
+    }
+}
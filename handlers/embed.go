@@ -3,29 +3,55 @@ package handlers
 import (
     "context"
     "crypto/md5"
+    "crypto/rand"
+    "crypto/subtle"
     "fmt"
+    "html"
+    "log"
+    "net/mail"
     "net/http"
+    "net/url"
+    "os"
+    "strings"
     "time"
-    "crypto/rand"
     "encoding/hex"
     
     "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v4"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "golang.org/x/crypto/bcrypt"
     "jevi-chat/config"
+    "jevi-chat/middleware"
     "jevi-chat/models"
 )
 
 func EmbedChat(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("projectId")
     
     // Check if user is already authenticated
     userToken := c.Query("token")
     if userToken == "" {
+        // Restrict framing before the project has been fully loaded
+        var project models.Project
+        if objID, err := primitive.ObjectIDFromHex(projectID); err == nil {
+            opts := options.FindOne().SetProjection(bson.M{"name": 1, "allowed_domains": 1, "widget_config": 1})
+            if config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&project) == nil {
+                setFrameAncestors(c, project.AllowedDomains)
+            }
+        }
+        
         // Show pre-chat authentication form
         c.HTML(http.StatusOK, "prechat.html", gin.H{
+            "project":    models.NewPublicProjectResponse(project),
             "project_id": projectID,
+            "verified":   c.Query("verified") == "1",
             "api_url":    "https://b536-150-107-16-191.ngrok-free.app", // Update with your current ngrok URL
+            "widget":     project.WidgetConfig.WithDefaults(project.Name),
         })
         return
     }
@@ -42,13 +68,14 @@ func EmbedChat(c *gin.Context) {
     // Get project details from database
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.HTML(http.StatusOK, "error.html", gin.H{
             "error": "Project not found or inactive",
         })
         return
     }
+    setFrameAncestors(c, project.AllowedDomains)
     
     // Check if project is active
     if !project.IsActive {
@@ -59,7 +86,7 @@ func EmbedChat(c *gin.Context) {
     }
     
     // Validate user token
-    userID, err := validateUserToken(userToken)
+    userID, err := validateUserToken(userToken, projectID)
     if err != nil {
         // Invalid token, redirect to auth
         c.Redirect(http.StatusFound, fmt.Sprintf("/embed/%s", projectID))
@@ -70,7 +97,7 @@ func EmbedChat(c *gin.Context) {
     userCollection := config.DB.Collection("chat_users")
     var user models.ChatUser
     userObjID, _ := primitive.ObjectIDFromHex(userID)
-    err = userCollection.FindOne(context.Background(), bson.M{"_id": userObjID}).Decode(&user)
+    err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
     if err != nil {
         c.Redirect(http.StatusFound, fmt.Sprintf("/embed/%s", projectID))
         return
@@ -78,16 +105,20 @@ func EmbedChat(c *gin.Context) {
     
     // Show chat interface with user info
     c.HTML(http.StatusOK, "chat.html", gin.H{
-        "project":    project,
+        "project":    models.NewPublicProjectResponse(project),
         "project_id": projectID,
         "api_url":    "https://b536-150-107-16-191.ngrok-free.app",
         "user":       user,
         "user_token": userToken,
+        "widget":     project.WidgetConfig.WithDefaults(project.Name),
     })
 }
 
 // Handle authentication for embed chat
 func EmbedAuth(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("projectId")
     
     var authData struct {
@@ -111,7 +142,7 @@ func EmbedAuth(c *gin.Context) {
     
     projectCollection := config.DB.Collection("projects")
     var project models.Project
-    err = projectCollection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = projectCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Project not found"})
         return
@@ -121,12 +152,22 @@ func EmbedAuth(c *gin.Context) {
     
     if authData.Mode == "register" {
         // Handle registration
+        authData.Name = strings.TrimSpace(authData.Name)
+        authData.Email = strings.TrimSpace(authData.Email)
+        if message := validateChatRegistration(authData.Name, authData.Email, authData.Password); message != "" {
+            c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": message})
+            return
+        }
+        normalizedEmail := models.NormalizeEmail(authData.Email)
         
-        // Check if user already exists
+        // Check if user already exists, including the same mailbox spelled differently
         var existingUser models.ChatUser
-        err := userCollection.FindOne(context.Background(), bson.M{
+        err := userCollection.FindOne(ctx, bson.M{
             "project_id": projectID,
-            "email":      authData.Email,
+            "$or": bson.A{
+                bson.M{"email": authData.Email},
+                bson.M{"normalized_email": normalizedEmail},
+            },
         }).Decode(&existingUser)
         
         if err == nil {
@@ -134,24 +175,66 @@ func EmbedAuth(c *gin.Context) {
             return
         }
         
+        if !reserveChatUserSlot(ctx, objID, project.Registration.MaxUsers) {
+            c.JSON(http.StatusForbidden, gin.H{
+                "success": false,
+                "message": "This chat isn't accepting new registrations",
+                "status":  "registration_limit_reached",
+            })
+            return
+        }
+        
+        hashedPassword, err := hashPassword(authData.Password)
+        if err != nil {
+            releaseChatUserSlot(objID)
+            c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create account"})
+            return
+        }
+        
         // Create new user
         user := models.ChatUser{
-            ProjectID: projectID,
-            Name:      authData.Name,
-            Email:     authData.Email,
-            Password:  hashPassword(authData.Password),
-            CreatedAt: time.Now(),
-            IsActive:  true,
+            ProjectID:       projectID,
+            Name:            authData.Name,
+            Email:           authData.Email,
+            NormalizedEmail: normalizedEmail,
+            Password:        hashedPassword,
+            CreatedAt:       time.Now(),
+            IsActive:        true,
+        }
+        
+        var verificationToken string
+        if project.Registration.RequireVerification {
+            verificationToken, err = newVerificationToken()
+            if err != nil {
+                releaseChatUserSlot(objID)
+                c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create account"})
+                return
+            }
+            user.PendingVerification = true
+            user.VerificationTokenHash = hashToken(verificationToken)
+            user.VerificationExpires = time.Now().Add(chatVerificationTTL)
         }
         
-        result, err := userCollection.InsertOne(context.Background(), user)
+        result, err := userCollection.InsertOne(ctx, user)
         if err != nil {
+            releaseChatUserSlot(objID)
             c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Failed to create account"})
             return
         }
         
         user.ID = result.InsertedID.(primitive.ObjectID)
-        token := generateUserToken(user.ID.Hex())
+        
+        if user.PendingVerification {
+            sendChatUserVerification(c, project, user, verificationToken)
+            c.JSON(http.StatusOK, gin.H{
+                "success":               true,
+                "verification_required": true,
+                "message":               "Check your email to confirm your address, then log in",
+            })
+            return
+        }
+        
+        token := generateUserToken(user.ID.Hex(), projectID)
         
         c.JSON(http.StatusOK, gin.H{
             "success": true,
@@ -164,24 +247,58 @@ func EmbedAuth(c *gin.Context) {
         })
         
     } else {
-        // Handle login
-        var user models.ChatUser
-        err := userCollection.FindOne(context.Background(), bson.M{
+        // Handle login. Any spelling of the mailbox finds the account; accounts created
+        // before emails were normalized are matched on the exact address.
+        authData.Email = strings.TrimSpace(authData.Email)
+        normalizedEmail := models.NormalizeEmail(authData.Email)
+        cursor, err := userCollection.Find(ctx, bson.M{
             "project_id": projectID,
-            "email":      authData.Email,
-        }).Decode(&user)
+            "$or": bson.A{
+                bson.M{"normalized_email": normalizedEmail},
+                bson.M{"email": authData.Email},
+            },
+        }, options.Find().SetLimit(maxLoginCandidates))
+        var candidates []models.ChatUser
+        if err == nil {
+            err = cursor.All(ctx, &candidates)
+        }
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Login failed"})
+            return
+        }
         
-        if err != nil || !verifyPassword(authData.Password, user.Password) {
+        // Addresses registered before normalization may share a mailbox, so the password picks the account
+        var user models.ChatUser
+        found, legacyHash := false, false
+        for _, candidate := range candidates {
+            if ok, legacy := verifyPassword(authData.Password, candidate.Password); ok {
+                user, found, legacyHash = candidate, true, legacy
+                break
+            }
+        }
+        if !found {
             c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid email or password"})
             return
         }
+        if legacyHash || user.NormalizedEmail == "" {
+            upgradeChatUserLogin(ctx, user, authData.Password, legacyHash)
+        }
         
         if !user.IsActive {
             c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Account is deactivated"})
             return
         }
         
-        token := generateUserToken(user.ID.Hex())
+        if user.PendingVerification {
+            c.JSON(http.StatusUnauthorized, gin.H{
+                "success": false,
+                "message": "Please confirm your email address before logging in",
+                "status":  "verification_required",
+            })
+            return
+        }
+        
+        token := generateUserToken(user.ID.Hex(), projectID)
         
         c.JSON(http.StatusOK, gin.H{
             "success": true,
@@ -196,6 +313,9 @@ func EmbedAuth(c *gin.Context) {
 }
 
 func IframeChatInterface(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("projectId")
     
     // Validate project ID
@@ -208,35 +328,430 @@ func IframeChatInterface(c *gin.Context) {
     // Get project details
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
     }
+    setFrameAncestors(c, project.AllowedDomains)
     
     c.JSON(http.StatusOK, gin.H{
-        "project": project,
+        "project": models.NewPublicProjectResponse(project),
         "status":  "active",
+        "widget":  project.WidgetConfig.WithDefaults(project.Name),
+    })
+}
+
+// setFrameAncestors - Limit which sites may frame the widget to the project's allowed domains.
+// Overrides the global "frame-ancestors *" header; projects without domains stay embeddable anywhere.
+func setFrameAncestors(c *gin.Context, domains []string) {
+    if len(domains) == 0 {
+        c.Header("Content-Security-Policy", "frame-ancestors *")
+        return
+    }
+    c.Header("Content-Security-Policy", "frame-ancestors 'self' "+strings.Join(domains, " "))
+    c.Writer.Header().Del("X-Frame-Options") // ALLOWALL is non-standard and would conflict with the CSP
+}
+
+// embedOriginAllowed - Check the request's Origin (or Referer) against the project's allowed domains.
+// Requests from this server's own pages, such as the embed iframe, are always allowed.
+func embedOriginAllowed(c *gin.Context, domains []string) bool {
+    if len(domains) == 0 {
+        return true
+    }
+
+    origin := c.GetHeader("Origin")
+    if origin == "" || origin == "null" {
+        referer, err := url.Parse(c.GetHeader("Referer"))
+        if err != nil || referer.Host == "" {
+            return false
+        }
+        origin = referer.Scheme + "://" + referer.Host
+    }
+
+    if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, c.Request.Host) {
+        return true
+    }
+    for _, domain := range domains {
+        if middleware.MatchOrigin(origin, domain) {
+            return true
+        }
+    }
+    return false
+}
+
+// Chat user registration limits
+const (
+    minChatPasswordLength = 6
+    maxChatUserNameLength = 100
+    chatVerificationTTL   = 48 * time.Hour
+)
+
+// validateChatRegistration - Reject obviously fake sign-ups. Returns the message to show, or "" when valid.
+func validateChatRegistration(name, email, password string) string {
+    if name == "" || len(name) > maxChatUserNameLength {
+        return "Please enter your name"
+    }
+    address, err := mail.ParseAddress(email)
+    if err != nil || address.Address != email {
+        return "Please enter a valid email address"
+    }
+    if models.IsDisposableEmail(email) {
+        return "Please use a permanent email address"
+    }
+    if len(password) < minChatPasswordLength {
+        return fmt.Sprintf("Password must be at least %d characters", minChatPasswordLength)
+    }
+    return ""
+}
+
+// reserveChatUserSlot - Count a registration against the project's cap, reporting false when it is full.
+// The check and increment are one update so concurrent sign-ups can't overshoot the cap.
+func reserveChatUserSlot(ctx context.Context, projectID primitive.ObjectID, maxUsers int) bool {
+    filter := bson.M{"_id": projectID}
+    if maxUsers > 0 {
+        filter["chat_user_count"] = bson.M{"$lt": maxUsers}
+    }
+    result, err := config.DB.Collection("projects").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"chat_user_count": 1}})
+    return err == nil && result.MatchedCount > 0
+}
+
+// releaseChatUserSlot - Give back a slot reserved for a registration that failed
+func releaseChatUserSlot(projectID primitive.ObjectID) {
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    defer cancel()
+    config.DB.Collection("projects").UpdateOne(ctx,
+        bson.M{"_id": projectID, "chat_user_count": bson.M{"$gt": 0}},
+        bson.M{"$inc": bson.M{"chat_user_count": -1}})
+}
+
+// newVerificationToken - A random token for an email confirmation link; only its hash is stored
+func newVerificationToken() (string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(raw), nil
+}
+
+// sendChatUserVerification - Email the link that confirms a new chat user's address
+func sendChatUserVerification(c *gin.Context, project models.Project, user models.ChatUser, token string) {
+    link := fmt.Sprintf("%s/embed/%s/verify?token=%s", embedBaseURL(c), user.ProjectID, token)
+    if config.Mailer == nil {
+        // Development mode: no SMTP, so surface the link in the server log
+        log.Printf("Chat verification link for %s: %s", user.Email, link)
+        return
+    }
+    body := fmt.Sprintf("Hello %s,\n\nConfirm your email address to start chatting with %s. The link expires in %d hours.\n\n%s\n\nIf you didn't sign up, you can ignore this email.",
+        user.Name, project.Name, int(chatVerificationTTL.Hours()), link)
+    if err := config.SendEmail([]string{user.Email}, "Confirm your email for "+project.Name, body); err != nil {
+        log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+    }
+}
+
+// VerifyChatUser - Confirm a chat user's email from the link sent at registration,
+// then return them to the chat to log in
+func VerifyChatUser(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID := c.Param("projectId")
+    token := c.Query("token")
+    if token == "" {
+        c.HTML(http.StatusBadRequest, "error.html", gin.H{"error": "Invalid verification link"})
+        return
+    }
+
+    result, err := config.DB.Collection("chat_users").UpdateOne(ctx,
+        bson.M{
+            "project_id":              projectID,
+            "verification_token_hash": hashToken(token),
+            "pending_verification":    true,
+            "verification_expires":    bson.M{"$gt": time.Now()},
+        },
+        bson.M{
+            "$set":   bson.M{"pending_verification": false},
+            "$unset": bson.M{"verification_token_hash": "", "verification_expires": ""},
+        })
+    if err != nil {
+        c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to verify email"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.HTML(http.StatusNotFound, "error.html", gin.H{"error": "This verification link is invalid, expired or has already been used"})
+        return
+    }
+
+    c.Redirect(http.StatusFound, fmt.Sprintf("/embed/%s?verified=1", url.PathEscape(projectID)))
+}
+
+// ResendChatVerification - Send a fresh confirmation link to a chat user who hasn't
+// confirmed their email. Always responds the same so it can't reveal who has registered.
+func ResendChatVerification(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID := c.Param("projectId")
+    var input struct {
+        Email string `json:"email"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Email) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Email is required"})
+        return
+    }
+
+    response := gin.H{
+        "success": true,
+        "message": "If this email is awaiting confirmation, a new link has been sent",
+    }
+
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid project"})
+        return
+    }
+    var project models.Project
+    opts := options.FindOne().SetProjection(bson.M{"name": 1})
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&project); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Project not found"})
+        return
+    }
+
+    collection := config.DB.Collection("chat_users")
+    var user models.ChatUser
+    err = collection.FindOne(ctx, bson.M{
+        "project_id":           projectID,
+        "email":                strings.TrimSpace(input.Email),
+        "pending_verification": true,
+    }).Decode(&user)
+    if err != nil {
+        c.JSON(http.StatusOK, response)
+        return
+    }
+
+    token, err := newVerificationToken()
+    if err != nil {
+        log.Printf("Failed to generate verification token: %v", err)
+        c.JSON(http.StatusOK, response)
+        return
+    }
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+        "verification_token_hash": hashToken(token),
+        "verification_expires":    time.Now().Add(chatVerificationTTL),
+    }})
+    if err != nil {
+        log.Printf("Failed to store verification token for %s: %v", user.Email, err)
+        c.JSON(http.StatusOK, response)
+        return
+    }
+    sendChatUserVerification(c, project, user, token)
+
+    c.JSON(http.StatusOK, response)
+}
+
+// widgetThemes are the color schemes understood by widget.js
+var widgetThemes = []string{"light", "dark"}
+
+// GetEmbedSnippet - Ready-to-paste HTML for embedding a project's chat: the floating
+// widget (widget.js and widget.css) and a plain iframe alternative. URLs are built from
+// APP_URL, or from this request's host when it isn't set. The position and theme query
+// parameters pick the widget options; position defaults to the project's widget config.
+func GetEmbedSnippet(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var project models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    widget := project.WidgetConfig.WithDefaults(project.Name)
+    position := c.DefaultQuery("position", widget.Position)
+    theme := c.DefaultQuery("theme", widgetThemes[0])
+    if !containsValue(models.WidgetPositions, position) || !containsValue(widgetThemes, theme) {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":     "Unknown widget position or theme",
+            "positions": models.WidgetPositions,
+            "themes":    widgetThemes,
+        })
+        return
+    }
+
+    baseURL := embedBaseURL(c)
+    scriptURL := baseURL + "/widget.js"
+    styleURL := baseURL + "/widget.css"
+    embedURL := fmt.Sprintf("%s/embed/%s", baseURL, projectID)
+
+    script := fmt.Sprintf(`<link rel="stylesheet" href="%s">
+<script src="%s" data-jevi-project-id="%s" data-jevi-api-url="%s" data-jevi-position="%s" data-jevi-theme="%s" async></script>`,
+        html.EscapeString(styleURL), html.EscapeString(scriptURL), projectID,
+        html.EscapeString(baseURL), position, theme)
+    iframe := fmt.Sprintf(`<iframe src="%s" title="%s" width="400" height="600" style="border:none;border-radius:10px"></iframe>`,
+        html.EscapeString(embedURL), html.EscapeString(project.Name))
+
+    c.JSON(http.StatusOK, gin.H{
+        "project_id": projectID,
+        "app_url":    baseURL,
+        "script_url": scriptURL,
+        "style_url":  styleURL,
+        "embed_url":  embedURL,
+        "snippet":    script,
+        "iframe":     iframe,
+        "widget_options": gin.H{
+            "position":        position,
+            "theme":           theme,
+            "welcome_message": project.WelcomeMessage,
+        },
     })
 }
 
+// GetWidgetConfig - Public branding for a project's chat widget, with defaults filled in,
+// for widget.js to style itself before the chat is opened
+func GetWidgetConfig(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
 
+    objID, err := primitive.ObjectIDFromHex(c.Param("projectId"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
 
-// Helper functions for authentication
-func hashPassword(password string) string {
-    hash := md5.Sum([]byte(password + "jevi_salt")) // Simple hashing, use bcrypt in production
+    var project models.Project
+    opts := options.FindOne().SetProjection(bson.M{"name": 1, "is_active": 1, "allowed_domains": 1, "welcome_message": 1, "widget_config": 1})
+    err = config.DB.Collection("projects").FindOne(ctx,
+        bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}, opts).Decode(&project)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if !project.IsActive {
+        c.JSON(http.StatusForbidden, gin.H{"error": "This chat is currently inactive"})
+        return
+    }
+    if !embedOriginAllowed(c, project.AllowedDomains) {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error":  "This chat is not available on this website",
+            "status": "origin_not_allowed",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "project_id":      project.ID.Hex(),
+        "welcome_message": project.WelcomeMessage,
+        "widget":          project.WidgetConfig.WithDefaults(project.Name),
+    })
+}
+
+// embedBaseURL - Public base URL of this server for embed code: APP_URL, or the request's own host
+func embedBaseURL(c *gin.Context) string {
+    if appURL := strings.TrimRight(os.Getenv("APP_URL"), "/"); appURL != "" {
+        return appURL
+    }
+    scheme := "http"
+    if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+        scheme = "https"
+    }
+    return scheme + "://" + c.Request.Host
+}
+
+func containsValue(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// maxLoginCandidates bounds the accounts one embed login checks the password against
+const maxLoginCandidates = 5
+
+// hashPassword hashes a chat user's password with bcrypt
+func hashPassword(password string) (string, error) {
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    if err != nil {
+        return "", err
+    }
+    return string(hash), nil
+}
+
+// legacyPasswordHash is the salted MD5 chat user passwords were stored as before bcrypt
+func legacyPasswordHash(password string) string {
+    hash := md5.Sum([]byte(password + "jevi_salt"))
     return hex.EncodeToString(hash[:])
 }
 
-func verifyPassword(password, hash string) bool {
-    return hashPassword(password) == hash
+// verifyPassword checks password against a stored hash; legacy reports a match against
+// an old MD5 hash, which should be replaced
+func verifyPassword(password, hash string) (ok bool, legacy bool) {
+    if strings.HasPrefix(hash, "$2") {
+        return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+    }
+    if hash == "" {
+        return false, false
+    }
+    ok = subtle.ConstantTimeCompare([]byte(legacyPasswordHash(password)), []byte(hash)) == 1
+    return ok, ok
+}
+
+// upgradeChatUserLogin re-hashes a legacy MD5 password with bcrypt and fills in a missing
+// normalized email after a successful login. Failures are logged; the login still succeeds.
+func upgradeChatUserLogin(ctx context.Context, user models.ChatUser, password string, rehash bool) {
+    set := bson.M{}
+    if rehash {
+        hashedPassword, err := hashPassword(password)
+        if err != nil {
+            log.Printf("Failed to re-hash password for chat user %s: %v", user.ID.Hex(), err)
+        } else {
+            set["password"] = hashedPassword
+        }
+    }
+    if user.NormalizedEmail == "" {
+        set["normalized_email"] = models.NormalizeEmail(user.Email)
+    }
+    if len(set) == 0 {
+        return
+    }
+    // Only replace the hash that was just verified, in case the password changed meanwhile
+    _, err := config.DB.Collection("chat_users").UpdateOne(ctx,
+        bson.M{"_id": user.ID, "password": user.Password},
+        bson.M{"$set": set},
+    )
+    if err != nil {
+        log.Printf("Failed to upgrade chat user %s: %v", user.ID.Hex(), err)
+    }
 }
 
-func generateUserToken(userID string) string {
-    // Simple token generation, use JWT in production
-    bytes := make([]byte, 16)
-    rand.Read(bytes)
-    return fmt.Sprintf("%s_%s_%d", userID, hex.EncodeToString(bytes), time.Now().Unix())
+// Chat user tokens are JWTs signed with JWT_SECRET (see config.ParseJWT) and scoped to one project
+const (
+    chatUserTokenType = "chat_user"
+    chatUserTokenTTL  = 30 * 24 * time.Hour
+)
+
+func generateUserToken(userID, projectID string) string {
+    claims := jwt.MapClaims{
+        "user_id":    userID,
+        "project_id": projectID,
+        "type":       chatUserTokenType,
+        "exp":        time.Now().Add(chatUserTokenTTL).Unix(),
+        "iat":        time.Now().Unix(),
+    }
+    
+    tokenString, err := config.SignJWT(claims)
+    if err != nil {
+        return ""
+    }
+    return tokenString
 }
 
 
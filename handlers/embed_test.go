@@ -0,0 +1,356 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestHashPasswordUsesBcrypt(t *testing.T) {
+    hash, err := hashPassword("correct horse")
+    if err != nil {
+        t.Fatalf("hashPassword: %v", err)
+    }
+    if !strings.HasPrefix(hash, "$2") {
+        t.Fatalf("hash = %q, want a bcrypt hash", hash)
+    }
+
+    if ok, legacy := verifyPassword("correct horse", hash); !ok || legacy {
+        t.Errorf("verifyPassword(right) = %v, %v; want a current match", ok, legacy)
+    }
+    if ok, _ := verifyPassword("wrong horse", hash); ok {
+        t.Error("verifyPassword accepted the wrong password")
+    }
+}
+
+func TestVerifyPasswordLegacyMD5(t *testing.T) {
+    hash := legacyPasswordHash("correct horse")
+
+    if ok, legacy := verifyPassword("correct horse", hash); !ok || !legacy {
+        t.Errorf("verifyPassword(right) = %v, %v; want a legacy match to re-hash", ok, legacy)
+    }
+    if ok, legacy := verifyPassword("wrong horse", hash); ok || legacy {
+        t.Errorf("verifyPassword(wrong) = %v, %v; want no match", ok, legacy)
+    }
+}
+
+func TestVerifyPasswordEmptyHash(t *testing.T) {
+    if ok, _ := verifyPassword("", ""); ok {
+        t.Error("an account without a password hash must not log in")
+    }
+}
+
+func TestChatUserTokenScopedToProject(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    userID, projectID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+
+    token := generateUserToken(userID, projectID)
+    if got, err := validateUserToken(token, projectID); err != nil || got != userID {
+        t.Errorf("validateUserToken = %q, %v; want %q", got, err, userID)
+    }
+    if _, err := validateUserToken(token, primitive.NewObjectID().Hex()); err == nil {
+        t.Error("a token for one project was accepted by another")
+    }
+
+    // Admin and dashboard JWTs are signed with the same secret but aren't chat user tokens
+    if _, err := validateUserToken(generateJWT(userID, false), projectID); err == nil {
+        t.Error("a dashboard token was accepted as a chat user token")
+    }
+}
+
+func TestLegacyChatUserTokens(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    userID := primitive.NewObjectID().Hex()
+    legacy := fmt.Sprintf("%s_abc123_%d", userID, time.Now().Unix())
+
+    t.Setenv("ALLOW_LEGACY_CHAT_TOKENS", "")
+    if _, err := validateUserToken(legacy, "any"); err == nil {
+        t.Error("a legacy token was accepted with legacy tokens disabled")
+    }
+
+    t.Setenv("ALLOW_LEGACY_CHAT_TOKENS", "true")
+    if got, err := validateUserToken(legacy, "any"); err != nil || got != userID {
+        t.Errorf("validateUserToken(legacy) = %q, %v; want %q", got, err, userID)
+    }
+    expired := fmt.Sprintf("%s_abc123_%d", userID, time.Now().Add(-chatUserTokenTTL-time.Hour).Unix())
+    if _, err := validateUserToken(expired, "any"); err == nil {
+        t.Error("an expired legacy token was accepted")
+    }
+}
+
+func embedContext(headers map[string]string) (*gin.Context, *httptest.ResponseRecorder) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodGet, "http://chat.jevi.io/embed/x", nil)
+    for name, value := range headers {
+        c.Request.Header.Set(name, value)
+    }
+    return c, w
+}
+
+func TestEmbedOriginAllowed(t *testing.T) {
+    domains := []string{"https://shop.example.com", "*.acme.io"}
+    cases := []struct {
+        name    string
+        headers map[string]string
+        want    bool
+    }{
+        {"listed origin", map[string]string{"Origin": "https://shop.example.com"}, true},
+        {"wildcard subdomain", map[string]string{"Origin": "https://help.acme.io"}, true},
+        {"unlisted origin", map[string]string{"Origin": "https://evil.io"}, false},
+        {"referer fallback", map[string]string{"Referer": "https://shop.example.com/cart?x=1"}, true},
+        {"null origin uses referer", map[string]string{"Origin": "null", "Referer": "https://evil.io/"}, false},
+        {"own embed page", map[string]string{"Origin": "http://chat.jevi.io"}, true},
+        {"no origin", map[string]string{}, false},
+    }
+    for _, tc := range cases {
+        c, _ := embedContext(tc.headers)
+        if got := embedOriginAllowed(c, domains); got != tc.want {
+            t.Errorf("%s: embedOriginAllowed = %v, want %v", tc.name, got, tc.want)
+        }
+    }
+
+    c, _ := embedContext(map[string]string{"Origin": "https://evil.io"})
+    if !embedOriginAllowed(c, nil) {
+        t.Error("projects without allowed domains must be embeddable anywhere")
+    }
+}
+
+func TestSetFrameAncestors(t *testing.T) {
+    c, w := embedContext(nil)
+    c.Header("X-Frame-Options", "ALLOWALL")
+    setFrameAncestors(c, []string{"https://shop.example.com"})
+    if csp := w.Header().Get("Content-Security-Policy"); csp != "frame-ancestors 'self' https://shop.example.com" {
+        t.Errorf("Content-Security-Policy = %q", csp)
+    }
+    if w.Header().Get("X-Frame-Options") != "" {
+        t.Error("X-Frame-Options must be dropped when frame-ancestors restricts embedding")
+    }
+
+    c, w = embedContext(nil)
+    setFrameAncestors(c, nil)
+    if csp := w.Header().Get("Content-Security-Policy"); csp != "frame-ancestors *" {
+        t.Errorf("Content-Security-Policy without domains = %q", csp)
+    }
+}
+
+func TestEmbedBaseURL(t *testing.T) {
+    t.Setenv("APP_URL", "")
+    c, _ := embedContext(nil)
+    if got := embedBaseURL(c); got != "http://chat.jevi.io" {
+        t.Errorf("embedBaseURL = %q, want the request host", got)
+    }
+    c, _ = embedContext(map[string]string{"X-Forwarded-Proto": "https"})
+    if got := embedBaseURL(c); got != "https://chat.jevi.io" {
+        t.Errorf("embedBaseURL behind TLS proxy = %q, want https", got)
+    }
+
+    t.Setenv("APP_URL", "https://widgets.example.com/")
+    if got := embedBaseURL(c); got != "https://widgets.example.com" {
+        t.Errorf("embedBaseURL = %q, want APP_URL without the trailing slash", got)
+    }
+}
+
+func TestGetEmbedSnippetRejectsInvalidProject(t *testing.T) {
+    if w := serveRoute(http.MethodGet, "/projects/:id/embed-snippet", "/projects/nope/embed-snippet", GetEmbedSnippet, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+func TestGetEmbedSnippet(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("APP_URL", "https://chat.example.com")
+
+    project := models.Project{ID: primitive.NewObjectID(), Name: `Tom & Jerry's "Shop"`}
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+    route := "/projects/:id/embed-snippet"
+    path := "/projects/" + project.ID.Hex() + "/embed-snippet"
+
+    w := serveRoute(http.MethodGet, route, path+"?position=top-left&theme=dark", GetEmbedSnippet, "")
+    var body struct {
+        Snippet  string `json:"snippet"`
+        Iframe   string `json:"iframe"`
+        EmbedURL string `json:"embed_url"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetEmbedSnippet = %d %s", w.Code, w.Body)
+    }
+    for _, want := range []string{
+        `src="https://chat.example.com/widget.js"`,
+        `data-jevi-project-id="` + project.ID.Hex() + `"`,
+        `data-jevi-position="top-left"`,
+        `data-jevi-theme="dark"`,
+    } {
+        if !strings.Contains(body.Snippet, want) {
+            t.Errorf("snippet is missing %s:\n%s", want, body.Snippet)
+        }
+    }
+    if body.EmbedURL != "https://chat.example.com/embed/"+project.ID.Hex() {
+        t.Errorf("embed_url = %q", body.EmbedURL)
+    }
+    if !strings.Contains(body.Iframe, `title="Tom &amp; Jerry&#39;s &#34;Shop&#34;"`) {
+        t.Errorf("iframe = %s, want the project name escaped", body.Iframe)
+    }
+
+    if w := serveRoute(http.MethodGet, route, path+"?position=center", GetEmbedSnippet, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("unknown position: status = %d, want 400", w.Code)
+    }
+    missing := "/projects/" + primitive.NewObjectID().Hex() + "/embed-snippet"
+    if w := serveRoute(http.MethodGet, route, missing, GetEmbedSnippet, ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown project: status = %d, want 404", w.Code)
+    }
+}
+
+func TestWidgetConfigEndpointsRejectBadInput(t *testing.T) {
+    if w := serveRoute(http.MethodGet, "/embed/:projectId/config", "/embed/nope/config", GetWidgetConfig, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("GetWidgetConfig: status = %d, want 400", w.Code)
+    }
+
+    route := "/projects/:id/widget"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/widget"
+    for _, body := range []string{
+        `{"primary_color":"blue"}`,
+        `{"avatar_url":"ftp://example.com/a.png"}`,
+        `{"position":"middle"}`,
+    } {
+        if w := serveRoute(http.MethodPut, route, path, SetWidgetConfig, body); w.Code != http.StatusBadRequest {
+            t.Errorf("SetWidgetConfig(%s): status = %d, want 400", body, w.Code)
+        }
+    }
+}
+
+func TestGetWidgetConfig(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    active := models.Project{ID: primitive.NewObjectID(), Name: "Acme", IsActive: true,
+        WidgetConfig: models.WidgetConfig{PrimaryColor: "#112233"}}
+    inactive := models.Project{ID: primitive.NewObjectID(), Name: "Paused"}
+    if _, err := config.DB.Collection("projects").InsertMany(ctx, []interface{}{active, inactive}); err != nil {
+        t.Fatal(err)
+    }
+
+    route := "/embed/:projectId/config"
+    w := serveRoute(http.MethodGet, route, "/embed/"+active.ID.Hex()+"/config", GetWidgetConfig, "")
+    var body struct {
+        Widget models.WidgetConfig `json:"widget"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetWidgetConfig = %d %s", w.Code, w.Body)
+    }
+    if body.Widget.PrimaryColor != "#112233" || body.Widget.BotName != "Acme" || body.Widget.Position != models.DefaultWidgetPosition {
+        t.Errorf("widget = %+v, want the project's color with defaults filled in", body.Widget)
+    }
+
+    if w := serveRoute(http.MethodGet, route, "/embed/"+inactive.ID.Hex()+"/config", GetWidgetConfig, ""); w.Code != http.StatusForbidden {
+        t.Errorf("inactive project: status = %d, want 403", w.Code)
+    }
+}
+
+func TestNewVerificationToken(t *testing.T) {
+    first, err := newVerificationToken()
+    if err != nil {
+        t.Fatal(err)
+    }
+    second, _ := newVerificationToken()
+    if len(first) != 64 || first == second {
+        t.Errorf("tokens = %q, %q; want distinct 32-byte hex tokens", first, second)
+    }
+}
+
+func TestChatVerificationRejectsBadInput(t *testing.T) {
+    route := "/embed/:projectId/verify/resend"
+    path := "/embed/" + primitive.NewObjectID().Hex() + "/verify/resend"
+    if w := serveRoute(http.MethodPost, route, path, ResendChatVerification, `{"email":"  "}`); w.Code != http.StatusBadRequest {
+        t.Errorf("blank email: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodPost, route, "/embed/nope/verify/resend", ResendChatVerification, `{"email":"a@example.com"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project: status = %d, want 400", w.Code)
+    }
+    if w := verifyChatUser(primitive.NewObjectID().Hex(), ""); w.Code != http.StatusBadRequest {
+        t.Errorf("link without a token: status = %d, want 400", w.Code)
+    }
+}
+
+// verifyChatUser follows an email confirmation link, with the embed templates loaded
+func verifyChatUser(projectID, token string) *httptest.ResponseRecorder {
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.LoadHTMLGlob("../templates/**/*")
+    router.GET("/embed/:projectId/verify", VerifyChatUser)
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/embed/"+projectID+"/verify?token="+token, nil))
+    return w
+}
+
+func TestChatVerificationLinksExpire(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    projectID := primitive.NewObjectID().Hex()
+    users := []interface{}{
+        models.ChatUser{ProjectID: projectID, Email: "fresh@example.com", PendingVerification: true,
+            VerificationTokenHash: hashToken("fresh-token"), VerificationExpires: time.Now().Add(time.Hour)},
+        models.ChatUser{ProjectID: projectID, Email: "stale@example.com", PendingVerification: true,
+            VerificationTokenHash: hashToken("stale-token"), VerificationExpires: time.Now().Add(-time.Hour)},
+    }
+    if _, err := config.DB.Collection("chat_users").InsertMany(ctx, users); err != nil {
+        t.Fatal(err)
+    }
+
+    if w := verifyChatUser(projectID, "stale-token"); w.Code != http.StatusNotFound {
+        t.Errorf("expired link: status = %d, want 404", w.Code)
+    }
+    w := verifyChatUser(projectID, "fresh-token")
+    if w.Code != http.StatusFound || w.Header().Get("Location") != "/embed/"+projectID+"?verified=1" {
+        t.Fatalf("fresh link = %d to %q, want a redirect back to the chat", w.Code, w.Header().Get("Location"))
+    }
+    if w := verifyChatUser(projectID, "fresh-token"); w.Code != http.StatusNotFound {
+        t.Errorf("reused link: status = %d, want 404", w.Code)
+    }
+}
+
+func TestResendChatVerification(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Acme"}
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    user := models.ChatUser{ProjectID: project.ID.Hex(), Email: "stale@example.com", PendingVerification: true,
+        VerificationTokenHash: hashToken("stale-token"), VerificationExpires: time.Now().Add(-time.Hour)}
+    if _, err := config.DB.Collection("chat_users").InsertOne(ctx, user); err != nil {
+        t.Fatal(err)
+    }
+
+    route := "/embed/:projectId/verify/resend"
+    path := "/embed/" + project.ID.Hex() + "/verify/resend"
+    registered := serveRoute(http.MethodPost, route, path, ResendChatVerification, `{"email":"stale@example.com"}`)
+    unknown := serveRoute(http.MethodPost, route, path, ResendChatVerification, `{"email":"nobody@example.com"}`)
+    if registered.Code != http.StatusOK || registered.Body.String() != unknown.Body.String() {
+        t.Errorf("responses differ: %d %s vs %d %s", registered.Code, registered.Body, unknown.Code, unknown.Body)
+    }
+
+    var updated models.ChatUser
+    if err := config.DB.Collection("chat_users").FindOne(ctx, bson.M{"email": "stale@example.com"}).Decode(&updated); err != nil {
+        t.Fatal(err)
+    }
+    if updated.VerificationTokenHash == user.VerificationTokenHash || !updated.VerificationExpires.After(time.Now()) {
+        t.Errorf("user = %+v, want a new token that hasn't expired", updated)
+    }
+}
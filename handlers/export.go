@@ -0,0 +1,296 @@
+package handlers
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "html"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// ExportChatMessages - Stream a project's chat transcripts as JSON or CSV.
+// Optional filters: session_id, from and to (RFC3339 or YYYY-MM-DD).
+func ExportChatMessages(c *gin.Context) {
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    format := c.DefaultQuery("format", "json")
+    if format != "json" && format != "csv" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json or csv"})
+        return
+    }
+
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var project models.Project
+    err = config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    filter := bson.M{"project_id": objID}
+    if sessionID := c.Query("session_id"); sessionID != "" {
+        filter["session_id"] = sessionID
+    }
+
+    timestampFilter := bson.M{}
+    if from := c.Query("from"); from != "" {
+        fromTime, err := parseExportDate(from, false)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date"})
+            return
+        }
+        timestampFilter["$gte"] = fromTime
+    }
+    if to := c.Query("to"); to != "" {
+        toTime, err := parseExportDate(to, true)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date"})
+            return
+        }
+        timestampFilter["$lte"] = toTime
+    }
+    if len(timestampFilter) > 0 {
+        filter["timestamp"] = timestampFilter
+    }
+
+    // The export can take a while, so it is bounded by the client connection
+    // rather than the per-operation timeout
+    opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+    cursor, err := config.DB.Collection("chat_messages").Find(c.Request.Context(), filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export messages"})
+        return
+    }
+    defer cursor.Close(context.Background())
+
+    filename := fmt.Sprintf("chat-export-%s-%s.%s", projectID, time.Now().Format("20060102-150405"), format)
+    c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+    if format == "csv" {
+        streamCSVExport(c, cursor)
+    } else {
+        streamJSONExport(c, cursor)
+    }
+}
+
+// maxTranscriptMessages bounds a single session transcript export
+const maxTranscriptMessages = 5000
+
+// transcriptEntry is one exchange in a session transcript
+type transcriptEntry struct {
+    Timestamp time.Time `json:"timestamp"`
+    Message   string    `json:"message"`
+    Response  string    `json:"response"`
+}
+
+// ExportSessionTranscript - Let a widget user download one of their own conversations as
+// plain text (format=txt, the default) or JSON. The user's token (token query parameter
+// or Bearer header) must own the session; other sessions look like missing ones.
+func ExportSessionTranscript(c *gin.Context) {
+    projectID := c.Param("projectId")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    sessionID := c.Query("session_id")
+    if sessionID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "session_id is required"})
+        return
+    }
+    format := c.DefaultQuery("format", "txt")
+    if format != "txt" && format != "json" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be txt or json"})
+        return
+    }
+
+    userID, err := validateUserToken(chatUserTokenFromRequest(c), projectID)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Valid chat token required"})
+        return
+    }
+    userObjID, _ := primitive.ObjectIDFromHex(userID)
+
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var session models.ChatSession
+    err = config.DB.Collection("chat_sessions").FindOne(ctx, bson.M{
+        "project_id": objID,
+        "session_id": sessionID,
+        "user_id":    userObjID,
+    }).Decode(&session)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+        return
+    }
+
+    var project models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+        SetLimit(maxTranscriptMessages)
+    cursor, err := config.DB.Collection("chat_messages").Find(ctx, bson.M{
+        "project_id": objID,
+        "session_id": sessionID,
+    }, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export transcript"})
+        return
+    }
+    var messages []models.ChatMessage
+    if err := cursor.All(ctx, &messages); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export transcript"})
+        return
+    }
+
+    // Messages are stored HTML-escaped for display; the transcript holds what was typed
+    entries := make([]transcriptEntry, 0, len(messages))
+    for _, message := range messages {
+        entries = append(entries, transcriptEntry{
+            Timestamp: message.Timestamp,
+            Message:   html.UnescapeString(message.Message),
+            Response:  message.Response,
+        })
+    }
+
+    filename := fmt.Sprintf("chat-transcript-%s.%s", time.Now().Format("20060102-150405"), format)
+    c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+    if format == "json" {
+        c.JSON(http.StatusOK, gin.H{
+            "project":    project.Name,
+            "session_id": sessionID,
+            "started_at": session.StartTime,
+            "messages":   entries,
+        })
+        return
+    }
+    c.String(http.StatusOK, formatTranscript(project.Name, sessionID, entries))
+}
+
+// formatTranscript renders a session as a readable plain-text conversation
+func formatTranscript(projectName, sessionID string, entries []transcriptEntry) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Chat transcript - %s\n", projectName)
+    fmt.Fprintf(&b, "Session: %s\n", sessionID)
+    fmt.Fprintf(&b, "Exported: %s\n", time.Now().UTC().Format("2006-01-02 15:04 MST"))
+
+    for _, entry := range entries {
+        timestamp := entry.Timestamp.UTC().Format("2006-01-02 15:04:05")
+        b.WriteString("\n")
+        if entry.Message != "" {
+            fmt.Fprintf(&b, "[%s] You: %s\n", timestamp, entry.Message)
+        }
+        if entry.Response != "" {
+            fmt.Fprintf(&b, "[%s] %s: %s\n", timestamp, projectName, entry.Response)
+        }
+    }
+    return b.String()
+}
+
+// streamJSONExport writes the messages as a JSON array, one document at a time
+func streamJSONExport(c *gin.Context, cursor *mongo.Cursor) {
+    c.Header("Content-Type", "application/json")
+    c.Status(http.StatusOK)
+
+    encoder := json.NewEncoder(c.Writer)
+    c.Writer.Write([]byte("["))
+    first := true
+    for cursor.Next(c.Request.Context()) {
+        var message models.ChatMessage
+        if err := cursor.Decode(&message); err != nil {
+            log.Printf("Export: failed to decode message: %v", err)
+            continue
+        }
+        if !first {
+            c.Writer.Write([]byte(","))
+        }
+        first = false
+        encoder.Encode(message)
+        c.Writer.Flush()
+    }
+    c.Writer.Write([]byte("]"))
+
+    if err := cursor.Err(); err != nil {
+        log.Printf("Export: cursor error: %v", err)
+    }
+}
+
+// streamCSVExport writes a header row followed by one row per message
+func streamCSVExport(c *gin.Context, cursor *mongo.Cursor) {
+    c.Header("Content-Type", "text/csv")
+    c.Status(http.StatusOK)
+
+    writer := csv.NewWriter(c.Writer)
+    writer.Write([]string{"timestamp", "session_id", "user_name", "user_email", "message", "response", "rating"})
+
+    for cursor.Next(c.Request.Context()) {
+        var message models.ChatMessage
+        if err := cursor.Decode(&message); err != nil {
+            log.Printf("Export: failed to decode message: %v", err)
+            continue
+        }
+
+        rating := ""
+        if message.Rating > 0 {
+            rating = strconv.Itoa(message.Rating)
+        }
+        writer.Write([]string{
+            message.Timestamp.Format(time.RFC3339),
+            message.SessionID,
+            message.UserName,
+            message.UserEmail,
+            message.Message,
+            message.Response,
+            rating,
+        })
+        writer.Flush()
+    }
+    writer.Flush()
+
+    if err := cursor.Err(); err != nil {
+        log.Printf("Export: cursor error: %v", err)
+    }
+}
+
+// parseExportDate accepts RFC3339 timestamps or plain dates. A plain 'to' date
+// covers the whole day.
+func parseExportDate(value string, endOfDay bool) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    t, err := time.Parse("2006-01-02", value)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if endOfDay {
+        t = t.Add(24*time.Hour - time.Nanosecond)
+    }
+    return t, nil
+}
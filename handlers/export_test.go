@@ -0,0 +1,196 @@
+package handlers
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func exportCursor(t *testing.T, messages ...models.ChatMessage) *mongo.Cursor {
+    t.Helper()
+    documents := make([]interface{}, len(messages))
+    for i, message := range messages {
+        documents[i] = message
+    }
+    cursor, err := mongo.NewCursorFromDocuments(documents, nil, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return cursor
+}
+
+func exportRecorder() (*httptest.ResponseRecorder, *gin.Context) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+    return w, c
+}
+
+var exportMessages = []models.ChatMessage{
+    {ProjectID: primitive.NewObjectID(), SessionID: "s1", Message: "Hi, \"are\" you open?", Response: "Yes, until 5pm.", Rating: 5,
+        Timestamp: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)},
+    {ProjectID: primitive.NewObjectID(), SessionID: "s1", Message: "Thanks", Response: "Anytime!",
+        Timestamp: time.Date(2026, 3, 1, 9, 1, 0, 0, time.UTC)},
+}
+
+func TestStreamCSVExport(t *testing.T) {
+    w, c := exportRecorder()
+    streamCSVExport(c, exportCursor(t, exportMessages...))
+
+    rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+    if err != nil {
+        t.Fatalf("export isn't valid CSV: %v\n%s", err, w.Body.String())
+    }
+    if len(rows) != 3 || rows[0][0] != "timestamp" {
+        t.Fatalf("rows = %v, want a header and two messages", rows)
+    }
+    if rows[1][4] != `Hi, "are" you open?` || rows[1][6] != "5" || rows[2][6] != "" {
+        t.Errorf("rows = %v, want quoted messages and ratings only when given", rows[1:])
+    }
+}
+
+func TestStreamJSONExport(t *testing.T) {
+    w, c := exportRecorder()
+    streamJSONExport(c, exportCursor(t, exportMessages...))
+
+    var exported []models.ChatMessage
+    if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+        t.Fatalf("export isn't a JSON array: %v\n%s", err, w.Body.String())
+    }
+    if len(exported) != 2 || exported[1].Response != "Anytime!" {
+        t.Errorf("exported = %+v", exported)
+    }
+
+    w, c = exportRecorder()
+    streamJSONExport(c, exportCursor(t))
+    if strings.TrimSpace(w.Body.String()) != "[]" {
+        t.Errorf("empty export = %q, want []", w.Body.String())
+    }
+}
+
+func TestParseExportDate(t *testing.T) {
+    from, err := parseExportDate("2026-03-01", false)
+    if err != nil || !from.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+        t.Errorf("from = %v, %v; want the start of the day", from, err)
+    }
+    to, err := parseExportDate("2026-03-01", true)
+    if err != nil || to.Day() != 1 || to.Hour() != 23 {
+        t.Errorf("to = %v, %v; want the end of the day", to, err)
+    }
+    exact, err := parseExportDate("2026-03-01T10:30:00Z", true)
+    if err != nil || exact.Hour() != 10 {
+        t.Errorf("RFC3339 = %v, %v; want the exact time", exact, err)
+    }
+    if _, err := parseExportDate("March 1st", false); err == nil {
+        t.Error("an unparseable date was accepted")
+    }
+}
+
+func TestExportChatMessagesRejectsUnknownFormat(t *testing.T) {
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/export?format=xml"
+    if w := serveRoute(http.MethodGet, "/projects/:id/export", path, ExportChatMessages, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+func TestFormatTranscript(t *testing.T) {
+    transcript := formatTranscript("Acme Support", "s1", []transcriptEntry{
+        {Timestamp: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), Message: "Are you open?", Response: "Yes, until 5pm."},
+        {Timestamp: time.Date(2026, 3, 1, 9, 1, 0, 0, time.UTC), Response: "Anything else?"},
+    })
+
+    for _, want := range []string{
+        "Chat transcript - Acme Support\n",
+        "Session: s1\n",
+        "[2026-03-01 09:00:00] You: Are you open?\n",
+        "[2026-03-01 09:00:00] Acme Support: Yes, until 5pm.\n",
+        "[2026-03-01 09:01:00] Acme Support: Anything else?\n",
+    } {
+        if !strings.Contains(transcript, want) {
+            t.Errorf("transcript is missing %q:\n%s", want, transcript)
+        }
+    }
+    if strings.Contains(transcript, "09:01:00] You:") {
+        t.Error("an exchange without a message still printed an empty user line")
+    }
+}
+
+func TestExportSessionTranscriptRejectsBadInput(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    route := "/chat/:projectId/history/export"
+    projectID := primitive.NewObjectID().Hex()
+    token := generateUserToken(primitive.NewObjectID().Hex(), projectID)
+    otherToken := generateUserToken(primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex())
+
+    cases := []struct {
+        name      string
+        projectID string
+        query     string
+        token     string
+        want      int
+    }{
+        {"invalid project ID", "nope", "session_id=s1", token, http.StatusBadRequest},
+        {"missing session", projectID, "", token, http.StatusBadRequest},
+        {"unknown format", projectID, "session_id=s1&format=pdf", token, http.StatusBadRequest},
+        {"no token", projectID, "session_id=s1", "", http.StatusUnauthorized},
+        {"another project's token", projectID, "session_id=s1", otherToken, http.StatusUnauthorized},
+    }
+    for _, tc := range cases {
+        path := "/chat/" + tc.projectID + "/history/export?" + tc.query + "&token=" + tc.token
+        if w := serveRoute(http.MethodGet, route, path, ExportSessionTranscript, ""); w.Code != tc.want {
+            t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+        }
+    }
+}
+
+func TestExportSessionTranscriptOwnSessionOnly(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("JWT_SECRET", "test-secret")
+    ctx := context.Background()
+
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Acme Support"}
+    owner := primitive.NewObjectID()
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    session := models.ChatSession{ProjectID: project.ID, SessionID: "s1", UserID: owner, StartTime: time.Now()}
+    if _, err := config.DB.Collection("chat_sessions").InsertOne(ctx, session); err != nil {
+        t.Fatal(err)
+    }
+    message := models.ChatMessage{ProjectID: project.ID, SessionID: "s1", Message: "Fish &amp; chips?", Response: "Fridays.", Timestamp: time.Now()}
+    if _, err := config.DB.Collection("chat_messages").InsertOne(ctx, message); err != nil {
+        t.Fatal(err)
+    }
+
+    route := "/chat/:projectId/history/export"
+    path := "/chat/" + project.ID.Hex() + "/history/export?session_id=s1&token="
+
+    w := serveRoute(http.MethodGet, route, path+generateUserToken(owner.Hex(), project.ID.Hex()), ExportSessionTranscript, "")
+    if w.Code != http.StatusOK {
+        t.Fatalf("owner export = %d %s", w.Code, w.Body)
+    }
+    if !strings.Contains(w.Body.String(), "You: Fish & chips?") || !strings.Contains(w.Body.String(), "Acme Support: Fridays.") {
+        t.Errorf("transcript = %q, want the unescaped exchange", w.Body.String())
+    }
+    if disposition := w.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") {
+        t.Errorf("Content-Disposition = %q, want an attachment", disposition)
+    }
+
+    // Another widget user of the same project can't see the session
+    stranger := generateUserToken(primitive.NewObjectID().Hex(), project.ID.Hex())
+    if w := serveRoute(http.MethodGet, route, path+stranger, ExportSessionTranscript, ""); w.Code != http.StatusNotFound {
+        t.Errorf("stranger export = %d, want 404", w.Code)
+    }
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// GetGeminiFailures - List a project's failed Gemini requests, newest first
+func GetGeminiFailures(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    filter := bson.M{"project_id": objID, "success": false}
+    collection := config.DB.Collection("gemini_usage_logs")
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch failures"})
+        return
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch failures"})
+        return
+    }
+
+    var failures []models.GeminiUsageLog
+    if err := cursor.All(ctx, &failures); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse failures"})
+        return
+    }
+    if failures == nil {
+        failures = []models.GeminiUsageLog{}
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":     true,
+        "failures":    failures,
+        "total":       total,
+        "page":        page,
+        "limit":       limit,
+        "total_pages": (total + int64(limit) - 1) / int64(limit),
+    })
+}
+
+// ReplayGeminiFailure - Run a failed request's question through Gemini again and
+// report the new result. The replay counts against the project's usage like any
+// other request and is logged on its own; the original entry records the outcome.
+func ReplayGeminiFailure(c *gin.Context) {
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+    logID, err := primitive.ObjectIDFromHex(c.Param("logId"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log ID"})
+        return
+    }
+
+    logs := config.DB.Collection("gemini_usage_logs")
+    var failure models.GeminiUsageLog
+    ctx, cancel := requestContext(c)
+    err = logs.FindOne(ctx, bson.M{"_id": logID, "project_id": objID, "success": false}).Decode(&failure)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Failed request not found"})
+        return
+    }
+
+    ctx, cancel = requestContext(c)
+    project, err := loadChatProject(ctx, objID)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if project.GeminiAPIKey == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no Gemini API key configured"})
+        return
+    }
+
+    ctx, cancel = requestContext(c)
+    reservedCost := reservedGeminiCost(project.GeminiModel)
+    reserved, err := reserveGeminiUsage(ctx, objID, reservedCost)
+    cancel()
+    if err == mongo.ErrNoDocuments {
+        if !rejectOverUsageLimit(c, reserved) {
+            c.JSON(http.StatusTooManyRequests, gin.H{
+                "error":  "AI usage limit reached for this project",
+                "status": "limit_exceeded",
+            })
+        }
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check usage limits"})
+        return
+    }
+
+    startTime := time.Now()
+    response, inputTokens, outputTokens, genErr := generateGeminiResponseWithTracking(
+        project, failure.Question, c.ClientIP(), models.ChatUser{}, nil)
+    responseTime := time.Since(startTime).Milliseconds()
+
+    success := genErr == nil
+    errorMsg := ""
+    if !success {
+        go releaseGeminiUsage(objID, reservedCost)
+        errorMsg = genErr.Error()
+    }
+    trackGeminiUsage(objID, failure.Question, response, getGeminiModel(project.GeminiModel),
+        inputTokens, outputTokens, responseTime, c.ClientIP(), genErr, reservedCost)
+
+    ctx, cancel = requestContext(c)
+    logs.UpdateOne(ctx, bson.M{"_id": logID}, bson.M{"$set": bson.M{
+        "replayed_at":    time.Now(),
+        "replay_success": success,
+    }})
+    cancel()
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":          success,
+        "log_id":           logID.Hex(),
+        "question":         failure.Question,
+        "original_error":   failure.Error,
+        "response":         response,
+        "error":            errorMsg,
+        "input_tokens":     inputTokens,
+        "output_tokens":    outputTokens,
+        "response_time_ms": responseTime,
+    })
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestGeminiFailureRoutesRejectInvalidIDs(t *testing.T) {
+    if w := serveRoute(http.MethodGet, "/projects/:id/gemini/failures", "/projects/bad/gemini/failures", GetGeminiFailures, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("list with invalid project ID: status = %d, want 400", w.Code)
+    }
+
+    route := "/projects/:id/gemini/failures/:logId/replay"
+    if w := serveRoute(http.MethodPost, route, "/projects/bad/gemini/failures/"+primitive.NewObjectID().Hex()+"/replay", ReplayGeminiFailure, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("replay with invalid project ID: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodPost, route, "/projects/"+primitive.NewObjectID().Hex()+"/gemini/failures/bad/replay", ReplayGeminiFailure, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("replay with invalid log ID: status = %d, want 400", w.Code)
+    }
+}
+
+func TestGetGeminiFailuresListsOnlyFailures(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    projectID := primitive.NewObjectID()
+    now := time.Now()
+    logs := []interface{}{
+        models.GeminiUsageLog{ProjectID: projectID, Question: "older failure", Success: false, Error: "timeout", Timestamp: now.Add(-time.Hour)},
+        models.GeminiUsageLog{ProjectID: projectID, Question: "newer failure", Success: false, Error: "quota", Timestamp: now},
+        models.GeminiUsageLog{ProjectID: projectID, Question: "answered", Success: true, Timestamp: now},
+        models.GeminiUsageLog{ProjectID: primitive.NewObjectID(), Question: "other project", Success: false, Timestamp: now},
+    }
+    if _, err := config.DB.Collection("gemini_usage_logs").InsertMany(ctx, logs); err != nil {
+        t.Fatal(err)
+    }
+
+    w := serveRoute(http.MethodGet, "/projects/:id/gemini/failures", "/projects/"+projectID.Hex()+"/gemini/failures", GetGeminiFailures, "")
+    var body struct {
+        Failures []models.GeminiUsageLog `json:"failures"`
+        Total    int64                   `json:"total"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetGeminiFailures = %d %s", w.Code, w.Body)
+    }
+    if body.Total != 2 || len(body.Failures) != 2 {
+        t.Fatalf("total = %d, failures = %d; want the project's 2 failures", body.Total, len(body.Failures))
+    }
+    if body.Failures[0].Question != "newer failure" {
+        t.Errorf("first failure = %q, want newest first", body.Failures[0].Question)
+    }
+}
+
+func TestReplayGeminiFailureScopedToProject(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    failure := models.GeminiUsageLog{ID: primitive.NewObjectID(), ProjectID: primitive.NewObjectID(), Question: "hi", Success: false}
+    if _, err := config.DB.Collection("gemini_usage_logs").InsertOne(ctx, failure); err != nil {
+        t.Fatal(err)
+    }
+
+    // Another project's failure can't be replayed through this one
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/gemini/failures/" + failure.ID.Hex() + "/replay"
+    if w := serveRoute(http.MethodPost, "/projects/:id/gemini/failures/:logId/replay", path, ReplayGeminiFailure, ""); w.Code != http.StatusNotFound {
+        t.Errorf("status = %d, want 404", w.Code)
+    }
+}
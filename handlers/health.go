@@ -0,0 +1,55 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/config"
+)
+
+// HealthCheck - Report service health including MongoDB and Gemini reachability.
+// Responds 503 when a dependency is down.
+func HealthCheck(c *gin.Context) {
+    status := "healthy"
+    httpStatus := http.StatusOK
+
+    checks := gin.H{}
+    if err := config.HealthCheck(); err != nil {
+        status = "unhealthy"
+        httpStatus = http.StatusServiceUnavailable
+        checks["database"] = gin.H{"status": "down", "error": err.Error()}
+    } else {
+        checks["database"] = gin.H{"status": "up"}
+    }
+
+    if err := config.GeminiHealthCheck(); err != nil {
+        status = "unhealthy"
+        httpStatus = http.StatusServiceUnavailable
+        checks["gemini"] = gin.H{"status": "down", "error": err.Error()}
+    } else {
+        checks["gemini"] = gin.H{"status": "up"}
+    }
+
+    build := config.GetBuildInfo()
+    response := gin.H{
+        "status":    status,
+        "service":   "jevi-chat",
+        "version":   build.Version,
+        "build":     build,
+        "cors":      "enabled",
+        "iframe":    "enabled",
+        "timestamp": time.Now().Format(time.RFC3339),
+        "checks":    checks,
+    }
+    if stats, err := config.GetDatabaseStats(); err == nil {
+        response["database_stats"] = stats
+    }
+
+    c.JSON(httpStatus, response)
+}
+
+// GetVersion - Version, commit and build time of the running server
+func GetVersion(c *gin.Context) {
+    c.JSON(http.StatusOK, config.GetBuildInfo())
+}
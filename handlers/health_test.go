@@ -0,0 +1,61 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "jevi-chat/config"
+)
+
+func TestHealthCheckReportsDatabaseDown(t *testing.T) {
+    // No database is initialized in tests, which looks the same as MongoDB being down
+    w := serveRoute(http.MethodGet, "/health", "/health", HealthCheck, "")
+    if w.Code != http.StatusServiceUnavailable {
+        t.Fatalf("status = %d, want 503", w.Code)
+    }
+
+    var body struct {
+        Status  string `json:"status"`
+        Service string `json:"service"`
+        Checks  map[string]struct {
+            Status string `json:"status"`
+            Error  string `json:"error"`
+        } `json:"checks"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.Status != "unhealthy" || body.Service != "jevi-chat" {
+        t.Errorf("status = %q, service = %q", body.Status, body.Service)
+    }
+    if db := body.Checks["database"]; db.Status != "down" || db.Error == "" {
+        t.Errorf("database check = %+v, want down with an error", db)
+    }
+    if _, ok := body.Checks["gemini"]; !ok {
+        t.Error("the Gemini check is missing")
+    }
+}
+
+func TestGetVersion(t *testing.T) {
+    w := serveRoute(http.MethodGet, "/api/version", "/api/version", GetVersion, "")
+    var info config.BuildInfo
+    if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetVersion = %d %s", w.Code, w.Body)
+    }
+    if info != config.GetBuildInfo() {
+        t.Errorf("version = %+v, want %+v", info, config.GetBuildInfo())
+    }
+
+    var health struct {
+        Version string           `json:"version"`
+        Build   config.BuildInfo `json:"build"`
+    }
+    w = serveRoute(http.MethodGet, "/health", "/health", HealthCheck, "")
+    if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+        t.Fatal(err)
+    }
+    if health.Version != info.Version || health.Build != info {
+        t.Errorf("health reports %q %+v, want %+v", health.Version, health.Build, info)
+    }
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// maxIdempotencyKeyLength bounds client-chosen keys
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecorder tees the response body so it can be replayed for a repeated key
+type idempotencyRecorder struct {
+    gin.ResponseWriter
+    body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+    w.body.Write(data)
+    return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(data string) (int, error) {
+    w.body.WriteString(data)
+    return w.ResponseWriter.WriteString(data)
+}
+
+// idempotentReplayable - Whether a response is stored for its key; only successes are
+func idempotentReplayable(status int) bool {
+    return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+// idempotencyKey - The key from the Idempotency-Key header, falling back to the body field
+func idempotencyKey(c *gin.Context, bodyKey string) string {
+    if key := strings.TrimSpace(c.GetHeader("Idempotency-Key")); key != "" {
+        return key
+    }
+    return strings.TrimSpace(bodyKey)
+}
+
+// beginIdempotentRequest - Claim an idempotency key for a message submission. When the key
+// was already used, the original response is replayed (or 409 returned while it is still
+// being processed) and replayed is true. Otherwise the caller must defer finish, which
+// stores a successful response for later repeats and releases the key after any other, so
+// a retry after a validation error or rate limit runs again. Requests without a key
+// always proceed.
+func beginIdempotentRequest(c *gin.Context, projectID, key string) (replayed bool, finish func()) {
+    if key == "" {
+        return false, func() {}
+    }
+    if len(key) > maxIdempotencyKeyLength {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency key is too long"})
+        return true, nil
+    }
+
+    collection := config.DB.Collection("idempotency_keys")
+    record := models.IdempotencyRecord{
+        ID:        projectID + ":" + key,
+        ProjectID: projectID,
+        Key:       key,
+        Status:    models.IdempotencyPending,
+        CreatedAt: time.Now(),
+    }
+
+    ctx, cancel := requestContext(c)
+    _, err := collection.InsertOne(ctx, record)
+    cancel()
+    if mongo.IsDuplicateKeyError(err) {
+        var existing models.IdempotencyRecord
+        ctx, cancel := requestContext(c)
+        err = collection.FindOne(ctx, bson.M{"_id": record.ID}).Decode(&existing)
+        cancel()
+        switch {
+        case err != nil:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency key"})
+        case existing.Status == models.IdempotencyPending:
+            c.JSON(http.StatusConflict, gin.H{
+                "error":  "A request with this idempotency key is still being processed",
+                "status": "idempotency_key_in_use",
+            })
+        default:
+            c.Header("Idempotent-Replayed", "true")
+            c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+        }
+        return true, nil
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency key"})
+        return true, nil
+    }
+
+    recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+    c.Writer = recorder
+
+    return false, func() {
+        // Not the request's context: a client that disconnected is the one that retries,
+        // and its key must not stay pending
+        ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+        defer cancel()
+
+        if !idempotentReplayable(recorder.Status()) {
+            collection.DeleteOne(ctx, bson.M{"_id": record.ID})
+            return
+        }
+        collection.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{
+            "status":       models.IdempotencyCompleted,
+            "status_code":  recorder.Status(),
+            "content_type": recorder.Header().Get("Content-Type"),
+            "body":         recorder.body.Bytes(),
+        }})
+    }
+}
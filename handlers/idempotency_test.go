@@ -0,0 +1,62 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestIdempotentReplayableOnlySuccesses(t *testing.T) {
+    cases := map[int]bool{
+        http.StatusOK:                  true,
+        http.StatusCreated:             true,
+        http.StatusBadRequest:          false,
+        http.StatusForbidden:           false,
+        http.StatusConflict:            false,
+        http.StatusTooManyRequests:     false,
+        http.StatusInternalServerError: false,
+    }
+    for status, want := range cases {
+        if got := idempotentReplayable(status); got != want {
+            t.Errorf("idempotentReplayable(%d) = %v, want %v", status, got, want)
+        }
+    }
+}
+
+func TestIdempotencyKeyPrefersHeader(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+    if got := idempotencyKey(c, "  body-key "); got != "body-key" {
+        t.Errorf("body key = %q, want %q", got, "body-key")
+    }
+    c.Request.Header.Set("Idempotency-Key", "header-key")
+    if got := idempotencyKey(c, "body-key"); got != "header-key" {
+        t.Errorf("header key = %q, want %q", got, "header-key")
+    }
+}
+
+func TestBeginIdempotentRequestRejectsLongKey(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+    replayed, _ := beginIdempotentRequest(c, "project", strings.Repeat("k", maxIdempotencyKeyLength+1))
+    if !replayed || w.Code != http.StatusBadRequest {
+        t.Fatalf("replayed=%v status=%d, want true and 400", replayed, w.Code)
+    }
+}
+
+func TestBeginIdempotentRequestWithoutKeyProceeds(t *testing.T) {
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    replayed, finish := beginIdempotentRequest(c, "project", "")
+    if replayed || finish == nil {
+        t.Fatalf("replayed=%v finish=%v, want false and a no-op finish", replayed, finish != nil)
+    }
+    finish()
+}
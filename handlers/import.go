@@ -0,0 +1,213 @@
+package handlers
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// maxImportRows caps a single import request
+const maxImportRows = 500
+
+// projectImportRow is one project definition in an import batch
+type projectImportRow struct {
+    Name               string `json:"name"`
+    Description        string `json:"description"`
+    Category           string `json:"category"`
+    GeminiModel        string `json:"gemini_model"`
+    GeminiAPIKey       string `json:"gemini_api_key"`
+    GeminiLimit        int    `json:"gemini_limit"`
+    GeminiDailyLimit   int    `json:"gemini_daily_limit"`
+    GeminiMonthlyLimit int    `json:"gemini_monthly_limit"`
+    WelcomeMessage     string `json:"welcome_message"`
+}
+
+// projectImportResult reports the outcome for one row
+type projectImportResult struct {
+    Row    int    `json:"row"`
+    Name   string `json:"name"`
+    Status string `json:"status"` // "created", "skipped" or "failed"
+    ID     string `json:"id,omitempty"`
+    Error  string `json:"error,omitempty"`
+}
+
+// ImportProjects - Create projects in bulk from a JSON array or a CSV body with a header row.
+// Each row is validated and inserted on its own; the response reports every row.
+func ImportProjects(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var rows []projectImportRow
+    var err error
+    if strings.Contains(c.ContentType(), "csv") {
+        rows, err = parseProjectImportCSV(c.Request.Body)
+    } else {
+        err = json.NewDecoder(c.Request.Body).Decode(&rows)
+    }
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import data", "details": err.Error()})
+        return
+    }
+    if len(rows) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "No projects to import"})
+        return
+    }
+    if len(rows) > maxImportRows {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Import is limited to %d projects per request", maxImportRows)})
+        return
+    }
+
+    ownerID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+    collection := config.DB.Collection("projects")
+    seen := make(map[string]bool)
+
+    results := make([]projectImportResult, 0, len(rows))
+    created, skipped, failed := 0, 0, 0
+    for i, row := range rows {
+        result := projectImportResult{Row: i + 1, Name: strings.TrimSpace(row.Name)}
+
+        project := models.Project{
+            Name:               strings.TrimSpace(row.Name),
+            Description:        row.Description,
+            Category:           row.Category,
+            GeminiModel:        row.GeminiModel,
+            GeminiAPIKey:       strings.TrimSpace(row.GeminiAPIKey),
+            GeminiLimit:        row.GeminiLimit,
+            GeminiDailyLimit:   row.GeminiDailyLimit,
+            GeminiMonthlyLimit: row.GeminiMonthlyLimit,
+            WelcomeMessage:     row.WelcomeMessage,
+            GeminiEnabled:      true, // every valid row carries an API key
+            OwnerID:            ownerID,
+        }
+        applyNewProjectDefaults(&project)
+
+        if err := project.Validate(); err != nil {
+            result.Status, result.Error = "failed", err.Error()
+            failed++
+            results = append(results, result)
+            continue
+        }
+        if err := validateGeminiModel(project.GeminiModel); err != nil {
+            result.Status, result.Error = "failed", err.Error()
+            failed++
+            results = append(results, result)
+            continue
+        }
+
+        // Duplicates are skipped, whether they already exist or repeat within the batch
+        key := strings.ToLower(project.Name)
+        exists, err := projectNameExists(ctx, project.Name, primitive.NilObjectID)
+        if err != nil {
+            result.Status, result.Error = "failed", "failed to check for duplicates"
+            failed++
+            results = append(results, result)
+            continue
+        }
+        if exists || seen[key] {
+            result.Status, result.Error = "skipped", "a project with this name already exists"
+            skipped++
+            results = append(results, result)
+            continue
+        }
+
+        if project.GeminiAPIKey, err = encryptAPIKey(project.GeminiAPIKey); err != nil {
+            result.Status, result.Error = "failed", "failed to secure API key"
+            failed++
+            results = append(results, result)
+            continue
+        }
+
+        if _, err := collection.InsertOne(ctx, project); err != nil {
+            result.Status, result.Error = "failed", "failed to create project"
+            failed++
+            results = append(results, result)
+            continue
+        }
+
+        seen[key] = true
+        result.Status, result.ID = "created", project.ID.Hex()
+        created++
+        results = append(results, result)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": failed == 0,
+        "total":   len(rows),
+        "created": created,
+        "skipped": skipped,
+        "failed":  failed,
+        "results": results,
+    })
+}
+
+// parseProjectImportCSV reads rows keyed by a header row using the JSON field names
+func parseProjectImportCSV(body io.Reader) ([]projectImportRow, error) {
+    reader := csv.NewReader(body)
+    reader.TrimLeadingSpace = true
+
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, err
+    }
+    if len(records) < 2 {
+        return nil, nil
+    }
+
+    header := make(map[string]int)
+    for i, name := range records[0] {
+        header[strings.ToLower(strings.TrimSpace(name))] = i
+    }
+    if _, ok := header["name"]; !ok {
+        return nil, fmt.Errorf("CSV header must include a name column")
+    }
+
+    rows := make([]projectImportRow, 0, len(records)-1)
+    for line, record := range records[1:] {
+        get := func(column string) string {
+            if i, ok := header[column]; ok && i < len(record) {
+                return strings.TrimSpace(record[i])
+            }
+            return ""
+        }
+        getInt := func(column string) (int, error) {
+            value := get(column)
+            if value == "" {
+                return 0, nil
+            }
+            n, err := strconv.Atoi(value)
+            if err != nil {
+                return 0, fmt.Errorf("row %d: %s must be a number", line+1, column)
+            }
+            return n, nil
+        }
+
+        row := projectImportRow{
+            Name:           get("name"),
+            Description:    get("description"),
+            Category:       get("category"),
+            GeminiModel:    get("gemini_model"),
+            GeminiAPIKey:   get("gemini_api_key"),
+            WelcomeMessage: get("welcome_message"),
+        }
+        if row.GeminiLimit, err = getInt("gemini_limit"); err != nil {
+            return nil, err
+        }
+        if row.GeminiDailyLimit, err = getInt("gemini_daily_limit"); err != nil {
+            return nil, err
+        }
+        if row.GeminiMonthlyLimit, err = getInt("gemini_monthly_limit"); err != nil {
+            return nil, err
+        }
+        rows = append(rows, row)
+    }
+    return rows, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestParseProjectImportCSV(t *testing.T) {
+    csv := "Name, gemini_api_key, gemini_limit, category\n" +
+        "Support Bot, key-1, 500, support\n" +
+        "Sales Bot, key-2, , sales\n"
+
+    rows, err := parseProjectImportCSV(strings.NewReader(csv))
+    if err != nil {
+        t.Fatalf("parseProjectImportCSV: %v", err)
+    }
+    if len(rows) != 2 {
+        t.Fatalf("rows = %d, want 2", len(rows))
+    }
+    first := rows[0]
+    if first.Name != "Support Bot" || first.GeminiAPIKey != "key-1" || first.GeminiLimit != 500 || first.Category != "support" {
+        t.Errorf("first row = %+v", first)
+    }
+    if rows[1].GeminiLimit != 0 {
+        t.Errorf("blank gemini_limit = %d, want 0 so the default applies", rows[1].GeminiLimit)
+    }
+}
+
+func TestParseProjectImportCSVErrors(t *testing.T) {
+    cases := map[string]string{
+        "missing name column": "description\nhello\n",
+        "non-numeric limit":   "name,gemini_limit\nBot,lots\n",
+        "ragged rows":         "name,category\nBot\n",
+    }
+    for name, csv := range cases {
+        if _, err := parseProjectImportCSV(strings.NewReader(csv)); err == nil {
+            t.Errorf("%s: expected an error", name)
+        }
+    }
+
+    rows, err := parseProjectImportCSV(strings.NewReader("name,category\n"))
+    if err != nil || len(rows) != 0 {
+        t.Errorf("header only: rows = %v, err = %v; want no rows", rows, err)
+    }
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "html"
+    "log"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/generative-ai-go/genai"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+    "jevi-chat/utils"
+)
+
+// Knowledge base retrieval settings, in characters
+const (
+    knowledgeChunkSize    = 1500
+    knowledgeChunkOverlap = 200
+    // Gemini accepts at most 100 texts per batch embedding request
+    embeddingBatchSize = 100
+)
+
+// RebuildEmbeddings - Re-chunk a project's knowledge base and embed every chunk again,
+// e.g. after changing the API key or when earlier embedding attempts failed
+func RebuildEmbeddings(c *gin.Context) {
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var project models.Project
+    ctx, cancel := requestContext(c)
+    err = config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if project.GeminiAPIKey == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Project has no Gemini API key configured"})
+        return
+    }
+
+    chunks, embedded, err := rebuildKnowledgeChunks(project, project.Sources())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild knowledge base"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":         embedded == chunks,
+        "chunks":          chunks,
+        "embedded_chunks": embedded,
+        "model":           models.GeminiEmbeddingModel,
+    })
+}
+
+// rebuildKnowledgeChunks - Replace a project's stored chunks with ones cut from its enabled
+// sources, embedding them with Gemini when the project has an API key. Chunks that can't be
+// embedded are still stored and found by keyword. Returns the number of chunks stored and
+// how many of them were embedded.
+func rebuildKnowledgeChunks(project models.Project, files []models.KnowledgeSource) (int, int, error) {
+    var chunks []models.KnowledgeChunk
+    now := time.Now()
+    for _, file := range files {
+        if !file.Enabled || file.Content == "" {
+            continue
+        }
+        for i, content := range utils.ChunkText(file.Content, knowledgeChunkSize, knowledgeChunkOverlap) {
+            chunks = append(chunks, models.KnowledgeChunk{
+                ProjectID: project.ID,
+                FileID:    file.ID,
+                FileName:  file.Name,
+                Index:     i,
+                Content:   content,
+                CreatedAt: now,
+            })
+        }
+    }
+
+    embedded := 0
+    if project.GeminiAPIKey != "" && len(chunks) > 0 {
+        var err error
+        if embedded, err = embedKnowledgeChunks(decryptAPIKey(project.GeminiAPIKey), chunks); err != nil {
+            log.Printf("Failed to embed knowledge chunks for %s: %v", project.ID.Hex(), err)
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    collection := config.DB.Collection("kb_chunks")
+    if _, err := collection.DeleteMany(ctx, bson.M{"project_id": project.ID}); err != nil {
+        log.Printf("Failed to clear knowledge chunks for %s: %v", project.ID.Hex(), err)
+        return 0, 0, err
+    }
+    if len(chunks) == 0 {
+        return 0, 0, nil
+    }
+
+    documents := make([]interface{}, len(chunks))
+    for i := range chunks {
+        documents[i] = chunks[i]
+    }
+    if _, err := collection.InsertMany(ctx, documents); err != nil {
+        log.Printf("Failed to store knowledge chunks for %s: %v", project.ID.Hex(), err)
+        return 0, 0, err
+    }
+    return len(chunks), embedded, nil
+}
+
+// embedKnowledgeChunks - Fill in the embedding of each chunk, in batches of embeddingBatchSize.
+// Returns how many chunks were embedded before any error.
+func embedKnowledgeChunks(apiKey string, chunks []models.KnowledgeChunk) (int, error) {
+    client, release, err := config.AcquireGeminiClient(apiKey)
+    if err != nil {
+        return 0, err
+    }
+    defer release()
+
+    model := client.EmbeddingModel(models.GeminiEmbeddingModel)
+    model.TaskType = genai.TaskTypeRetrievalDocument
+
+    embedded := 0
+    for start := 0; start < len(chunks); start += embeddingBatchSize {
+        end := start + embeddingBatchSize
+        if end > len(chunks) {
+            end = len(chunks)
+        }
+
+        batch := model.NewBatch()
+        for _, chunk := range chunks[start:end] {
+            batch.AddContentWithTitle(chunk.FileName, genai.Text(chunk.Content))
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+        resp, err := model.BatchEmbedContents(ctx, batch)
+        cancel()
+        if err != nil {
+            return embedded, err
+        }
+        if len(resp.Embeddings) != end-start {
+            return embedded, fmt.Errorf("expected %d embeddings, got %d", end-start, len(resp.Embeddings))
+        }
+
+        for i, embedding := range resp.Embeddings {
+            chunks[start+i].Embedding = embedding.Values
+            chunks[start+i].EmbeddingModel = models.GeminiEmbeddingModel
+            embedded++
+        }
+    }
+    return embedded, nil
+}
+
+// embedQuestion - Embedding of a user question for semantic chunk retrieval
+func embedQuestion(apiKey, question string) ([]float32, error) {
+    client, release, err := config.AcquireGeminiClient(apiKey)
+    if err != nil {
+        return nil, err
+    }
+    defer release()
+
+    model := client.EmbeddingModel(models.GeminiEmbeddingModel)
+    model.TaskType = genai.TaskTypeRetrievalQuery
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    resp, err := model.EmbedContent(ctx, genai.Text(question))
+    if err != nil {
+        return nil, err
+    }
+    if resp.Embedding == nil {
+        return nil, fmt.Errorf("no embedding returned")
+    }
+    return resp.Embedding.Values, nil
+}
+
+// knowledgeContext - Knowledge base text to include in the prompt for a question.
+// Small knowledge bases are used whole; larger ones contribute their best matching
+// chunks up to config.KnowledgeMaxChars, kept in document order.
+func knowledgeContext(project models.Project, question string) string {
+    if !knowledgeBaseReady(project) {
+        return ""
+    }
+    if len([]rune(project.PDFContent)) <= config.KnowledgeMaxChars {
+        return project.PDFContent
+    }
+
+    chunks := loadKnowledgeChunks(project.ID)
+    if len(chunks) == 0 {
+        // Not chunked yet (e.g. uploaded before chunking existed); cut the aggregate content
+        for i, content := range utils.ChunkText(project.PDFContent, knowledgeChunkSize, knowledgeChunkOverlap) {
+            chunks = append(chunks, models.KnowledgeChunk{Index: i, Content: content})
+        }
+    }
+
+    contents := make([]string, len(chunks))
+    for i, chunk := range chunks {
+        contents[i] = chunk.Content
+    }
+    question = html.UnescapeString(question)
+
+    // Prefer semantic ranking when every chunk has an embedding; fall back to keywords
+    var ranked []int
+    if vectors := chunkEmbeddings(chunks); vectors != nil && project.GeminiAPIKey != "" {
+        if queryVector, err := embedQuestion(decryptAPIKey(project.GeminiAPIKey), question); err == nil {
+            ranked = utils.RankBySimilarity(queryVector, vectors)
+        } else {
+            log.Printf("Failed to embed question for %s: %v", project.ID.Hex(), err)
+        }
+    }
+    if ranked == nil {
+        ranked = utils.RankChunks(question, contents)
+    }
+    if len(ranked) == 0 {
+        // Nothing matches; the opening of the documents is the best general context
+        for i := range chunks {
+            ranked = append(ranked, i)
+        }
+    }
+
+    knowledge := joinChunks(contents, ranked)
+    if size := len([]rune(knowledge)); size > config.KnowledgeMaxChars {
+        // Only happens when a single chunk is over the budget
+        log.Printf("Knowledge base for %s truncated from %d to %d characters (%s)",
+            project.ID.Hex(), size, config.KnowledgeMaxChars, config.KnowledgeTruncation)
+        knowledge = utils.TruncateText(knowledge, config.KnowledgeMaxChars, config.KnowledgeTruncation)
+    }
+    return knowledge
+}
+
+// minKnowledgeChars is the least text a knowledge base needs to be worth answering from
+const minKnowledgeChars = 40
+
+// knowledgePlaceholders are texts left in pdf_content when no document was really
+// processed, compared case-insensitively against the whole trimmed content
+var knowledgePlaceholders = []string{
+    "no content",
+    "no pdf content",
+    "no content available",
+    "no content generated from pdf",
+    "placeholder",
+    "lorem ipsum",
+    "todo",
+    "n/a",
+}
+
+// knowledgeBaseReady - Whether the project has real knowledge base content, rather than
+// none, a few stray characters or a placeholder
+func knowledgeBaseReady(project models.Project) bool {
+    content := strings.TrimSpace(project.PDFContent)
+    if len([]rune(content)) < minKnowledgeChars {
+        return false
+    }
+    lower := strings.ToLower(strings.TrimRight(content, ".!"))
+    for _, placeholder := range knowledgePlaceholders {
+        if lower == placeholder {
+            return false
+        }
+    }
+    return !strings.HasPrefix(strings.ToLower(content), "lorem ipsum")
+}
+
+// knowledgeNotReadyReply - The configured reply for a Gemini-enabled project without a
+// usable knowledge base, when chat is set to send it instead of calling Gemini
+func knowledgeNotReadyReply(project models.Project) (string, bool) {
+    if config.EmptyKnowledgeMode != config.EmptyKnowledgeMessage || !project.GeminiEnabled || knowledgeBaseReady(project) {
+        return "", false
+    }
+    return config.EmptyKnowledgeReply, true
+}
+
+// chunkEmbeddings - The chunks' vectors, or nil unless all of them are embedded
+func chunkEmbeddings(chunks []models.KnowledgeChunk) [][]float32 {
+    vectors := make([][]float32, len(chunks))
+    for i, chunk := range chunks {
+        if len(chunk.Embedding) == 0 {
+            return nil
+        }
+        vectors[i] = chunk.Embedding
+    }
+    return vectors
+}
+
+// joinChunks - Take chunks in ranked order until the context budget is used, then
+// join them in their original order
+func joinChunks(contents []string, ranked []int) string {
+    var selected []int
+    size := 0
+    for _, i := range ranked {
+        length := len([]rune(contents[i]))
+        if size+length > config.KnowledgeMaxChars && len(selected) > 0 {
+            break
+        }
+        selected = append(selected, i)
+        size += length
+    }
+    sort.Ints(selected)
+
+    parts := make([]string, len(selected))
+    for i, index := range selected {
+        parts[i] = contents[index]
+    }
+    return strings.Join(parts, "\n\n---\n\n")
+}
+
+// loadKnowledgeChunks - A project's stored chunks in document order
+func loadKnowledgeChunks(projectID primitive.ObjectID) []models.KnowledgeChunk {
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    defer cancel()
+
+    opts := options.Find().SetSort(bson.D{{Key: "file_id", Value: 1}, {Key: "index", Value: 1}})
+    cursor, err := config.DB.Collection("kb_chunks").Find(ctx, bson.M{"project_id": projectID}, opts)
+    if err != nil {
+        log.Printf("Failed to load knowledge chunks for %s: %v", projectID.Hex(), err)
+        return nil
+    }
+
+    var chunks []models.KnowledgeChunk
+    if err := cursor.All(ctx, &chunks); err != nil {
+        log.Printf("Failed to decode knowledge chunks for %s: %v", projectID.Hex(), err)
+        return nil
+    }
+    return chunks
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// useKnowledgeBudget sets config.KnowledgeMaxChars for the length of a test
+func useKnowledgeBudget(t *testing.T, chars int) {
+    t.Helper()
+    previous := config.KnowledgeMaxChars
+    config.KnowledgeMaxChars = chars
+    t.Cleanup(func() { config.KnowledgeMaxChars = previous })
+}
+
+func TestJoinChunksKeepsBudgetAndOrder(t *testing.T) {
+    useKnowledgeBudget(t, 25)
+    contents := []string{"first chunk", "second chunk", "third chunk"}
+
+    // Best matches first, but the result reads in document order
+    if got := joinChunks(contents, []int{2, 0, 1}); got != "first chunk\n\n---\n\nthird chunk" {
+        t.Errorf("joinChunks = %q", got)
+    }
+    // The best chunk is always included, even when it alone is over the budget
+    useKnowledgeBudget(t, 5)
+    if got := joinChunks(contents, []int{1, 0}); got != "second chunk" {
+        t.Errorf("joinChunks over budget = %q, want the best chunk", got)
+    }
+}
+
+func TestKnowledgeContextWithinBudget(t *testing.T) {
+    useKnowledgeBudget(t, 1000)
+    content := strings.Repeat("Opening hours are nine to five on weekdays. ", 5)
+    // Small knowledge bases go into the prompt whole, without loading chunks
+    if got := knowledgeContext(models.Project{PDFContent: content}, "when are you open?"); got != content {
+        t.Errorf("knowledgeContext = %q, want the whole knowledge base", got)
+    }
+}
+
+func TestKnowledgeBaseReady(t *testing.T) {
+    cases := []struct {
+        content string
+        ready   bool
+    }{
+        {"", false},
+        {"   \n  ", false},
+        {"Short note.", false},
+        {"No content available.", false},
+        {"  NO PDF CONTENT  ", false},
+        {"Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod.", false},
+        {"Opening hours are nine to five on weekdays and ten to two on Saturdays.", true},
+    }
+    for _, tc := range cases {
+        if got := knowledgeBaseReady(models.Project{PDFContent: tc.content}); got != tc.ready {
+            t.Errorf("knowledgeBaseReady(%q) = %v, want %v", tc.content, got, tc.ready)
+        }
+    }
+    // Empty knowledge bases add nothing to the prompt
+    if got := knowledgeContext(models.Project{PDFContent: "placeholder"}, "hours?"); got != "" {
+        t.Errorf("knowledgeContext = %q, want nothing for a placeholder", got)
+    }
+}
+
+// useEmptyKnowledgeMode sets config.EmptyKnowledgeMode for the length of a test
+func useEmptyKnowledgeMode(t *testing.T, mode string) {
+    t.Helper()
+    previous := config.EmptyKnowledgeMode
+    config.EmptyKnowledgeMode = mode
+    t.Cleanup(func() { config.EmptyKnowledgeMode = previous })
+}
+
+func TestKnowledgeNotReadyReply(t *testing.T) {
+    ready := "Opening hours are nine to five on weekdays and ten to two on Saturdays."
+    cases := []struct {
+        name    string
+        mode    string
+        project models.Project
+        reply   bool
+    }{
+        {"general mode", config.EmptyKnowledgeGeneral, models.Project{GeminiEnabled: true}, false},
+        {"message mode", config.EmptyKnowledgeMessage, models.Project{GeminiEnabled: true}, true},
+        {"placeholder content", config.EmptyKnowledgeMessage, models.Project{GeminiEnabled: true, PDFContent: "TODO"}, true},
+        {"knowledge ready", config.EmptyKnowledgeMessage, models.Project{GeminiEnabled: true, PDFContent: ready}, false},
+        {"Gemini disabled", config.EmptyKnowledgeMessage, models.Project{}, false},
+    }
+    for _, tc := range cases {
+        useEmptyKnowledgeMode(t, tc.mode)
+        reply, notReady := knowledgeNotReadyReply(tc.project)
+        if notReady != tc.reply || (notReady && reply != config.EmptyKnowledgeReply) {
+            t.Errorf("%s: = %q, %v; want the configured reply %v", tc.name, reply, notReady, tc.reply)
+        }
+    }
+}
+
+func TestIframeSendMessageWithEmptyKnowledgeBase(t *testing.T) {
+    testDatabase(t)
+    useEmptyKnowledgeMode(t, config.EmptyKnowledgeMessage)
+    ctx := context.Background()
+    project := models.Project{
+        ID:                 primitive.NewObjectID(),
+        IsActive:           true,
+        GeminiEnabled:      true,
+        GeminiAPIKey:       "key",
+        GeminiLimit:        100,
+        GeminiDailyLimit:   100,
+        GeminiMonthlyLimit: 1000,
+        PDFContent:         "No content available",
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    // Past the greeting, so the knowledge base would be needed
+    earlier := models.ChatMessage{ProjectID: project.ID, SessionID: "s1", Message: "Hi", Response: "Hello!", Timestamp: time.Now()}
+    if _, err := config.DB.Collection("chat_messages").InsertOne(ctx, earlier); err != nil {
+        t.Fatal(err)
+    }
+
+    path := "/chat/" + project.ID.Hex() + "/message"
+    w := serveRoute(http.MethodPost, "/chat/:projectId/message", path, IframeSendMessage, `{"message":"What are your hours?","session_id":"s1"}`)
+    var body struct {
+        Response string `json:"response"`
+        Status   string `json:"status"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("IframeSendMessage = %d %s", w.Code, w.Body)
+    }
+    if body.Response != config.EmptyKnowledgeReply || body.Status != "knowledge_base_not_ready" {
+        t.Errorf("reply = %q (%s), want the not-ready reply", body.Response, body.Status)
+    }
+
+    // The reply didn't reach Gemini, so no usage was reserved
+    var stored models.Project
+    config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored)
+    if stored.GeminiUsageToday != 0 {
+        t.Errorf("usage today = %d, want 0", stored.GeminiUsageToday)
+    }
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsHandler = promhttp.Handler()
+
+// Metrics - Expose application metrics from the default Prometheus registry
+func Metrics(c *gin.Context) {
+    metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
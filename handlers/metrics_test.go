@@ -0,0 +1,51 @@
+package handlers
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/utils"
+)
+
+func TestMetricsScrape(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    utils.HTTPRequestsTotal.WithLabelValues("/scrape-test", "GET", "200").Inc()
+    utils.GeminiTokensTotal.WithLabelValues("gemini-test", "input").Add(12)
+    utils.ChatResponseLatency.WithLabelValues("scrape-test").Observe(0.3)
+
+    r := gin.New()
+    r.GET("/metrics", Metrics)
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("scrape status = %d", w.Code)
+    }
+    if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+        t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+    }
+    body := w.Body.String()
+    for _, want := range []string{
+        `http_requests_total{method="GET",route="/scrape-test",status="200"} 1`,
+        `gemini_tokens_total{model="gemini-test",type="input"} 12`,
+        `chat_response_latency_seconds_bucket{endpoint="scrape-test",le="0.5"} 1`,
+        "# TYPE http_requests_total counter",
+        "go_goroutines",
+    } {
+        if !strings.Contains(body, want) {
+            t.Errorf("scrape output is missing %q", want)
+        }
+    }
+}
+
+func TestCounterTotalSumsLabels(t *testing.T) {
+    before := utils.CounterTotal(utils.RateLimitRejectionsTotal)
+    utils.RateLimitRejectionsTotal.WithLabelValues("counter-total-a").Inc()
+    utils.RateLimitRejectionsTotal.WithLabelValues("counter-total-b").Add(2)
+    if got := utils.CounterTotal(utils.RateLimitRejectionsTotal) - before; got != 3 {
+        t.Errorf("CounterTotal grew by %v, want 3", got)
+    }
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "html"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/generative-ai-go/genai"
+    "jevi-chat/config"
+    "jevi-chat/models"
+    "jevi-chat/utils"
+)
+
+// Replies shown when moderation refuses a message, or Gemini withholds its answer
+const (
+    moderationRejectedMessage = "Your message contains content that isn't allowed here. Please rephrase it."
+    contentBlockedMessage     = "I'm not able to help with that. Please try asking something else."
+)
+
+// moderateMessage - Apply the project's moderation to an HTML-escaped message. Returns the
+// message to use (with blocked words masked when the project masks) and whether it was refused.
+func moderateMessage(project models.Project, message string) (string, bool) {
+    if !project.Moderation.Enabled {
+        return message, false
+    }
+
+    filter := utils.NewWordFilter(append(config.BlockedWords(), project.Moderation.BlockedWords...))
+    typed := html.UnescapeString(message)
+    if !filter.Matches(typed) {
+        return message, false
+    }
+    if project.Moderation.MaskBlockedWords() {
+        return html.EscapeString(filter.Mask(typed)), false
+    }
+    return "", true
+}
+
+// rejectModeratedMessage - moderateMessage for HTTP handlers. Writes a 400 with status
+// "message_blocked" and returns false when the message is refused.
+func rejectModeratedMessage(c *gin.Context, project models.Project, message string) (string, bool) {
+    moderated, blocked := moderateMessage(project, message)
+    if blocked {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":  moderationRejectedMessage,
+            "status": "message_blocked",
+        })
+        return "", false
+    }
+    return moderated, true
+}
+
+// geminiHarmCategories and geminiBlockThresholds map the names projects configure to Gemini's
+var (
+    geminiHarmCategories = map[string]genai.HarmCategory{
+        models.SafetyCategoryHarassment:       genai.HarmCategoryHarassment,
+        models.SafetyCategoryHateSpeech:       genai.HarmCategoryHateSpeech,
+        models.SafetyCategorySexuallyExplicit: genai.HarmCategorySexuallyExplicit,
+        models.SafetyCategoryDangerousContent: genai.HarmCategoryDangerousContent,
+    }
+    geminiBlockThresholds = map[string]genai.HarmBlockThreshold{
+        models.SafetyBlockNone:           genai.HarmBlockNone,
+        models.SafetyBlockOnlyHigh:       genai.HarmBlockOnlyHigh,
+        models.SafetyBlockMediumAndAbove: genai.HarmBlockMediumAndAbove,
+        models.SafetyBlockLowAndAbove:    genai.HarmBlockLowAndAbove,
+    }
+)
+
+// geminiSafetySettings - The safety settings to generate a project's replies with, or nil
+// for Gemini's defaults. Projects using Gemini's moderation block even low-probability
+// harmful content in every category, whatever thresholds are configured.
+func geminiSafetySettings(project models.Project) []*genai.SafetySetting {
+    if project.Moderation.Enabled && project.Moderation.GeminiSafety {
+        settings := make([]*genai.SafetySetting, 0, len(models.SafetyCategories))
+        for _, category := range models.SafetyCategories {
+            settings = append(settings, &genai.SafetySetting{
+                Category:  geminiHarmCategories[category],
+                Threshold: genai.HarmBlockLowAndAbove,
+            })
+        }
+        return settings
+    }
+
+    var settings []*genai.SafetySetting
+    for _, setting := range project.SafetySettings {
+        settings = append(settings, &genai.SafetySetting{
+            Category:  geminiHarmCategories[setting.Category],
+            Threshold: geminiBlockThresholds[setting.Threshold],
+        })
+    }
+    return settings
+}
+
+// responseText - The text of Gemini's first candidate. A reply withheld without text is
+// reported as a *genai.BlockedError, like the prompt and safety blocks the client detects.
+func responseText(resp *genai.GenerateContentResponse) (string, error) {
+    if len(resp.Candidates) == 0 {
+        if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+            return "", &genai.BlockedError{PromptFeedback: resp.PromptFeedback}
+        }
+        return "", fmt.Errorf("no response generated")
+    }
+
+    candidate := resp.Candidates[0]
+    if candidate.Content != nil && len(candidate.Content.Parts) > 0 {
+        return fmt.Sprintf("%v", candidate.Content.Parts[0]), nil
+    }
+    switch candidate.FinishReason {
+    case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonOther:
+        return "", &genai.BlockedError{Candidate: candidate}
+    }
+    return "", fmt.Errorf("no response generated (finish reason %s)", candidate.FinishReason)
+}
+
+// isBlockedBySafety - Whether a generation error means Gemini refused the content
+func isBlockedBySafety(err error) bool {
+    var blocked *genai.BlockedError
+    return errors.As(err, &blocked)
+}
+
+// safetyBlockReason - Why Gemini refused, e.g. "prompt: BlockReasonSafety" or
+// "response: FinishReasonRecitation"; empty when err isn't a block
+func safetyBlockReason(err error) string {
+    var blocked *genai.BlockedError
+    if !errors.As(err, &blocked) {
+        return ""
+    }
+    if blocked.PromptFeedback != nil && blocked.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+        return "prompt: " + blocked.PromptFeedback.BlockReason.String()
+    }
+    if blocked.Candidate != nil {
+        return "response: " + blocked.Candidate.FinishReason.String()
+    }
+    return "blocked"
+}
+
+// blockedReply - What to tell the user when Gemini refused: a blocked question is
+// theirs to rephrase, a withheld answer is not
+func blockedReply(err error) string {
+    var blocked *genai.BlockedError
+    if errors.As(err, &blocked) && blocked.Candidate == nil {
+        return moderationRejectedMessage
+    }
+    return contentBlockedMessage
+}
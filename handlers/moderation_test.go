@@ -0,0 +1,175 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/google/generative-ai-go/genai"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/models"
+)
+
+func TestConfigureChatModelAppliesProjectSafety(t *testing.T) {
+    project := models.Project{
+        SafetySettings: []models.SafetySetting{
+            {Category: models.SafetyCategoryHarassment, Threshold: models.SafetyBlockOnlyHigh},
+        },
+    }
+
+    model := &genai.GenerativeModel{}
+    configureChatModel(model, project, defaultChatTemperature)
+
+    if model.Temperature == nil || *model.Temperature != defaultChatTemperature {
+        t.Errorf("Temperature = %v, want %v", model.Temperature, defaultChatTemperature)
+    }
+    if len(model.SafetySettings) != 1 {
+        t.Fatalf("SafetySettings = %d entries, want 1", len(model.SafetySettings))
+    }
+    got := model.SafetySettings[0]
+    if got.Category != genai.HarmCategoryHarassment || got.Threshold != genai.HarmBlockOnlyHigh {
+        t.Errorf("SafetySettings[0] = %v/%v, want harassment/only high", got.Category, got.Threshold)
+    }
+}
+
+func TestConfigureChatModelStrictModeration(t *testing.T) {
+    project := models.Project{
+        Moderation: models.ModerationSettings{Enabled: true, GeminiSafety: true},
+        SafetySettings: []models.SafetySetting{
+            {Category: models.SafetyCategoryHarassment, Threshold: models.SafetyBlockNone},
+        },
+    }
+
+    model := &genai.GenerativeModel{}
+    configureChatModel(model, project, 0.3)
+
+    if len(model.SafetySettings) != len(models.SafetyCategories) {
+        t.Fatalf("SafetySettings = %d entries, want one per category", len(model.SafetySettings))
+    }
+    for _, setting := range model.SafetySettings {
+        if setting.Threshold != genai.HarmBlockLowAndAbove {
+            t.Errorf("%v threshold = %v, want low and above", setting.Category, setting.Threshold)
+        }
+    }
+}
+
+func TestConfigureChatModelDefaultSafety(t *testing.T) {
+    model := &genai.GenerativeModel{}
+    configureChatModel(model, models.Project{}, defaultChatTemperature)
+    if model.SafetySettings != nil {
+        t.Errorf("SafetySettings = %v, want nil for Gemini's defaults", model.SafetySettings)
+    }
+}
+
+func TestResponseTextBlocked(t *testing.T) {
+    promptBlocked := &genai.GenerateContentResponse{
+        PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonSafety},
+    }
+    _, err := responseText(promptBlocked)
+    if !isBlockedBySafety(err) {
+        t.Fatalf("blocked prompt: err = %v, want a block", err)
+    }
+    if blockedReply(err) != moderationRejectedMessage {
+        t.Errorf("blocked prompt reply = %q, want the rephrase message", blockedReply(err))
+    }
+
+    replyBlocked := &genai.GenerateContentResponse{
+        Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}},
+    }
+    _, err = responseText(replyBlocked)
+    if !isBlockedBySafety(err) {
+        t.Fatalf("blocked reply: err = %v, want a block", err)
+    }
+    if blockedReply(err) != contentBlockedMessage {
+        t.Errorf("blocked reply = %q, want the withheld message", blockedReply(err))
+    }
+    if reason := safetyBlockReason(err); reason != "response: FinishReasonSafety" {
+        t.Errorf("safetyBlockReason = %q", reason)
+    }
+
+    if isBlockedBySafety(fmt.Errorf("network down")) {
+        t.Error("a plain error must not count as a block")
+    }
+}
+
+func TestModerateMessage(t *testing.T) {
+    t.Setenv("MODERATION_BLOCKED_WORDS", "darn")
+    rejecting := models.Project{Moderation: models.ModerationSettings{Enabled: true, BlockedWords: []string{"heck"}}}
+    masking := models.Project{Moderation: models.ModerationSettings{Enabled: true, Action: models.ModerationActionMask}}
+
+    cases := []struct {
+        name    string
+        project models.Project
+        message string
+        want    string
+        blocked bool
+    }{
+        {"moderation off", models.Project{}, "darn it", "darn it", false},
+        {"clean message", rejecting, "hello there", "hello there", false},
+        {"server-wide word", rejecting, "darn it", "", true},
+        {"project word", rejecting, "what the heck", "", true},
+        {"project word elsewhere", masking, "what the heck", "what the heck", false},
+        // Stored messages are HTML-escaped; masking keeps them that way
+        {"masked", masking, "darn &amp; blast", "**** &amp; blast", false},
+    }
+    for _, tc := range cases {
+        got, blocked := moderateMessage(tc.project, tc.message)
+        if got != tc.want || blocked != tc.blocked {
+            t.Errorf("%s: moderateMessage = %q, %v; want %q, %v", tc.name, got, blocked, tc.want, tc.blocked)
+        }
+    }
+}
+
+func TestSetModerationSettingsRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/moderation"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/moderation"
+    cases := []struct {
+        name string
+        path string
+        body string
+    }{
+        {"invalid project ID", "/projects/nope/moderation", `{"enabled":true}`},
+        {"unknown action", path, `{"enabled":true,"action":"shadowban"}`},
+        {"blank word", path, `{"enabled":true,"blocked_words":["ok"," "]}`},
+    }
+    for _, tc := range cases {
+        if w := serveRoute(http.MethodPut, route, tc.path, SetModerationSettings, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+func TestResponseTextWithoutBlock(t *testing.T) {
+    answered := &genai.GenerateContentResponse{
+        Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []genai.Part{genai.Text("We open at 9.")}}}},
+    }
+    if text, err := responseText(answered); err != nil || text != "We open at 9." {
+        t.Errorf("responseText = %q, %v; want the candidate text", text, err)
+    }
+
+    for name, resp := range map[string]*genai.GenerateContentResponse{
+        "no candidates": {},
+        "truncated":     {Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonMaxTokens}}},
+    } {
+        _, err := responseText(resp)
+        if err == nil || isBlockedBySafety(err) {
+            t.Errorf("%s: err = %v, want a plain failure", name, err)
+        }
+        if reason := safetyBlockReason(err); reason != "" {
+            t.Errorf("%s: safetyBlockReason = %q, want none", name, reason)
+        }
+    }
+}
+
+func TestSafetyBlockReasonThroughWrapping(t *testing.T) {
+    _, err := responseText(&genai.GenerateContentResponse{
+        PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonSafety},
+    })
+    wrapped := fmt.Errorf("failed to generate content: %w", err)
+    if !isBlockedBySafety(wrapped) {
+        t.Fatal("a wrapped block is no longer recognised")
+    }
+    if reason := safetyBlockReason(wrapped); reason != "prompt: BlockReasonSafety" {
+        t.Errorf("safetyBlockReason = %q", reason)
+    }
+}
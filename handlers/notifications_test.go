@@ -0,0 +1,91 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestNotificationEndpointsRejectBadIDs(t *testing.T) {
+    if w := serveRoute(http.MethodGet, "/notifications", "/notifications?project_id=nope", GetNotifications, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("GetNotifications: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodPost, "/notifications/:id/read", "/notifications/nope/read", MarkNotificationRead, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("MarkNotificationRead: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodPost, "/notifications/read-all", "/notifications/read-all?project_id=nope", MarkAllNotificationsRead, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("MarkAllNotificationsRead: status = %d, want 400", w.Code)
+    }
+}
+
+type notificationList struct {
+    Notifications []models.Notification `json:"notifications"`
+    UnreadCount   int64                 `json:"unread_count"`
+    Total         int64                 `json:"total"`
+}
+
+func listNotifications(t *testing.T, query string) notificationList {
+    t.Helper()
+    w := serveRoute(http.MethodGet, "/notifications", "/notifications"+query, GetNotifications, "")
+    var list notificationList
+    if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetNotifications%s = %d %s", query, w.Code, w.Body)
+    }
+    return list
+}
+
+func TestNotificationReadTracking(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    projectID := primitive.NewObjectID()
+    otherID := primitive.NewObjectID()
+    now := time.Now()
+    notifications := []interface{}{
+        models.Notification{ID: primitive.NewObjectID(), ProjectID: projectID, Type: models.NotificationDailyLimitWarning, CreatedAt: now.Add(-time.Hour)},
+        models.Notification{ID: primitive.NewObjectID(), ProjectID: projectID, Type: models.NotificationDailyLimitReached, CreatedAt: now},
+        models.Notification{ID: primitive.NewObjectID(), ProjectID: otherID, Type: models.NotificationExpiryWarning, CreatedAt: now},
+    }
+    if _, err := config.DB.Collection("notifications").InsertMany(ctx, notifications); err != nil {
+        t.Fatal(err)
+    }
+
+    list := listNotifications(t, "")
+    if list.Total != 3 || list.UnreadCount != 3 {
+        t.Fatalf("total = %d, unread = %d; want 3 and 3", list.Total, list.UnreadCount)
+    }
+    newest := list.Notifications[0]
+
+    path := "/notifications/" + newest.ID.Hex() + "/read"
+    if w := serveRoute(http.MethodPost, "/notifications/:id/read", path, MarkNotificationRead, ""); w.Code != http.StatusOK {
+        t.Fatalf("MarkNotificationRead = %d %s", w.Code, w.Body)
+    }
+    list = listNotifications(t, "?unread=true")
+    if list.UnreadCount != 2 || len(list.Notifications) != 2 {
+        t.Errorf("after one read: unread = %d, listed = %d; want 2 and 2", list.UnreadCount, len(list.Notifications))
+    }
+    for _, notification := range list.Notifications {
+        if notification.ID == newest.ID {
+            t.Error("unread=true listed a read notification")
+        }
+    }
+
+    // Marking one project's notifications leaves the other project's unread
+    if w := serveRoute(http.MethodPost, "/notifications/read-all", "/notifications/read-all?project_id="+projectID.Hex(), MarkAllNotificationsRead, ""); w.Code != http.StatusOK {
+        t.Fatalf("MarkAllNotificationsRead = %d %s", w.Code, w.Body)
+    }
+    if list = listNotifications(t, ""); list.UnreadCount != 1 {
+        t.Errorf("unread = %d, want only the other project's notification", list.UnreadCount)
+    }
+
+    missing := "/notifications/" + primitive.NewObjectID().Hex() + "/read"
+    if w := serveRoute(http.MethodPost, "/notifications/:id/read", missing, MarkNotificationRead, ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown notification: status = %d, want 404", w.Code)
+    }
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// overviewRecentMessages is how many of the latest messages the overview includes
+const overviewRecentMessages = 10
+
+// GetProjectOverview - Everything a project dashboard shows in one call: the project,
+// its subscription and usage, message and session counts, ratings and recent activity.
+// The statistics are fetched concurrently under the request's context.
+func GetProjectOverview(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var project models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    now := time.Now()
+    var (
+        messages gin.H
+        sessions gin.H
+        ratings  gin.H
+        recent   []gin.H
+        failures int64
+    )
+
+    // Each query writes only its own result; the first error cancels the rest
+    ctx, cancelQueries := context.WithCancel(ctx)
+    defer cancelQueries()
+    var (
+        wg       sync.WaitGroup
+        errOnce  sync.Once
+        queryErr error
+    )
+    run := func(query func() error) {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if err := query(); err != nil {
+                errOnce.Do(func() {
+                    queryErr = err
+                    cancelQueries()
+                })
+            }
+        }()
+    }
+
+    run(func() (err error) {
+        messages, ratings, err = overviewMessageStats(ctx, objID, now)
+        return err
+    })
+    run(func() (err error) {
+        sessions, err = overviewSessionStats(ctx, objID, now)
+        return err
+    })
+    run(func() (err error) {
+        recent, err = overviewRecentActivity(ctx, objID)
+        return err
+    })
+    run(func() (err error) {
+        failures, err = config.DB.Collection("gemini_usage_logs").CountDocuments(ctx, bson.M{
+            "project_id": objID,
+            "success":    false,
+            "timestamp":  bson.M{"$gte": now.Add(-24 * time.Hour)},
+        })
+        return err
+    })
+    wg.Wait()
+
+    if queryErr != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch project overview"})
+        return
+    }
+
+    subscription := gin.H{
+        "status":              project.Status,
+        "plan_id":             project.PlanID,
+        "plan_name":           project.PlanName,
+        "tokens_used_month":   project.TokensUsedMonth,
+        "monthly_token_limit": project.MonthlyTokenLimit,
+    }
+    if !project.StartDate.IsZero() {
+        subscription["start_date"] = project.StartDate
+    }
+    if !project.ExpiryDate.IsZero() {
+        subscription["expiry_date"] = project.ExpiryDate
+        subscription["days_remaining"] = int(project.ExpiryDate.Sub(now).Hours() / 24)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":      true,
+        "project":      models.NewProjectResponse(project),
+        "subscription": subscription,
+        "usage": gin.H{
+            "daily_usage":          project.GeminiUsageToday,
+            "daily_limit":          project.GeminiDailyLimit,
+            "monthly_usage":        project.GeminiUsageMonth,
+            "monthly_limit":        project.GeminiMonthlyLimit,
+            "estimated_cost_today": project.EstimatedCostToday,
+            "estimated_cost_month": project.EstimatedCostMonth,
+            "monthly_cost_budget":  project.MonthlyCostBudget,
+            "failures_last_24h":    failures,
+            "daily_resets_at":      getNextDailyReset(),
+            "monthly_resets_at":    getNextMonthlyReset(project),
+        },
+        "messages":        messages,
+        "sessions":        sessions,
+        "ratings":         ratings,
+        "recent_activity": recent,
+    })
+}
+
+// overviewMessageStats - Message totals for the overview, with the rating summary that depends on them
+func overviewMessageStats(ctx context.Context, projectID primitive.ObjectID, now time.Time) (gin.H, gin.H, error) {
+    collection := config.DB.Collection("chat_messages")
+    total, err := collection.CountDocuments(ctx, bson.M{"project_id": projectID})
+    if err != nil {
+        return nil, nil, err
+    }
+    lastWeek, err := collection.CountDocuments(ctx, bson.M{
+        "project_id": projectID,
+        "timestamp":  bson.M{"$gte": now.AddDate(0, 0, -7)},
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    ratings, err := getRatingSummary(ctx, projectID, total)
+    if err != nil {
+        return nil, nil, err
+    }
+    return gin.H{"total": total, "last_7_days": lastWeek}, ratings, nil
+}
+
+// overviewSessionStats - Session totals for the overview
+func overviewSessionStats(ctx context.Context, projectID primitive.ObjectID, now time.Time) (gin.H, error) {
+    collection := config.DB.Collection("chat_sessions")
+    total, err := collection.CountDocuments(ctx, bson.M{"project_id": projectID})
+    if err != nil {
+        return nil, err
+    }
+    active, err := collection.CountDocuments(ctx, bson.M{
+        "project_id":    projectID,
+        "last_activity": bson.M{"$gte": now.Add(-24 * time.Hour)},
+    })
+    if err != nil {
+        return nil, err
+    }
+    return gin.H{"total": total, "active_last_24h": active}, nil
+}
+
+// overviewRecentActivity - The project's latest messages, newest first
+func overviewRecentActivity(ctx context.Context, projectID primitive.ObjectID) ([]gin.H, error) {
+    opts := options.Find().
+        SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+        SetLimit(overviewRecentMessages).
+        SetProjection(bson.M{"message": 1, "session_id": 1, "user_name": 1, "timestamp": 1, "rating": 1})
+    cursor, err := config.DB.Collection("chat_messages").Find(ctx, bson.M{"project_id": projectID}, opts)
+    if err != nil {
+        return nil, err
+    }
+    var messages []models.ChatMessage
+    if err := cursor.All(ctx, &messages); err != nil {
+        return nil, err
+    }
+
+    activity := make([]gin.H, 0, len(messages))
+    for _, message := range messages {
+        activity = append(activity, gin.H{
+            "id":         message.ID.Hex(),
+            "message":    message.Message,
+            "session_id": message.SessionID,
+            "user_name":  message.UserName,
+            "rating":     message.Rating,
+            "timestamp":  message.Timestamp,
+        })
+    }
+    return activity, nil
+}
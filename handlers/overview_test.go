@@ -0,0 +1,95 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestGetProjectOverviewRejectsInvalidID(t *testing.T) {
+    if w := serveRoute(http.MethodGet, "/projects/:id/overview", "/projects/nope/overview", GetProjectOverview, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+func TestGetProjectOverview(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    now := time.Now()
+
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Acme", GeminiUsageToday: 3, GeminiDailyLimit: 50}
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    other := primitive.NewObjectID()
+
+    var messages []interface{}
+    for i := 0; i < overviewRecentMessages+2; i++ {
+        messages = append(messages, models.ChatMessage{ProjectID: project.ID, SessionID: "s1", Message: "hi", Timestamp: now.Add(-time.Duration(i) * time.Minute)})
+    }
+    messages = append(messages,
+        models.ChatMessage{ProjectID: project.ID, SessionID: "s2", Message: "old", Rating: 4, Timestamp: now.AddDate(0, 0, -30)},
+        models.ChatMessage{ProjectID: other, SessionID: "x", Message: "elsewhere", Timestamp: now},
+    )
+    if _, err := config.DB.Collection("chat_messages").InsertMany(ctx, messages); err != nil {
+        t.Fatal(err)
+    }
+    sessions := []interface{}{
+        models.ChatSession{ProjectID: project.ID, SessionID: "s1", LastActivity: now},
+        models.ChatSession{ProjectID: project.ID, SessionID: "s2", LastActivity: now.AddDate(0, 0, -30)},
+    }
+    if _, err := config.DB.Collection("chat_sessions").InsertMany(ctx, sessions); err != nil {
+        t.Fatal(err)
+    }
+    logs := []interface{}{
+        models.GeminiUsageLog{ProjectID: project.ID, Success: false, Timestamp: now.Add(-time.Hour)},
+        models.GeminiUsageLog{ProjectID: project.ID, Success: false, Timestamp: now.AddDate(0, 0, -2)},
+    }
+    if _, err := config.DB.Collection("gemini_usage_logs").InsertMany(ctx, logs); err != nil {
+        t.Fatal(err)
+    }
+
+    w := serveRoute(http.MethodGet, "/projects/:id/overview", "/projects/"+project.ID.Hex()+"/overview", GetProjectOverview, "")
+    var body struct {
+        Usage struct {
+            DailyUsage      int   `json:"daily_usage"`
+            FailuresLast24h int64 `json:"failures_last_24h"`
+        } `json:"usage"`
+        Messages struct {
+            Total    int64 `json:"total"`
+            LastWeek int64 `json:"last_7_days"`
+        } `json:"messages"`
+        Sessions struct {
+            Total  int64 `json:"total"`
+            Active int64 `json:"active_last_24h"`
+        } `json:"sessions"`
+        RecentActivity []map[string]interface{} `json:"recent_activity"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("GetProjectOverview = %d %s", w.Code, w.Body)
+    }
+
+    if body.Usage.DailyUsage != 3 || body.Usage.FailuresLast24h != 1 {
+        t.Errorf("usage = %+v, want 3 used and 1 recent failure", body.Usage)
+    }
+    if body.Messages.Total != overviewRecentMessages+3 || body.Messages.LastWeek != overviewRecentMessages+2 {
+        t.Errorf("messages = %+v, want only this project's", body.Messages)
+    }
+    if body.Sessions.Total != 2 || body.Sessions.Active != 1 {
+        t.Errorf("sessions = %+v, want 2 with 1 active", body.Sessions)
+    }
+    if len(body.RecentActivity) != overviewRecentMessages {
+        t.Errorf("recent activity = %d messages, want %d", len(body.RecentActivity), overviewRecentMessages)
+    }
+
+    missing := "/projects/" + primitive.NewObjectID().Hex() + "/overview"
+    if w := serveRoute(http.MethodGet, "/projects/:id/overview", missing, GetProjectOverview, ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown project: status = %d, want 404", w.Code)
+    }
+}
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+    "bytes"
     "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
     "fmt"
+    "io"
+    "log"
+    "mime/multipart"
     "net/http"
     "os"
     "path/filepath"
@@ -12,10 +19,11 @@ import (
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
     "github.com/google/generative-ai-go/genai"
-    "google.golang.org/api/option"
     "jevi-chat/config"
     "jevi-chat/models"
+    "jevi-chat/utils"
 )
 
 // ===== PDF MANAGEMENT =====
@@ -32,15 +40,26 @@ func UploadPDF(c *gin.Context) {
     // Get project to check if it exists
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
     }
 
-    // Handle multiple file upload
+    // Handle multiple file upload; the body may carry a little form overhead beyond the files
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxTotalUpload+1<<20)
     form, err := c.MultipartForm()
     if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+                "error":     fmt.Sprintf("Upload exceeds the %s total limit", formatFileSize(config.MaxTotalUpload)),
+                "max_total": config.MaxTotalUpload,
+            })
+            return
+        }
         c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
         return
     }
@@ -51,18 +70,60 @@ func UploadPDF(c *gin.Context) {
         return
     }
 
-    var uploadedFiles []models.PDFFile
-    var allContent strings.Builder
+    // Check sizes before saving anything so an oversize upload is rejected as a whole
+    var totalSize int64
+    for _, file := range files {
+        if file.Size > config.MaxPDFSize {
+            c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+                "error":    fmt.Sprintf("%s exceeds the %s per-file limit", file.Filename, formatFileSize(config.MaxPDFSize)),
+                "file":     file.Filename,
+                "size":     file.Size,
+                "max_size": config.MaxPDFSize,
+            })
+            return
+        }
+        totalSize += file.Size
+        if totalSize > config.MaxTotalUpload {
+            c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+                "error":     fmt.Sprintf("Adding %s takes the upload over the %s total limit", file.Filename, formatFileSize(config.MaxTotalUpload)),
+                "file":      file.Filename,
+                "max_total": config.MaxTotalUpload,
+            })
+            return
+        }
+    }
+
+    var uploadedFiles []models.KnowledgeSource
+    var rejectedFiles []gin.H
+    var duplicateFiles []gin.H
+    seenHashes := make(map[string]string)
 
     // Create uploads directory if it doesn't exist
     os.MkdirAll("./static/uploads", 0755)
 
     for _, file := range files {
         // Validate file type and size
-        if !strings.HasSuffix(strings.ToLower(file.Filename), ".pdf") {
+        if strings.ToLower(filepath.Ext(file.Filename)) != ".pdf" {
+            rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": "Only PDF files are accepted"})
             continue
         }
-        if file.Size > 10*1024*1024 { // 10MB limit
+        if err := validateFileType(file); err != nil {
+            rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": err.Error()})
+            continue
+        }
+
+        // Skip files whose exact content is already in the project or this upload
+        hash, err := hashUploadedFile(file)
+        if err != nil {
+            rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": "could not read file"})
+            continue
+        }
+        existingID, duplicate := seenHashes[hash]
+        if !duplicate {
+            existingID, duplicate = findPDFByHash(c, objID, hash)
+        }
+        if duplicate {
+            duplicateFiles = append(duplicateFiles, gin.H{"file": file.Filename, "status": "duplicate", "existing_file_id": existingID})
             continue
         }
 
@@ -76,68 +137,220 @@ func UploadPDF(c *gin.Context) {
             continue
         }
 
-        pdfFile := models.PDFFile{
-            ID:         fileID,
-            FileName:   file.Filename,
-            FilePath:   filePath,
-            FileSize:   file.Size,
-            UploadedAt: time.Now(),
-            Status:     "processing",
+        source := models.KnowledgeSource{
+            ID:        fileID,
+            Type:      models.KnowledgeSourcePDF,
+            Name:      file.Filename,
+            FilePath:  filePath,
+            Size:      file.Size,
+            Hash:      hash,
+            Status:    models.PDFStatusProcessing,
+            Enabled:   true,
+            CreatedAt: time.Now(),
         }
 
-        // Process with Gemini if enabled
-        var content string
-        if project.GeminiEnabled && project.GeminiAPIKey != "" {
-            content, err = processPDFWithGemini(filePath, project.GeminiAPIKey)
-            if err == nil {
-                pdfFile.ProcessedAt = time.Now()
-                pdfFile.Status = "completed"
-            } else {
-                pdfFile.Status = "failed"
-                content = "Failed to process PDF content"
-            }
+        uploadedFiles = append(uploadedFiles, source)
+        seenHashes[hash] = fileID
+    }
+
+    if len(uploadedFiles) == 0 {
+        if len(duplicateFiles) > 0 && len(rejectedFiles) == 0 {
+            c.JSON(http.StatusOK, gin.H{
+                "message":         "All files were already uploaded",
+                "files_uploaded":  0,
+                "duplicate_files": duplicateFiles,
+            })
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":           "No valid PDF files uploaded",
+            "rejected_files":  rejectedFiles,
+            "duplicate_files": duplicateFiles,
+        })
+        return
+    }
+
+    // Store the files right away; their content is added once processing finishes
+    ctx, cancel = requestContext(c)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+        "$push": bson.M{"knowledge_sources": bson.M{"$each": uploadedFiles}},
+        "$set":  bson.M{"updated_at": time.Now()},
+        "$inc":  bson.M{"version": 1},
+    })
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    go processUploadedPDFs(project, uploadedFiles)
+
+    fileIDs := make([]string, len(uploadedFiles))
+    responses := make([]models.PDFFileResponse, len(uploadedFiles))
+    for i, file := range uploadedFiles {
+        fileIDs[i] = file.ID
+        responses[i] = models.NewPDFFileResponse(file)
+    }
+
+    c.JSON(http.StatusAccepted, gin.H{
+        "message":         "PDFs uploaded; processing in the background",
+        "files_uploaded":  len(uploadedFiles),
+        "file_ids":        fileIDs,
+        "sources":         models.NewKnowledgeSourceResponses(uploadedFiles),
+        "files":           responses,
+        "rejected_files":  rejectedFiles,
+        "duplicate_files": duplicateFiles,
+    })
+}
+
+// hashUploadedFile - Hex SHA-256 of an uploaded file's bytes
+func hashUploadedFile(file *multipart.FileHeader) (string, error) {
+    f, err := file.Open()
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+
+    hasher := sha256.New()
+    if _, err := io.Copy(hasher, f); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// findPDFByHash - ID of the project's knowledge source with this content hash, if any
+func findPDFByHash(c *gin.Context, projectID primitive.ObjectID, hash string) (string, bool) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    var project models.Project
+    opts := options.FindOne().SetProjection(bson.M{"knowledge_sources": bson.M{"$elemMatch": bson.M{"hash": hash}}})
+    err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": projectID, "knowledge_sources.hash": hash}, opts).Decode(&project)
+    if err != nil || len(project.KnowledgeSources) == 0 {
+        return "", false
+    }
+    return project.KnowledgeSources[0].ID, true
+}
+
+// pdfProcessingSlots bounds how many upload batches are processed at once
+var pdfProcessingSlots = make(chan struct{}, 2)
+
+// processUploadedPDFs - Extract the content of newly uploaded files in the background,
+// recording each file's outcome, then rebuild the project's knowledge base
+func processUploadedPDFs(project models.Project, files []models.KnowledgeSource) {
+    pdfProcessingSlots <- struct{}{}
+    defer func() { <-pdfProcessingSlots }()
+
+    collection := config.DB.Collection("projects")
+    for _, file := range files {
+        set := bson.M{"knowledge_sources.$.processed_at": time.Now()}
+        content, err := extractPDFContent(project, file.FilePath)
+        if err != nil {
+            log.Printf("Failed to process PDF %s for project %s: %v", file.ID, project.ID.Hex(), err)
+            set["knowledge_sources.$.status"] = models.PDFStatusFailed
+            set["knowledge_sources.$.error"] = err.Error()
         } else {
-            content = "PDF uploaded successfully (Gemini processing disabled)"
-            pdfFile.Status = "completed"
+            set["knowledge_sources.$.status"] = models.PDFStatusCompleted
+            set["knowledge_sources.$.content"] = content
         }
 
-        uploadedFiles = append(uploadedFiles, pdfFile)
-        allContent.WriteString(content + "\n\n")
+        ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+        _, err = collection.UpdateOne(ctx, bson.M{"_id": project.ID, "knowledge_sources.id": file.ID}, bson.M{"$set": set})
+        cancel()
+        if err != nil {
+            log.Printf("Failed to record PDF %s status: %v", file.ID, err)
+        }
     }
 
-    // Update project with PDF files and content
-    update := bson.M{
-        "$push": bson.M{"pdf_files": bson.M{"$each": uploadedFiles}},
-        "$set": bson.M{
-            "pdf_content": allContent.String(),
-            "updated_at":  time.Now(),
-        },
+    refreshKnowledgeBase(project.ID)
+}
+
+// refreshKnowledgeBase - Rebuild pdf_content and the stored chunks from the project's current sources
+func refreshKnowledgeBase(projectID primitive.ObjectID) {
+    collection := config.DB.Collection("projects")
+
+    var project models.Project
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    err := collection.FindOne(ctx, bson.M{"_id": projectID}).Decode(&project)
+    cancel()
+    if err != nil {
+        log.Printf("Failed to load project %s for knowledge base refresh: %v", projectID.Hex(), err)
+        return
     }
 
-    _, err = collection.UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+    ctx, cancel = context.WithTimeout(context.Background(), config.DBTimeout)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": projectID}, bson.M{
+        "$set": bson.M{"pdf_content": aggregatePDFContent(project.KnowledgeSources), "updated_at": time.Now()},
+    })
+    cancel()
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        log.Printf("Failed to update knowledge base for %s: %v", projectID.Hex(), err)
+        return
+    }
+
+    rebuildKnowledgeChunks(project, project.KnowledgeSources)
+}
+
+// GetPDFStatus - Processing status of a single uploaded PDF, for polling after upload
+func GetPDFStatus(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+    fileID := c.Param("fileId")
+
+    var project models.Project
+    opts := options.FindOne().SetProjection(bson.M{"knowledge_sources": bson.M{"$elemMatch": bson.M{"id": fileID}}})
+    err = config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}, opts).Decode(&project)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if len(project.KnowledgeSources) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "PDF not found"})
         return
     }
 
+    source := project.KnowledgeSources[0]
     c.JSON(http.StatusOK, gin.H{
-        "message":        "PDFs uploaded and processed successfully",
-        "files_uploaded": len(uploadedFiles),
-        "files":          uploadedFiles,
+        "project_id": c.Param("id"),
+        "source":     models.NewKnowledgeSourceResponse(source),
+        "file":       models.NewPDFFileResponse(source),
+        "status":     source.Status,
     })
 }
 
+// extractPDFContent - Process a stored PDF with Gemini when enabled, otherwise extract its text locally
+func extractPDFContent(project models.Project, filePath string) (string, error) {
+    if project.GeminiEnabled && project.GeminiAPIKey != "" {
+        return processPDFWithGemini(filePath, decryptAPIKey(project.GeminiAPIKey))
+    }
+    
+    content, err := utils.ExtractPDFText(filePath)
+    if err != nil {
+        return "", err
+    }
+    if strings.TrimSpace(content) == "" {
+        return "", fmt.Errorf("no text could be extracted from PDF")
+    }
+    return content, nil
+}
+
 // processPDFWithGemini - Enhanced PDF processing with Gemini AI
 func processPDFWithGemini(filePath, apiKey string) (string, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
     defer cancel()
     
     // Create client with project-specific API key
-    client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+    client, release, err := config.AcquireGeminiClient(apiKey)
     if err != nil {
         return "", fmt.Errorf("failed to create Gemini client: %v", err)
     }
-    defer client.Close()
+    defer release()
     
     // Upload file to Gemini
     file, err := client.UploadFileFromPath(ctx, filePath, nil)
@@ -197,6 +410,9 @@ func processPDFWithGemini(filePath, apiKey string) (string, error) {
 
 // DeletePDF - Delete specific PDF file
 func DeletePDF(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     fileID := c.Param("fileId")
     
@@ -210,15 +426,15 @@ func DeletePDF(c *gin.Context) {
     
     // Get project to find file path for deletion
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
     }
     
     // Find and delete physical file
-    var fileToDelete models.PDFFile
-    for _, file := range project.PDFFiles {
+    var fileToDelete models.KnowledgeSource
+    for _, file := range project.KnowledgeSources {
         if file.ID == fileID {
             fileToDelete = file
             break
@@ -229,17 +445,29 @@ func DeletePDF(c *gin.Context) {
         os.Remove(fileToDelete.FilePath)
     }
     
-    // Remove file from array
+    var remaining []models.KnowledgeSource
+    for _, file := range project.KnowledgeSources {
+        if file.ID != fileID {
+            remaining = append(remaining, file)
+        }
+    }
+    
+    // Remove file from array and rebuild the knowledge base without it
     update := bson.M{
-        "$pull": bson.M{"pdf_files": bson.M{"id": fileID}},
-        "$set":  bson.M{"updated_at": time.Now()},
+        "$pull": bson.M{"knowledge_sources": bson.M{"id": fileID}},
+        "$set": bson.M{
+            "pdf_content": aggregatePDFContent(remaining),
+            "updated_at":  time.Now(),
+        },
+        "$inc": bson.M{"version": 1},
     }
 
-    _, err = collection.UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete PDF"})
         return
     }
+    rebuildKnowledgeChunks(project, remaining)
 
     c.JSON(http.StatusOK, gin.H{
         "message": "PDF deleted successfully",
@@ -247,8 +475,167 @@ func DeletePDF(c *gin.Context) {
     })
 }
 
-// GetPDFFiles - Get all PDF files for a project
+// ReprocessPDFs - Re-run extraction on every stored PDF and rebuild the knowledge base
+func ReprocessPDFs(c *gin.Context) {
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    var project models.Project
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    results := []gin.H{}
+    succeeded, failed := 0, 0
+
+    for i := range project.KnowledgeSources {
+        file := &project.KnowledgeSources[i]
+        result := gin.H{"id": file.ID, "file_name": file.Name, "type": file.Type}
+
+        // Text and web sources are stored as fetched, so there is nothing to extract again
+        if !file.IsPDF() {
+            succeeded++
+            result["status"] = file.Status
+            results = append(results, result)
+            continue
+        }
+
+        // A missing file fails on its own without aborting the batch
+        if _, err := os.Stat(file.FilePath); err != nil {
+            file.Status = "failed"
+            failed++
+            result["status"] = file.Status
+            result["error"] = "File not found on disk"
+            results = append(results, result)
+            continue
+        }
+
+        content, err := extractPDFContent(project, file.FilePath)
+        if err != nil {
+            file.Status = "failed"
+            failed++
+            result["error"] = err.Error()
+        } else {
+            file.Status = "completed"
+            file.ProcessedAt = time.Now()
+            file.Content = content
+            succeeded++
+        }
+
+        result["status"] = file.Status
+        results = append(results, result)
+    }
+
+    update := bson.M{
+        "$set": bson.M{
+            "knowledge_sources": project.KnowledgeSources,
+            "pdf_content":       aggregatePDFContent(project.KnowledgeSources),
+            "updated_at":        time.Now(),
+        },
+        "$inc": bson.M{"version": 1},
+    }
+
+    ctx, cancel = requestContext(c)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+    rebuildKnowledgeChunks(project, project.KnowledgeSources)
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":     "PDFs reprocessed",
+        "total_files": len(project.KnowledgeSources),
+        "succeeded":   succeeded,
+        "failed":      failed,
+        "files":       results,
+    })
+}
+
+// TogglePDF - Include or exclude a single PDF from the knowledge base without deleting it
+func TogglePDF(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
+    projectID := c.Param("id")
+    fileID := c.Param("fileId")
+
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    var project models.Project
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    var toggled *models.KnowledgeSource
+    for i := range project.KnowledgeSources {
+        if project.KnowledgeSources[i].ID == fileID {
+            toggled = &project.KnowledgeSources[i]
+            break
+        }
+    }
+    if toggled == nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "PDF not found"})
+        return
+    }
+    toggled.Enabled = !toggled.Enabled
+
+    update := bson.M{
+        "$set": bson.M{
+            "knowledge_sources.$.enabled": toggled.Enabled,
+            "pdf_content":                 aggregatePDFContent(project.KnowledgeSources),
+            "updated_at":                  time.Now(),
+        },
+        "$inc": bson.M{"version": 1},
+    }
+
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID, "knowledge_sources.id": fileID}, update)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update PDF"})
+        return
+    }
+    rebuildKnowledgeChunks(project, project.KnowledgeSources)
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "PDF updated successfully",
+        "file_id": fileID,
+        "enabled": toggled.Enabled,
+    })
+}
+
+// aggregatePDFContent - Build the knowledge base from the content of enabled sources
+func aggregatePDFContent(files []models.KnowledgeSource) string {
+    var allContent strings.Builder
+    for _, file := range files {
+        if file.Enabled && file.Content != "" {
+            allContent.WriteString(file.Content + "\n\n")
+        }
+    }
+    return allContent.String()
+}
+
+// GetPDFFiles - Get all knowledge sources for a project; pdf_files repeats them in the old shape
 func GetPDFFiles(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -258,16 +645,23 @@ func GetPDFFiles(c *gin.Context) {
 
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
     }
 
+    sources := project.Sources()
+    files := make([]models.PDFFileResponse, len(sources))
+    for i, source := range sources {
+        files[i] = models.NewPDFFileResponse(source)
+    }
+
     c.JSON(http.StatusOK, gin.H{
-        "project_id": projectID,
-        "pdf_files":  project.PDFFiles,
-        "total_files": len(project.PDFFiles),
+        "project_id":        projectID,
+        "knowledge_sources": models.NewKnowledgeSourceResponses(sources),
+        "pdf_files":         files,
+        "total_files":       len(sources),
     })
 }
 
@@ -277,6 +671,9 @@ func GetPDFFiles(c *gin.Context) {
 
 // ProjectDashboard - Display project dashboard page
 func ProjectDashboard(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("id")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -287,7 +684,7 @@ func ProjectDashboard(c *gin.Context) {
     // Get project details
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -295,7 +692,7 @@ func ProjectDashboard(c *gin.Context) {
     
     // Get additional statistics
     chatCollection := config.DB.Collection("chat_messages")
-    messageCount, _ := chatCollection.CountDocuments(context.Background(), bson.M{"project_id": objID})
+    messageCount, _ := chatCollection.CountDocuments(ctx, bson.M{"project_id": objID})
     
     c.HTML(http.StatusOK, "project/dashboard.html", gin.H{
         "title":         "Project Dashboard - " + project.Name,
@@ -307,6 +704,9 @@ func ProjectDashboard(c *gin.Context) {
 
 // GetProjectInfo - Get project information for API calls
 func GetProjectInfo(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     projectID := c.Param("projectId")
     objID, err := primitive.ObjectIDFromHex(projectID)
     if err != nil {
@@ -316,7 +716,7 @@ func GetProjectInfo(c *gin.Context) {
 
     collection := config.DB.Collection("projects")
     var project models.Project
-    err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&project)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
         return
@@ -324,7 +724,7 @@ func GetProjectInfo(c *gin.Context) {
 
     // Get additional stats
     chatCollection := config.DB.Collection("chat_messages")
-    messageCount, _ := chatCollection.CountDocuments(context.Background(), bson.M{"project_id": objID})
+    messageCount, _ := chatCollection.CountDocuments(ctx, bson.M{"project_id": objID})
     
     // Get unique sessions count
     pipeline := []bson.M{
@@ -333,9 +733,9 @@ func GetProjectInfo(c *gin.Context) {
         {"$count": "unique_sessions"},
     }
     
-    cursor, _ := chatCollection.Aggregate(context.Background(), pipeline)
+    cursor, _ := chatCollection.Aggregate(ctx, pipeline)
     var result []bson.M
-    cursor.All(context.Background(), &result)
+    cursor.All(ctx, &result)
     
     uniqueSessions := int64(0)
     if len(result) > 0 {
@@ -346,7 +746,7 @@ func GetProjectInfo(c *gin.Context) {
 
     c.JSON(http.StatusOK, gin.H{
         "project_id":      projectID,
-        "project":         project,
+        "project":         models.NewProjectResponse(project),
         "message_count":   messageCount,
         "unique_sessions": uniqueSessions,
         "embed_url":       fmt.Sprintf("/embed/%s", projectID),
@@ -355,48 +755,83 @@ func GetProjectInfo(c *gin.Context) {
 
 // ===== USER PROJECT FUNCTIONS =====
 
-// UserProjects - Get projects for regular users
+// UserProjects - Get the caller's own active projects; admins see every active project
 func UserProjects(c *gin.Context) {
-    // Get user projects (implement based on your auth system)
+    ctx, cancel := requestContext(c)
+    defer cancel()
+    
     collection := config.DB.Collection("projects")
     
-    // For now, return all active projects
-    // In production, filter by user permissions
-    cursor, err := collection.Find(context.Background(), bson.M{"is_active": true})
+    filter := bson.M{"is_active": true, "deleted_at": bson.M{"$exists": false}}
+    if !c.GetBool("is_admin") {
+        ownerID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+        if err != nil {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+            return
+        }
+        filter["owner_id"] = ownerID
+    }
+    
+    cursor, err := collection.Find(ctx, filter)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
         return
     }
 
     var projects []models.Project
-    if err := cursor.All(context.Background(), &projects); err != nil {
+    if err := cursor.All(ctx, &projects); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse projects"})
         return
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "projects": projects,
+        "projects": models.NewProjectResponses(projects),
         "count":    len(projects),
     })
 }
 
 // ===== HELPER FUNCTIONS =====
 
-// getGeminiModel - Get Gemini model with fallback
+// encryptAPIKey - Encrypt a Gemini API key for storage. Keys stay in plaintext
+// when ENCRYPTION_KEY is not configured.
+func encryptAPIKey(key string) (string, error) {
+    if !utils.EncryptionEnabled() {
+        return key, nil
+    }
+    return utils.EncryptSecret(key)
+}
+
+// decryptAPIKey - Decrypt a stored Gemini API key for use
+func decryptAPIKey(stored string) string {
+    key, err := utils.DecryptSecret(stored)
+    if err != nil {
+        log.Printf("Failed to decrypt Gemini API key: %v", err)
+        return ""
+    }
+    return key
+}
+
+// getGeminiModel - Get Gemini model with fallback. Models are checked when they are
+// set, so the fallback only applies to values stored before they were validated or
+// dropped from GEMINI_MODELS since.
 func getGeminiModel(model string) string {
     if model == "" {
-        return "gemini-1.5-flash"
+        return models.DefaultGeminiModel
     }
-    
-    // Validate model name
-    validModels := []string{"gemini-1.5-flash", "gemini-1.5-pro", "gemini-pro"}
-    for _, validModel := range validModels {
-        if model == validModel {
-            return model
-        }
+    if !config.IsSupportedGeminiModel(model) {
+        log.Printf("Unsupported Gemini model %q, using %s", model, models.DefaultGeminiModel)
+        return models.DefaultGeminiModel
     }
-    
-    return "gemini-1.5-flash" // fallback
+    return model
+}
+
+// validateGeminiModel - Reject models outside the supported set with an error naming them
+func validateGeminiModel(model string) error {
+    if model == "" || config.IsSupportedGeminiModel(model) {
+        return nil
+    }
+    return fmt.Errorf("unsupported Gemini model %q; supported models: %s",
+        model, strings.Join(config.SupportedGeminiModels(), ", "))
 }
 
 // getWelcomeMessage - Get welcome message with fallback
@@ -407,17 +842,47 @@ func getWelcomeMessage(message string) string {
     return message
 }
 
-// validateFileType - Validate uploaded file type
-func validateFileType(filename string) bool {
-    allowedExtensions := []string{".pdf", ".doc", ".docx", ".txt"}
-    ext := strings.ToLower(filepath.Ext(filename))
-    
-    for _, allowed := range allowedExtensions {
-        if ext == allowed {
-            return true
+// fileSignatures - Magic bytes expected at the start of each accepted document type.
+// Plain text has no signature and is checked by content sniffing instead.
+var fileSignatures = map[string][]string{
+    ".pdf":  {"%PDF-"},
+    ".doc":  {"\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"},
+    ".docx": {"PK\x03\x04"},
+}
+
+// validateFileType - Check that an uploaded file's content matches its extension
+func validateFileType(file *multipart.FileHeader) error {
+    ext := strings.ToLower(filepath.Ext(file.Filename))
+    signatures, known := fileSignatures[ext]
+    if !known && ext != ".txt" {
+        return fmt.Errorf("unsupported file type %q", ext)
+    }
+
+    f, err := file.Open()
+    if err != nil {
+        return fmt.Errorf("could not read file")
+    }
+    defer f.Close()
+
+    header := make([]byte, 512)
+    n, err := io.ReadFull(f, header)
+    if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+        return fmt.Errorf("could not read file")
+    }
+    header = header[:n]
+
+    if ext == ".txt" {
+        if !strings.HasPrefix(http.DetectContentType(header), "text/plain") {
+            return fmt.Errorf("file is not plain text")
+        }
+        return nil
+    }
+    for _, signature := range signatures {
+        if bytes.HasPrefix(header, []byte(signature)) {
+            return nil
         }
     }
-    return false
+    return fmt.Errorf("file content is not a valid %s document", strings.ToUpper(strings.TrimPrefix(ext, ".")))
 }
 
 // formatFileSize - Format file size for display
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestExtractPDFContentWithoutGemini(t *testing.T) {
+    // Gemini is disabled, so the text is extracted locally
+    project := models.Project{GeminiEnabled: false}
+
+    content, err := extractPDFContent(project, filepath.Join("..", "utils", "testdata", "classic.pdf"))
+    if err != nil {
+        t.Fatalf("extractPDFContent: %v", err)
+    }
+    if !strings.Contains(content, "Opening hours are 9am to 5pm.") {
+        t.Errorf("content = %q, want the PDF's text", content)
+    }
+
+    notPDF := filepath.Join(t.TempDir(), "notes.pdf")
+    if err := os.WriteFile(notPDF, []byte("just text"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := extractPDFContent(project, notPDF); err == nil {
+        t.Error("extractPDFContent accepted a file that isn't a PDF")
+    }
+}
+
+func TestAggregatePDFContentSkipsDisabledFiles(t *testing.T) {
+    files := []models.KnowledgeSource{
+        {ID: "a", Enabled: true, Content: "Refunds take five days."},
+        {ID: "b", Enabled: false, Content: "Old price list."},
+        {ID: "c", Enabled: true, Content: ""},
+        {ID: "d", Enabled: true, Content: "Support is open weekdays."},
+    }
+
+    content := aggregatePDFContent(files)
+    if !strings.Contains(content, "Refunds take five days.") || !strings.Contains(content, "Support is open weekdays.") {
+        t.Errorf("content = %q, want every enabled file", content)
+    }
+    if strings.Contains(content, "Old price list.") {
+        t.Error("a disabled file made it into the knowledge base")
+    }
+    if aggregatePDFContent(nil) != "" {
+        t.Error("no files should give an empty knowledge base")
+    }
+}
+
+func TestAggregatePDFContentMixedSources(t *testing.T) {
+    files := []models.KnowledgeSource{
+        {ID: "a", Type: models.KnowledgeSourcePDF, Enabled: true, Content: "Manual text."},
+        {ID: "b", Type: models.KnowledgeSourceText, Enabled: true, Content: "Plain notes."},
+        {ID: "c", Type: models.KnowledgeSourceURL, Enabled: false, Content: "Stale page."},
+        {ID: "d", Type: models.KnowledgeSourceMarkdown, Enabled: true, Content: "# Heading"},
+        {ID: "e", Type: models.KnowledgeSourceURL, Enabled: true, Content: "Fresh page."},
+        {ID: "f", Type: models.KnowledgeSourcePDF, Status: models.PDFStatusProcessing, Enabled: true},
+    }
+
+    want := "Manual text.\n\nPlain notes.\n\n# Heading\n\nFresh page.\n\n"
+    if content := aggregatePDFContent(files); content != want {
+        t.Errorf("content = %q, want %q", content, want)
+    }
+}
+
+func TestGetPDFFilesListsEverySourceType(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    mixed := models.Project{ID: primitive.NewObjectID(), KnowledgeSources: []models.KnowledgeSource{
+        {ID: "a", Type: models.KnowledgeSourcePDF, Name: "manual.pdf", Enabled: true},
+        {ID: "b", Type: models.KnowledgeSourceText, Name: "notes.txt", Enabled: true},
+        {ID: "c", Type: models.KnowledgeSourceURL, Name: "FAQ", Origin: "https://example.com/faq", Enabled: false},
+    }}
+    legacy := models.Project{ID: primitive.NewObjectID(), PDFFiles: []models.PDFFile{
+        {ID: "old", FileName: "old.pdf", Enabled: true},
+    }}
+    if _, err := config.DB.Collection("projects").InsertMany(ctx, []interface{}{mixed, legacy}); err != nil {
+        t.Fatal(err)
+    }
+
+    cases := []struct {
+        project primitive.ObjectID
+        ids     []string
+        types   []string
+    }{
+        {mixed.ID, []string{"a", "b", "c"}, []string{models.KnowledgeSourcePDF, models.KnowledgeSourceText, models.KnowledgeSourceURL}},
+        {legacy.ID, []string{"old"}, []string{models.KnowledgeSourcePDF}},
+    }
+    for _, tc := range cases {
+        w := serveRoute(http.MethodGet, "/projects/:id/pdfs", "/projects/"+tc.project.Hex()+"/pdfs", GetPDFFiles, "")
+        var body struct {
+            KnowledgeSources []models.KnowledgeSourceResponse `json:"knowledge_sources"`
+            PDFFiles         []models.PDFFileResponse         `json:"pdf_files"`
+            TotalFiles       int                              `json:"total_files"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+            t.Fatalf("GetPDFFiles = %d %s", w.Code, w.Body)
+        }
+        if body.TotalFiles != len(tc.ids) || len(body.KnowledgeSources) != len(tc.ids) || len(body.PDFFiles) != len(tc.ids) {
+            t.Fatalf("project %s: %d sources, %d files, total %d; want %d", tc.project.Hex(),
+                len(body.KnowledgeSources), len(body.PDFFiles), body.TotalFiles, len(tc.ids))
+        }
+        for i, id := range tc.ids {
+            source, file := body.KnowledgeSources[i], body.PDFFiles[i]
+            if source.ID != id || source.Type != tc.types[i] || file.ID != id || file.SourceType != tc.types[i] {
+                t.Errorf("entry %d = %+v / %+v, want %s of type %s in both views", i, source, file, id, tc.types[i])
+            }
+        }
+    }
+}
+
+func TestGetPDFStatusRejectsInvalidProject(t *testing.T) {
+    w := serveRoute(http.MethodGet, "/projects/:id/pdfs/:fileId/status", "/projects/bad/pdfs/f1/status", GetPDFStatus, "")
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+func TestProcessUploadedPDFsCompletesStatus(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    source := models.KnowledgeSource{
+        ID:       primitive.NewObjectID().Hex(),
+        Type:     models.KnowledgeSourcePDF,
+        Name:     "classic.pdf",
+        FilePath: filepath.Join("..", "utils", "testdata", "classic.pdf"),
+        Status:   models.PDFStatusProcessing,
+        Enabled:  true,
+    }
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Uploads", KnowledgeSources: []models.KnowledgeSource{source}}
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+
+    path := "/projects/" + project.ID.Hex() + "/pdfs/" + source.ID + "/status"
+    pollStatus := func() string {
+        w := serveRoute(http.MethodGet, "/projects/:id/pdfs/:fileId/status", path, GetPDFStatus, "")
+        var body struct {
+            Status string `json:"status"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+            t.Fatalf("GetPDFStatus = %d %s", w.Code, w.Body)
+        }
+        return body.Status
+    }
+
+    if status := pollStatus(); status != models.PDFStatusProcessing {
+        t.Errorf("status before processing = %q, want processing", status)
+    }
+    processUploadedPDFs(project, []models.KnowledgeSource{source})
+    if status := pollStatus(); status != models.PDFStatusCompleted {
+        t.Errorf("status after processing = %q, want completed", status)
+    }
+
+    var stored models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": project.ID}).Decode(&stored); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(stored.PDFContent, "Opening hours are 9am to 5pm.") {
+        t.Errorf("pdf_content = %q, want the processed file's text", stored.PDFContent)
+    }
+}
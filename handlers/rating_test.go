@@ -0,0 +1,99 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+)
+
+func TestSummarizeRatings(t *testing.T) {
+    summary := summarizeRatings([]ratingGroup{{Rating: 5, Count: 2}, {Rating: 2, Count: 1}}, 12)
+
+    if summary["average_rating"] != 4.0 {
+        t.Errorf("average_rating = %v, want 4", summary["average_rating"])
+    }
+    if summary["rated_messages"] != int64(3) {
+        t.Errorf("rated_messages = %v, want 3", summary["rated_messages"])
+    }
+    if summary["rated_percentage"] != 25.0 {
+        t.Errorf("rated_percentage = %v, want 25", summary["rated_percentage"])
+    }
+    distribution := summary["distribution"].(gin.H)
+    want := map[string]int64{"1": 0, "2": 1, "3": 0, "4": 0, "5": 2}
+    for star, count := range want {
+        if distribution[star] != count {
+            t.Errorf("distribution[%s] = %v, want %d", star, distribution[star], count)
+        }
+    }
+}
+
+func TestSummarizeRatingsWithoutRatings(t *testing.T) {
+    summary := summarizeRatings(nil, 0)
+    if summary["average_rating"] != 0.0 || summary["rated_percentage"] != 0.0 {
+        t.Errorf("summary = %v, want zeros rather than NaN", summary)
+    }
+    if len(summary["distribution"].(gin.H)) != 5 {
+        t.Error("every star must be present in the distribution")
+    }
+}
+
+func TestGetRatingSummary(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+    projectID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+    messages := []interface{}{
+        bson.M{"project_id": projectID, "rating": 5},
+        bson.M{"project_id": projectID, "rating": 5},
+        bson.M{"project_id": projectID, "rating": 2},
+        bson.M{"project_id": projectID},              // not rated
+        bson.M{"project_id": projectID, "rating": 0}, // cleared rating
+        bson.M{"project_id": otherID, "rating": 1},
+    }
+    if _, err := config.DB.Collection("chat_messages").InsertMany(ctx, messages); err != nil {
+        t.Fatal(err)
+    }
+
+    summary, err := getRatingSummary(ctx, projectID, 5)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if summary["average_rating"] != 4.0 || summary["rated_messages"] != int64(3) || summary["rated_percentage"] != 60.0 {
+        t.Errorf("summary = %v, want an average of 4 over 3 of 5 messages", summary)
+    }
+    distribution := summary["distribution"].(gin.H)
+    want := map[string]int64{"1": 0, "2": 1, "3": 0, "4": 0, "5": 2}
+    for star, count := range want {
+        if distribution[star] != count {
+            t.Errorf("distribution[%s] = %v, want %d", star, distribution[star], count)
+        }
+    }
+
+    empty, err := getRatingSummary(ctx, primitive.NewObjectID(), 0)
+    if err != nil || empty["rated_messages"] != int64(0) {
+        t.Errorf("project without messages: summary = %v, err = %v", empty, err)
+    }
+}
+
+func TestMessageFeedbackRejectsBadInput(t *testing.T) {
+    route := "/chat/:projectId/feedback/:messageId"
+    projectID, messageID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+    cases := []struct {
+        name, path, body string
+    }{
+        {"invalid project", "/chat/bad/feedback/" + messageID, `{"helpful":true}`},
+        {"invalid message", "/chat/" + projectID + "/feedback/bad", `{"helpful":true}`},
+        {"missing helpful", "/chat/" + projectID + "/feedback/" + messageID, `{}`},
+        {"wrong type", "/chat/" + projectID + "/feedback/" + messageID, `{"helpful":"yes"}`},
+    }
+    for _, tc := range cases {
+        // Rejected before the database is touched
+        if w := serveRoute(http.MethodPost, route, tc.path, MessageFeedback, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// Sampling temperatures for regenerated answers. A retry defaults to a little more
+// variety than a normal reply so it doesn't come back the same.
+const (
+    regenerateTemperature    = 1.0
+    maxRegenerateTemperature = 2.0
+)
+
+// RegenerateResponse - Answer the last question of a session again. The new answer is
+// stored as its own message linked to the original and counts against the project's
+// rate and usage limits like any other message.
+func RegenerateResponse(c *gin.Context) {
+    projectID := c.Param("projectId")
+    startTime := time.Now()
+    defer observeChatLatency("regenerate", startTime)
+
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        SessionID   string   `json:"session_id"`
+        UserToken   string   `json:"user_token"`
+        Temperature *float32 `json:"temperature"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil || input.SessionID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "session_id is required"})
+        return
+    }
+    temperature := float32(regenerateTemperature)
+    if input.Temperature != nil {
+        if *input.Temperature < 0 || *input.Temperature > maxRegenerateTemperature {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Temperature must be between 0 and 2"})
+            return
+        }
+        temperature = *input.Temperature
+    }
+
+    ctx, cancel := requestContext(c)
+    project, err := loadChatProject(ctx, objID)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if !project.IsActive || project.Status == models.ProjectStatusExpired {
+        c.JSON(http.StatusForbidden, gin.H{"error": "This chat is currently unavailable"})
+        return
+    }
+    if !embedOriginAllowed(c, project.AllowedDomains) {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error":  "This chat is not available on this website",
+            "status": "origin_not_allowed",
+        })
+        return
+    }
+    if !checkRateLimit(c, project) {
+        return
+    }
+    if rejectFullSession(c, project, input.SessionID) {
+        return
+    }
+    if !project.GeminiEnabled {
+        c.JSON(http.StatusForbidden, gin.H{
+            "error":  "AI responses are currently disabled for this project",
+            "status": "gemini_disabled",
+        })
+        return
+    }
+    if project.GeminiAPIKey == "" {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AI configuration is incomplete. Please contact support."})
+        return
+    }
+    if rejectOverUsageLimit(c, project) {
+        return
+    }
+
+    var user models.ChatUser
+    if input.UserToken != "" {
+        if userID, err := validateUserToken(input.UserToken, projectID); err == nil {
+            userObjID, _ := primitive.ObjectIDFromHex(userID)
+            ctx, cancel := requestContext(c)
+            config.DB.Collection("chat_users").FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+            cancel()
+        }
+    }
+
+    var last models.ChatMessage
+    ctx, cancel = requestContext(c)
+    err = config.DB.Collection("chat_messages").FindOne(ctx,
+        bson.M{"project_id": objID, "session_id": input.SessionID, "message": bson.M{"$ne": ""}},
+        options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}),
+    ).Decode(&last)
+    cancel()
+    // Another user's conversation looks the same as an empty one
+    if err != nil || (!last.UserID.IsZero() && last.UserID != user.ID) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "No message to regenerate in this session"})
+        return
+    }
+    originalID := last.ID
+    if !last.RegeneratedFrom.IsZero() {
+        originalID = last.RegeneratedFrom
+    }
+
+    ctx, cancel = requestContext(c)
+    reservedCost := reservedGeminiCost(project.GeminiModel)
+    reserved, err := reserveGeminiUsage(ctx, objID, reservedCost)
+    cancel()
+    if err == mongo.ErrNoDocuments {
+        if !rejectOverUsageLimit(c, reserved) {
+            c.JSON(http.StatusTooManyRequests, gin.H{
+                "error":  "AI usage limit reached for this project",
+                "status": "limit_exceeded",
+            })
+        }
+        return
+    } else if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check usage limits"})
+        return
+    }
+    project.GeminiUsageToday = reserved.GeminiUsageToday - 1
+    project.GeminiUsageMonth = reserved.GeminiUsageMonth - 1
+
+    response, inputTokens, outputTokens, err := generateGeminiResponseWithTemperature(
+        project, last.Message, c.ClientIP(), user, nil, temperature)
+    responseTime := time.Since(startTime).Milliseconds()
+    if err != nil {
+        go releaseGeminiUsage(objID, reservedCost)
+        go trackGeminiUsage(objID, last.Message, "", getGeminiModel(project.GeminiModel),
+            inputTokens, outputTokens, responseTime, c.ClientIP(), err, reservedCost)
+        if isBlockedBySafety(err) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": blockedReply(err), "status": "content_blocked"})
+            return
+        }
+        c.JSON(http.StatusBadGateway, gin.H{
+            "error":  "I'm having trouble answering just now. Please try again later.",
+            "status": "error",
+        })
+        return
+    }
+    go trackGeminiUsage(objID, last.Message, response, getGeminiModel(project.GeminiModel),
+        inputTokens, outputTokens, responseTime, c.ClientIP(), nil, reservedCost)
+
+    regenerated := models.ChatMessage{
+        ProjectID:       objID,
+        SessionID:       input.SessionID,
+        Message:         last.Message,
+        Response:        response,
+        Timestamp:       time.Now(),
+        IPAddress:       c.ClientIP(),
+        Status:          models.ChatReplySuccess,
+        RegeneratedFrom: originalID,
+    }
+    if !user.ID.IsZero() {
+        regenerated.UserID = user.ID
+        regenerated.UserName = user.Name
+        regenerated.UserEmail = user.Email
+    }
+    insertCtx, insertCancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    result, err := config.DB.Collection("chat_messages").InsertOne(insertCtx, regenerated)
+    insertCancel()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save regenerated response"})
+        return
+    }
+    regenerated.ID = result.InsertedID.(primitive.ObjectID)
+    recordSessionActivity(objID, input.SessionID, c.ClientIP(), user.ID)
+
+    usageInfo := gin.H{
+        "daily_usage":     project.GeminiUsageToday + 1,
+        "daily_limit":     project.GeminiDailyLimit,
+        "daily_remaining": project.GeminiDailyLimit - project.GeminiUsageToday - 1,
+        "monthly_usage":   project.GeminiUsageMonth + 1,
+        "monthly_limit":   project.GeminiMonthlyLimit,
+        "response_time":   responseTime,
+        "tokens_used":     inputTokens + outputTokens,
+    }
+    addUsageOutlook(usageInfo, project, inputTokens+outputTokens, time.Now())
+
+    c.JSON(http.StatusOK, gin.H{
+        "status":           "success",
+        "response":         response,
+        "message_id":       regenerated.ID.Hex(),
+        "regenerated_from": originalID.Hex(),
+        "project_id":       projectID,
+        "session_id":       input.SessionID,
+        "timestamp":        regenerated.Timestamp.Format(time.RFC3339),
+        "user_name":        user.Name,
+        "usage_info":       usageInfo,
+    })
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestRegenerateResponseRejectsBadInput(t *testing.T) {
+    route := "/chat/:projectId/regenerate"
+    path := "/chat/" + primitive.NewObjectID().Hex() + "/regenerate"
+    cases := []struct {
+        name string
+        path string
+        body string
+    }{
+        {"invalid project ID", "/chat/nope/regenerate", `{"session_id":"s1"}`},
+        {"missing session", path, `{}`},
+        {"temperature too high", path, `{"session_id":"s1","temperature":2.5}`},
+        {"negative temperature", path, `{"session_id":"s1","temperature":-0.1}`},
+    }
+    for _, tc := range cases {
+        // Rejected before the project is loaded or Gemini is called
+        if w := serveRoute(http.MethodPost, route, tc.path, RegenerateResponse, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+func TestRegenerateResponseOnlyOwnSession(t *testing.T) {
+    testDatabase(t)
+    t.Setenv("JWT_SECRET", "test-secret")
+    ctx := context.Background()
+
+    project := models.Project{
+        ID:                 primitive.NewObjectID(),
+        IsActive:           true,
+        GeminiEnabled:      true,
+        GeminiAPIKey:       "key",
+        GeminiDailyLimit:   100,
+        GeminiMonthlyLimit: 1000,
+    }
+    if _, err := config.DB.Collection("projects").InsertOne(ctx, project); err != nil {
+        t.Fatal(err)
+    }
+    owner := primitive.NewObjectID()
+    message := models.ChatMessage{ProjectID: project.ID, SessionID: "s1", UserID: owner, Message: "Hours?", Response: "9 to 5", Timestamp: time.Now()}
+    if _, err := config.DB.Collection("chat_messages").InsertOne(ctx, message); err != nil {
+        t.Fatal(err)
+    }
+
+    route := "/chat/:projectId/regenerate"
+    path := "/chat/" + project.ID.Hex() + "/regenerate"
+    stranger := generateUserToken(primitive.NewObjectID().Hex(), project.ID.Hex())
+    cases := []struct {
+        name string
+        body string
+    }{
+        {"empty session", `{"session_id":"s2"}`},
+        {"anonymous caller", `{"session_id":"s1"}`},
+        {"another user", `{"session_id":"s1","user_token":"` + stranger + `"}`},
+    }
+    for _, tc := range cases {
+        // Another user's conversation looks the same as an empty one, and neither reaches Gemini
+        if w := serveRoute(http.MethodPost, route, path, RegenerateResponse, tc.body); w.Code != http.StatusNotFound {
+            t.Errorf("%s: status = %d, want 404", tc.name, w.Code)
+        }
+    }
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+    "context"
+    "html"
+    "strings"
+    "time"
+    "unicode"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// maxRepeatLookback bounds how many of a session's recent messages are compared
+const maxRepeatLookback = 50
+
+// normalizeChatMessage - The message as compared for repeats: unescaped, lower-cased,
+// whitespace collapsed and trailing punctuation dropped, so "Price?" and "price " match
+func normalizeChatMessage(message string) string {
+    normalized := strings.Join(strings.Fields(strings.ToLower(html.UnescapeString(message))), " ")
+    return strings.TrimRightFunc(normalized, func(r rune) bool {
+        return unicode.IsPunct(r) || unicode.IsSpace(r)
+    })
+}
+
+// repeatedMessageReply - The last successful reply when the session already sent this
+// message config.RepeatThreshold times within config.RepeatWindow. Error, fallback and
+// blocked replies are never reused. Lookup errors count as no repeat.
+func repeatedMessageReply(projectID primitive.ObjectID, sessionID, message string) (string, bool) {
+    if config.RepeatThreshold <= 0 || sessionID == "" {
+        return "", false
+    }
+    normalized := normalizeChatMessage(message)
+    if normalized == "" {
+        return "", false
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    defer cancel()
+    cursor, err := config.DB.Collection("chat_messages").Find(ctx, bson.M{
+        "project_id": projectID,
+        "session_id": sessionID,
+        "timestamp":  bson.M{"$gte": time.Now().Add(-config.RepeatWindow)},
+    }, options.Find().
+        SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+        SetLimit(maxRepeatLookback).
+        SetProjection(bson.M{"message": 1, "response": 1, "status": 1}))
+    if err != nil {
+        return "", false
+    }
+    var recent []models.ChatMessage
+    if err := cursor.All(ctx, &recent); err != nil {
+        return "", false
+    }
+    return repeatReply(recent, normalized, config.RepeatThreshold)
+}
+
+// repeatReply - The newest reusable reply among a session's recent messages (newest
+// first) once at least threshold of them match the normalized message
+func repeatReply(recent []models.ChatMessage, normalized string, threshold int) (string, bool) {
+    var reply string
+    matches := 0
+    for _, earlier := range recent {
+        if normalizeChatMessage(earlier.Message) != normalized {
+            continue
+        }
+        matches++
+        if reply == "" && reusableReply(earlier) {
+            reply = earlier.Response
+        }
+    }
+    if matches < threshold || reply == "" {
+        return "", false
+    }
+    return reply, true
+}
+
+// reusableReply - Whether a saved reply answered its question and can be sent again. A
+// replayed reply is itself a successful one.
+func reusableReply(message models.ChatMessage) bool {
+    if strings.TrimSpace(message.Response) == "" {
+        return false
+    }
+    return message.Status == models.ChatReplySuccess || message.Status == "repeated_message"
+}
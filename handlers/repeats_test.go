@@ -0,0 +1,60 @@
+package handlers
+
+import (
+    "testing"
+
+    "jevi-chat/models"
+)
+
+func TestNormalizeChatMessage(t *testing.T) {
+    cases := map[string]string{
+        "What is the PRICE?":     "what is the price",
+        "  what   is the price ": "what is the price",
+        "what is the price?!":    "what is the price",
+        "Tom &amp; Jerry":        "tom & jerry",
+        "...":                    "",
+    }
+    for in, want := range cases {
+        if got := normalizeChatMessage(in); got != want {
+            t.Errorf("normalizeChatMessage(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestRepeatReplyDeduplicatesAfterThreshold(t *testing.T) {
+    recent := []models.ChatMessage{ // newest first
+        {Message: "What is the price?", Response: "It costs $10.", Status: models.ChatReplySuccess},
+        {Message: "what is the price", Response: "It costs $10.", Status: models.ChatReplySuccess},
+        {Message: "hello", Response: "Hi!", Status: models.ChatReplySuccess},
+    }
+    normalized := normalizeChatMessage("WHAT is the price")
+
+    reply, repeated := repeatReply(recent, normalized, 2)
+    if !repeated || reply != "It costs $10." {
+        t.Fatalf("repeatReply = %q, %v; want the cached reply", reply, repeated)
+    }
+    if _, repeated := repeatReply(recent, normalized, 3); repeated {
+        t.Error("two earlier messages should not reach a threshold of 3")
+    }
+    if _, repeated := repeatReply(recent, normalizeChatMessage("something else"), 1); repeated {
+        t.Error("a different message must not be treated as a repeat")
+    }
+}
+
+func TestRepeatReplyNeverReusesFailures(t *testing.T) {
+    recent := []models.ChatMessage{
+        {Message: "price?", Response: "I'm having trouble answering just now. Please try again later.", Status: "error"},
+        {Message: "price?", Response: "Sorry, I can't help with that.", Status: "content_blocked"},
+        {Message: "price?", Response: "Legacy reply without a status"},
+    }
+    if reply, repeated := repeatReply(recent, "price", 2); repeated {
+        t.Fatalf("replayed %q; only successful replies may be reused", reply)
+    }
+
+    // A later success is reused even though the newest attempt failed
+    recent = append([]models.ChatMessage{recent[0]},
+        models.ChatMessage{Message: "price", Response: "It costs $10.", Status: models.ChatReplySuccess})
+    if reply, repeated := repeatReply(recent, "price", 2); !repeated || reply != "It costs $10." {
+        t.Fatalf("repeatReply = %q, %v; want the successful reply", reply, repeated)
+    }
+}
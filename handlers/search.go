@@ -0,0 +1,265 @@
+package handlers
+
+import (
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// searchSnippetRadius is how many characters of context are kept on each side of a match
+const searchSnippetRadius = 60
+
+// SearchMessages - Full-text search over a project's messages and responses
+func SearchMessages(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    projectID := c.Param("id")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    query := strings.TrimSpace(c.Query("q"))
+    if query == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+        return
+    }
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    // Uses the message_text index created in setupIndexes; $text matching is case-insensitive
+    filter := bson.M{
+        "project_id": objID,
+        "$text":      bson.M{"$search": query},
+    }
+
+    collection := config.DB.Collection("chat_messages")
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+        return
+    }
+
+    opts := options.Find().
+        SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+        SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "timestamp", Value: -1}}).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+        return
+    }
+    defer cursor.Close(ctx)
+
+    var messages []models.ChatMessage
+    if err := cursor.All(ctx, &messages); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse search results"})
+        return
+    }
+
+    terms := strings.Fields(strings.ToLower(strings.ReplaceAll(query, `"`, " ")))
+    results := make([]gin.H, 0, len(messages))
+    for _, message := range messages {
+        matchedFields := []string{}
+        snippets := gin.H{}
+        fields := []struct{ name, text string }{
+            {"message", message.Message},
+            {"response", message.Response},
+        }
+        for _, field := range fields {
+            if snippet, ok := searchSnippet(field.text, terms); ok {
+                matchedFields = append(matchedFields, field.name)
+                snippets[field.name] = snippet
+            }
+        }
+
+        results = append(results, gin.H{
+            "id":             message.ID,
+            "session_id":     message.SessionID,
+            "user_name":      message.UserName,
+            "timestamp":      message.Timestamp.Format(time.RFC3339),
+            "message":        message.Message,
+            "response":       message.Response,
+            "matched_fields": matchedFields,
+            "snippets":       snippets,
+        })
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":     true,
+        "query":       query,
+        "results":     results,
+        "total":       total,
+        "page":        page,
+        "limit":       limit,
+        "total_pages": (total + int64(limit) - 1) / int64(limit),
+    })
+}
+
+// searchSnippet returns the text around the first matching term with the match
+// wrapped in <mark> tags. Text search also matches word stems, so a field can
+// match without containing a term verbatim; ok is false in that case.
+func searchSnippet(text string, terms []string) (string, bool) {
+    lower := strings.ToLower(text)
+    for _, term := range terms {
+        index := strings.Index(lower, term)
+        if index < 0 || len(lower) != len(text) {
+            continue
+        }
+        return markedSnippet(text, index, len(term)), true
+    }
+    return "", false
+}
+
+// markedSnippet returns the text around text[index:index+length], which is wrapped in
+// <mark> tags, with searchSnippetRadius characters of context on each side
+func markedSnippet(text string, index, length int) string {
+    start := index - searchSnippetRadius
+    prefix := "..."
+    if start <= 0 {
+        start, prefix = 0, ""
+    }
+    matchEnd := index + length
+    end := matchEnd + searchSnippetRadius
+    suffix := "..."
+    if end >= len(text) {
+        end, suffix = len(text), ""
+    }
+
+    // Keep the cut on valid UTF-8 boundaries
+    for start > 0 && !utf8.RuneStart(text[start]) {
+        start--
+    }
+    for end < len(text) && !utf8.RuneStart(text[end]) {
+        end++
+    }
+
+    return prefix + text[start:index] + "<mark>" + text[index:matchEnd] + "</mark>" + text[matchEnd:end] + suffix
+}
+
+// maxSnippetsPerPassage caps how many matches of one chunk or source are returned
+const maxSnippetsPerPassage = 5
+
+// knowledgePassage is a piece of the knowledge base searched by SearchKnowledgeBase
+type knowledgePassage struct {
+    sourceID   string
+    sourceName string
+    index      int
+    content    string
+}
+
+// SearchKnowledgeBase - Find a phrase in a project's knowledge base, so admins can check
+// what the bot knows. Searches the stored chunks, or the sources' content when the project
+// hasn't been chunked, and returns each match in context with the source it came from.
+func SearchKnowledgeBase(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    query := strings.TrimSpace(c.Query("q"))
+    if query == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+        return
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    var project models.Project
+    if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": objID}).Decode(&project); err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    passages, searched := knowledgePassages(project)
+    pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+
+    results := []gin.H{}
+    total := 0
+    for _, passage := range passages {
+        matches := pattern.FindAllStringIndex(passage.content, -1)
+        if len(matches) == 0 {
+            continue
+        }
+        total += len(matches)
+        if len(results) >= limit {
+            continue
+        }
+
+        snippets := make([]string, 0, maxSnippetsPerPassage)
+        for _, match := range matches {
+            if len(snippets) == maxSnippetsPerPassage {
+                break
+            }
+            snippets = append(snippets, markedSnippet(passage.content, match[0], match[1]-match[0]))
+        }
+        results = append(results, gin.H{
+            "source_id":   passage.sourceID,
+            "source_name": passage.sourceName,
+            "chunk_index": passage.index,
+            "matches":     len(matches),
+            "snippets":    snippets,
+        })
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":       true,
+        "query":         query,
+        "searched":      searched,
+        "results":       results,
+        "total_matches": total,
+        "limit":         limit,
+    })
+}
+
+// knowledgePassages - The project's stored chunks, else its enabled sources, else its
+// aggregated pdf_content, along with which of them is being searched
+func knowledgePassages(project models.Project) ([]knowledgePassage, string) {
+    if chunks := loadKnowledgeChunks(project.ID); len(chunks) > 0 {
+        passages := make([]knowledgePassage, len(chunks))
+        for i, chunk := range chunks {
+            passages[i] = knowledgePassage{sourceID: chunk.FileID, sourceName: chunk.FileName, index: chunk.Index, content: chunk.Content}
+        }
+        return passages, "chunks"
+    }
+
+    var passages []knowledgePassage
+    for _, source := range project.Sources() {
+        if source.Enabled && source.Content != "" {
+            passages = append(passages, knowledgePassage{sourceID: source.ID, sourceName: source.Name, content: source.Content})
+        }
+    }
+    if len(passages) > 0 {
+        return passages, "sources"
+    }
+    if project.PDFContent != "" {
+        return []knowledgePassage{{content: project.PDFContent}}, "pdf_content"
+    }
+    return nil, "none"
+}
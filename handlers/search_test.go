@@ -0,0 +1,158 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+    "unicode/utf8"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestSearchSnippet(t *testing.T) {
+    snippet, ok := searchSnippet("Where can I find the Refund policy?", []string{"refund"})
+    if !ok || snippet != "Where can I find the <mark>Refund</mark> policy?" {
+        t.Errorf("searchSnippet = %q, %v", snippet, ok)
+    }
+
+    // Stemmed matches don't contain the term verbatim
+    if _, ok := searchSnippet("We refunded the order", []string{"refunds"}); ok {
+        t.Error("a field without the literal term must not report a snippet")
+    }
+}
+
+func TestMarkedSnippetTrimsLongText(t *testing.T) {
+    text := strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100)
+    snippet := markedSnippet(text, 100, len("needle"))
+
+    want := "..." + strings.Repeat("a", searchSnippetRadius) + "<mark>needle</mark>" + strings.Repeat("b", searchSnippetRadius) + "..."
+    if snippet != want {
+        t.Errorf("markedSnippet = %q, want %q", snippet, want)
+    }
+}
+
+func TestMarkedSnippetKeepsValidUTF8(t *testing.T) {
+    text := strings.Repeat("é", 80) + "match" + strings.Repeat("ü", 80)
+    index := strings.Index(text, "match")
+    if snippet := markedSnippet(text, index, len("match")); !utf8.ValidString(snippet) {
+        t.Errorf("markedSnippet cut a multi-byte character: %q", snippet)
+    }
+}
+
+func TestSearchMessagesRequiresQuery(t *testing.T) {
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/search?q=%20"
+    if w := serveRoute(http.MethodGet, "/projects/:id/search", path, SearchMessages, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("blank query: status = %d, want 400", w.Code)
+    }
+    if w := serveRoute(http.MethodGet, "/projects/:id/search", "/projects/bad/search?q=refund", SearchMessages, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project ID: status = %d, want 400", w.Code)
+    }
+}
+
+func TestSearchKnowledgeBaseRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/kb/search"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/kb/search"
+    for _, tc := range []struct{ name, path string }{
+        {"invalid project ID", "/projects/bad/kb/search?q=refund"},
+        {"missing query", path},
+        {"blank query", path + "?q=%20%20"},
+    } {
+        // Rejected before the project is loaded
+        if w := serveRoute(http.MethodGet, route, tc.path, SearchKnowledgeBase, ""); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+type knowledgeSearch struct {
+    Searched string `json:"searched"`
+    Results  []struct {
+        SourceID   string   `json:"source_id"`
+        SourceName string   `json:"source_name"`
+        ChunkIndex int      `json:"chunk_index"`
+        Matches    int      `json:"matches"`
+        Snippets   []string `json:"snippets"`
+    } `json:"results"`
+    TotalMatches int `json:"total_matches"`
+    Limit        int `json:"limit"`
+}
+
+func searchKnowledge(t *testing.T, projectID primitive.ObjectID, query string) knowledgeSearch {
+    t.Helper()
+    path := "/projects/" + projectID.Hex() + "/kb/search?" + query
+    w := serveRoute(http.MethodGet, "/projects/:id/kb/search", path, SearchKnowledgeBase, "")
+    var result knowledgeSearch
+    if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK {
+        t.Fatalf("SearchKnowledgeBase?%s = %d %s", query, w.Code, w.Body)
+    }
+    return result
+}
+
+func TestSearchKnowledgeBase(t *testing.T) {
+    testDatabase(t)
+    ctx := context.Background()
+
+    chunked := models.Project{ID: primitive.NewObjectID()}
+    unchunked := models.Project{ID: primitive.NewObjectID(), KnowledgeSources: []models.KnowledgeSource{
+        {ID: "a", Name: "prices.txt", Content: "Shipping costs $5.00. Express shipping costs more.", Enabled: true},
+        {ID: "b", Name: "old.txt", Content: "Shipping was free.", Enabled: false},
+    }}
+    legacy := models.Project{ID: primitive.NewObjectID(), PDFContent: "Shipping takes three days."}
+    empty := models.Project{ID: primitive.NewObjectID()}
+    if _, err := config.DB.Collection("projects").InsertMany(ctx, []interface{}{chunked, unchunked, legacy, empty}); err != nil {
+        t.Fatal(err)
+    }
+    chunks := []interface{}{
+        models.KnowledgeChunk{ProjectID: chunked.ID, FileID: "f1", FileName: "faq.txt", Index: 0, Content: "Refunds take five days."},
+        models.KnowledgeChunk{ProjectID: chunked.ID, FileID: "f1", FileName: "faq.txt", Index: 1, Content: strings.Repeat("refund ", 8)},
+        models.KnowledgeChunk{ProjectID: chunked.ID, FileID: "f2", FileName: "hours.txt", Index: 0, Content: "Open 9am to 5pm."},
+    }
+    if _, err := config.DB.Collection("kb_chunks").InsertMany(ctx, chunks); err != nil {
+        t.Fatal(err)
+    }
+
+    result := searchKnowledge(t, chunked.ID, "q=REFUND")
+    if result.Searched != "chunks" || result.TotalMatches != 9 || len(result.Results) != 2 {
+        t.Fatalf("chunks search = %+v, want 9 matches in 2 chunks", result)
+    }
+    first, second := result.Results[0], result.Results[1]
+    if first.SourceName != "faq.txt" || first.ChunkIndex != 0 || first.Snippets[0] != "<mark>Refund</mark>s take five days." {
+        t.Errorf("first result = %+v", first)
+    }
+    if second.ChunkIndex != 1 || second.Matches != 8 || len(second.Snippets) != maxSnippetsPerPassage {
+        t.Errorf("second result = %+v, want 8 matches with %d snippets", second, maxSnippetsPerPassage)
+    }
+
+    // The limit caps the results returned, not the matches counted
+    if result := searchKnowledge(t, chunked.ID, "q=refund&limit=1"); len(result.Results) != 1 || result.TotalMatches != 9 || result.Limit != 1 {
+        t.Errorf("limited search = %+v, want 1 result of 9 matches", result)
+    }
+    if result := searchKnowledge(t, chunked.ID, "q=refund&limit=500"); result.Limit != 20 {
+        t.Errorf("limit = %d, want out-of-range limits reset to 20", result.Limit)
+    }
+
+    // Without chunks the enabled sources are searched, with the query taken literally
+    result = searchKnowledge(t, unchunked.ID, "q=%245.00")
+    if result.Searched != "sources" || result.TotalMatches != 1 || len(result.Results) != 1 || result.Results[0].SourceID != "a" {
+        t.Errorf("sources search = %+v, want the price in prices.txt", result)
+    }
+    if result := searchKnowledge(t, unchunked.ID, "q=free"); result.TotalMatches != 0 || len(result.Results) != 0 {
+        t.Errorf("disabled source was searched: %+v", result)
+    }
+
+    if result := searchKnowledge(t, legacy.ID, "q=three"); result.Searched != "pdf_content" || result.TotalMatches != 1 {
+        t.Errorf("legacy search = %+v, want pdf_content searched", result)
+    }
+    if result := searchKnowledge(t, empty.ID, "q=anything"); result.Searched != "none" || result.Results == nil {
+        t.Errorf("empty search = %+v, want none searched and an empty list", result)
+    }
+
+    missing := "/projects/" + primitive.NewObjectID().Hex() + "/kb/search?q=refund"
+    if w := serveRoute(http.MethodGet, "/projects/:id/kb/search", missing, SearchKnowledgeBase, ""); w.Code != http.StatusNotFound {
+        t.Errorf("unknown project: status = %d, want 404", w.Code)
+    }
+}
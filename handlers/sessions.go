@@ -0,0 +1,123 @@
+package handlers
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// GetProjectSessions - List a project's chat sessions, most recently active first.
+// status can be "active" or "ended"; all sessions are returned by default.
+func GetProjectSessions(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+    if page < 1 {
+        page = 1
+    }
+    limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+    if limit < 1 || limit > 100 {
+        limit = 20
+    }
+
+    filter := bson.M{"project_id": objID}
+    switch c.Query("status") {
+    case "":
+    case "active":
+        filter["is_active"] = true
+    case "ended":
+        filter["is_active"] = false
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+        return
+    }
+
+    collection := config.DB.Collection("chat_sessions")
+    total, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+        return
+    }
+    activeCount, err := collection.CountDocuments(ctx, bson.M{"project_id": objID, "is_active": true})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+        return
+    }
+
+    opts := options.Find().
+        SetSort(bson.D{{Key: "last_activity", Value: -1}}).
+        SetSkip(int64((page - 1) * limit)).
+        SetLimit(int64(limit))
+    cursor, err := collection.Find(ctx, filter, opts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+        return
+    }
+
+    var sessions []models.ChatSession
+    if err := cursor.All(ctx, &sessions); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse sessions"})
+        return
+    }
+    if sessions == nil {
+        sessions = []models.ChatSession{}
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":         true,
+        "sessions":        sessions,
+        "active_sessions": activeCount,
+        "total":           total,
+        "page":            page,
+        "limit":           limit,
+        "total_pages":     (total + int64(limit) - 1) / int64(limit),
+    })
+}
+
+// EndChatSession - Close an active chat session from the widget
+func EndChatSession(c *gin.Context) {
+    ctx, cancel := requestContext(c)
+    defer cancel()
+
+    objID, err := primitive.ObjectIDFromHex(c.Param("projectId"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+    sessionID := c.Param("sessionId")
+
+    endTime := time.Now()
+    result, err := config.DB.Collection("chat_sessions").UpdateOne(
+        ctx,
+        bson.M{"project_id": objID, "session_id": sessionID, "is_active": true},
+        bson.M{"$set": bson.M{"is_active": false, "end_time": endTime}},
+    )
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Active session not found"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":    true,
+        "session_id": sessionID,
+        "end_time":   endTime,
+    })
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestGetProjectSessionsRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/sessions"
+    if w := serveRoute(http.MethodGet, route, "/projects/bad/sessions", GetProjectSessions, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project ID: status = %d, want 400", w.Code)
+    }
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/sessions?status=paused"
+    if w := serveRoute(http.MethodGet, route, path, GetProjectSessions, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("unknown status filter: status = %d, want 400", w.Code)
+    }
+}
+
+func TestEndChatSessionRejectsInvalidProject(t *testing.T) {
+    w := serveRoute(http.MethodPost, "/chat/:projectId/sessions/:sessionId/end", "/chat/bad/sessions/s1/end", EndChatSession, "")
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+func TestSessionAtMessageLimitWithoutCap(t *testing.T) {
+    // Uncapped projects and sessionless messages never count, so the database isn't needed
+    ctx := context.Background()
+    if sessionAtMessageLimit(ctx, models.Project{}, "s1") {
+        t.Error("a project without a cap reported a full session")
+    }
+    if sessionAtMessageLimit(ctx, models.Project{MaxSessionMessages: 5}, "") {
+        t.Error("a message without a session reported a full session")
+    }
+}
+
+func TestRejectFullSession(t *testing.T) {
+    testDatabase(t)
+    gin.SetMode(gin.TestMode)
+
+    project := models.Project{ID: primitive.NewObjectID(), MaxSessionMessages: 2}
+    message := models.ChatMessage{ProjectID: project.ID, SessionID: "s1", Timestamp: time.Now()}
+    if _, err := config.DB.Collection("chat_messages").InsertOne(context.Background(), message); err != nil {
+        t.Fatal(err)
+    }
+
+    reject := func() (bool, *httptest.ResponseRecorder) {
+        w := httptest.NewRecorder()
+        c, _ := gin.CreateTestContext(w)
+        c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+        return rejectFullSession(c, project, "s1"), w
+    }
+    if rejected, _ := reject(); rejected {
+        t.Fatal("a session below the cap was rejected")
+    }
+
+    message.ID = primitive.NilObjectID
+    if _, err := config.DB.Collection("chat_messages").InsertOne(context.Background(), message); err != nil {
+        t.Fatal(err)
+    }
+    rejected, w := reject()
+    if !rejected {
+        t.Fatal("a session at the cap was accepted")
+    }
+    var body map[string]interface{}
+    json.Unmarshal(w.Body.Bytes(), &body)
+    if w.Code != http.StatusOK || body["status"] != "session_limit_reached" || body["response"] != sessionLimitMessage {
+        t.Errorf("reply = %d %v, want the start-a-new-chat message", w.Code, body)
+    }
+}
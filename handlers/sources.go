@@ -0,0 +1,407 @@
+package handlers
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net"
+    "net/http"
+    "net/url"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "time"
+    "unicode/utf8"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+    "jevi-chat/utils"
+)
+
+// textSourceTypes maps the accepted text document extensions to their source type
+var textSourceTypes = map[string]string{
+    ".txt":      models.KnowledgeSourceText,
+    ".md":       models.KnowledgeSourceMarkdown,
+    ".markdown": models.KnowledgeSourceMarkdown,
+}
+
+// UploadText - Add plain-text or markdown knowledge sources to a project, either as
+// .txt/.md files in the "files" form field or as a JSON body {"title", "content", "format"}.
+// The text is used as uploaded, so sources are ready immediately; the knowledge base
+// is rebuilt in the background like it is for PDFs.
+func UploadText(c *gin.Context) {
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    var project models.Project
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxTotalUpload+1<<20)
+
+    type textDocument struct {
+        name, sourceType string
+        content          []byte
+    }
+    var documents []textDocument
+    var rejectedFiles []gin.H
+
+    if strings.HasPrefix(c.ContentType(), "multipart/") {
+        form, err := c.MultipartForm()
+        if err != nil {
+            var tooLarge *http.MaxBytesError
+            if errors.As(err, &tooLarge) {
+                c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload exceeds the %s total limit", formatFileSize(config.MaxTotalUpload))})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+            return
+        }
+        for _, file := range form.File["files"] {
+            sourceType, ok := textSourceTypes[strings.ToLower(filepath.Ext(file.Filename))]
+            if !ok {
+                rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": "Only .txt and .md files are accepted"})
+                continue
+            }
+            if file.Size > config.MaxPDFSize {
+                rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": fmt.Sprintf("exceeds the %s per-file limit", formatFileSize(config.MaxPDFSize))})
+                continue
+            }
+            f, err := file.Open()
+            if err != nil {
+                rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": "could not read file"})
+                continue
+            }
+            content, err := io.ReadAll(f)
+            f.Close()
+            if err != nil {
+                rejectedFiles = append(rejectedFiles, gin.H{"file": file.Filename, "error": "could not read file"})
+                continue
+            }
+            documents = append(documents, textDocument{name: file.Filename, sourceType: sourceType, content: content})
+        }
+    } else {
+        var input struct {
+            Title   string `json:"title"`
+            Content string `json:"content"`
+            Format  string `json:"format"` // "text" (default) or "markdown"
+        }
+        if err := c.ShouldBindJSON(&input); err != nil || strings.TrimSpace(input.Content) == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Upload .txt/.md files or send content"})
+            return
+        }
+        sourceType := models.KnowledgeSourceText
+        if input.Format == models.KnowledgeSourceMarkdown {
+            sourceType = models.KnowledgeSourceMarkdown
+        } else if input.Format != "" && input.Format != models.KnowledgeSourceText {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be text or markdown"})
+            return
+        }
+        if int64(len(input.Content)) > config.MaxPDFSize {
+            c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Content exceeds the %s limit", formatFileSize(config.MaxPDFSize))})
+            return
+        }
+        title := strings.TrimSpace(input.Title)
+        if title == "" {
+            title = "Text snippet"
+        }
+        documents = append(documents, textDocument{name: title, sourceType: sourceType, content: []byte(input.Content)})
+    }
+
+    var uploadedFiles []models.KnowledgeSource
+    var duplicateFiles []gin.H
+    seenHashes := make(map[string]string)
+    now := time.Now()
+
+    for _, document := range documents {
+        if !utf8.Valid(document.content) || bytes.IndexByte(document.content, 0) >= 0 {
+            rejectedFiles = append(rejectedFiles, gin.H{"file": document.name, "error": "file is not UTF-8 text"})
+            continue
+        }
+        text := strings.TrimSpace(string(document.content))
+        if text == "" {
+            rejectedFiles = append(rejectedFiles, gin.H{"file": document.name, "error": "file is empty"})
+            continue
+        }
+
+        sum := sha256.Sum256(document.content)
+        hash := hex.EncodeToString(sum[:])
+        existingID, duplicate := seenHashes[hash]
+        if !duplicate {
+            existingID, duplicate = findPDFByHash(c, objID, hash)
+        }
+        if duplicate {
+            duplicateFiles = append(duplicateFiles, gin.H{"file": document.name, "status": "duplicate", "existing_file_id": existingID})
+            continue
+        }
+
+        fileID := primitive.NewObjectID().Hex()
+        uploadedFiles = append(uploadedFiles, models.KnowledgeSource{
+            ID:          fileID,
+            Type:        document.sourceType,
+            Name:        document.name,
+            Size:        int64(len(document.content)),
+            Hash:        hash,
+            Content:     text,
+            Status:      models.PDFStatusCompleted,
+            Enabled:     true,
+            CreatedAt:   now,
+            ProcessedAt: now,
+        })
+        seenHashes[hash] = fileID
+    }
+
+    if len(uploadedFiles) == 0 {
+        if len(duplicateFiles) > 0 && len(rejectedFiles) == 0 {
+            c.JSON(http.StatusOK, gin.H{
+                "message":         "All documents were already uploaded",
+                "files_uploaded":  0,
+                "duplicate_files": duplicateFiles,
+            })
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":           "No valid text documents uploaded",
+            "rejected_files":  rejectedFiles,
+            "duplicate_files": duplicateFiles,
+        })
+        return
+    }
+
+    ctx, cancel = requestContext(c)
+    _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+        "$push": bson.M{"knowledge_sources": bson.M{"$each": uploadedFiles}},
+        "$set":  bson.M{"updated_at": now},
+        "$inc":  bson.M{"version": 1},
+    })
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    go refreshKnowledgeBase(objID)
+
+    responses := make([]models.PDFFileResponse, len(uploadedFiles))
+    for i, file := range uploadedFiles {
+        responses[i] = models.NewPDFFileResponse(file)
+    }
+    c.JSON(http.StatusCreated, gin.H{
+        "message":         "Documents added to the knowledge base",
+        "files_uploaded":  len(uploadedFiles),
+        "sources":         models.NewKnowledgeSourceResponses(uploadedFiles),
+        "files":           responses,
+        "rejected_files":  rejectedFiles,
+        "duplicate_files": duplicateFiles,
+    })
+}
+
+// URL ingestion limits
+const (
+    maxIngestBytes = 5 << 20
+    ingestTimeout  = 15 * time.Second
+)
+
+// ingestClient fetches pages for IngestURL. It refuses to connect to anything but public
+// addresses so the endpoint can't be used to reach internal services, and never goes
+// through a proxy, which would hide the real destination from that check.
+var ingestClient = &http.Client{
+    Timeout: ingestTimeout,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: 5 * time.Second,
+            Control: refuseInternalAddress,
+        }).DialContext,
+        TLSHandshakeTimeout:   5 * time.Second,
+        ResponseHeaderTimeout: 10 * time.Second,
+    },
+    CheckRedirect: func(req *http.Request, via []*http.Request) error {
+        if len(via) >= 5 {
+            return fmt.Errorf("too many redirects")
+        }
+        return nil
+    },
+}
+
+// refuseInternalAddress is a dialer hook refusing connections to anything but public addresses
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return err
+    }
+    if ip := net.ParseIP(host); ip == nil || !models.IsPublicIP(ip) {
+        return fmt.Errorf("address %s is not allowed", host)
+    }
+    return nil
+}
+
+// IngestURL - Fetch a web page and add its readable text to the project's knowledge
+// base, recording where it came from. Ingesting a URL again refreshes its content.
+// HTML is stripped of scripts, styles and navigation; plain text and markdown are used as-is.
+func IngestURL(c *gin.Context) {
+    objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    var input struct {
+        URL string `json:"url"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+        return
+    }
+    pageURL, err := url.Parse(strings.TrimSpace(input.URL))
+    if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+        return
+    }
+
+    collection := config.DB.Collection("projects")
+    var project models.Project
+    ctx, cancel := requestContext(c)
+    err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&project)
+    cancel()
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+
+    req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, pageURL.String(), nil)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid url"})
+        return
+    }
+    req.Header.Set("User-Agent", "JeviChatBot/1.0 (+knowledge base ingestion)")
+    req.Header.Set("Accept", "text/html, text/plain, text/markdown;q=0.9")
+
+    resp, err := ingestClient.Do(req)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch url", "details": err.Error()})
+        return
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        c.JSON(http.StatusBadGateway, gin.H{
+            "error":       fmt.Sprintf("The page responded with status %d", resp.StatusCode),
+            "status_code": resp.StatusCode,
+        })
+        return
+    }
+
+    body, err := io.ReadAll(io.LimitReader(resp.Body, maxIngestBytes+1))
+    if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read page"})
+        return
+    }
+    if len(body) > maxIngestBytes {
+        c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("The page exceeds the %s limit", formatFileSize(maxIngestBytes))})
+        return
+    }
+
+    mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+    if mediaType == "" {
+        mediaType = strings.Split(http.DetectContentType(body), ";")[0]
+    }
+    var title, text string
+    switch mediaType {
+    case "text/html", "application/xhtml+xml":
+        title, text, err = utils.ExtractHTMLText(bytes.NewReader(body))
+        if err != nil {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to read the page's HTML"})
+            return
+        }
+    case "text/plain", "text/markdown":
+        if !utf8.Valid(body) {
+            c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The page is not UTF-8 text"})
+            return
+        }
+        text = strings.TrimSpace(string(body))
+    default:
+        c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("Unsupported content type %q; only HTML and text pages can be ingested", mediaType)})
+        return
+    }
+    if text == "" {
+        c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No readable text found on the page"})
+        return
+    }
+    if title == "" {
+        title = pageURL.String()
+    }
+
+    sum := sha256.Sum256([]byte(text))
+    now := time.Now()
+    source := models.KnowledgeSource{
+        ID:          primitive.NewObjectID().Hex(),
+        Type:        models.KnowledgeSourceURL,
+        Name:        title,
+        Origin:      pageURL.String(),
+        Size:        int64(len(text)),
+        Hash:        hex.EncodeToString(sum[:]),
+        Content:     text,
+        Status:      models.PDFStatusCompleted,
+        Enabled:     true,
+        CreatedAt:   now,
+        ProcessedAt: now,
+    }
+
+    // Refresh the source for this URL in place, or add it
+    ctx, cancel = requestContext(c)
+    defer cancel()
+    refreshed := false
+    for _, file := range project.KnowledgeSources {
+        if file.Type == models.KnowledgeSourceURL && file.Origin == source.Origin {
+            source.ID = file.ID
+            source.CreatedAt = file.CreatedAt
+            source.Enabled = file.Enabled
+            refreshed = true
+            break
+        }
+    }
+    if refreshed {
+        _, err = collection.UpdateOne(ctx,
+            bson.M{"_id": objID, "knowledge_sources.id": source.ID},
+            bson.M{"$set": bson.M{"knowledge_sources.$": source, "updated_at": now}, "$inc": bson.M{"version": 1}})
+    } else {
+        _, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{
+            "$push": bson.M{"knowledge_sources": source},
+            "$set":  bson.M{"updated_at": now},
+            "$inc":  bson.M{"version": 1},
+        })
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+        return
+    }
+
+    go refreshKnowledgeBase(objID)
+
+    status, message := http.StatusCreated, "Page added to the knowledge base"
+    if refreshed {
+        status, message = http.StatusOK, "Page content refreshed"
+    }
+    c.JSON(status, gin.H{
+        "message":   message,
+        "refreshed": refreshed,
+        "source":    models.NewKnowledgeSourceResponse(source),
+        "file":      models.NewPDFFileResponse(source),
+        "chars":     len([]rune(text)),
+    })
+}
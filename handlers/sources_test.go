@@ -0,0 +1,299 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestUploadTextRejectsInvalidProjectID(t *testing.T) {
+    if w := serveRoute(http.MethodPost, "/projects/:id/upload-text", "/projects/nope/upload-text", UploadText, `{"content":"hi"}`); w.Code != http.StatusBadRequest {
+        t.Errorf("status = %d, want 400", w.Code)
+    }
+}
+
+// uploadTextFiles posts files to UploadText as a multipart form
+func uploadTextFiles(t *testing.T, projectID primitive.ObjectID, files map[string]string) *httptest.ResponseRecorder {
+    t.Helper()
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    for name, content := range files {
+        part, err := writer.CreateFormFile("files", name)
+        if err != nil {
+            t.Fatal(err)
+        }
+        part.Write([]byte(content))
+    }
+    writer.Close()
+
+    gin.SetMode(gin.TestMode)
+    router := gin.New()
+    router.POST("/projects/:id/upload-text", UploadText)
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodPost, "/projects/"+projectID.Hex()+"/upload-text", &body)
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    router.ServeHTTP(w, req)
+    return w
+}
+
+// waitForKnowledgeRefresh waits for the background refreshKnowledgeBase started by an
+// upload to store the project's chunks, so it doesn't outlive the test database
+func waitForKnowledgeRefresh(t *testing.T, projectID primitive.ObjectID) models.Project {
+    t.Helper()
+    ctx := context.Background()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        var project models.Project
+        if err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": projectID}).Decode(&project); err != nil {
+            t.Fatal(err)
+        }
+        chunks, _ := config.DB.Collection("kb_chunks").CountDocuments(ctx, bson.M{"project_id": projectID})
+        if project.PDFContent != "" && chunks > 0 {
+            return project
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("knowledge base for %s was not refreshed", projectID.Hex())
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+func TestUploadText(t *testing.T) {
+    testDatabase(t)
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Acme"}
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+    route := "/projects/:id/upload-text"
+    path := "/projects/" + project.ID.Hex() + "/upload-text"
+
+    for _, body := range []string{`{}`, `{"content":"   "}`, `{"content":"hi","format":"html"}`} {
+        if w := serveRoute(http.MethodPost, route, path, UploadText, body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", body, w.Code)
+        }
+    }
+
+    w := serveRoute(http.MethodPost, route, path, UploadText, `{"title":"Hours","content":"Open 9am to 5pm on weekdays.","format":"markdown"}`)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("JSON upload = %d %s", w.Code, w.Body)
+    }
+    waitForKnowledgeRefresh(t, project.ID)
+
+    w = uploadTextFiles(t, project.ID, map[string]string{
+        "returns.txt": "Returns are accepted within 30 days.",
+        "again.md":    "Open 9am to 5pm on weekdays.",
+        "manual.pdf":  "%PDF-1.4",
+        "empty.txt":   "  \n",
+        "binary.txt":  "\x00\x01",
+    })
+    var result struct {
+        FilesUploaded  int                      `json:"files_uploaded"`
+        Sources        []map[string]interface{} `json:"sources"`
+        RejectedFiles  []map[string]interface{} `json:"rejected_files"`
+        DuplicateFiles []map[string]interface{} `json:"duplicate_files"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusCreated {
+        t.Fatalf("file upload = %d %s", w.Code, w.Body)
+    }
+    if result.FilesUploaded != 1 || len(result.RejectedFiles) != 3 || len(result.DuplicateFiles) != 1 {
+        t.Errorf("uploaded %d, rejected %d, duplicates %d; want 1, 3 and 1",
+            result.FilesUploaded, len(result.RejectedFiles), len(result.DuplicateFiles))
+    }
+
+    // Wait for the second refresh: it is the one that adds the returns policy
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        stored := waitForKnowledgeRefresh(t, project.ID)
+        if strings.Contains(stored.PDFContent, "Returns are accepted") {
+            if len(stored.KnowledgeSources) != 2 || !strings.Contains(stored.PDFContent, "Open 9am") {
+                t.Errorf("sources = %d, content = %q; want both documents", len(stored.KnowledgeSources), stored.PDFContent)
+            }
+            for _, source := range stored.KnowledgeSources {
+                if source.Status != models.PDFStatusCompleted || !source.Enabled {
+                    t.Errorf("source %q: status %q, enabled %v; want ready immediately", source.Name, source.Status, source.Enabled)
+                }
+            }
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("uploaded file never reached pdf_content")
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
+
+func TestIngestURLRejectsBadInput(t *testing.T) {
+    route := "/projects/:id/ingest-url"
+    path := "/projects/" + primitive.NewObjectID().Hex() + "/ingest-url"
+    cases := []struct {
+        name string
+        path string
+        body string
+    }{
+        {"invalid project ID", "/projects/nope/ingest-url", `{"url":"https://example.com"}`},
+        {"missing body", path, ``},
+        {"missing url", path, `{}`},
+        {"ftp url", path, `{"url":"ftp://example.com/file.txt"}`},
+        {"javascript url", path, `{"url":"javascript:alert(1)"}`},
+        {"no host", path, `{"url":"https:///faq"}`},
+    }
+    for _, tc := range cases {
+        // Rejected before the project is loaded or anything is fetched
+        if w := serveRoute(http.MethodPost, route, tc.path, IngestURL, tc.body); w.Code != http.StatusBadRequest {
+            t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+        }
+    }
+}
+
+func TestIngestClientRefusesInternalAddresses(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("internal"))
+    }))
+    defer server.Close()
+
+    resp, err := ingestClient.Get(server.URL)
+    if err == nil {
+        resp.Body.Close()
+        t.Fatal("ingestClient fetched a loopback address")
+    }
+    if !strings.Contains(err.Error(), "not allowed") {
+        t.Errorf("err = %v, want the address to be refused", err)
+    }
+
+    // Hostnames can resolve anywhere, so the dialer hook checks every connected address
+    cases := []struct {
+        address string
+        allowed bool
+    }{
+        {"93.184.216.34:443", true},
+        {"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+        {"127.0.0.1:80", false},
+        {"10.0.0.5:80", false},
+        {"192.168.1.1:80", false},
+        {"169.254.169.254:80", false},
+        {"100.64.0.1:80", false},
+        {"100.127.255.254:80", false},
+        {"0.0.0.0:80", false},
+        {"[::1]:80", false},
+        {"[fd00::1]:80", false},
+    }
+    for _, tc := range cases {
+        err := refuseInternalAddress("tcp", tc.address, nil)
+        if tc.allowed && err != nil {
+            t.Errorf("%s: err = %v, want allowed", tc.address, err)
+        }
+        if !tc.allowed && err == nil {
+            t.Errorf("%s: allowed, want refused", tc.address)
+        }
+    }
+}
+
+func TestIngestURL(t *testing.T) {
+    testDatabase(t)
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Acme"}
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+
+    hours := "9am to 5pm"
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/faq":
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.Write([]byte(`<html><head><title>FAQ</title></head><body><nav>Menu</nav><p>Open ` + hours + `.</p></body></html>`))
+        case "/notes.txt":
+            w.Header().Set("Content-Type", "text/plain")
+            w.Write([]byte("Returns within 30 days."))
+        case "/logo.png":
+            w.Header().Set("Content-Type", "image/png")
+            w.Write([]byte("\x89PNG"))
+        case "/blank":
+            w.Header().Set("Content-Type", "text/html")
+            w.Write([]byte(`<html><body><script>x()</script></body></html>`))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+    // The real client refuses loopback addresses like the test server's
+    previous := ingestClient
+    ingestClient = server.Client()
+    t.Cleanup(func() { ingestClient = previous })
+
+    route := "/projects/:id/ingest-url"
+    path := "/projects/" + project.ID.Hex() + "/ingest-url"
+    ingest := func(page string) *httptest.ResponseRecorder {
+        return serveRoute(http.MethodPost, route, path, IngestURL, `{"url":"`+server.URL+page+`"}`)
+    }
+
+    for _, tc := range []struct {
+        page string
+        want int
+    }{
+        {"/missing", http.StatusBadGateway},
+        {"/logo.png", http.StatusUnsupportedMediaType},
+        {"/blank", http.StatusUnprocessableEntity},
+    } {
+        if w := ingest(tc.page); w.Code != tc.want {
+            t.Errorf("%s: status = %d, want %d", tc.page, w.Code, tc.want)
+        }
+    }
+    missing := "/projects/" + primitive.NewObjectID().Hex() + "/ingest-url"
+    if w := serveRoute(http.MethodPost, route, missing, IngestURL, `{"url":"`+server.URL+`/faq"}`); w.Code != http.StatusNotFound {
+        t.Errorf("unknown project: status = %d, want 404", w.Code)
+    }
+
+    var result struct {
+        Refreshed bool                   `json:"refreshed"`
+        Source    map[string]interface{} `json:"source"`
+    }
+    w := ingest("/faq")
+    if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusCreated {
+        t.Fatalf("first ingest = %d %s", w.Code, w.Body)
+    }
+    if result.Refreshed || result.Source["name"] != "FAQ" {
+        t.Errorf("first ingest = %+v, want a new source named after the page title", result)
+    }
+    waitForKnowledgeRefresh(t, project.ID)
+
+    hours = "8am to 6pm"
+    w = ingest("/faq")
+    if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK || !result.Refreshed {
+        t.Fatalf("second ingest = %d %s, want the source refreshed", w.Code, w.Body)
+    }
+    if w := ingest("/notes.txt"); w.Code != http.StatusCreated {
+        t.Fatalf("text ingest = %d %s", w.Code, w.Body)
+    }
+
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        stored := waitForKnowledgeRefresh(t, project.ID)
+        if strings.Contains(stored.PDFContent, "Returns within 30 days.") && strings.Contains(stored.PDFContent, "8am to 6pm") {
+            if len(stored.KnowledgeSources) != 2 || strings.Contains(stored.PDFContent, "9am") || strings.Contains(stored.PDFContent, "Menu") {
+                t.Errorf("sources = %d, content = %q; want the refreshed page and the notes only", len(stored.KnowledgeSources), stored.PDFContent)
+            }
+            for _, source := range stored.KnowledgeSources {
+                if source.Type != models.KnowledgeSourceURL || !strings.HasPrefix(source.Origin, server.URL) {
+                    t.Errorf("source %q: type %q, origin %q; want a url source", source.Name, source.Type, source.Origin)
+                }
+            }
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("ingested pages never reached pdf_content")
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+}
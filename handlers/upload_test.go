@@ -0,0 +1,112 @@
+package handlers
+
+import (
+    "bytes"
+    "context"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+// uploadedFile builds the file header gin hands to upload handlers for content
+func uploadedFile(t *testing.T, name string, content []byte) *multipart.FileHeader {
+    t.Helper()
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    part, err := writer.CreateFormFile("files", name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    part.Write(content)
+    writer.Close()
+
+    req := httptest.NewRequest(http.MethodPost, "/", &body)
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    if err := req.ParseMultipartForm(1 << 20); err != nil {
+        t.Fatal(err)
+    }
+    return req.MultipartForm.File["files"][0]
+}
+
+func TestValidateFileType(t *testing.T) {
+    cases := []struct {
+        name    string
+        content []byte
+        valid   bool
+    }{
+        {"manual.pdf", []byte("%PDF-1.4\n..."), true},
+        {"MANUAL.PDF", []byte("%PDF-1.7\n..."), true},
+        {"renamed.pdf", []byte("MZ\x90\x00 executable"), false},
+        {"notes.txt", []byte("Opening hours are 9am to 5pm."), true},
+        {"binary.txt", []byte{0x00, 0x01, 0x02, 0xff, 0xfe}, false},
+        {"report.docx", []byte("PK\x03\x04rest"), true},
+        {"report.docx", []byte("%PDF-1.4"), false},
+        {"legacy.doc", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1rest"), true},
+        {"script.exe", []byte("MZ"), false},
+        {"empty.pdf", nil, false},
+    }
+    for _, tc := range cases {
+        err := validateFileType(uploadedFile(t, tc.name, tc.content))
+        if (err == nil) != tc.valid {
+            t.Errorf("%s (%q): err = %v, want valid = %v", tc.name, tc.content, err, tc.valid)
+        }
+    }
+}
+
+func TestUploadPDFRejectsOversizeFiles(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    testDatabase(t)
+    limit := config.MaxPDFSize
+    config.MaxPDFSize = 16
+    t.Cleanup(func() { config.MaxPDFSize = limit })
+
+    project := models.Project{ID: primitive.NewObjectID(), Name: "Uploads"}
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    part, _ := writer.CreateFormFile("pdfs", "big.pdf")
+    part.Write([]byte("%PDF-1.4 more than sixteen bytes"))
+    writer.Close()
+
+    router := gin.New()
+    router.POST("/projects/:id/upload-pdf", UploadPDF)
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodPost, "/projects/"+project.ID.Hex()+"/upload-pdf", &body)
+    req.Header.Set("Content-Type", writer.FormDataContentType())
+    router.ServeHTTP(w, req)
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("status = %d, want 413", w.Code)
+    }
+}
+
+func TestHashUploadedFile(t *testing.T) {
+    first, err := hashUploadedFile(uploadedFile(t, "manual.pdf", []byte("%PDF-1.4 same bytes")))
+    if err != nil {
+        t.Fatalf("hashUploadedFile: %v", err)
+    }
+    renamed, err := hashUploadedFile(uploadedFile(t, "manual-copy.pdf", []byte("%PDF-1.4 same bytes")))
+    if err != nil {
+        t.Fatalf("hashUploadedFile: %v", err)
+    }
+    if first != renamed {
+        t.Error("the same content under another name must hash the same")
+    }
+    if len(first) != 64 {
+        t.Errorf("hash = %q, want hex SHA-256", first)
+    }
+
+    changed, _ := hashUploadedFile(uploadedFile(t, "manual.pdf", []byte("%PDF-1.4 other bytes")))
+    if changed == first {
+        t.Error("different content must not hash the same")
+    }
+}
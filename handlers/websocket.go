@@ -0,0 +1,337 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "html"
+    "log"
+    "math"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "jevi-chat/config"
+    "jevi-chat/middleware"
+    "jevi-chat/models"
+)
+
+// WebSocket connection settings
+const (
+    wsWriteWait    = 10 * time.Second
+    wsPongWait     = 60 * time.Second
+    wsPingPeriod   = wsPongWait * 9 / 10 // must be shorter than wsPongWait
+    wsMaxFrameSize = 16 * 1024
+)
+
+// wsClientFrame is a frame sent by the widget: "message" carries a chat message,
+// "typing" tells the server the user is typing (currently only acknowledged)
+type wsClientFrame struct {
+    Type      string `json:"type"`
+    Message   string `json:"message,omitempty"`
+    SessionID string `json:"session_id,omitempty"`
+}
+
+// wsConn serializes writes, since a WebSocket allows only one writer at a time
+type wsConn struct {
+    conn *websocket.Conn
+    mu   sync.Mutex
+}
+
+func (w *wsConn) send(frame gin.H) error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+    return w.conn.WriteJSON(frame)
+}
+
+func (w *wsConn) ping() error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+}
+
+// ChatWebSocket - Bidirectional chat channel for the widget. The widget user's token
+// (token query parameter or Bearer header) is required. Each message frame is rate
+// limited and checked against the project's status and usage limits like
+// IframeSendMessage, then answered with progress frames ("thinking",
+// "searching_knowledge_base", "typing") followed by a "response" frame.
+func ChatWebSocket(c *gin.Context) {
+    projectID := c.Param("projectId")
+    objID, err := primitive.ObjectIDFromHex(projectID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+        return
+    }
+
+    userID, err := validateUserToken(chatUserTokenFromRequest(c), projectID)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Valid chat token required"})
+        return
+    }
+
+    project, err := loadChatProject(c.Request.Context(), objID)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+        return
+    }
+    if !project.IsActive || project.Status == models.ProjectStatusExpired {
+        c.JSON(http.StatusForbidden, gin.H{"error": "This chat is currently unavailable"})
+        return
+    }
+
+    var user models.ChatUser
+    userObjID, _ := primitive.ObjectIDFromHex(userID)
+    ctx, cancel := requestContext(c)
+    config.DB.Collection("chat_users").FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+    cancel()
+
+    upgrader := websocket.Upgrader{
+        ReadBufferSize:  4096,
+        WriteBufferSize: 4096,
+        // Same rule as the HTTP widget endpoints: only the project's embedding sites
+        CheckOrigin: func(r *http.Request) bool {
+            return embedOriginAllowed(c, project.AllowedDomains)
+        },
+    }
+    conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+    if err != nil {
+        // Upgrade has already written the error response
+        log.Printf("WebSocket upgrade failed for project %s: %v", projectID, err)
+        return
+    }
+    ws := &wsConn{conn: conn}
+    defer conn.Close()
+
+    conn.SetReadLimit(wsMaxFrameSize)
+    conn.SetReadDeadline(time.Now().Add(wsPongWait))
+    conn.SetPongHandler(func(string) error {
+        return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+    })
+
+    // Keep the connection alive until the read loop exits
+    done := make(chan struct{})
+    defer close(done)
+    go func() {
+        ticker := time.NewTicker(wsPingPeriod)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-ticker.C:
+                if err := ws.ping(); err != nil {
+                    return
+                }
+            }
+        }
+    }()
+
+    clientIP := c.ClientIP()
+    for {
+        var frame wsClientFrame
+        if err := conn.ReadJSON(&frame); err != nil {
+            if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+                log.Printf("WebSocket for project %s closed unexpectedly: %v", projectID, err)
+            }
+            return
+        }
+
+        switch frame.Type {
+        case chatEventTyping:
+            continue
+        case "message":
+            if err := handleWebSocketMessage(ws, objID, frame, clientIP, user); err != nil {
+                return
+            }
+            // Pongs aren't read while a reply is generated, so restart the deadline
+            conn.SetReadDeadline(time.Now().Add(wsPongWait))
+        default:
+            if err := ws.send(gin.H{"type": "error", "error": "Unknown frame type", "status": "invalid_frame"}); err != nil {
+                return
+            }
+        }
+    }
+}
+
+// handleWebSocketMessage - Run one message frame through the widget pipeline and push the
+// reply. Returns an error only when the connection can no longer be written to.
+func handleWebSocketMessage(ws *wsConn, projectID primitive.ObjectID, frame wsClientFrame, clientIP string, user models.ChatUser) error {
+    startTime := time.Now()
+    defer observeChatLatency("websocket", startTime)
+
+    sendError := func(status, message string, extra gin.H) error {
+        reply := gin.H{"type": "error", "error": message, "status": status}
+        for key, value := range extra {
+            reply[key] = value
+        }
+        return ws.send(reply)
+    }
+
+    trimmed := trimMessageInput(frame.Message)
+    if trimmed == "" {
+        return sendError("empty_message", "Message cannot be empty", nil)
+    }
+    if length, maxLength := utf8.RuneCountInString(trimmed), maxMessageLength(); length > maxLength {
+        return sendError("message_too_long", fmt.Sprintf("Message must be at most %d characters", maxLength),
+            gin.H{"length": length, "max_length": maxLength})
+    }
+    message := html.EscapeString(trimmed)
+
+    ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+    project, err := loadChatProject(ctx, projectID)
+    cancel()
+    if err != nil {
+        return sendError("project_not_found", "Project not found", nil)
+    }
+    // The connection can outlive a subscription, so check it on every message
+    if !project.IsActive || project.Status == models.ProjectStatusExpired {
+        return sendError("project_unavailable", "This chat is currently unavailable", nil)
+    }
+    message, blocked := moderateMessage(project, message)
+    if blocked {
+        return sendError("message_blocked", moderationRejectedMessage, nil)
+    }
+    if !project.GeminiEnabled {
+        return sendError("gemini_disabled", "AI responses are currently disabled for this project", nil)
+    }
+
+    allowed, retryAfter := middleware.AllowProjectMessage(context.Background(), projectID.Hex(), clientIP, project.RateLimitPerMinute)
+    if !allowed {
+        return sendError("rate_limited", "Too many messages. Please try again later.",
+            gin.H{"retry_after": int(math.Ceil(retryAfter.Seconds()))})
+    }
+
+    if frame.SessionID, err = ensureSessionID(frame.SessionID); err != nil {
+        return sendError("server_error", "Failed to start chat session", nil)
+    }
+
+    ctx, cancel = context.WithTimeout(context.Background(), config.DBTimeout)
+    sessionFull := sessionAtMessageLimit(ctx, project, frame.SessionID)
+    cancel()
+    if sessionFull {
+        return ws.send(gin.H{
+            "type":                 "response",
+            "status":               "session_limit_reached",
+            "response":             sessionLimitMessage,
+            "session_id":           frame.SessionID,
+            "max_session_messages": project.MaxSessionMessages,
+        })
+    }
+
+    // Progress events precede the response so the widget can show what is happening;
+    // a failed write surfaces on the final send
+    progress := func(event string) {
+        ws.send(gin.H{"type": event})
+    }
+    if err := ws.send(gin.H{"type": chatEventThinking}); err != nil {
+        return err
+    }
+    applyResponseDelay(project)
+
+    var response string
+    var inputTokens, outputTokens int
+    success, blocked, knowledgeNotReady, repeated := true, false, false, false
+    if isFirstMessage(projectID, frame.SessionID) {
+        progress(chatEventTyping)
+        response = project.WelcomeMessage
+    } else if reply, notReady := knowledgeNotReadyReply(project); notReady {
+        progress(chatEventTyping)
+        response, knowledgeNotReady = reply, true
+    } else if reply, isRepeat := repeatedMessageReply(projectID, frame.SessionID, message); isRepeat {
+        progress(chatEventTyping)
+        response, repeated = reply, true
+    } else if project.GeminiAPIKey != "" {
+        ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+        reservedCost := reservedGeminiCost(project.GeminiModel)
+        reserved, err := reserveGeminiUsage(ctx, projectID, reservedCost)
+        cancel()
+        if err == mongo.ErrNoDocuments {
+            return sendError("limit_exceeded", "AI usage limit reached for this project", gin.H{
+                "usage_info": gin.H{
+                    "daily_usage":   reserved.GeminiUsageToday,
+                    "daily_limit":   reserved.GeminiDailyLimit,
+                    "monthly_usage": reserved.GeminiUsageMonth,
+                    "monthly_limit": reserved.GeminiMonthlyLimit,
+                },
+            })
+        } else if err != nil {
+            return sendError("server_error", "Failed to check usage limits", nil)
+        }
+        project.GeminiUsageToday = reserved.GeminiUsageToday - 1
+        project.GeminiUsageMonth = reserved.GeminiUsageMonth - 1
+
+        response, inputTokens, outputTokens, err = generateGeminiResponseWithTracking(project, message, clientIP, user, progress)
+        if err != nil {
+            go releaseGeminiUsage(projectID, reservedCost)
+            success = false
+            blocked = isBlockedBySafety(err)
+            response = "I'm having trouble answering just now. Please try again later."
+            if blocked {
+                response = blockedReply(err)
+            }
+        }
+        go trackGeminiUsage(projectID, message, response, getGeminiModel(project.GeminiModel),
+            inputTokens, outputTokens, time.Since(startTime).Milliseconds(), clientIP, err, reservedCost)
+    } else {
+        success = false
+        response = "AI configuration is incomplete. Please contact support."
+    }
+
+    status := models.ChatReplySuccess
+    if knowledgeNotReady {
+        status = "knowledge_base_not_ready"
+    } else if repeated {
+        status = "repeated_message"
+    } else if blocked {
+        status = "content_blocked"
+    } else if !success {
+        status = "error"
+    }
+    saveMessage(projectID, message, response, frame.SessionID, clientIP, status, user)
+
+    usageInfo := gin.H{
+        "daily_usage":     project.GeminiUsageToday + 1,
+        "daily_limit":     project.GeminiDailyLimit,
+        "daily_remaining": project.GeminiDailyLimit - project.GeminiUsageToday - 1,
+        "monthly_usage":   project.GeminiUsageMonth + 1,
+        "monthly_limit":   project.GeminiMonthlyLimit,
+        "response_time":   time.Since(startTime).Milliseconds(),
+        "tokens_used":     inputTokens + outputTokens,
+    }
+    addUsageOutlook(usageInfo, project, inputTokens+outputTokens, time.Now())
+
+    return ws.send(gin.H{
+        "type":       "response",
+        "status":     status,
+        "response":   response,
+        "session_id": frame.SessionID,
+        "timestamp":  time.Now().Format(time.RFC3339),
+        "user_name":  user.Name,
+        "usage_info": usageInfo,
+    })
+}
+
+// chatUserTokenFromRequest - The widget user's token from the token query parameter or a Bearer header
+func chatUserTokenFromRequest(c *gin.Context) string {
+    if token := c.Query("token"); token != "" {
+        return token
+    }
+    return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// loadChatProject - Fetch a project for answering chat messages
+func loadChatProject(ctx context.Context, projectID primitive.ObjectID) (models.Project, error) {
+    var project models.Project
+    err := config.DB.Collection("projects").FindOne(ctx, bson.M{"_id": projectID}).Decode(&project)
+    if err != nil {
+        return project, fmt.Errorf("loading project %s: %w", projectID.Hex(), err)
+    }
+    return project, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+    "jevi-chat/models"
+)
+
+func TestChatWebSocketRejectsBeforeUpgrade(t *testing.T) {
+    t.Setenv("JWT_SECRET", "test-secret")
+    route := "/ws/chat/:projectId"
+
+    if w := serveRoute(http.MethodGet, route, "/ws/chat/bad", ChatWebSocket, ""); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project ID: status = %d, want 400", w.Code)
+    }
+
+    projectID := primitive.NewObjectID().Hex()
+    if w := serveRoute(http.MethodGet, route, "/ws/chat/"+projectID, ChatWebSocket, ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("missing token: status = %d, want 401", w.Code)
+    }
+    otherProject := generateUserToken(primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex())
+    if w := serveRoute(http.MethodGet, route, "/ws/chat/"+projectID+"?token="+otherProject, ChatWebSocket, ""); w.Code != http.StatusUnauthorized {
+        t.Errorf("token for another project: status = %d, want 401", w.Code)
+    }
+}
+
+func TestChatUserTokenFromRequest(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodGet, "/?token=from-query", nil)
+    c.Request.Header.Set("Authorization", "Bearer from-header")
+    if got := chatUserTokenFromRequest(c); got != "from-query" {
+        t.Errorf("token = %q, want the query parameter to win", got)
+    }
+
+    c, _ = gin.CreateTestContext(httptest.NewRecorder())
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+    c.Request.Header.Set("Authorization", "Bearer from-header")
+    if got := chatUserTokenFromRequest(c); got != "from-header" {
+        t.Errorf("token = %q, want the Bearer token", got)
+    }
+}
+
+// dialChat opens a widget WebSocket for a new project inserted into the test database
+func dialChat(t *testing.T, project models.Project) *websocket.Conn {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    t.Setenv("JWT_SECRET", "test-secret")
+
+    project.ID = primitive.NewObjectID()
+    if _, err := config.DB.Collection("projects").InsertOne(context.Background(), project); err != nil {
+        t.Fatal(err)
+    }
+
+    router := gin.New()
+    router.GET("/ws/chat/:projectId", ChatWebSocket)
+    server := httptest.NewServer(router)
+    t.Cleanup(server.Close)
+
+    token := generateUserToken(primitive.NewObjectID().Hex(), project.ID.Hex())
+    url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/chat/" + project.ID.Hex() + "?token=" + token
+    conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    t.Cleanup(func() { conn.Close() })
+    return conn
+}
+
+// exchange sends a frame and returns the next frame the server pushes
+func exchange(t *testing.T, conn *websocket.Conn, frame wsClientFrame) map[string]interface{} {
+    t.Helper()
+    if err := conn.WriteJSON(frame); err != nil {
+        t.Fatalf("write: %v", err)
+    }
+    return readFrame(t, conn)
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+    t.Helper()
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    var reply map[string]interface{}
+    if err := conn.ReadJSON(&reply); err != nil {
+        t.Fatalf("read: %v", err)
+    }
+    return reply
+}
+
+func TestChatWebSocketFrames(t *testing.T) {
+    testDatabase(t)
+    conn := dialChat(t, models.Project{Name: "Socket", IsActive: true, GeminiEnabled: false})
+
+    // Typing frames are acknowledged silently, so the next reply belongs to the unknown frame
+    if err := conn.WriteJSON(wsClientFrame{Type: "typing"}); err != nil {
+        t.Fatal(err)
+    }
+    if reply := exchange(t, conn, wsClientFrame{Type: "shout"}); reply["status"] != "invalid_frame" {
+        t.Errorf("unknown frame reply = %v, want invalid_frame", reply)
+    }
+    if reply := exchange(t, conn, wsClientFrame{Type: "message", Message: "  "}); reply["status"] != "empty_message" {
+        t.Errorf("blank message reply = %v, want empty_message", reply)
+    }
+    if reply := exchange(t, conn, wsClientFrame{Type: "message", Message: "hello"}); reply["status"] != "gemini_disabled" {
+        t.Errorf("message reply = %v, want gemini_disabled", reply)
+    }
+}
+
+func TestChatWebSocketProgressPrecedesResponse(t *testing.T) {
+    testDatabase(t)
+    conn := dialChat(t, models.Project{
+        Name:           "Socket",
+        IsActive:       true,
+        GeminiEnabled:  true,
+        WelcomeMessage: "Hi! How can I help?",
+    })
+
+    // The first message of a session is answered with the welcome message
+    if err := conn.WriteJSON(wsClientFrame{Type: "message", Message: "hello", SessionID: "progress-session"}); err != nil {
+        t.Fatal(err)
+    }
+    var events []string
+    for {
+        frame := readFrame(t, conn)
+        events = append(events, frame["type"].(string))
+        if frame["type"] == "response" {
+            if frame["response"] != "Hi! How can I help?" {
+                t.Errorf("response = %v, want the welcome message", frame["response"])
+            }
+            break
+        }
+        if len(events) > 5 {
+            t.Fatalf("no response after %v", events)
+        }
+    }
+    if got := strings.Join(events, ","); got != "thinking,typing,response" {
+        t.Errorf("events = %s, want thinking,typing,response", got)
+    }
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+    "context"
     "log"
     "net/http"
     "os"
+    "os/signal"
+    "sync"
+    "syscall"
     "time"
 
-    "github.com/gin-contrib/cors"
     "github.com/gin-gonic/gin"
     "github.com/joho/godotenv"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
     "jevi-chat/config"
     "jevi-chat/handlers"
     "jevi-chat/middleware"
@@ -23,34 +27,62 @@ func main() {
     // Initialize database and Gemini
     config.InitMongoDB()
     config.InitGemini()
+    config.EnsurePDFFileDefaults()
+    config.MigrateKnowledgeSources()
+    config.EncryptExistingAPIKeys()
+    config.InitEmail()
+    config.InitUploadLimits()
+    config.InitDataRetention()
+    config.InitTokenGrace()
+    config.InitKnowledgeLimits()
+    config.InitJWT()
+    config.InitRepeatDetection()
+    if err := config.LoadGeminiPricing(); err != nil {
+        log.Printf("Warning: using built-in Gemini pricing: %v", err)
+    }
+    middleware.InitRateLimiter()
+
+    // Background maintenance (usage rollover, subscription expiry, data retention) and usage notifications,
+    // stopped through ctx on shutdown
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    maintenanceInterval := envDuration("MAINTENANCE_INTERVAL", time.Hour)
+    notificationInterval := envDuration("NOTIFICATION_INTERVAL", 15*time.Minute)
+
+    var workers sync.WaitGroup
+    workers.Add(2)
+    go func() {
+        defer workers.Done()
+        runMaintenance(ctx, maintenanceInterval)
+    }()
+    go func() {
+        defer workers.Done()
+        runNotificationChecks(ctx, notificationInterval)
+    }()
 
     // Setup router
     r := gin.Default()
+    r.MaxMultipartMemory = config.MaxTotalUpload
+
+    // Client IPs come from X-Forwarded-For/X-Real-IP only via TRUSTED_PROXIES
+    middleware.ConfigureTrustedProxies(r)
 
     // Load templates and static files
     r.LoadHTMLGlob("templates/**/*")
     r.Static("/static", "./static")
+    r.Use(middleware.MetricsMiddleware())
+
+    // CORS: default origins plus CORS_ALLOWED_ORIGINS
+    r.Use(middleware.CORSMiddleware())
 
-    // CORS middleware (fixes your error)
-    corsConfig := cors.Config{
-        AllowOrigins: []string{
-            "http://localhost:8080",
-            "http://localhost:3000",
-            "http://127.0.0.1:3000",
-            "http://localhost:3001",
-            "http://127.0.0.1:3001",
-            "https://155b-150-107-16-191.ngrok-free.app",
-                "http://localhost:3000",   // CRA dev server
-        "http://localhost:8081",   // if you proxy
-            
-        },
-        AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH", "HEAD"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-CSRF-Token", "Cache-Control"},
-        ExposeHeaders:    []string{"Content-Length", "Content-Type"},
-        AllowCredentials: true,
-        MaxAge:           12 * time.Hour,
-    }
-    r.Use(cors.New(corsConfig))
+    // Cap request bodies; the upload routes check their files against the upload limits instead
+    r.Use(middleware.BodySizeLimit(config.MaxRequestBody,
+        "/admin/projects/:id/upload-pdf",
+        "/admin/projects/:id/upload-text",
+        "/user/project/:id/upload",
+        "/user/project/:id/upload-text",
+    ))
 
     // Add iframe-specific headers (optional, if needed)
     r.Use(func(c *gin.Context) {
@@ -65,8 +97,11 @@ func main() {
 
     // Embed routes
     r.GET("/embed/:projectId", handlers.EmbedChat)
-    r.POST("/embed/:projectId/auth", handlers.EmbedAuth)
+    r.POST("/embed/:projectId/auth", middleware.RateLimitMiddleware("auth"), handlers.EmbedAuth)
     r.GET("/embed/:projectId/chat", handlers.IframeChatInterface)
+    r.GET("/embed/:projectId/config", handlers.GetWidgetConfig)
+    r.GET("/embed/:projectId/verify", handlers.VerifyChatUser)
+    r.POST("/embed/:projectId/verify/resend", middleware.RateLimitMiddleware("auth"), handlers.ResendChatVerification)
 
     // Widget API
     r.GET("/widget.js", func(c *gin.Context) {
@@ -81,7 +116,8 @@ func main() {
         port = "https://troikabackend.onrender.com"
     }
 
-    log.Printf("🚀 Jevi Chat Server starting on port %s", port)
+    build := config.GetBuildInfo()
+    log.Printf("🚀 Jevi Chat Server %s (%s, built %s) starting on port %s", build.Version, build.GitCommit, build.BuildTime, port)
     log.Printf("✅ CORS configured for React frontend")
     log.Printf("🌐 Frontend URL: http://localhost:3000")
     log.Printf("🔗 Backend URL: http://localhost:%s", port)
@@ -89,21 +125,136 @@ func main() {
     log.Printf("🤖 Embed URL: http://localhost:%s/embed/PROJECT_ID", port)
     log.Printf("📱 Widget Script: http://localhost:%s/widget.js", port)
 
-    log.Fatal(http.ListenAndServe(":"+port, r))
+    server := &http.Server{
+        Addr:    ":" + port,
+        Handler: r,
+    }
+
+    go func() {
+        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Fatalf("Server failed: %v", err)
+        }
+    }()
+
+    // Prometheus scrapes METRICS_ADDR (e.g. "127.0.0.1:9090"), which should not be reachable publicly
+    var metricsServer *http.Server
+    if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+        metricsMux := http.NewServeMux()
+        metricsMux.Handle("/metrics", promhttp.Handler())
+        metricsServer = &http.Server{Addr: addr, Handler: metricsMux}
+        log.Printf("📈 Metrics: http://%s/metrics", addr)
+        go func() {
+            if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+                log.Printf("Metrics server failed: %v", err)
+            }
+        }()
+    }
+
+    // Wait for SIGINT/SIGTERM, then drain in-flight requests before releasing resources
+    servers := []shutdowner{server}
+    if metricsServer != nil {
+        servers = append(servers, metricsServer)
+    }
+    shutdownGracefully(ctx, stop, 30*time.Second, servers, &workers, config.CloseGemini, config.CloseMongoDB)
+    log.Println("Server stopped")
+}
+
+// shutdowner is a server that can drain in-flight requests and stop, like *http.Server
+type shutdowner interface {
+    Shutdown(ctx context.Context) error
+}
+
+// shutdownGracefully waits for ctx to be cancelled, stops listening for signals, gives
+// the servers up to timeout to drain in-flight requests, waits for the background
+// workers to finish and then runs closers in order to release shared resources
+func shutdownGracefully(ctx context.Context, stop context.CancelFunc, timeout time.Duration, servers []shutdowner, workers *sync.WaitGroup, closers ...func()) {
+    <-ctx.Done()
+    stop()
+    log.Println("Shutting down server...")
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    for _, server := range servers {
+        if err := server.Shutdown(shutdownCtx); err != nil {
+            log.Printf("Server shutdown did not complete cleanly: %v", err)
+        }
+    }
+
+    workers.Wait()
+    for _, closer := range closers {
+        closer()
+    }
+}
+
+// envDuration reads a duration such as "30m" from the environment, using fallback
+// when the variable is unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+    value := os.Getenv(name)
+    if value == "" {
+        return fallback
+    }
+    interval, err := time.ParseDuration(value)
+    if err != nil || interval <= 0 {
+        log.Printf("Invalid %s %q, using %s", name, value, fallback)
+        return fallback
+    }
+    return interval
+}
+
+// runMaintenance performs periodic housekeeping, once at startup and then every
+// interval (MAINTENANCE_INTERVAL, default hourly), until ctx is canceled
+func runMaintenance(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if err := config.ResetDailyMonthlyUsage(); err != nil {
+            log.Printf("Maintenance: failed to reset usage counters: %v", err)
+        }
+        if err := config.ExpireProjects(); err != nil {
+            log.Printf("Maintenance: failed to expire projects: %v", err)
+        }
+        if err := config.NotifyExpiringProjects(); err != nil {
+            log.Printf("Maintenance: failed to send expiry warnings: %v", err)
+        }
+        if err := config.CleanupExpiredData(time.Now()); err != nil {
+            log.Printf("Maintenance: failed to remove expired data: %v", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// runNotificationChecks raises usage threshold notifications every interval
+// (NOTIFICATION_INTERVAL, default 15 minutes) until ctx is canceled
+func runNotificationChecks(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if err := config.CheckUsageNotifications(); err != nil {
+                log.Printf("Notification check failed: %v", err)
+            }
+        }
+    }
 }
 
 func setupRoutes(r *gin.Engine) {
     // Health check
-    r.GET("/health", func(c *gin.Context) {
-        c.JSON(http.StatusOK, gin.H{
-            "status":    "healthy",
-            "service":   "jevi-chat",
-            "version":   "1.0.0",
-            "cors":      "enabled",
-            "iframe":    "enabled",
-            "timestamp": time.Now().Format(time.RFC3339),
-        })
-    })
+    r.GET("/health", handlers.HealthCheck)
+
+    // Metrics are for admins only, unless they are served on the internal METRICS_ADDR listener
+    if os.Getenv("METRICS_ADDR") == "" {
+        r.GET("/metrics", middleware.AdminAuth(), handlers.Metrics)
+    }
 
     // CORS test endpoint
     r.GET("/cors-test", func(c *gin.Context) {
@@ -118,27 +269,39 @@ func setupRoutes(r *gin.Engine) {
     // Public routes
     r.GET("/", handlers.Home)
     r.GET("/login", handlers.LoginPage)
-    r.POST("/login", handlers.Login)
+    r.POST("/login", middleware.RateLimitMiddleware("auth"), handlers.Login)
     r.GET("/logout", handlers.Logout)
     r.GET("/register", handlers.RegisterPage)
-    r.POST("/register", handlers.Register)
+    r.POST("/register", middleware.RateLimitMiddleware("auth"), handlers.Register)
 
     // API routes for React frontend
     api := r.Group("/api")
+    api.Use(middleware.RateLimitMiddleware("general"))
     {
-        api.POST("/login", handlers.Login)
-        api.POST("/register", handlers.Register)
+        api.GET("/version", handlers.GetVersion)
+        api.POST("/login", middleware.RateLimitMiddleware("auth"), handlers.Login)
+        api.POST("/register", middleware.RateLimitMiddleware("auth"), handlers.Register)
         api.POST("/logout", handlers.Logout)
-        api.GET("/admin/dashboard", handlers.AdminDashboard)
-        api.GET("/admin/projects", handlers.AdminProjects)
-        api.POST("/admin/projects", handlers.CreateProject)
-        api.GET("/admin/users", handlers.AdminUsers)
-        api.DELETE("/admin/users/:id", handlers.DeleteUser)
-        api.GET("/project/:id", handlers.ProjectDetails)
-        api.PUT("/project/:id", handlers.UpdateProject)
-        api.DELETE("/project/:id", handlers.DeleteProject)
-        api.GET("/admin/notifications", handlers.GetNotifications)
-        api.GET("/admin/realtime-stats", handlers.GetRealtimeStats)
+        api.POST("/refresh", middleware.RateLimitMiddleware("auth"), handlers.RefreshAccessToken)
+        api.POST("/forgot-password", middleware.RateLimitMiddleware("auth"), handlers.ForgotPassword)
+        api.POST("/reset-password", middleware.RateLimitMiddleware("auth"), handlers.ResetPassword)
+    }
+
+    // Admin API for the React frontend, guarded like /admin
+    apiAdmin := api.Group("")
+    apiAdmin.Use(middleware.AdminAuth())
+    apiAdmin.Use(middleware.CSRFProtection())
+    {
+        apiAdmin.GET("/admin/dashboard", handlers.AdminDashboard)
+        apiAdmin.GET("/admin/projects", handlers.AdminProjects)
+        apiAdmin.POST("/admin/projects", handlers.CreateProject)
+        apiAdmin.GET("/admin/users", handlers.AdminUsers)
+        apiAdmin.DELETE("/admin/users/:id", handlers.DeleteUser)
+        apiAdmin.GET("/project/:id", handlers.ProjectDetails)
+        apiAdmin.PUT("/project/:id", handlers.UpdateProject)
+        apiAdmin.DELETE("/project/:id", handlers.DeleteProject)
+        apiAdmin.GET("/admin/notifications", handlers.GetNotifications)
+        apiAdmin.GET("/admin/realtime-stats", handlers.GetRealtimeStats)
     }
 
     // Admin routes
@@ -150,26 +313,65 @@ func setupRoutes(r *gin.Engine) {
         }
         middleware.AdminAuth()(c)
     })
+    admin.Use(middleware.CSRFProtection())
     {
         admin.GET("/", handlers.AdminDashboard)
         admin.GET("/dashboard", handlers.AdminDashboard)
+        admin.GET("/analytics/usage", handlers.GetUsageAnalytics)
+        admin.GET("/notifications", handlers.GetNotifications)
+        admin.POST("/notifications/read-all", handlers.MarkAllNotificationsRead)
+        admin.POST("/notifications/:id/read", handlers.MarkNotificationRead)
         admin.GET("/projects", handlers.AdminProjects)
         admin.POST("/projects", handlers.CreateProject)
+        admin.POST("/projects/import", handlers.ImportProjects)
+        admin.POST("/projects/bulk", handlers.BulkProjectAction)
         admin.GET("/projects/:id", handlers.ProjectDetails)
+        admin.GET("/projects/:id/overview", handlers.GetProjectOverview)
         admin.PUT("/projects/:id", handlers.UpdateProject)
         admin.DELETE("/projects/:id", handlers.DeleteProject)
+        admin.POST("/projects/:id/restore", handlers.RestoreProject)
+        admin.POST("/projects/:id/clone", handlers.CloneProject)
+        admin.DELETE("/projects/:id/purge", handlers.PurgeProject)
+        admin.GET("/plans", handlers.GetPlans)
         admin.GET("/users", handlers.AdminUsers)
+        admin.GET("/users/:id", handlers.GetUserDetails)
+        admin.PUT("/users/:id", handlers.UpdateUser)
+        admin.PATCH("/users/:id/status", handlers.ToggleUserStatus)
         admin.DELETE("/users/:id", handlers.DeleteUser)
 
         // Gemini Management
         admin.PATCH("/projects/:id/gemini/toggle", handlers.ToggleGeminiStatus)
         admin.PATCH("/projects/:id/gemini/limit", handlers.SetGeminiLimit)
+        admin.PATCH("/projects/:id/plan", handlers.SetProjectPlan)
+        admin.PUT("/projects/:id/gemini/key", handlers.RotateGeminiKey)
+        admin.PUT("/projects/:id/gemini/safety", handlers.SetSafetySettings)
         admin.POST("/projects/:id/gemini/reset", handlers.ResetGeminiUsage)
         admin.GET("/projects/:id/gemini/analytics", handlers.GetGeminiAnalytics)
+        admin.GET("/projects/:id/gemini/failures", handlers.GetGeminiFailures)
+        admin.POST("/projects/:id/gemini/failures/:logId/replay", handlers.ReplayGeminiFailure)
+        admin.GET("/projects/:id/ratings", handlers.GetRatingAnalytics)
+        admin.GET("/projects/:id/sessions", handlers.GetProjectSessions)
+        admin.GET("/projects/:id/export", handlers.ExportChatMessages)
+        admin.GET("/projects/:id/messages/search", handlers.SearchMessages)
+        admin.PUT("/projects/:id/prompt", handlers.SetSystemPrompt)
+        admin.PATCH("/projects/:id/response-delay", handlers.SetResponseDelay)
+        admin.GET("/projects/:id/embed-snippet", handlers.GetEmbedSnippet)
+        admin.PUT("/projects/:id/notifications/settings", handlers.SetNotificationSettings)
+        admin.PUT("/projects/:id/moderation", handlers.SetModerationSettings)
+        admin.PUT("/projects/:id/widget", handlers.SetWidgetConfig)
+        admin.PUT("/projects/:id/registration", handlers.SetRegistrationSettings)
+        admin.POST("/projects/:id/test-chat", handlers.TestChat)
         
         // PDF Management
         admin.POST("/projects/:id/upload-pdf", handlers.UploadPDF)
+        admin.POST("/projects/:id/upload-text", handlers.UploadText)
+        admin.POST("/projects/:id/ingest-url", handlers.IngestURL)
         admin.DELETE("/projects/:id/pdf/:fileId", handlers.DeletePDF)
+        admin.POST("/projects/:id/pdfs/reprocess", handlers.ReprocessPDFs)
+        admin.GET("/projects/:id/pdfs/:fileId/status", handlers.GetPDFStatus)
+        admin.PATCH("/projects/:id/pdf/:fileId/toggle", handlers.TogglePDF)
+        admin.POST("/projects/:id/embeddings/rebuild", handlers.RebuildEmbeddings)
+        admin.GET("/projects/:id/kb/search", handlers.SearchKnowledgeBase)
     }
 
     // User routes - FIXED VERSION
@@ -181,12 +383,17 @@ func setupRoutes(r *gin.Engine) {
         }
         middleware.UserAuth()(c)
     })
+    user.Use(middleware.CSRFProtection())
+    user.Use(middleware.ProjectOwnerAuth())
     {
         user.GET("/dashboard", handlers.UserDashboard)
+        user.GET("/projects", handlers.UserProjects)
         user.GET("/project/:id", handlers.ProjectDashboard)
         user.GET("/chat/:id", handlers.IframeChatInterface)
         user.POST("/chat/:id/message", handlers.SendMessage)    // Use SendMessage for authenticated users
         user.POST("/project/:id/upload", handlers.UploadPDF)
+        user.POST("/project/:id/upload-text", handlers.UploadText)
+        user.PUT("/project/:id/notifications/settings", handlers.SetNotificationSettings)
         user.GET("/chat/:id/history", handlers.GetChatHistory)
         // REMOVED: duplicate user.POST("/chat/:id/message", handlers.SendMessage)
     }
@@ -196,8 +403,15 @@ func setupRoutes(r *gin.Engine) {
     {
         chat.POST("/:projectId/message", handlers.IframeSendMessage)  // Use IframeSendMessage for public/embed
         chat.GET("/:projectId/history", handlers.GetChatHistory)
+        chat.GET("/:projectId/history/export", handlers.ExportSessionTranscript)
+        chat.POST("/:projectId/regenerate", handlers.RegenerateResponse)
+        chat.POST("/:projectId/feedback/:messageId", handlers.MessageFeedback)
+        chat.POST("/:projectId/sessions/:sessionId/end", handlers.EndChatSession)
     }
 
+    // Real-time chat for embed widgets
+    r.GET("/ws/chat/:projectId", handlers.ChatWebSocket)
+
     // Error handlers
     r.NoRoute(func(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{
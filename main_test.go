@@ -0,0 +1,153 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestAdminAPIRoutesRequireAuth(t *testing.T) {
+    t.Setenv("METRICS_ADDR", "")
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    setupRoutes(r)
+
+    routes := []struct{ method, path string }{
+        {http.MethodGet, "/api/admin/dashboard"},
+        {http.MethodGet, "/api/admin/projects"},
+        {http.MethodPost, "/api/admin/projects"},
+        {http.MethodGet, "/api/admin/users"},
+        {http.MethodDelete, "/api/admin/users/64b7f0c2a1b2c3d4e5f60718"},
+        {http.MethodGet, "/api/project/64b7f0c2a1b2c3d4e5f60718"},
+        {http.MethodPut, "/api/project/64b7f0c2a1b2c3d4e5f60718"},
+        {http.MethodDelete, "/api/project/64b7f0c2a1b2c3d4e5f60718"},
+        {http.MethodGet, "/api/admin/notifications"},
+        {http.MethodGet, "/api/admin/realtime-stats"},
+        {http.MethodGet, "/metrics"},
+    }
+    for _, route := range routes {
+        w := httptest.NewRecorder()
+        r.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+        if w.Code != http.StatusUnauthorized {
+            t.Errorf("%s %s without a token = %d, want 401", route.method, route.path, w.Code)
+        }
+    }
+}
+
+func TestEnvDuration(t *testing.T) {
+    cases := map[string]time.Duration{
+        "":     time.Hour,
+        "30m":  30 * time.Minute,
+        "soon": time.Hour,
+        "-5m":  time.Hour,
+        "0s":   time.Hour,
+    }
+    for value, want := range cases {
+        t.Setenv("MAINTENANCE_INTERVAL", value)
+        if got := envDuration("MAINTENANCE_INTERVAL", time.Hour); got != want {
+            t.Errorf("envDuration(%q) = %s, want %s", value, got, want)
+        }
+    }
+}
+
+func TestNotificationChecksStopOnCancel(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        runNotificationChecks(ctx, time.Hour)
+        close(done)
+    }()
+
+    cancel()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("runNotificationChecks did not return after cancel")
+    }
+}
+
+// shutdownRecord collects the steps of a shutdown from several goroutines
+type shutdownRecord struct {
+    mu    sync.Mutex
+    steps []string
+}
+
+func (r *shutdownRecord) add(step string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.steps = append(r.steps, step)
+}
+
+func (r *shutdownRecord) String() string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return strings.Join(r.steps, ",")
+}
+
+// recordingServer is a shutdowner that notes its shutdown
+type recordingServer struct {
+    name   string
+    record *shutdownRecord
+}
+
+func (s recordingServer) Shutdown(ctx context.Context) error {
+    if _, ok := ctx.Deadline(); !ok {
+        s.record.add(s.name + " without deadline")
+    }
+    s.record.add(s.name)
+    return nil
+}
+
+func TestShutdownGracefully(t *testing.T) {
+    record := &shutdownRecord{}
+    ctx, cancel := context.WithCancel(context.Background())
+    stopped := make(chan struct{})
+    stop := func() { close(stopped) }
+
+    // A worker that only finishes once shutdown begins, like the maintenance loops
+    var workers sync.WaitGroup
+    workers.Add(1)
+    go func() {
+        defer workers.Done()
+        <-ctx.Done()
+        time.Sleep(10 * time.Millisecond)
+        record.add("worker")
+    }()
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        servers := []shutdowner{recordingServer{"api", record}, recordingServer{"metrics", record}}
+        shutdownGracefully(ctx, stop, time.Second, servers, &workers,
+            func() { record.add("gemini") },
+            func() { record.add("mongo") })
+    }()
+
+    select {
+    case <-done:
+        t.Fatal("shutdownGracefully returned before the context was cancelled")
+    case <-time.After(20 * time.Millisecond):
+    }
+    cancel()
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        t.Fatal("shutdownGracefully did not return after cancellation")
+    }
+
+    select {
+    case <-stopped:
+    default:
+        t.Error("stop was not called")
+    }
+    // Servers drain first, then the workers finish, then the shared clients are closed
+    if got := record.String(); got != "api,metrics,worker,gemini,mongo" {
+        t.Errorf("shutdown order = %s, want api,metrics,worker,gemini,mongo", got)
+    }
+}
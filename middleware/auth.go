@@ -1,11 +1,18 @@
 package middleware
 
 import (
+    "context"
     "net/http"
     "os"
+    "sync"
+    "time"
     
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v4"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "jevi-chat/config"
 )
 
 func AdminAuth() gin.HandlerFunc {
@@ -16,7 +23,7 @@ func AdminAuth() gin.HandlerFunc {
             return
         }
         
-        token, err := c.Cookie("token")
+        token, err := authToken(c)
         if err != nil {
             c.JSON(http.StatusUnauthorized, gin.H{
                 "error": "Authentication required",
@@ -27,11 +34,7 @@ func AdminAuth() gin.HandlerFunc {
         }
         
         claims := jwt.MapClaims{}
-        parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-            return []byte(os.Getenv("JWT_SECRET")), nil
-        })
-        
-        if err != nil || !parsedToken.Valid {
+        if _, err := config.ParseJWT(token, claims); err != nil {
             c.JSON(http.StatusUnauthorized, gin.H{
                 "error": "Invalid token",
                 "message": "Token is expired or invalid",
@@ -50,6 +53,11 @@ func AdminAuth() gin.HandlerFunc {
             return
         }
         
+        userID, _ := claims["user_id"].(string)
+        if !requireActiveUser(c, userID, true) {
+            return
+        }
+        
         // Set user info in context
         c.Set("user_id", claims["user_id"])
         c.Set("is_admin", true)
@@ -65,7 +73,7 @@ func UserAuth() gin.HandlerFunc {
             return
         }
         
-        token, err := c.Cookie("token")
+        token, err := authToken(c)
         if err != nil {
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
             c.Abort()
@@ -73,17 +81,152 @@ func UserAuth() gin.HandlerFunc {
         }
         
         claims := jwt.MapClaims{}
-        parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-            return []byte(os.Getenv("JWT_SECRET")), nil
-        })
-        
-        if err != nil || !parsedToken.Valid {
+        if _, err := config.ParseJWT(token, claims); err != nil {
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
             c.Abort()
             return
         }
         
+        isAdmin, _ := claims["is_admin"].(bool)
+        userID, _ := claims["user_id"].(string)
+        
+        if !requireActiveUser(c, userID, isAdmin) {
+            return
+        }
+        
         c.Set("user_id", claims["user_id"])
+        c.Set("is_admin", isAdmin)
+        c.Next()
+    }
+}
+
+// requireActiveUser aborts with 401 or 403 unless the token's account still exists and
+// is active, so deactivated or deleted users lose access before their token expires
+func requireActiveUser(c *gin.Context, userID string, isAdmin bool) bool {
+    exists, active := lookupUserStatus(userID, isAdmin)
+    if !exists {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+        c.Abort()
+        return false
+    }
+    if !active {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+        c.Abort()
+        return false
+    }
+    return true
+}
+
+// AdminUserID is the user ID in tokens issued to the admin account configured by
+// ADMIN_EMAIL and ADMIN_PASSWORD
+const AdminUserID = "admin"
+
+// AdminAccountConfigured reports whether the environment still defines the admin account
+func AdminAccountConfigured() bool {
+    return os.Getenv("ADMIN_EMAIL") != "" && os.Getenv("ADMIN_PASSWORD") != ""
+}
+
+// userStatusTTL bounds how long a user's active flag is cached between DB lookups
+const userStatusTTL = 30 * time.Second
+
+type userStatus struct {
+    exists    bool
+    active    bool
+    expiresAt time.Time
+}
+
+var (
+    userStatusMu    sync.Mutex
+    userStatusCache = make(map[string]userStatus)
+)
+
+// lookupUserStatus reports whether the user exists and is active, using a short-lived cache.
+// The admin account lives in the environment, so it exists while it stays configured.
+func lookupUserStatus(userID string, isAdmin bool) (bool, bool) {
+    if isAdmin && userID == AdminUserID {
+        configured := AdminAccountConfigured()
+        return configured, configured
+    }
+
+    userStatusMu.Lock()
+    cached, ok := userStatusCache[userID]
+    userStatusMu.Unlock()
+    if ok && time.Now().Before(cached.expiresAt) {
+        return cached.exists, cached.active
+    }
+
+    status := userStatus{expiresAt: time.Now().Add(userStatusTTL)}
+    if objID, err := primitive.ObjectIDFromHex(userID); err == nil {
+        var user struct {
+            IsActive bool `bson:"is_active"`
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), config.DBTimeout)
+        err := config.DB.Collection("users").FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+        cancel()
+        if err == nil {
+            status.exists = true
+            status.active = user.IsActive
+        } else if err != mongo.ErrNoDocuments {
+            // Don't cache transient DB failures as "not found"
+            return false, false
+        }
+    }
+
+    userStatusMu.Lock()
+    userStatusCache[userID] = status
+    for id, s := range userStatusCache {
+        if time.Now().After(s.expiresAt) {
+            delete(userStatusCache, id)
+        }
+    }
+    userStatusMu.Unlock()
+
+    return status.exists, status.active
+}
+
+// InvalidateUserStatus drops a cached user status so changes apply on the next request
+func InvalidateUserStatus(userID string) {
+    userStatusMu.Lock()
+    delete(userStatusCache, userID)
+    userStatusMu.Unlock()
+}
+
+// ProjectOwnerAuth restricts routes with an :id project parameter to the project's
+// owner. Admins can access every project. Must run after UserAuth.
+func ProjectOwnerAuth() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        projectID := c.Param("id")
+        if projectID == "" || c.GetBool("is_admin") {
+            c.Next()
+            return
+        }
+
+        projectObjID, err := primitive.ObjectIDFromHex(projectID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+            c.Abort()
+            return
+        }
+        userObjID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+        if err != nil {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+            c.Abort()
+            return
+        }
+
+        // Projects owned by someone else look the same as missing ones
+        ctx, cancel := context.WithTimeout(c.Request.Context(), config.DBTimeout)
+        defer cancel()
+        count, err := config.DB.Collection("projects").CountDocuments(ctx, bson.M{
+            "_id":      projectObjID,
+            "owner_id": userObjID,
+        })
+        if err != nil || count == 0 {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+            c.Abort()
+            return
+        }
+
         c.Next()
     }
 }
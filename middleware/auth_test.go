@@ -0,0 +1,131 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v4"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "jevi-chat/config"
+)
+
+func signedToken(t *testing.T, userID string, isAdmin bool) string {
+    t.Helper()
+    token, err := config.SignJWT(jwt.MapClaims{
+        "user_id":  userID,
+        "is_admin": isAdmin,
+        "exp":      time.Now().Add(time.Hour).Unix(),
+    })
+    if err != nil {
+        t.Fatalf("SignJWT: %v", err)
+    }
+    return token
+}
+
+func authRequest(handler gin.HandlerFunc, token string) *httptest.ResponseRecorder {
+    router := gin.New()
+    router.GET("/", handler, func(c *gin.Context) { c.Status(http.StatusOK) })
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodGet, "/", nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestAdminTokensRequireConfiguredAdmin(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    t.Setenv("JWT_SECRET", "test-secret")
+    t.Setenv("ADMIN_EMAIL", "admin@example.com")
+    t.Setenv("ADMIN_PASSWORD", "secret")
+    token := signedToken(t, AdminUserID, true)
+
+    for name, handler := range map[string]gin.HandlerFunc{"AdminAuth": AdminAuth(), "UserAuth": UserAuth()} {
+        if w := authRequest(handler, token); w.Code != http.StatusOK {
+            t.Errorf("%s with configured admin = %d, want 200", name, w.Code)
+        }
+    }
+
+    // Removing the admin account revokes its outstanding tokens
+    t.Setenv("ADMIN_PASSWORD", "")
+    for name, handler := range map[string]gin.HandlerFunc{"AdminAuth": AdminAuth(), "UserAuth": UserAuth()} {
+        if w := authRequest(handler, token); w.Code != http.StatusUnauthorized {
+            t.Errorf("%s with removed admin = %d, want 401", name, w.Code)
+        }
+    }
+}
+
+func TestAdminAuthChecksAccountStatus(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    t.Setenv("JWT_SECRET", "test-secret")
+
+    userID := primitive.NewObjectID().Hex()
+    userStatusMu.Lock()
+    userStatusCache[userID] = userStatus{exists: true, active: false, expiresAt: time.Now().Add(time.Minute)}
+    userStatusMu.Unlock()
+    t.Cleanup(func() { InvalidateUserStatus(userID) })
+
+    if w := authRequest(AdminAuth(), signedToken(t, userID, true)); w.Code != http.StatusForbidden {
+        t.Errorf("AdminAuth for a deactivated admin = %d, want 403", w.Code)
+    }
+    if w := authRequest(UserAuth(), signedToken(t, userID, false)); w.Code != http.StatusForbidden {
+        t.Errorf("UserAuth for a deactivated user = %d, want 403", w.Code)
+    }
+}
+
+func TestUnknownUserIDIsRejected(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    t.Setenv("JWT_SECRET", "test-secret")
+
+    // Not an ObjectID, and not the admin account unless the token says so
+    if w := authRequest(UserAuth(), signedToken(t, AdminUserID, false)); w.Code != http.StatusUnauthorized {
+        t.Errorf("UserAuth = %d, want 401", w.Code)
+    }
+}
+
+func TestInvalidateUserStatus(t *testing.T) {
+    userID := primitive.NewObjectID().Hex()
+    userStatusMu.Lock()
+    userStatusCache[userID] = userStatus{exists: true, active: true, expiresAt: time.Now().Add(time.Minute)}
+    userStatusMu.Unlock()
+
+    InvalidateUserStatus(userID)
+
+    userStatusMu.Lock()
+    _, cached := userStatusCache[userID]
+    userStatusMu.Unlock()
+    if cached {
+        t.Error("InvalidateUserStatus left the cached status in place")
+    }
+}
+
+func ownerRequest(userID string, isAdmin bool, projectID string) *httptest.ResponseRecorder {
+    router := gin.New()
+    router.GET("/projects/:id", func(c *gin.Context) {
+        c.Set("user_id", userID)
+        c.Set("is_admin", isAdmin)
+    }, ProjectOwnerAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/"+projectID, nil))
+    return w
+}
+
+func TestProjectOwnerAuthAdminBypass(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    // Admins reach every project without an ownership lookup
+    if w := ownerRequest(AdminUserID, true, primitive.NewObjectID().Hex()); w.Code != http.StatusOK {
+        t.Errorf("admin = %d, want 200", w.Code)
+    }
+}
+
+func TestProjectOwnerAuthRejectsBadIDs(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    if w := ownerRequest(primitive.NewObjectID().Hex(), false, "not-an-id"); w.Code != http.StatusBadRequest {
+        t.Errorf("invalid project ID = %d, want 400", w.Code)
+    }
+    if w := ownerRequest("not-an-id", false, primitive.NewObjectID().Hex()); w.Code != http.StatusForbidden {
+        t.Errorf("invalid user ID = %d, want 403", w.Code)
+    }
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// BodySizeLimit rejects request bodies over limit bytes with 413 before a handler
+// binds them. Bodies within the limit are buffered so handlers read them as usual.
+// Routes listed in exempt (by their registered path, e.g. "/admin/projects/:id/upload-pdf")
+// are skipped because they enforce their own upload limits.
+func BodySizeLimit(limit int64, exempt ...string) gin.HandlerFunc {
+    skip := make(map[string]bool, len(exempt))
+    for _, path := range exempt {
+        skip[path] = true
+    }
+
+    return func(c *gin.Context) {
+        if c.Request.Body == nil || c.Request.Body == http.NoBody || skip[c.FullPath()] {
+            c.Next()
+            return
+        }
+        if c.Request.ContentLength > limit {
+            abortBodyTooLarge(c, limit)
+            return
+        }
+
+        body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+        if err != nil {
+            var maxBytesErr *http.MaxBytesError
+            if errors.As(err, &maxBytesErr) {
+                abortBodyTooLarge(c, limit)
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+            c.Abort()
+            return
+        }
+        c.Request.Body = io.NopCloser(bytes.NewReader(body))
+        c.Next()
+    }
+}
+
+func abortBodyTooLarge(c *gin.Context, limit int64) {
+    c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+        "error":    fmt.Sprintf("Request body exceeds the %d byte limit", limit),
+        "max_size": limit,
+    })
+    c.Abort()
+}
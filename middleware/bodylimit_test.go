@@ -0,0 +1,59 @@
+package middleware
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestBodySizeLimit(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    const limit = 16
+    cases := []struct {
+        name    string
+        path    string
+        body    string
+        chunked bool
+        want    int
+    }{
+        {"within limit", "/echo", strings.Repeat("a", limit), false, http.StatusOK},
+        {"over limit", "/echo", strings.Repeat("a", limit+1), false, http.StatusRequestEntityTooLarge},
+        {"over limit without a length", "/echo", strings.Repeat("a", limit+1), true, http.StatusRequestEntityTooLarge},
+        {"within limit without a length", "/echo", "short", true, http.StatusOK},
+        {"empty body", "/echo", "", false, http.StatusOK},
+        {"exempt upload route", "/projects/p1/upload", strings.Repeat("a", 10*limit), false, http.StatusOK},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            var received string
+            echo := func(c *gin.Context) {
+                body, _ := io.ReadAll(c.Request.Body)
+                received = string(body)
+                c.Status(http.StatusOK)
+            }
+            router := gin.New()
+            router.Use(BodySizeLimit(limit, "/projects/:id/upload"))
+            router.POST("/echo", echo)
+            router.POST("/projects/:id/upload", echo)
+
+            req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+            if tc.chunked {
+                // Hide the length so the limit is enforced while reading
+                req.Body = io.NopCloser(strings.NewReader(tc.body))
+                req.ContentLength = -1
+            }
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, req)
+            if w.Code != tc.want {
+                t.Fatalf("status = %d, want %d", w.Code, tc.want)
+            }
+            if tc.want == http.StatusOK && received != tc.body {
+                t.Errorf("handler read %d bytes, want the whole %d-byte body", len(received), len(tc.body))
+            }
+        })
+    }
+}
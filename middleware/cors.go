@@ -0,0 +1,106 @@
+package middleware
+
+import (
+    "log"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/gin-contrib/cors"
+    "github.com/gin-gonic/gin"
+)
+
+// defaultCORSOrigins are always allowed in addition to CORS_ALLOWED_ORIGINS
+var defaultCORSOrigins = []string{
+    "http://localhost:8080",
+    "http://localhost:8081",
+    "http://localhost:3000",
+    "http://127.0.0.1:3000",
+    "http://localhost:3001",
+    "http://127.0.0.1:3001",
+    "https://155b-150-107-16-191.ngrok-free.app",
+}
+
+// CORSMiddleware allows the default origins plus the comma-separated CORS_ALLOWED_ORIGINS.
+// Entries may be exact origins, wildcard subdomains ("*.example.com" or
+// "https://*.example.com") or "*" for any origin. Credentials are disabled when
+// "*" is configured, since that would let every site make authenticated requests.
+func CORSMiddleware() gin.HandlerFunc {
+    origins := corsAllowedOrigins()
+
+    allowCredentials := true
+    for _, origin := range origins {
+        if origin == "*" {
+            allowCredentials = false
+            log.Println("⚠️ CORS_ALLOWED_ORIGINS contains \"*\" - credentials will not be allowed for cross-origin requests")
+            break
+        }
+    }
+
+    return cors.New(cors.Config{
+        AllowOriginFunc: func(origin string) bool {
+            for _, pattern := range origins {
+                if MatchOrigin(origin, pattern) {
+                    return true
+                }
+            }
+            return false
+        },
+        AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH", "HEAD"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "X-CSRF-Token", "Cache-Control", "Idempotency-Key"},
+        ExposeHeaders:    []string{"Content-Length", "Content-Type", "Idempotent-Replayed"},
+        AllowCredentials: allowCredentials,
+        MaxAge:           12 * time.Hour,
+    })
+}
+
+// corsAllowedOrigins merges the defaults with CORS_ALLOWED_ORIGINS, dropping duplicates
+func corsAllowedOrigins() []string {
+    seen := make(map[string]bool)
+    var origins []string
+    add := func(origin string) {
+        origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+        if origin == "" || seen[origin] {
+            return
+        }
+        seen[origin] = true
+        origins = append(origins, origin)
+    }
+
+    for _, origin := range defaultCORSOrigins {
+        add(origin)
+    }
+    for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+        add(origin)
+    }
+    return origins
+}
+
+// MatchOrigin reports whether a request origin matches an allow-list entry.
+// Entries without a scheme match both http and https; "*.example.com" matches
+// any subdomain of example.com but not example.com itself.
+func MatchOrigin(origin, pattern string) bool {
+    pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "/"))
+    if pattern == "*" {
+        return true
+    }
+
+    parsed, err := url.Parse(strings.ToLower(strings.TrimSpace(origin)))
+    if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+        return false
+    }
+
+    host := pattern
+    if scheme, rest, found := strings.Cut(pattern, "://"); found {
+        if scheme != parsed.Scheme {
+            return false
+        }
+        host = rest
+    }
+
+    if suffix, found := strings.CutPrefix(host, "*."); found {
+        return strings.HasSuffix(parsed.Host, "."+suffix)
+    }
+    return parsed.Host == host
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestMatchOrigin(t *testing.T) {
+    cases := []struct {
+        origin, pattern string
+        want            bool
+    }{
+        {"https://app.example.com", "https://app.example.com", true},
+        {"https://APP.example.com", "https://app.example.com/", true},
+        {"http://app.example.com", "https://app.example.com", false},
+        {"http://app.example.com", "app.example.com", true},
+        {"https://a.example.com", "*.example.com", true},
+        {"https://a.b.example.com", "https://*.example.com", true},
+        {"https://example.com", "*.example.com", false},
+        {"https://evilexample.com", "*.example.com", false},
+        {"https://app.example.com.evil.io", "app.example.com", false},
+        {"null", "*.example.com", false},
+        {"ftp://app.example.com", "app.example.com", false},
+        {"https://anything.io", "*", true},
+    }
+    for _, tc := range cases {
+        if got := MatchOrigin(tc.origin, tc.pattern); got != tc.want {
+            t.Errorf("MatchOrigin(%q, %q) = %v, want %v", tc.origin, tc.pattern, got, tc.want)
+        }
+    }
+}
+
+func TestCORSAllowedOriginsMergesEnv(t *testing.T) {
+    t.Setenv("CORS_ALLOWED_ORIGINS", " https://App.example.com/ , ,http://localhost:3000")
+    origins := corsAllowedOrigins()
+
+    count := map[string]int{}
+    for _, origin := range origins {
+        count[origin]++
+    }
+    if count["https://app.example.com"] != 1 {
+        t.Errorf("configured origin not normalized and added once: %v", origins)
+    }
+    if count["http://localhost:3000"] != 1 {
+        t.Errorf("default origin duplicated: %v", origins)
+    }
+    if count[""] != 0 {
+        t.Errorf("empty entry kept: %v", origins)
+    }
+}
+
+func corsPreflight(origin string) *httptest.ResponseRecorder {
+    router := gin.New()
+    router.Use(CORSMiddleware())
+    router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodOptions, "/", nil)
+    req.Header.Set("Origin", origin)
+    req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+    router.ServeHTTP(w, req)
+    return w
+}
+
+func TestCORSMiddlewareCredentials(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    t.Setenv("CORS_ALLOWED_ORIGINS", "*.example.com")
+    w := corsPreflight("https://app.example.com")
+    if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+        t.Errorf("allowed origin not echoed: %v", w.Header())
+    }
+    if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+        t.Error("credentials must be allowed for listed origins")
+    }
+    if w := corsPreflight("https://evil.io"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+        t.Errorf("unlisted origin allowed: %v", w.Header())
+    }
+
+    // A wildcard entry disables credentials
+    t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+    if w := corsPreflight("https://evil.io"); w.Header().Get("Access-Control-Allow-Credentials") == "true" {
+        t.Error("credentials must not be allowed with a \"*\" origin")
+    }
+}
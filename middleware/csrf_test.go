@@ -0,0 +1,103 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+func TestCSRFProtection(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    cases := []struct {
+        name   string
+        method string
+        cookie string
+        header string
+        bearer bool
+        want   int
+    }{
+        {"safe method", http.MethodGet, "", "", false, http.StatusOK},
+        {"preflight", http.MethodOptions, "", "", false, http.StatusOK},
+        {"matching token", http.MethodPost, "abc123", "abc123", false, http.StatusOK},
+        {"missing header", http.MethodPost, "abc123", "", false, http.StatusForbidden},
+        {"missing cookie", http.MethodDelete, "", "abc123", false, http.StatusForbidden},
+        {"mismatched token", http.MethodPut, "abc123", "abc124", false, http.StatusForbidden},
+        {"bearer token", http.MethodPost, "", "", true, http.StatusOK},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            router := gin.New()
+            router.Use(CSRFProtection())
+            router.Handle(tc.method, "/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+            req := httptest.NewRequest(tc.method, "/", nil)
+            if tc.cookie != "" {
+                req.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tc.cookie})
+            }
+            if tc.header != "" {
+                req.Header.Set(CSRFHeaderName, tc.header)
+            }
+            if tc.bearer {
+                req.Header.Set("Authorization", "Bearer some-token")
+            }
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, req)
+            if w.Code != tc.want {
+                t.Errorf("status = %d, want %d", w.Code, tc.want)
+            }
+        })
+    }
+}
+
+func TestIssueCSRFToken(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+
+    token := IssueCSRFToken(c, 3600)
+    if len(token) != 64 || w.Header().Get(CSRFHeaderName) != token {
+        t.Errorf("token = %q, header = %q; want the same 32-byte hex token", token, w.Header().Get(CSRFHeaderName))
+    }
+    cookies := w.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].Name != CSRFCookieName || cookies[0].Value != token {
+        t.Fatalf("cookies = %v, want the csrf_token cookie", cookies)
+    }
+    // The dashboard's scripts read the cookie to echo it back
+    if cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode || cookies[0].MaxAge != 3600 {
+        t.Errorf("cookie = %+v, want a script-readable SameSite=Lax cookie", cookies[0])
+    }
+    if IssueCSRFToken(c, 3600) == token {
+        t.Error("IssueCSRFToken repeated a token")
+    }
+}
+
+func TestAuthTokenPrefersBearer(t *testing.T) {
+    cases := []struct {
+        name   string
+        header string
+        cookie string
+        want   string
+    }{
+        {"bearer only", "Bearer header-token", "", "header-token"},
+        {"lowercase scheme", "bearer header-token", "", "header-token"},
+        {"bearer over cookie", "Bearer header-token", "cookie-token", "header-token"},
+        {"cookie only", "", "cookie-token", "cookie-token"},
+        {"other scheme", "Basic dXNlcjpwYXNz", "cookie-token", "cookie-token"},
+    }
+    for _, tc := range cases {
+        c, _ := gin.CreateTestContext(httptest.NewRecorder())
+        c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+        if tc.header != "" {
+            c.Request.Header.Set("Authorization", tc.header)
+        }
+        if tc.cookie != "" {
+            c.Request.AddCookie(&http.Cookie{Name: "token", Value: tc.cookie})
+        }
+        if got, _ := authToken(c); got != tc.want {
+            t.Errorf("%s: authToken = %q, want %q", tc.name, got, tc.want)
+        }
+    }
+}
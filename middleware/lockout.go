@@ -0,0 +1,119 @@
+package middleware
+
+import (
+    "log"
+    "math"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/redis/go-redis/v9"
+    "jevi-chat/utils"
+)
+
+// loginLockout is the default policy: five failures lock an email for a minute, doubling
+// with each further failure up to an hour. Failures are forgotten after a day without one.
+var loginLockout = utils.LockoutPolicy{
+    Threshold:   5,
+    BaseLockout: time.Minute,
+    MaxLockout:  time.Hour,
+    Window:      24 * time.Hour,
+}
+
+var (
+    memoryLoginAttempts                     = utils.NewMemoryLoginAttempts()
+    loginAttempts       utils.LoginAttempts = memoryLoginAttempts
+)
+
+// initLoginLockout reads LOGIN_LOCKOUT_THRESHOLD, LOGIN_LOCKOUT_BASE and LOGIN_LOCKOUT_MAX
+// (Go durations) and tracks failures in Redis when the rate limiter uses it
+func initLoginLockout(redis *redis.Client) {
+    if value := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); value != "" {
+        if threshold, err := strconv.Atoi(value); err == nil && threshold >= 0 {
+            loginLockout.Threshold = threshold
+        } else {
+            log.Printf("Invalid LOGIN_LOCKOUT_THRESHOLD %q, locking after %d failures", value, loginLockout.Threshold)
+        }
+    }
+    if value := os.Getenv("LOGIN_LOCKOUT_BASE"); value != "" {
+        if base, err := time.ParseDuration(value); err == nil && base > 0 {
+            loginLockout.BaseLockout = base
+        } else {
+            log.Printf("Invalid LOGIN_LOCKOUT_BASE %q, first lockout lasts %s", value, loginLockout.BaseLockout)
+        }
+    }
+    if value := os.Getenv("LOGIN_LOCKOUT_MAX"); value != "" {
+        if max, err := time.ParseDuration(value); err == nil && max > 0 {
+            loginLockout.MaxLockout = max
+        } else {
+            log.Printf("Invalid LOGIN_LOCKOUT_MAX %q, lockouts last at most %s", value, loginLockout.MaxLockout)
+        }
+    }
+    if loginLockout.MaxLockout < loginLockout.BaseLockout {
+        loginLockout.MaxLockout = loginLockout.BaseLockout
+    }
+
+    if redis != nil {
+        loginAttempts = utils.NewRedisLoginAttempts(redis)
+    }
+}
+
+// loginAttemptKey identifies the account being logged into
+func loginAttemptKey(email string) string {
+    return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CheckLoginLockout responds 429 with a Retry-After when email is locked out and
+// reports whether the login may proceed
+func CheckLoginLockout(c *gin.Context, email string) bool {
+    lockedFor, err := loginAttempts.LockedFor(c.Request.Context(), loginAttemptKey(email))
+    if err != nil {
+        // Keep enforcing locally rather than failing open while Redis is unreachable
+        log.Printf("Login lockout check failed, falling back to in-memory: %v", err)
+        lockedFor, _ = memoryLoginAttempts.LockedFor(c.Request.Context(), loginAttemptKey(email))
+    }
+    if lockedFor <= 0 {
+        return true
+    }
+    respondLockedOut(c, lockedFor)
+    return false
+}
+
+// RecordLoginFailure counts a failed login for email. When the failure triggers a
+// lockout it responds 429 itself and returns false.
+func RecordLoginFailure(c *gin.Context, email string) bool {
+    lockedFor, err := loginAttempts.RecordFailure(c.Request.Context(), loginAttemptKey(email), loginLockout)
+    if err != nil {
+        log.Printf("Failed to record login failure, falling back to in-memory: %v", err)
+        lockedFor, _ = memoryLoginAttempts.RecordFailure(c.Request.Context(), loginAttemptKey(email), loginLockout)
+    }
+    if lockedFor <= 0 {
+        return true
+    }
+    log.Printf("🔒 Locked out %q for %s after repeated failed logins from %s", loginAttemptKey(email), lockedFor, c.ClientIP())
+    respondLockedOut(c, lockedFor)
+    return false
+}
+
+// ResetLoginFailures clears email's failed logins after it logs in successfully
+func ResetLoginFailures(c *gin.Context, email string) {
+    key := loginAttemptKey(email)
+    if err := loginAttempts.Reset(c.Request.Context(), key); err != nil {
+        log.Printf("Failed to reset login failures: %v", err)
+    }
+    memoryLoginAttempts.Reset(c.Request.Context(), key)
+}
+
+func respondLockedOut(c *gin.Context, lockedFor time.Duration) {
+    retryAfter := int(math.Ceil(lockedFor.Seconds()))
+    c.Header("Retry-After", strconv.Itoa(retryAfter))
+    c.JSON(http.StatusTooManyRequests, gin.H{
+        "success":     false,
+        "error":       "Too many failed login attempts. Please try again later.",
+        "retry_after": retryAfter,
+    })
+    c.Abort()
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/redis/go-redis/v9"
+    "jevi-chat/utils"
+)
+
+// useLoginLockout swaps in policy and fresh trackers for the test
+func useLoginLockout(t *testing.T, policy utils.LockoutPolicy, attempts utils.LoginAttempts) {
+    t.Helper()
+    previousPolicy, previousMemory, previousAttempts := loginLockout, memoryLoginAttempts, loginAttempts
+    loginLockout = policy
+    memoryLoginAttempts = utils.NewMemoryLoginAttempts()
+    loginAttempts = attempts
+    if attempts == nil {
+        loginAttempts = memoryLoginAttempts
+    }
+    t.Cleanup(func() {
+        loginLockout, memoryLoginAttempts, loginAttempts = previousPolicy, previousMemory, previousAttempts
+    })
+}
+
+func loginContext() (*gin.Context, *httptest.ResponseRecorder) {
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+    return c, w
+}
+
+func TestInitLoginLockout(t *testing.T) {
+    defaults := utils.LockoutPolicy{Threshold: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 24 * time.Hour}
+    cases := []struct {
+        name                 string
+        threshold, base, max string
+        want                 utils.LockoutPolicy
+    }{
+        {"defaults", "", "", "", defaults},
+        {"overrides", "3", "30s", "10m", utils.LockoutPolicy{Threshold: 3, BaseLockout: 30 * time.Second, MaxLockout: 10 * time.Minute, Window: 24 * time.Hour}},
+        {"disabled", "0", "", "", utils.LockoutPolicy{Threshold: 0, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 24 * time.Hour}},
+        {"invalid values", "-1", "soon", "0s", defaults},
+        {"max below base", "", "2h", "", utils.LockoutPolicy{Threshold: 5, BaseLockout: 2 * time.Hour, MaxLockout: 2 * time.Hour, Window: 24 * time.Hour}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            useLoginLockout(t, defaults, nil)
+            t.Setenv("LOGIN_LOCKOUT_THRESHOLD", tc.threshold)
+            t.Setenv("LOGIN_LOCKOUT_BASE", tc.base)
+            t.Setenv("LOGIN_LOCKOUT_MAX", tc.max)
+            initLoginLockout(nil)
+            if loginLockout != tc.want {
+                t.Errorf("policy = %+v, want %+v", loginLockout, tc.want)
+            }
+            if loginAttempts != utils.LoginAttempts(memoryLoginAttempts) {
+                t.Error("without Redis, failures should be tracked in memory")
+            }
+        })
+    }
+}
+
+func TestLoginLockout(t *testing.T) {
+    useLoginLockout(t, utils.LockoutPolicy{Threshold: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}, nil)
+
+    c, w := loginContext()
+    if !RecordLoginFailure(c, "Admin@Example.com") || w.Code != http.StatusOK {
+        t.Fatalf("first failure responded %d, want the handler to carry on", w.Code)
+    }
+    c, w = loginContext()
+    if RecordLoginFailure(c, " admin@example.com ") {
+        t.Fatal("the threshold failure didn't lock the email out")
+    }
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+        t.Errorf("lockout = %d with Retry-After %q, want 429 and 60", w.Code, w.Header().Get("Retry-After"))
+    }
+
+    // The same email in any case or spacing stays locked; other emails don't
+    c, w = loginContext()
+    if CheckLoginLockout(c, "ADMIN@example.com") {
+        t.Error("CheckLoginLockout let a locked-out email through")
+    }
+    if retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After")); w.Code != http.StatusTooManyRequests || retryAfter <= 0 || retryAfter > 60 {
+        t.Errorf("check = %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+    }
+    if c, _ := loginContext(); !CheckLoginLockout(c, "other@example.com") {
+        t.Error("an unrelated email was locked out")
+    }
+
+    c, _ = loginContext()
+    ResetLoginFailures(c, "admin@example.com")
+    if c, _ := loginContext(); !CheckLoginLockout(c, "admin@example.com") {
+        t.Error("still locked out after a successful login")
+    }
+}
+
+func TestLoginLockoutFallsBackToMemory(t *testing.T) {
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+    t.Cleanup(func() { client.Close() })
+    useLoginLockout(t, utils.LockoutPolicy{Threshold: 1, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour},
+        utils.NewRedisLoginAttempts(client))
+    server.Close()
+
+    // Redis is down, so the lockout is tracked and enforced in memory instead
+    c, w := loginContext()
+    if RecordLoginFailure(c, "admin@example.com") || w.Code != http.StatusTooManyRequests {
+        t.Fatalf("failure with Redis down = %d, want a local lockout", w.Code)
+    }
+    if c, _ := loginContext(); CheckLoginLockout(c, "admin@example.com") {
+        t.Error("CheckLoginLockout failed open while Redis is down")
+    }
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/utils"
+)
+
+// MetricsMiddleware counts requests by matched route, method and status code
+func MetricsMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Next()
+
+        // Use the route pattern rather than the raw path to keep label cardinality bounded
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        utils.HTTPRequestsTotal.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+    }
+}
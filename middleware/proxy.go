@@ -0,0 +1,54 @@
+package middleware
+
+import (
+    "log"
+    "os"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// defaultTrustedProxies are the loopback and private ranges load balancers such as
+// Render's and a local NGINX forward from
+var defaultTrustedProxies = []string{
+    "127.0.0.0/8",
+    "10.0.0.0/8",
+    "172.16.0.0/12",
+    "192.168.0.0/16",
+    "::1/128",
+    "fc00::/7",
+}
+
+// ConfigureTrustedProxies sets which proxies may report the client IP, so rate limits
+// and logs key off the real client rather than the proxy in front of it.
+//
+// TRUSTED_PROXIES takes comma-separated IPs and CIDRs (default: loopback and private
+// ranges); "none" ignores forwarding headers entirely. For a request from a trusted
+// proxy, c.ClientIP() walks X-Forwarded-For from the right and returns the first
+// address that isn't itself a trusted proxy, then falls back to X-Real-IP, then to the
+// connection's address. Headers from untrusted peers are ignored, so clients can't
+// pick their own bucket by spoofing them.
+func ConfigureTrustedProxies(r *gin.Engine) {
+    r.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+    proxies := defaultTrustedProxies
+    if value := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES")); value == "none" {
+        proxies = nil
+    } else if value != "" {
+        proxies = nil
+        for _, entry := range strings.Split(value, ",") {
+            if entry = strings.TrimSpace(entry); entry != "" {
+                proxies = append(proxies, entry)
+            }
+        }
+    }
+
+    if err := r.SetTrustedProxies(proxies); err != nil {
+        log.Printf("⚠️ Invalid TRUSTED_PROXIES (%v), using defaults", err)
+        r.SetTrustedProxies(defaultTrustedProxies)
+        return
+    }
+    if len(proxies) == 0 {
+        log.Println("⚠️ No trusted proxies - forwarding headers are ignored")
+    }
+}
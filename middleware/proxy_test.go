@@ -0,0 +1,62 @@
+package middleware
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// clientIPSeen returns what c.ClientIP() reports for a request from remoteAddr through
+// a router set up by ConfigureTrustedProxies
+func clientIPSeen(remoteAddr string, headers map[string]string) string {
+    gin.SetMode(gin.TestMode)
+    var seen string
+    r := gin.New()
+    ConfigureTrustedProxies(r)
+    r.GET("/", func(c *gin.Context) { seen = c.ClientIP() })
+
+    req := httptest.NewRequest(http.MethodGet, "/", nil)
+    req.RemoteAddr = remoteAddr
+    for name, value := range headers {
+        req.Header.Set(name, value)
+    }
+    r.ServeHTTP(httptest.NewRecorder(), req)
+    return seen
+}
+
+func TestConfigureTrustedProxies(t *testing.T) {
+    cases := []struct {
+        name           string
+        trustedProxies string
+        remoteAddr     string
+        headers        map[string]string
+        want           string
+    }{
+        {"private proxy by default", "", "10.0.0.5:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+        {"chained private proxies", "", "10.0.0.5:1234",
+            map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9, 10.0.0.6"}, "203.0.113.9"},
+        {"X-Real-IP fallback", "", "127.0.0.1:1234",
+            map[string]string{"X-Real-IP": "203.0.113.9"}, "203.0.113.9"},
+        {"spoofed from the internet", "", "198.51.100.7:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "198.51.100.7"},
+        {"none ignores headers", "none", "10.0.0.5:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "10.0.0.5"},
+        {"custom proxy list", "198.51.100.7", "198.51.100.7:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+        {"private range no longer trusted", "198.51.100.7", "10.0.0.5:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "10.0.0.5"},
+        {"invalid list uses defaults", "not-a-proxy", "10.0.0.5:1234",
+            map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            t.Setenv("TRUSTED_PROXIES", tc.trustedProxies)
+            if got := clientIPSeen(tc.remoteAddr, tc.headers); got != tc.want {
+                t.Errorf("ClientIP = %q, want %q", got, tc.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+    "context"
+    "log"
+    "math"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "jevi-chat/utils"
+)
+
+// Request limits per route tier
+var rateLimitTiers = map[string]utils.Limit{
+    "chat":    utils.PerMinute(30),
+    "auth":    utils.PerMinute(10),
+    "general": utils.PerMinute(100),
+}
+
+var (
+    memoryLimiter = utils.NewRateLimiter()
+    limiter       utils.Limiter = memoryLimiter
+)
+
+// rateLimitWhitelist holds the networks from RATE_LIMIT_WHITELIST that are never limited
+var rateLimitWhitelist []*net.IPNet
+
+// InitRateLimiter switches to the Redis limiter when REDIS_URL (redis:// or rediss:// for
+// TLS) or REDIS_ADDR is set, so limits and login lockouts are shared between instances,
+// keeping them in memory otherwise
+func InitRateLimiter() {
+    rateLimitWhitelist = parseIPWhitelist(os.Getenv("RATE_LIMIT_WHITELIST"))
+    if len(rateLimitWhitelist) > 0 {
+        log.Printf("✅ Rate limits skipped for %d whitelisted networks", len(rateLimitWhitelist))
+    }
+
+    url, addr := os.Getenv("REDIS_URL"), os.Getenv("REDIS_ADDR")
+    if url == "" && addr == "" {
+        log.Println("⚠️ REDIS_URL/REDIS_ADDR not set - using in-memory rate limiting")
+        initLoginLockout(nil)
+        return
+    }
+
+    db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+    client, err := utils.NewRedisClient(url, addr, os.Getenv("REDIS_PASSWORD"), db)
+    if err != nil {
+        log.Printf("⚠️ Redis rate limiter unavailable, using in-memory rate limiting: %v", err)
+        initLoginLockout(nil)
+        return
+    }
+
+    limiter = utils.NewRedisRateLimiter(client)
+    initLoginLockout(client)
+    log.Printf("✅ Redis rate limiting enabled (%s)", client.Options().Addr)
+}
+
+// RateLimitMiddleware limits requests per client IP using the given tier
+func RateLimitMiddleware(tier string) gin.HandlerFunc {
+    limit, exists := rateLimitTiers[tier]
+    if !exists {
+        limit = rateLimitTiers["general"]
+    }
+
+    return func(c *gin.Context) {
+        if c.Request.Method == "OPTIONS" {
+            c.Next()
+            return
+        }
+
+        if !applyRateLimit(c, tier, tier+":"+c.ClientIP(), limit) {
+            return
+        }
+        c.Next()
+    }
+}
+
+// ProjectRateLimit counts a chat request against the project's own per-minute limit
+// for the client IP, using the chat tier when the project has none configured.
+// It writes the 429 response itself and reports whether the request may proceed.
+func ProjectRateLimit(c *gin.Context, projectID string, perMinute int) bool {
+    return applyRateLimit(c, "project", "project:"+projectID+":"+c.ClientIP(), projectLimit(perMinute))
+}
+
+// AllowProjectMessage applies the same per-project limit as ProjectRateLimit to a
+// message that didn't arrive as its own HTTP request (e.g. over a WebSocket),
+// returning how long to wait when it is over the limit
+func AllowProjectMessage(ctx context.Context, projectID, clientIP string, perMinute int) (bool, time.Duration) {
+    if RateLimitExempt(clientIP) {
+        return true, 0
+    }
+    key := "project:" + projectID + ":" + clientIP
+    result, err := limiter.Allow(ctx, key, projectLimit(perMinute))
+    if err != nil {
+        log.Printf("Rate limiter error, falling back to in-memory: %v", err)
+        result, _ = memoryLimiter.Allow(ctx, key, projectLimit(perMinute))
+    }
+    if !result.Allowed {
+        utils.RateLimitRejectionsTotal.WithLabelValues("project").Inc()
+    }
+    return result.Allowed, result.RetryAfter
+}
+
+// projectLimit is a project's per-minute chat limit, or the chat tier when it has none
+func projectLimit(perMinute int) utils.Limit {
+    if perMinute > 0 {
+        return utils.PerMinute(perMinute)
+    }
+    return rateLimitTiers["chat"]
+}
+
+// applyRateLimit sets the rate limit headers and aborts with 429 when key is over limit
+func applyRateLimit(c *gin.Context, tier, key string, limit utils.Limit) bool {
+    if RateLimitExempt(c.ClientIP()) {
+        return true
+    }
+
+    result, err := limiter.Allow(c.Request.Context(), key, limit)
+    if err != nil {
+        // Keep limiting locally rather than failing open while Redis is unreachable
+        log.Printf("Rate limiter error, falling back to in-memory: %v", err)
+        result, _ = memoryLimiter.Allow(c.Request.Context(), key, limit)
+    }
+
+    c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Rate))
+    c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+    if !result.Allowed {
+        utils.RateLimitRejectionsTotal.WithLabelValues(tier).Inc()
+        c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+        c.JSON(http.StatusTooManyRequests, gin.H{
+            "error":   "Rate limit exceeded",
+            "message": "Too many requests. Please try again later.",
+        })
+        c.Abort()
+        return false
+    }
+    return true
+}
+
+// RateLimitExempt reports whether ip is on the rate limit whitelist
+func RateLimitExempt(ip string) bool {
+    parsed := net.ParseIP(ip)
+    if parsed == nil {
+        return false
+    }
+    for _, network := range rateLimitWhitelist {
+        if network.Contains(parsed) {
+            return true
+        }
+    }
+    return false
+}
+
+// parseIPWhitelist parses a comma-separated list of IPs and CIDRs, skipping invalid entries
+func parseIPWhitelist(value string) []*net.IPNet {
+    var networks []*net.IPNet
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            ip := net.ParseIP(entry)
+            if ip == nil {
+                log.Printf("⚠️ Ignoring invalid RATE_LIMIT_WHITELIST entry %q", entry)
+                continue
+            }
+            bits := 128
+            if ip.To4() != nil {
+                ip, bits = ip.To4(), 32
+            }
+            entry = ip.String() + "/" + strconv.Itoa(bits)
+        }
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            log.Printf("⚠️ Ignoring invalid RATE_LIMIT_WHITELIST entry %q", entry)
+            continue
+        }
+        networks = append(networks, network)
+    }
+    return networks
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/gin-gonic/gin"
+    "github.com/redis/go-redis/v9"
+    "jevi-chat/utils"
+)
+
+// useLimiter swaps the package limiter for the length of a test
+func useLimiter(t *testing.T, l utils.Limiter) {
+    t.Helper()
+    previous := limiter
+    limiter = l
+    t.Cleanup(func() { limiter = previous })
+}
+
+func rateLimitedRequest(key string, limit utils.Limit) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+    applyRateLimit(c, "test", key, limit)
+    return w
+}
+
+func TestApplyRateLimitWithRedis(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+    defer client.Close()
+    useLimiter(t, utils.NewRedisRateLimiter(client))
+
+    limit := utils.PerMinute(2)
+    for i := 0; i < limit.Rate; i++ {
+        if w := rateLimitedRequest("redis-boundary", limit); w.Code != http.StatusOK {
+            t.Fatalf("request %d = %d, want it allowed", i+1, w.Code)
+        }
+    }
+    w := rateLimitedRequest("redis-boundary", limit)
+    if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+        t.Fatalf("request over the limit = %d (Retry-After %q), want 429 with Retry-After",
+            w.Code, w.Header().Get("Retry-After"))
+    }
+    if w.Header().Get("X-RateLimit-Remaining") != "0" {
+        t.Errorf("X-RateLimit-Remaining = %q, want 0", w.Header().Get("X-RateLimit-Remaining"))
+    }
+}
+
+func TestApplyRateLimitFallsBackWhenRedisDown(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    server := miniredis.RunT(t)
+    client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+    defer client.Close()
+    useLimiter(t, utils.NewRedisRateLimiter(client))
+    server.Close()
+
+    // Still limited, by the in-memory limiter, rather than failing open or closed
+    limit := utils.PerMinute(2)
+    for i := 0; i < limit.Rate; i++ {
+        if w := rateLimitedRequest("redis-down", limit); w.Code != http.StatusOK {
+            t.Fatalf("request %d with Redis down = %d, want it allowed", i+1, w.Code)
+        }
+    }
+    if w := rateLimitedRequest("redis-down", limit); w.Code != http.StatusTooManyRequests {
+        t.Fatalf("request over the limit with Redis down = %d, want 429", w.Code)
+    }
+}
+
+func TestProjectLimit(t *testing.T) {
+    if got := projectLimit(5); got != utils.PerMinute(5) {
+        t.Errorf("projectLimit(5) = %+v, want 5 per minute", got)
+    }
+    if got := projectLimit(0); got != rateLimitTiers["chat"] {
+        t.Errorf("projectLimit(0) = %+v, want the chat tier", got)
+    }
+}
+
+func TestAllowProjectMessageIsPerProject(t *testing.T) {
+    useLimiter(t, utils.NewRateLimiter())
+    ctx := context.Background()
+
+    for i := 0; i < 2; i++ {
+        if ok, _ := AllowProjectMessage(ctx, "project-a", "203.0.113.9", 2); !ok {
+            t.Fatalf("message %d to project-a was limited", i+1)
+        }
+    }
+    ok, retryAfter := AllowProjectMessage(ctx, "project-a", "203.0.113.9", 2)
+    if ok || retryAfter <= 0 {
+        t.Errorf("third message = %v (retry after %v), want limited with a wait", ok, retryAfter)
+    }
+
+    // Another project's limit is counted separately
+    if ok, _ := AllowProjectMessage(ctx, "project-b", "203.0.113.9", 2); !ok {
+        t.Error("project-b was limited by project-a's traffic")
+    }
+}
+
+// useWhitelist swaps the rate limit whitelist for the length of a test
+func useWhitelist(t *testing.T, value string) {
+    t.Helper()
+    previous := rateLimitWhitelist
+    rateLimitWhitelist = parseIPWhitelist(value)
+    t.Cleanup(func() { rateLimitWhitelist = previous })
+}
+
+func TestParseIPWhitelist(t *testing.T) {
+    networks := parseIPWhitelist(" 203.0.113.7, 10.0.0.0/8,not-an-ip,2001:db8::/32, ,::1,300.1.1.1")
+    var got []string
+    for _, network := range networks {
+        got = append(got, network.String())
+    }
+    want := []string{"203.0.113.7/32", "10.0.0.0/8", "2001:db8::/32", "::1/128"}
+    if strings.Join(got, ",") != strings.Join(want, ",") {
+        t.Errorf("networks = %v, want %v", got, want)
+    }
+}
+
+func TestRateLimitExempt(t *testing.T) {
+    useWhitelist(t, "203.0.113.7,10.0.0.0/8,2001:db8::/32")
+    cases := []struct {
+        ip     string
+        exempt bool
+    }{
+        {"203.0.113.7", true},
+        {"203.0.113.8", false},
+        {"10.42.0.1", true},
+        {"2001:db8::1", true},
+        {"2001:db9::1", false},
+        {"garbage", false},
+        {"", false},
+    }
+    for _, tc := range cases {
+        if got := RateLimitExempt(tc.ip); got != tc.exempt {
+            t.Errorf("RateLimitExempt(%q) = %v, want %v", tc.ip, got, tc.exempt)
+        }
+    }
+}
+
+func TestWhitelistedClientsSkipLimits(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    useLimiter(t, utils.NewRateLimiter())
+    // httptest requests come from 192.0.2.1
+    useWhitelist(t, "192.0.2.0/24")
+
+    limit := utils.PerMinute(1)
+    for i := 0; i < 3; i++ {
+        if w := rateLimitedRequest("whitelisted", limit); w.Code != http.StatusOK {
+            t.Fatalf("request %d from a whitelisted network = %d, want it allowed", i+1, w.Code)
+        }
+    }
+    for i := 0; i < 3; i++ {
+        if ok, _ := AllowProjectMessage(context.Background(), "project-a", "192.0.2.1", 1); !ok {
+            t.Fatalf("message %d from a whitelisted network was limited", i+1)
+        }
+    }
+}
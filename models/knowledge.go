@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Knowledge Source Type Constants
+const (
+    KnowledgeSourcePDF      = "pdf"
+    KnowledgeSourceText     = "text"
+    KnowledgeSourceMarkdown = "markdown"
+    KnowledgeSourceURL      = "url"
+)
+
+// KnowledgeSource is one document in a project's knowledge base: an uploaded PDF, a text
+// or markdown document, or a web page. Enabled sources with content make up pdf_content.
+type KnowledgeSource struct {
+    ID          string    `bson:"id" json:"id"`
+    Type        string    `bson:"type" json:"type"`                         // KnowledgeSource*
+    Name        string    `bson:"name" json:"name"`                         // file name, title or page title
+    Origin      string    `bson:"origin,omitempty" json:"origin,omitempty"` // page URL for URL sources
+    FilePath    string    `bson:"file_path,omitempty" json:"-"`             // stored upload, for PDFs
+    Size        int64     `bson:"size" json:"size"`
+    Hash        string    `bson:"hash,omitempty" json:"hash,omitempty"` // SHA-256 of the uploaded bytes or fetched text
+    Content     string    `bson:"content" json:"-"`
+    Status      string    `bson:"status" json:"status"` // PDFStatus*
+    Error       string    `bson:"error,omitempty" json:"error,omitempty"`
+    Enabled     bool      `bson:"enabled" json:"enabled"`
+    CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+    ProcessedAt time.Time `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+}
+
+// IsPDF reports whether the source is a PDF, whose content is extracted rather than stored as uploaded
+func (s KnowledgeSource) IsPDF() bool {
+    return s.Type == KnowledgeSourcePDF
+}
+
+// NewKnowledgeSourceFromPDFFile converts a legacy pdf_files record
+func NewKnowledgeSourceFromPDFFile(file PDFFile) KnowledgeSource {
+    sourceType := file.SourceType
+    if sourceType == "" {
+        sourceType = KnowledgeSourcePDF
+    }
+    return KnowledgeSource{
+        ID:          file.ID,
+        Type:        sourceType,
+        Name:        file.FileName,
+        Origin:      file.SourceURL,
+        FilePath:    file.FilePath,
+        Size:        file.FileSize,
+        Hash:        file.Hash,
+        Content:     file.Content,
+        Status:      file.Status,
+        Error:       file.Error,
+        Enabled:     file.Enabled,
+        CreatedAt:   file.UploadedAt,
+        ProcessedAt: file.ProcessedAt,
+    }
+}
+
+// Sources returns the project's knowledge sources, falling back to the legacy
+// pdf_files for projects that haven't been migrated yet
+func (p Project) Sources() []KnowledgeSource {
+    if len(p.KnowledgeSources) > 0 || len(p.PDFFiles) == 0 {
+        return p.KnowledgeSources
+    }
+    sources := make([]KnowledgeSource, len(p.PDFFiles))
+    for i, file := range p.PDFFiles {
+        sources[i] = NewKnowledgeSourceFromPDFFile(file)
+    }
+    return sources
+}
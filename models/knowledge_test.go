@@ -0,0 +1,67 @@
+package models
+
+import (
+    "testing"
+    "time"
+)
+
+func TestNewKnowledgeSourceFromPDFFile(t *testing.T) {
+    uploaded := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+    cases := []struct {
+        name       string
+        file       PDFFile
+        wantType   string
+        wantOrigin string
+    }{
+        {"legacy PDF", PDFFile{ID: "a", FileName: "manual.pdf", SourceType: ""}, KnowledgeSourcePDF, ""},
+        {"text", PDFFile{ID: "b", FileName: "notes.txt", SourceType: KnowledgeSourceText}, KnowledgeSourceText, ""},
+        {"web page", PDFFile{ID: "c", FileName: "FAQ", SourceType: KnowledgeSourceURL, SourceURL: "https://example.com/faq"}, KnowledgeSourceURL, "https://example.com/faq"},
+    }
+    for _, tc := range cases {
+        tc.file.FileSize = 42
+        tc.file.Content = "content"
+        tc.file.Status = PDFStatusCompleted
+        tc.file.Enabled = true
+        tc.file.UploadedAt = uploaded
+        source := NewKnowledgeSourceFromPDFFile(tc.file)
+        if source.Type != tc.wantType || source.Origin != tc.wantOrigin {
+            t.Errorf("%s: type %q, origin %q; want %q, %q", tc.name, source.Type, source.Origin, tc.wantType, tc.wantOrigin)
+        }
+        if source.ID != tc.file.ID || source.Name != tc.file.FileName || source.Size != 42 || source.Content != "content" ||
+            source.Status != PDFStatusCompleted || !source.Enabled || !source.CreatedAt.Equal(uploaded) {
+            t.Errorf("%s: source = %+v, want the file's fields carried over", tc.name, source)
+        }
+        if source.IsPDF() != (tc.wantType == KnowledgeSourcePDF) {
+            t.Errorf("%s: IsPDF = %v", tc.name, source.IsPDF())
+        }
+    }
+}
+
+func TestProjectSources(t *testing.T) {
+    legacy := []PDFFile{{ID: "old", FileName: "manual.pdf"}, {ID: "page", FileName: "FAQ", SourceType: KnowledgeSourceURL}}
+    current := []KnowledgeSource{{ID: "new", Type: KnowledgeSourceMarkdown, Name: "notes.md"}}
+
+    if sources := (Project{}).Sources(); len(sources) != 0 {
+        t.Errorf("no files: sources = %+v, want none", sources)
+    }
+    sources := Project{PDFFiles: legacy}.Sources()
+    if len(sources) != 2 || sources[0].Type != KnowledgeSourcePDF || sources[1].Type != KnowledgeSourceURL {
+        t.Errorf("unmigrated project: sources = %+v, want the pdf_files converted in order", sources)
+    }
+    // Once a project has knowledge sources, left-over pdf_files are ignored
+    sources = Project{PDFFiles: legacy, KnowledgeSources: current}.Sources()
+    if len(sources) != 1 || sources[0].ID != "new" {
+        t.Errorf("migrated project: sources = %+v, want only knowledge_sources", sources)
+    }
+}
+
+func TestNewPDFFileResponseKeepsSourceType(t *testing.T) {
+    source := KnowledgeSource{ID: "p", Type: KnowledgeSourceURL, Name: "FAQ", Origin: "https://example.com/faq", Size: 10, Enabled: true}
+    response := NewPDFFileResponse(source)
+    if response.FileName != "FAQ" || response.SourceType != KnowledgeSourceURL || response.SourceURL != source.Origin || response.FileSize != 10 {
+        t.Errorf("response = %+v, want the page in the pdf_files shape", response)
+    }
+    if responses := NewKnowledgeSourceResponses(nil); responses == nil {
+        t.Error("NewKnowledgeSourceResponses(nil) = nil, want an empty list")
+    }
+}
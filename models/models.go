@@ -2,6 +2,7 @@ package models
 
 import (
     "fmt"
+    "strings"
     "time"
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -16,6 +17,21 @@ type User struct {
     Role      string             `bson:"role" json:"role"`
     CreatedAt time.Time          `bson:"created_at" json:"created_at"`
     UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+    
+    // Password reset; only the token hash is stored and it is cleared once used
+    ResetTokenHash    string    `bson:"reset_token_hash,omitempty" json:"-"`
+    ResetTokenExpires time.Time `bson:"reset_token_expires,omitempty" json:"-"`
+}
+
+// RefreshToken is a long-lived token used to obtain new access tokens.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID    string             `bson:"user_id" json:"user_id"`
+    IsAdmin   bool               `bson:"is_admin" json:"is_admin"`
+    TokenHash string             `bson:"token_hash" json:"-"`
+    ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 }
 
 // ChatUser represents users who interact with embed chat widgets
@@ -24,9 +40,13 @@ type ChatUser struct {
     ProjectID string             `bson:"project_id" json:"project_id"`
     Name      string             `bson:"name" json:"name"`
     Email     string             `bson:"email" json:"email"`
+    NormalizedEmail string       `bson:"normalized_email,omitempty" json:"-"` // see NormalizeEmail; catches duplicate sign-ups
     Password  string             `bson:"password" json:"-"`
     CreatedAt time.Time          `bson:"created_at" json:"created_at"`
     IsActive  bool               `bson:"is_active" json:"is_active"`
+    PendingVerification bool     `bson:"pending_verification,omitempty" json:"pending_verification"` // can't log in until the email is confirmed
+    VerificationTokenHash string `bson:"verification_token_hash,omitempty" json:"-"`
+    VerificationExpires time.Time `bson:"verification_expires,omitempty" json:"-"`
 }
 
 // Project represents a chatbot project
@@ -36,16 +56,20 @@ type Project struct {
     Description     string             `bson:"description" json:"description"`
     Category        string             `bson:"category" json:"category"`
     IsActive        bool               `bson:"is_active" json:"is_active"`
+    OwnerID         primitive.ObjectID `bson:"owner_id,omitempty" json:"owner_id,omitempty"` // user who can manage the project; admins can access all
+    ExternalID      string             `bson:"external_id,omitempty" json:"external_id,omitempty"` // integrator's own ID; creating with a known one returns the existing project
     CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
     UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+    Version         int                `bson:"version" json:"version"` // bumped by every admin or owner change; UpdateProject checks it against If-Match
     
     // PDF Storage Fields
-    PDFFiles        []PDFFile          `bson:"pdf_files" json:"pdf_files"`
+    KnowledgeSources []KnowledgeSource `bson:"knowledge_sources" json:"knowledge_sources"`
+    PDFFiles        []PDFFile          `bson:"pdf_files,omitempty" json:"-"` // Deprecated: legacy copy of KnowledgeSources, see MigrateKnowledgeSources
     PDFContent      string             `bson:"pdf_content" json:"pdf_content"`
     
     // Gemini Configuration
     GeminiEnabled   bool               `bson:"gemini_enabled" json:"gemini_enabled"`
-    GeminiAPIKey    string             `bson:"gemini_api_key" json:"gemini_api_key"`
+    GeminiAPIKey    string             `bson:"gemini_api_key" json:"-"` // never serialized; ProjectResponse reports has_api_key
     GeminiUsage     int                `bson:"gemini_usage" json:"gemini_usage"`
     GeminiLimit     int                `bson:"gemini_limit" json:"gemini_limit"`
     GeminiModel     string             `bson:"gemini_model" json:"gemini_model"`
@@ -57,25 +81,77 @@ type Project struct {
     LastMonthlyReset    time.Time `bson:"last_monthly_reset" json:"last_monthly_reset"`
     EstimatedCostToday  float64   `bson:"estimated_cost_today" json:"estimated_cost_today"`
     EstimatedCostMonth  float64   `bson:"estimated_cost_month" json:"estimated_cost_month"`
+    MonthlyCostBudget   float64   `bson:"monthly_cost_budget" json:"monthly_cost_budget"` // USD per billing period; 0 means no budget
+    
+    // Subscription
+    Status          string             `bson:"status" json:"status"` // "active", "expired"
+    PlanID          string             `bson:"plan_id" json:"plan_id"`     // see Plans; limits below are copied from it
+    PlanName        string             `bson:"plan_name" json:"plan_name"`
+    StartDate       time.Time          `bson:"start_date,omitempty" json:"start_date,omitempty"` // billing anchor; monthly usage resets on this day of the month
+    TokensUsedMonth int                `bson:"tokens_used_month" json:"tokens_used_month"` // tokens used in the current billing period
+    MonthlyTokenLimit int              `bson:"monthly_token_limit" json:"monthly_token_limit"` // 0 means unlimited
+    LastTokenReset  time.Time          `bson:"last_token_reset,omitempty" json:"last_token_reset,omitempty"`
+    TokenGraceStartedAt time.Time      `bson:"token_grace_started_at,omitempty" json:"token_grace_started_at,omitempty"` // when this period's usage passed the token limit into the grace allowance
+    ExpiryDate      time.Time          `bson:"expiry_date,omitempty" json:"expiry_date,omitempty"`
+    DeletedAt       time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // set when soft-deleted
     
     // Analytics
     TotalQuestions  int                `bson:"total_questions" json:"total_questions"`
+    TotalTokensUsed int                `bson:"total_tokens_used" json:"total_tokens_used"`
     LastUsed        time.Time          `bson:"last_used" json:"last_used"`
     
     // Additional Fields for Enhanced Functionality
     WelcomeMessage  string             `bson:"welcome_message" json:"welcome_message"`
+    SystemPrompt    string             `bson:"system_prompt" json:"system_prompt"`
+    ResponseDelayMs int                `bson:"response_delay_ms" json:"response_delay_ms"`
+    WebhookURL      string             `bson:"webhook_url" json:"webhook_url"`
+    NotificationSettings NotificationSettings `bson:"notification_settings" json:"notification_settings"`
+    Moderation      ModerationSettings `bson:"moderation" json:"moderation"`
+    WidgetConfig    WidgetConfig       `bson:"widget_config" json:"widget_config"`
+    Registration    RegistrationSettings `bson:"registration" json:"registration"`
+    ChatUserCount   int                `bson:"chat_user_count" json:"chat_user_count"` // chat users registered through the widget
+    SafetySettings  []SafetySetting    `bson:"safety_settings,omitempty" json:"safety_settings"` // Gemini's defaults apply to unlisted categories
+    RateLimitPerMinute int             `bson:"rate_limit_per_minute" json:"rate_limit_per_minute"` // 0 uses the default chat limit
+    AllowedDomains  []string           `bson:"allowed_domains" json:"allowed_domains"` // sites allowed to embed the widget; empty allows any
+    ForcedLanguage  string             `bson:"forced_language" json:"forced_language"` // e.g. "Spanish"; empty replies in the user's language
+    RetentionDays   int                `bson:"retention_days" json:"retention_days"` // days to keep chat messages and usage logs; 0 uses the server default
+    MaxSessionMessages int             `bson:"max_session_messages" json:"max_session_messages"` // messages allowed in one chat session; 0 means unlimited
 }
 
 
-// PDFFile represents uploaded PDF files for each project
+// PDFFile is the legacy record of an uploaded knowledge file, stored in pdf_files.
+//
+// Deprecated: use KnowledgeSource. MigrateKnowledgeSources copies pdf_files into
+// knowledge_sources; the field is only read for projects not migrated yet.
 type PDFFile struct {
     ID          string    `bson:"id" json:"id"`
     FileName    string    `bson:"file_name" json:"file_name"`
     FilePath    string    `bson:"file_path" json:"file_path"`
     FileSize    int64     `bson:"file_size" json:"file_size"`
+    Hash        string    `bson:"hash,omitempty" json:"hash,omitempty"` // SHA-256 of the file's bytes
     UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
     ProcessedAt time.Time `bson:"processed_at" json:"processed_at"`
     Status      string    `bson:"status" json:"status"` // "processing", "completed", "failed"
+    Error       string    `bson:"error,omitempty" json:"error,omitempty"` // why processing failed
+    Enabled     bool      `bson:"enabled" json:"enabled"`
+    Content     string    `bson:"content" json:"-"`
+    SourceType  string    `bson:"source_type,omitempty" json:"source_type,omitempty"` // KnowledgeSource*; empty means PDF
+    SourceURL   string    `bson:"source_url,omitempty" json:"source_url,omitempty"`   // page a URL source was fetched from
+}
+
+// KnowledgeChunk is a retrievable piece of a project's knowledge base, cut from one knowledge source
+type KnowledgeChunk struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ProjectID primitive.ObjectID `bson:"project_id" json:"project_id"`
+    FileID    string             `bson:"file_id" json:"file_id"`
+    FileName  string             `bson:"file_name" json:"file_name"`
+    Index     int                `bson:"index" json:"index"` // position within the file
+    Content   string             `bson:"content" json:"content"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+    
+    // Semantic search vector; empty when embedding failed or Gemini is not configured
+    Embedding      []float32 `bson:"embedding,omitempty" json:"-"`
+    EmbeddingModel string    `bson:"embedding_model,omitempty" json:"embedding_model,omitempty"`
 }
 
 // GeminiUsageLog tracks AI usage for analytics and billing
@@ -95,9 +171,19 @@ type GeminiUsageLog struct {
     EstimatedCost   float64            `bson:"estimated_cost" json:"estimated_cost"`
     ResponseTime    int64              `bson:"response_time_ms" json:"response_time_ms"`
     Success         bool               `bson:"success" json:"success"`
+    Error           string             `bson:"error,omitempty" json:"error,omitempty"` // why a failed request failed
+    BlockedBySafety bool               `bson:"blocked_by_safety,omitempty" json:"blocked_by_safety,omitempty"` // Gemini's safety filter refused the request
+    BlockReason     string             `bson:"block_reason,omitempty" json:"block_reason,omitempty"` // e.g. "prompt: BlockReasonSafety"
+    
+    // Set on failed requests once an admin has replayed them
+    ReplayedAt      time.Time          `bson:"replayed_at,omitempty" json:"replayed_at,omitempty"`
+    ReplaySuccess   bool               `bson:"replay_success,omitempty" json:"replay_success,omitempty"`
 }
 
 
+// ChatReplySuccess is the ChatMessage.Status of a reply that answered the question
+const ChatReplySuccess = "success"
+
 // ChatMessage represents individual chat messages
 type ChatMessage struct {
     ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -109,6 +195,13 @@ type ChatMessage struct {
     Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
     IPAddress string             `bson:"ip_address" json:"ip_address"`
     
+    // Outcome of the reply, as reported to the client ("success", "error",
+    // "content_blocked", ...). Empty on messages saved before it was recorded.
+    Status string `bson:"status,omitempty" json:"status,omitempty"`
+    
+    // Set on a regenerated answer: the message whose question it answers again
+    RegeneratedFrom primitive.ObjectID `bson:"regenerated_from,omitempty" json:"regenerated_from,omitempty"`
+    
     // User authentication fields
     UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
     UserName  string             `bson:"user_name,omitempty" json:"user_name,omitempty"`
@@ -118,6 +211,23 @@ type ChatMessage struct {
     Rating    int                `bson:"rating,omitempty" json:"rating,omitempty"`
     Feedback  string             `bson:"feedback,omitempty" json:"feedback,omitempty"`
     RatedAt   time.Time          `bson:"rated_at,omitempty" json:"rated_at,omitempty"`
+    
+    // Thumbs up/down feedback from the widget, separate from the star rating
+    Helpful   *bool              `bson:"helpful,omitempty" json:"helpful,omitempty"`
+    HelpfulAt time.Time          `bson:"helpful_at,omitempty" json:"helpful_at,omitempty"`
+}
+
+// IdempotencyRecord remembers the response to a message submitted with an idempotency
+// key so a retried submission gets the same answer instead of a second reply
+type IdempotencyRecord struct {
+    ID          string    `bson:"_id" json:"id"` // project ID and key
+    ProjectID   string    `bson:"project_id" json:"project_id"`
+    Key         string    `bson:"key" json:"key"`
+    Status      string    `bson:"status" json:"status"` // "pending", "completed"
+    StatusCode  int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+    ContentType string    `bson:"content_type,omitempty" json:"content_type,omitempty"`
+    Body        []byte    `bson:"body,omitempty" json:"-"`
+    CreatedAt   time.Time `bson:"created_at" json:"created_at"`
 }
 
 // ChatSession represents a chat session
@@ -128,8 +238,25 @@ type ChatSession struct {
     UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"user_id"`
     IsActive  bool               `bson:"is_active" json:"is_active"`
     StartTime time.Time          `bson:"start_time" json:"start_time"`
-    EndTime   time.Time          `bson:"end_time" json:"end_time"`
+    EndTime   time.Time          `bson:"end_time,omitempty" json:"end_time,omitempty"` // set when the session is ended
     IPAddress string             `bson:"ip_address" json:"ip_address"`
+    LastActivity time.Time       `bson:"last_activity" json:"last_activity"`
+    MessageCount int             `bson:"message_count" json:"message_count"`
+}
+
+// Notification records an alert raised for a project and its webhook delivery
+type Notification struct {
+    ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ProjectID        primitive.ObjectID `bson:"project_id" json:"project_id"`
+    Type             string             `bson:"type" json:"type"`
+    Message          string             `bson:"message" json:"message"`
+    CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+    DeliveryStatus   string             `bson:"delivery_status,omitempty" json:"delivery_status,omitempty"` // "pending", "delivered", "failed"
+    DeliveryAttempts int                `bson:"delivery_attempts,omitempty" json:"delivery_attempts,omitempty"`
+    DeliveryError    string             `bson:"delivery_error,omitempty" json:"delivery_error,omitempty"`
+    DeliveredAt      time.Time          `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+    Read             bool               `bson:"read" json:"read"`
+    ReadAt           time.Time          `bson:"read_at,omitempty" json:"read_at,omitempty"`
 }
 
 // ===== HELPER METHODS =====
@@ -155,6 +282,43 @@ func (p *Project) Validate() error {
     if p.GeminiLimit <= 0 {
         return fmt.Errorf("gemini usage limit must be greater than 0")
     }
+    if p.MonthlyCostBudget < 0 || p.MonthlyCostBudget > MaxMonthlyCostBudget {
+        return fmt.Errorf("monthly cost budget must be between 0 and %d", MaxMonthlyCostBudget)
+    }
+    if p.RetentionDays < 0 || p.RetentionDays > MaxRetentionDays {
+        return fmt.Errorf("retention days must be between 0 and %d", MaxRetentionDays)
+    }
+    if p.MaxSessionMessages < 0 || p.MaxSessionMessages > MaxSessionMessagesLimit {
+        return fmt.Errorf("max session messages must be between 0 and %d", MaxSessionMessagesLimit)
+    }
+    if p.WebhookURL != "" {
+        if err := ValidateWebhookURL(p.WebhookURL); err != nil {
+            return err
+        }
+    }
+    if err := p.Moderation.Validate(); err != nil {
+        return err
+    }
+    if err := ValidateSafetySettings(p.SafetySettings); err != nil {
+        return err
+    }
+    if err := p.WidgetConfig.Validate(); err != nil {
+        return err
+    }
+    if err := p.Registration.Validate(); err != nil {
+        return err
+    }
+    if len(p.ExternalID) > MaxExternalIDLength {
+        return fmt.Errorf("external ID must be at most %d characters", MaxExternalIDLength)
+    }
+    if len(p.ForcedLanguage) > MaxForcedLanguageLength {
+        return fmt.Errorf("forced language must be at most %d characters", MaxForcedLanguageLength)
+    }
+    for _, domain := range p.AllowedDomains {
+        if domain == "" || strings.ContainsAny(domain, " \t\r\n;,'\"") {
+            return fmt.Errorf("invalid allowed domain %q", domain)
+        }
+    }
     return nil
 }
 
@@ -171,14 +335,43 @@ func (p *Project) GetUsagePercentage() float64 {
     return float64(p.GeminiUsage) / float64(p.GeminiLimit) * 100
 }
 
-// IsProcessed checks if PDF file is successfully processed
-func (pdf *PDFFile) IsProcessed() bool {
-    return pdf.Status == "completed"
+// BillingPeriodStart returns when the billing period containing now began: the latest
+// occurrence of the anchor's day of the month (clamped to shorter months) at or before now.
+// The anchor is StartDate, falling back to CreatedAt for older projects.
+func (p *Project) BillingPeriodStart(now time.Time) time.Time {
+    anchor := p.StartDate
+    if anchor.IsZero() {
+        anchor = p.CreatedAt
+    }
+    anchor = anchor.UTC()
+    now = now.UTC()
+
+    start := anchoredMonthDay(anchor, now.Year(), now.Month())
+    if start.After(now) {
+        start = anchoredMonthDay(anchor, now.Year(), now.Month()-1)
+    }
+    return start
+}
+
+// NextBillingReset returns when the billing period containing now ends
+func (p *Project) NextBillingReset(now time.Time) time.Time {
+    anchor := p.StartDate
+    if anchor.IsZero() {
+        anchor = p.CreatedAt
+    }
+    start := p.BillingPeriodStart(now)
+    return anchoredMonthDay(anchor.UTC(), start.Year(), start.Month()+1)
 }
 
-// IsFailed checks if PDF processing failed
-func (pdf *PDFFile) IsFailed() bool {
-    return pdf.Status == "failed"
+// anchoredMonthDay is the anchor's day and time of day in the given month,
+// moved back to the last day when the month is shorter
+func anchoredMonthDay(anchor time.Time, year int, month time.Month) time.Time {
+    lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+    day := anchor.Day()
+    if day > lastDay {
+        day = lastDay
+    }
+    return time.Date(year, month, day, anchor.Hour(), anchor.Minute(), anchor.Second(), 0, time.UTC)
 }
 
 // ===== CONSTANTS =====
@@ -188,6 +381,13 @@ const (
     RoleAdmin = "admin"
 )
 
+// Idempotency Constants
+const (
+    IdempotencyPending   = "pending"
+    IdempotencyCompleted = "completed"
+    IdempotencyKeyTTL    = 24 * time.Hour // how long a key is remembered
+)
+
 // PDF Processing Status Constants
 const (
     PDFStatusProcessing = "processing"
@@ -197,7 +397,59 @@ const (
 
 // Gemini Model Constants
 const (
-    GeminiModelFlash = "gemini-1.5-flash"
-    GeminiModelPro   = "gemini-1.5-pro"
+    GeminiModelFlash       = "gemini-1.5-flash"
+    GeminiModelPro         = "gemini-1.5-pro"
+    GeminiModel20Flash     = "gemini-2.0-flash"
+    GeminiModel20FlashLite = "gemini-2.0-flash-lite"
+    GeminiModel25Flash     = "gemini-2.5-flash"
+    GeminiModel25FlashLite = "gemini-2.5-flash-lite"
+    GeminiModel25Pro       = "gemini-2.5-pro"
+    GeminiEmbeddingModel   = "text-embedding-004"
+    DefaultGeminiModel     = GeminiModelFlash
+)
+
+// Prompt Constants
+const (
+    MaxSystemPromptLength   = 8000
+    MaxForcedLanguageLength = 50
+    MaxExternalIDLength     = 128
 )
 
+// Chat Message Constants
+const (
+    DefaultMaxMessageLength = 1000 // characters; override with MAX_MESSAGE_LENGTH
+)
+
+// Project Setting Range Constants
+const (
+    MaxRetentionDays        = 3650   // ten years
+    MaxSessionMessagesLimit = 10000
+    MaxMonthlyCostBudget    = 100000 // USD
+)
+
+// Response Delay Constants
+const (
+    MaxResponseDelayMs = 10000
+)
+
+// Project Subscription Status Constants
+const (
+    ProjectStatusActive  = "active"
+    ProjectStatusExpired = "expired"
+)
+
+// Notification Type Constants
+const (
+    NotificationDailyLimitWarning   = "daily_limit_warning"
+    NotificationDailyLimitReached   = "daily_limit_reached"
+    NotificationMonthlyLimitWarning = "monthly_limit_warning"
+    NotificationMonthlyLimitReached = "monthly_limit_reached"
+    NotificationExpiryWarning       = "expiry_warning"
+)
+
+// Notification Delivery Status Constants
+const (
+    DeliveryStatusPending   = "pending"
+    DeliveryStatusDelivered = "delivered"
+    DeliveryStatusFailed    = "failed"
+)
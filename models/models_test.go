@@ -0,0 +1,83 @@
+package models
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func validProject() Project {
+    return Project{Name: "Support", GeminiAPIKey: "key", GeminiLimit: 100}
+}
+
+func TestProjectValidateRanges(t *testing.T) {
+    cases := []struct {
+        name   string
+        modify func(p *Project)
+        valid  bool
+    }{
+        {"defaults", func(p *Project) {}, true},
+        {"retention at max", func(p *Project) { p.RetentionDays = MaxRetentionDays }, true},
+        {"retention over max", func(p *Project) { p.RetentionDays = MaxRetentionDays + 1 }, false},
+        {"negative retention", func(p *Project) { p.RetentionDays = -1 }, false},
+        {"session messages at max", func(p *Project) { p.MaxSessionMessages = MaxSessionMessagesLimit }, true},
+        {"session messages over max", func(p *Project) { p.MaxSessionMessages = MaxSessionMessagesLimit + 1 }, false},
+        {"negative session messages", func(p *Project) { p.MaxSessionMessages = -1 }, false},
+        {"budget at max", func(p *Project) { p.MonthlyCostBudget = MaxMonthlyCostBudget }, true},
+        {"budget over max", func(p *Project) { p.MonthlyCostBudget = MaxMonthlyCostBudget + 0.01 }, false},
+        {"negative budget", func(p *Project) { p.MonthlyCostBudget = -5 }, false},
+        {"https webhook", func(p *Project) { p.WebhookURL = "https://hooks.example.com/x" }, true},
+        {"http webhook", func(p *Project) { p.WebhookURL = "http://hooks.example.com/x" }, false},
+        {"loopback webhook", func(p *Project) { p.WebhookURL = "https://127.0.0.1:8080/x" }, false},
+        {"external ID at max", func(p *Project) { p.ExternalID = strings.Repeat("x", MaxExternalIDLength) }, true},
+        {"external ID over max", func(p *Project) { p.ExternalID = strings.Repeat("x", MaxExternalIDLength+1) }, false},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            project := validProject()
+            tc.modify(&project)
+            err := project.Validate()
+            if tc.valid && err != nil {
+                t.Errorf("Validate() = %v, want valid", err)
+            }
+            if !tc.valid && err == nil {
+                t.Error("Validate() accepted an out-of-range project")
+            }
+        })
+    }
+}
+
+func TestBillingPeriodStart(t *testing.T) {
+    date := func(year int, month time.Month, day, hour int) time.Time {
+        return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+    }
+    cases := []struct {
+        name                string
+        anchor, now         time.Time
+        wantStart, wantNext time.Time
+    }{
+        {"after this month's anchor", date(2026, 1, 15, 9), date(2026, 5, 20, 0), date(2026, 5, 15, 9), date(2026, 6, 15, 9)},
+        {"before this month's anchor", date(2026, 1, 15, 9), date(2026, 5, 10, 0), date(2026, 4, 15, 9), date(2026, 5, 15, 9)},
+        {"same day, before the anchor time", date(2026, 1, 15, 9), date(2026, 5, 15, 8), date(2026, 4, 15, 9), date(2026, 5, 15, 9)},
+        {"anchor on the 31st in a short month", date(2026, 1, 31, 0), date(2026, 2, 28, 12), date(2026, 2, 28, 0), date(2026, 3, 31, 0)},
+        {"across the new year", date(2025, 12, 20, 0), date(2027, 1, 5, 0), date(2026, 12, 20, 0), date(2027, 1, 20, 0)},
+    }
+    for _, tc := range cases {
+        project := Project{StartDate: tc.anchor}
+        if got := project.BillingPeriodStart(tc.now); !got.Equal(tc.wantStart) {
+            t.Errorf("%s: BillingPeriodStart = %s, want %s", tc.name, got, tc.wantStart)
+        }
+        if got := project.NextBillingReset(tc.now); !got.Equal(tc.wantNext) {
+            t.Errorf("%s: NextBillingReset = %s, want %s", tc.name, got, tc.wantNext)
+        }
+    }
+}
+
+func TestBillingPeriodFallsBackToCreatedAt(t *testing.T) {
+    created := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+    project := Project{CreatedAt: created}
+    want := time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)
+    if got := project.BillingPeriodStart(time.Date(2026, 6, 12, 0, 0, 0, 0, time.UTC)); !got.Equal(want) {
+        t.Errorf("BillingPeriodStart = %s, want %s anchored on created_at", got, want)
+    }
+}
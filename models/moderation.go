@@ -0,0 +1,39 @@
+package models
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Moderation Action Constants
+const (
+    ModerationActionReject = "reject" // refuse the message
+    ModerationActionMask   = "mask"   // replace blocked words with asterisks and carry on
+)
+
+// ModerationSettings screen a project's inbound chat messages before they are stored
+// or sent to Gemini. The zero value leaves messages unmoderated.
+type ModerationSettings struct {
+    Enabled      bool     `bson:"enabled" json:"enabled"`
+    Action       string   `bson:"action,omitempty" json:"action"`               // "reject" (default) or "mask"
+    BlockedWords []string `bson:"blocked_words,omitempty" json:"blocked_words"` // added to the server-wide list
+    GeminiSafety bool     `bson:"gemini_safety" json:"gemini_safety"`           // also have Gemini block harassment, hate, sexual and dangerous content
+}
+
+// MaskBlockedWords reports whether blocked words are masked rather than the message refused
+func (m ModerationSettings) MaskBlockedWords() bool {
+    return m.Action == ModerationActionMask
+}
+
+// Validate checks the action and word list
+func (m ModerationSettings) Validate() error {
+    if m.Action != "" && m.Action != ModerationActionReject && m.Action != ModerationActionMask {
+        return fmt.Errorf("moderation action must be %q or %q", ModerationActionReject, ModerationActionMask)
+    }
+    for _, word := range m.BlockedWords {
+        if strings.TrimSpace(word) == "" {
+            return fmt.Errorf("blocked words cannot be empty")
+        }
+    }
+    return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import "fmt"
+
+// Notification Channel Constants
+const (
+    NotificationChannelWebhook = "webhook"
+    NotificationChannelEmail   = "email"
+)
+
+// DefaultWarningThreshold is the usage percentage that raises a limit warning
+// when a project hasn't chosen its own
+const DefaultWarningThreshold = 80
+
+// NotificationTypes lists every notification a project can opt out of
+var NotificationTypes = []string{
+    NotificationDailyLimitWarning,
+    NotificationDailyLimitReached,
+    NotificationMonthlyLimitWarning,
+    NotificationMonthlyLimitReached,
+    NotificationExpiryWarning,
+}
+
+// NotificationChannels lists the ways a notification is delivered besides being stored
+var NotificationChannels = []string{NotificationChannelWebhook, NotificationChannelEmail}
+
+// NotificationSettings is a project's notification preferences. The zero value
+// sends every type on every channel with the default warning threshold.
+type NotificationSettings struct {
+    DisabledTypes    []string `bson:"disabled_types,omitempty" json:"disabled_types"`
+    WarningThreshold int      `bson:"warning_threshold,omitempty" json:"warning_threshold"` // percent of a limit; 0 uses DefaultWarningThreshold
+    Channels         []string `bson:"channels,omitempty" json:"channels"`                   // empty delivers on every channel
+}
+
+// TypeEnabled reports whether notifications of the given type should be raised
+func (s NotificationSettings) TypeEnabled(notificationType string) bool {
+    return !containsString(s.DisabledTypes, notificationType)
+}
+
+// ChannelEnabled reports whether notifications should be delivered on channel
+func (s NotificationSettings) ChannelEnabled(channel string) bool {
+    return len(s.Channels) == 0 || containsString(s.Channels, channel)
+}
+
+// WarningPercent returns the usage percentage at which limit warnings are raised
+func (s NotificationSettings) WarningPercent() int {
+    if s.WarningThreshold <= 0 {
+        return DefaultWarningThreshold
+    }
+    return s.WarningThreshold
+}
+
+// Validate checks the settings only name known types and channels
+func (s NotificationSettings) Validate() error {
+    for _, notificationType := range s.DisabledTypes {
+        if !containsString(NotificationTypes, notificationType) {
+            return fmt.Errorf("unknown notification type %q", notificationType)
+        }
+    }
+    for _, channel := range s.Channels {
+        if !containsString(NotificationChannels, channel) {
+            return fmt.Errorf("unknown notification channel %q", channel)
+        }
+    }
+    if s.WarningThreshold < 0 || s.WarningThreshold >= 100 {
+        return fmt.Errorf("warning threshold must be between 1 and 99 percent, or 0 for the default")
+    }
+    return nil
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
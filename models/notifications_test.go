@@ -0,0 +1,60 @@
+package models
+
+import "testing"
+
+func TestNotificationSettingsDefaults(t *testing.T) {
+    var settings NotificationSettings
+    for _, notificationType := range NotificationTypes {
+        if !settings.TypeEnabled(notificationType) {
+            t.Errorf("%s is disabled by default", notificationType)
+        }
+    }
+    for _, channel := range NotificationChannels {
+        if !settings.ChannelEnabled(channel) {
+            t.Errorf("%s channel is disabled by default", channel)
+        }
+    }
+    if got := settings.WarningPercent(); got != DefaultWarningThreshold {
+        t.Errorf("WarningPercent = %d, want %d", got, DefaultWarningThreshold)
+    }
+}
+
+func TestNotificationSettingsChoices(t *testing.T) {
+    settings := NotificationSettings{
+        DisabledTypes:    []string{NotificationExpiryWarning},
+        WarningThreshold: 90,
+        Channels:         []string{NotificationChannelEmail},
+    }
+    if settings.TypeEnabled(NotificationExpiryWarning) {
+        t.Error("a disabled type is still enabled")
+    }
+    if !settings.TypeEnabled(NotificationDailyLimitReached) {
+        t.Error("disabling one type turned off another")
+    }
+    if settings.ChannelEnabled(NotificationChannelWebhook) || !settings.ChannelEnabled(NotificationChannelEmail) {
+        t.Error("only the listed channels should be enabled")
+    }
+    if got := settings.WarningPercent(); got != 90 {
+        t.Errorf("WarningPercent = %d, want 90", got)
+    }
+}
+
+func TestNotificationSettingsValidate(t *testing.T) {
+    cases := []struct {
+        name     string
+        settings NotificationSettings
+        valid    bool
+    }{
+        {"zero value", NotificationSettings{}, true},
+        {"known choices", NotificationSettings{DisabledTypes: []string{NotificationDailyLimitWarning}, Channels: []string{NotificationChannelWebhook}, WarningThreshold: 75}, true},
+        {"unknown type", NotificationSettings{DisabledTypes: []string{"daily_digest"}}, false},
+        {"unknown channel", NotificationSettings{Channels: []string{"sms"}}, false},
+        {"negative threshold", NotificationSettings{WarningThreshold: -1}, false},
+        {"threshold at 100", NotificationSettings{WarningThreshold: 100}, false},
+    }
+    for _, tc := range cases {
+        if err := tc.settings.Validate(); (err == nil) != tc.valid {
+            t.Errorf("%s: Validate() = %v, want valid = %v", tc.name, err, tc.valid)
+        }
+    }
+}
@@ -0,0 +1,64 @@
+package models
+
+// ===== SUBSCRIPTION PLANS =====
+
+// Plan IDs
+const (
+    PlanFree    = "free"
+    PlanStarter = "starter"
+    PlanPro     = "pro"
+
+    DefaultPlanID = PlanFree // applied to new projects that don't choose a plan
+)
+
+// Plan bundles the usage limits a project gets on a subscription tier
+type Plan struct {
+    ID                 string `json:"id"`
+    Name               string `json:"name"`
+    GeminiLimit        int    `json:"gemini_limit"`          // lifetime Gemini requests
+    GeminiDailyLimit   int    `json:"gemini_daily_limit"`
+    GeminiMonthlyLimit int    `json:"gemini_monthly_limit"`  // per billing period
+    RateLimitPerMinute int    `json:"rate_limit_per_minute"` // chat messages per client
+    MonthlyTokenLimit  int    `json:"monthly_token_limit"`   // per billing period
+}
+
+// Plans lists the available plans, cheapest first
+var Plans = []Plan{
+    {ID: PlanFree, Name: "Free", GeminiLimit: 1000, GeminiDailyLimit: 50, GeminiMonthlyLimit: 1000, RateLimitPerMinute: 10, MonthlyTokenLimit: 500000},
+    {ID: PlanStarter, Name: "Starter", GeminiLimit: 20000, GeminiDailyLimit: 500, GeminiMonthlyLimit: 10000, RateLimitPerMinute: 30, MonthlyTokenLimit: 5000000},
+    {ID: PlanPro, Name: "Pro", GeminiLimit: 200000, GeminiDailyLimit: 5000, GeminiMonthlyLimit: 100000, RateLimitPerMinute: 60, MonthlyTokenLimit: 50000000},
+}
+
+// FindPlan looks up a plan by ID
+func FindPlan(id string) (Plan, bool) {
+    for _, plan := range Plans {
+        if plan.ID == id {
+            return plan, true
+        }
+    }
+    return Plan{}, false
+}
+
+// ApplyPlan sets the project's plan and copies the plan's limits onto it
+func (p *Project) ApplyPlan(plan Plan) {
+    p.PlanID = plan.ID
+    p.PlanName = plan.Name
+    p.GeminiLimit = plan.GeminiLimit
+    p.GeminiDailyLimit = plan.GeminiDailyLimit
+    p.GeminiMonthlyLimit = plan.GeminiMonthlyLimit
+    p.RateLimitPerMinute = plan.RateLimitPerMinute
+    p.MonthlyTokenLimit = plan.MonthlyTokenLimit
+}
+
+// LimitFields are the stored fields a plan sets, for applying it in a single update
+func (plan Plan) LimitFields() map[string]interface{} {
+    return map[string]interface{}{
+        "plan_id":               plan.ID,
+        "plan_name":             plan.Name,
+        "gemini_limit":          plan.GeminiLimit,
+        "gemini_daily_limit":    plan.GeminiDailyLimit,
+        "gemini_monthly_limit":  plan.GeminiMonthlyLimit,
+        "rate_limit_per_minute": plan.RateLimitPerMinute,
+        "monthly_token_limit":   plan.MonthlyTokenLimit,
+    }
+}
@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestFindPlan(t *testing.T) {
+    plan, ok := FindPlan(PlanStarter)
+    if !ok || plan.Name != "Starter" {
+        t.Errorf("FindPlan(starter) = %+v, %v", plan, ok)
+    }
+    if _, ok := FindPlan("enterprise"); ok {
+        t.Error("an unknown plan must not be found")
+    }
+    if _, ok := FindPlan(DefaultPlanID); !ok {
+        t.Error("the default plan must exist")
+    }
+}
+
+func TestPlansCheapestFirst(t *testing.T) {
+    for i := 1; i < len(Plans); i++ {
+        if Plans[i].GeminiMonthlyLimit <= Plans[i-1].GeminiMonthlyLimit {
+            t.Errorf("%s does not raise the monthly limit over %s", Plans[i].ID, Plans[i-1].ID)
+        }
+    }
+}
+
+func TestApplyPlanMatchesLimitFields(t *testing.T) {
+    plan, _ := FindPlan(PlanPro)
+    project := Project{Name: "Support", GeminiLimit: 1}
+    project.ApplyPlan(plan)
+
+    if project.PlanID != PlanPro || project.PlanName != "Pro" {
+        t.Errorf("plan = %s/%s, want pro/Pro", project.PlanID, project.PlanName)
+    }
+    // ApplyPlan and the stored update must set the same values
+    fields := plan.LimitFields()
+    got := map[string]interface{}{
+        "plan_id":               project.PlanID,
+        "plan_name":             project.PlanName,
+        "gemini_limit":          project.GeminiLimit,
+        "gemini_daily_limit":    project.GeminiDailyLimit,
+        "gemini_monthly_limit":  project.GeminiMonthlyLimit,
+        "rate_limit_per_minute": project.RateLimitPerMinute,
+        "monthly_token_limit":   project.MonthlyTokenLimit,
+    }
+    if len(fields) != len(got) {
+        t.Fatalf("LimitFields has %d fields, want %d", len(fields), len(got))
+    }
+    for key, value := range got {
+        if fields[key] != value {
+            t.Errorf("%s: project = %v, LimitFields = %v", key, value, fields[key])
+        }
+    }
+}
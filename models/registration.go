@@ -0,0 +1,63 @@
+package models
+
+import (
+    "fmt"
+    "strings"
+)
+
+// DisposableEmailDomains are throwaway mail services refused when chat users register
+var DisposableEmailDomains = []string{
+    "mailinator.com",
+    "guerrillamail.com",
+    "10minutemail.com",
+    "tempmail.com",
+    "temp-mail.org",
+    "yopmail.com",
+    "trashmail.com",
+    "sharklasers.com",
+    "getnada.com",
+    "dispostable.com",
+}
+
+// RegistrationSettings limit sign-ups to a project's embedded chat. The zero value
+// allows unlimited registrations without email verification.
+type RegistrationSettings struct {
+    MaxUsers            int  `bson:"max_users" json:"max_users"` // registrations allowed in total; 0 means unlimited
+    RequireVerification bool `bson:"require_verification" json:"require_verification"` // new users must confirm their email before logging in
+}
+
+// Validate checks the registration cap
+func (r RegistrationSettings) Validate() error {
+    if r.MaxUsers < 0 {
+        return fmt.Errorf("max users cannot be negative")
+    }
+    return nil
+}
+
+// NormalizeEmail reduces an address to the mailbox it delivers to, so "John.Doe+chat@gmail.com"
+// and "johndoe@gmail.com" count as the same registration
+func NormalizeEmail(email string) string {
+    email = strings.ToLower(strings.TrimSpace(email))
+    at := strings.LastIndex(email, "@")
+    if at < 0 {
+        return email
+    }
+    local, domain := email[:at], email[at+1:]
+    if plus := strings.Index(local, "+"); plus >= 0 {
+        local = local[:plus]
+    }
+    if domain == "gmail.com" || domain == "googlemail.com" {
+        local = strings.ReplaceAll(local, ".", "")
+        domain = "gmail.com"
+    }
+    return local + "@" + domain
+}
+
+// IsDisposableEmail reports whether email belongs to a throwaway mail service
+func IsDisposableEmail(email string) bool {
+    at := strings.LastIndex(email, "@")
+    if at < 0 {
+        return false
+    }
+    return containsString(DisposableEmailDomains, strings.ToLower(email[at+1:]))
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ===== API RESPONSES =====
+// Handlers return these instead of the stored documents so internal fields
+// (API keys, password hashes, file paths, extracted PDF text) never reach clients.
+
+// ProjectResponse is the public view of a Project
+type ProjectResponse struct {
+    ID          primitive.ObjectID `json:"id"`
+    Name        string             `json:"name"`
+    Description string             `json:"description"`
+    Category    string             `json:"category"`
+    IsActive    bool               `json:"is_active"`
+    OwnerID     string             `json:"owner_id,omitempty"`
+    ExternalID  string             `json:"external_id,omitempty"`
+    CreatedAt   time.Time          `json:"created_at"`
+    UpdatedAt   time.Time          `json:"updated_at"`
+    Version     int                `json:"version"`
+
+    KnowledgeSources []KnowledgeSourceResponse `json:"knowledge_sources"`
+    PDFFiles         []PDFFileResponse         `json:"pdf_files"` // Deprecated: the same sources in the old shape
+
+    GeminiEnabled      bool    `json:"gemini_enabled"`
+    HasAPIKey          bool    `json:"has_api_key"`
+    GeminiModel        string  `json:"gemini_model"`
+    GeminiUsage        int     `json:"gemini_usage"`
+    GeminiLimit        int     `json:"gemini_limit"`
+    GeminiUsageToday   int     `json:"gemini_usage_today"`
+    GeminiUsageMonth   int     `json:"gemini_usage_month"`
+    GeminiDailyLimit   int     `json:"gemini_daily_limit"`
+    GeminiMonthlyLimit int     `json:"gemini_monthly_limit"`
+    EstimatedCostToday float64 `json:"estimated_cost_today"`
+    EstimatedCostMonth float64 `json:"estimated_cost_month"`
+    MonthlyCostBudget  float64 `json:"monthly_cost_budget"`
+
+    Status          string     `json:"status"`
+    PlanID          string     `json:"plan_id"`
+    PlanName        string     `json:"plan_name"`
+    StartDate       *time.Time `json:"start_date,omitempty"`
+    TokensUsedMonth   int        `json:"tokens_used_month"`
+    MonthlyTokenLimit int        `json:"monthly_token_limit"`
+    LastTokenReset  *time.Time `json:"last_token_reset,omitempty"`
+    TokenGraceStartedAt *time.Time `json:"token_grace_started_at,omitempty"`
+    ExpiryDate      *time.Time `json:"expiry_date,omitempty"`
+    DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+
+    TotalQuestions  int        `json:"total_questions"`
+    TotalTokensUsed int        `json:"total_tokens_used"`
+    LastUsed        *time.Time `json:"last_used,omitempty"`
+
+    WelcomeMessage     string `json:"welcome_message"`
+    SystemPrompt       string `json:"system_prompt"`
+    ResponseDelayMs    int    `json:"response_delay_ms"`
+    WebhookURL         string `json:"webhook_url"`
+    RateLimitPerMinute int    `json:"rate_limit_per_minute"`
+
+    AllowedDomains []string `json:"allowed_domains"`
+    ForcedLanguage string   `json:"forced_language"`
+    RetentionDays  int      `json:"retention_days"`
+
+    MaxSessionMessages int `json:"max_session_messages"`
+
+    NotificationSettings NotificationSettings `json:"notification_settings"`
+    Moderation           ModerationSettings   `json:"moderation"`
+    SafetySettings       []SafetySetting      `json:"safety_settings"`
+    WidgetConfig         WidgetConfig         `json:"widget_config"`
+    Registration         RegistrationSettings `json:"registration"`
+    ChatUserCount        int                  `json:"chat_user_count"`
+}
+
+// KnowledgeSourceResponse is the public view of a KnowledgeSource, without its storage path or content
+type KnowledgeSourceResponse struct {
+    ID          string     `json:"id"`
+    Type        string     `json:"type"`
+    Name        string     `json:"name"`
+    Origin      string     `json:"origin,omitempty"`
+    Size        int64      `json:"size"`
+    Hash        string     `json:"hash,omitempty"`
+    Status      string     `json:"status"`
+    Error       string     `json:"error,omitempty"`
+    Enabled     bool       `json:"enabled"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+// PDFFileResponse is a knowledge source in the shape pdf_files had, kept for existing clients.
+//
+// Deprecated: use KnowledgeSourceResponse.
+type PDFFileResponse struct {
+    ID          string     `json:"id"`
+    FileName    string     `json:"file_name"`
+    FileSize    int64      `json:"file_size"`
+    Hash        string     `json:"hash,omitempty"`
+    UploadedAt  time.Time  `json:"uploaded_at"`
+    ProcessedAt *time.Time `json:"processed_at,omitempty"`
+    Status      string     `json:"status"`
+    Error       string     `json:"error,omitempty"`
+    Enabled     bool       `json:"enabled"`
+    SourceType  string     `json:"source_type"`
+    SourceURL   string     `json:"source_url,omitempty"`
+}
+
+// PublicProjectResponse is what the unauthenticated embed widget may see of a project:
+// enough to render it, nothing about its configuration, owner, usage or knowledge base
+type PublicProjectResponse struct {
+    ID             primitive.ObjectID `json:"id"`
+    Name           string             `json:"name"`
+    WelcomeMessage string             `json:"welcome_message"`
+    Widget         WidgetConfig       `json:"widget"`
+}
+
+// UserResponse is the public view of a User
+type UserResponse struct {
+    ID        primitive.ObjectID `json:"id"`
+    Username  string             `json:"username"`
+    Email     string             `json:"email"`
+    IsActive  bool               `json:"is_active"`
+    Role      string             `json:"role"`
+    CreatedAt time.Time          `json:"created_at"`
+    UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// NewProjectResponse maps a stored project to its public view
+func NewProjectResponse(p Project) ProjectResponse {
+    response := ProjectResponse{
+        ID:                 p.ID,
+        Name:               p.Name,
+        Description:        p.Description,
+        Category:           p.Category,
+        ExternalID:         p.ExternalID,
+        IsActive:           p.IsActive,
+        CreatedAt:          p.CreatedAt,
+        UpdatedAt:          p.UpdatedAt,
+        Version:            p.Version,
+        KnowledgeSources:   []KnowledgeSourceResponse{},
+        PDFFiles:           []PDFFileResponse{},
+        GeminiEnabled:      p.GeminiEnabled,
+        HasAPIKey:          p.GeminiAPIKey != "",
+        GeminiModel:        p.GeminiModel,
+        GeminiUsage:        p.GeminiUsage,
+        GeminiLimit:        p.GeminiLimit,
+        GeminiUsageToday:   p.GeminiUsageToday,
+        GeminiUsageMonth:   p.GeminiUsageMonth,
+        GeminiDailyLimit:   p.GeminiDailyLimit,
+        GeminiMonthlyLimit: p.GeminiMonthlyLimit,
+        EstimatedCostToday: p.EstimatedCostToday,
+        EstimatedCostMonth: p.EstimatedCostMonth,
+        MonthlyCostBudget:  p.MonthlyCostBudget,
+        Status:             p.Status,
+        PlanID:             p.PlanID,
+        PlanName:           p.PlanName,
+        StartDate:          optionalTime(p.StartDate),
+        TokensUsedMonth:    p.TokensUsedMonth,
+        MonthlyTokenLimit:  p.MonthlyTokenLimit,
+        LastTokenReset:     optionalTime(p.LastTokenReset),
+        TokenGraceStartedAt: optionalTime(p.TokenGraceStartedAt),
+        ExpiryDate:         optionalTime(p.ExpiryDate),
+        DeletedAt:          optionalTime(p.DeletedAt),
+        TotalQuestions:     p.TotalQuestions,
+        TotalTokensUsed:    p.TotalTokensUsed,
+        LastUsed:           optionalTime(p.LastUsed),
+        WelcomeMessage:     p.WelcomeMessage,
+        SystemPrompt:       p.SystemPrompt,
+        ResponseDelayMs:    p.ResponseDelayMs,
+        WebhookURL:         p.WebhookURL,
+        RateLimitPerMinute: p.RateLimitPerMinute,
+        AllowedDomains:     append([]string{}, p.AllowedDomains...),
+        ForcedLanguage:     p.ForcedLanguage,
+        RetentionDays:      p.RetentionDays,
+        MaxSessionMessages: p.MaxSessionMessages,
+
+        NotificationSettings: p.NotificationSettings,
+        Moderation:           p.Moderation,
+        SafetySettings:       append([]SafetySetting{}, p.SafetySettings...),
+        WidgetConfig:         p.WidgetConfig,
+        Registration:         p.Registration,
+        ChatUserCount:        p.ChatUserCount,
+    }
+    if !p.OwnerID.IsZero() {
+        response.OwnerID = p.OwnerID.Hex()
+    }
+    for _, source := range p.Sources() {
+        response.KnowledgeSources = append(response.KnowledgeSources, NewKnowledgeSourceResponse(source))
+        response.PDFFiles = append(response.PDFFiles, NewPDFFileResponse(source))
+    }
+    return response
+}
+
+// NewKnowledgeSourceResponse maps a stored knowledge source to its public view
+func NewKnowledgeSourceResponse(source KnowledgeSource) KnowledgeSourceResponse {
+    return KnowledgeSourceResponse{
+        ID:          source.ID,
+        Type:        source.Type,
+        Name:        source.Name,
+        Origin:      source.Origin,
+        Size:        source.Size,
+        Hash:        source.Hash,
+        Status:      source.Status,
+        Error:       source.Error,
+        Enabled:     source.Enabled,
+        CreatedAt:   source.CreatedAt,
+        ProcessedAt: optionalTime(source.ProcessedAt),
+    }
+}
+
+// NewKnowledgeSourceResponses maps a list of sources, always returning a non-nil slice
+func NewKnowledgeSourceResponses(sources []KnowledgeSource) []KnowledgeSourceResponse {
+    responses := make([]KnowledgeSourceResponse, 0, len(sources))
+    for _, source := range sources {
+        responses = append(responses, NewKnowledgeSourceResponse(source))
+    }
+    return responses
+}
+
+// NewPDFFileResponse maps a knowledge source to the deprecated pdf_files view
+func NewPDFFileResponse(source KnowledgeSource) PDFFileResponse {
+    return PDFFileResponse{
+        ID:          source.ID,
+        FileName:    source.Name,
+        FileSize:    source.Size,
+        Hash:        source.Hash,
+        UploadedAt:  source.CreatedAt,
+        ProcessedAt: optionalTime(source.ProcessedAt),
+        Status:      source.Status,
+        Error:       source.Error,
+        Enabled:     source.Enabled,
+        SourceType:  source.Type,
+        SourceURL:   source.Origin,
+    }
+}
+
+// NewPublicProjectResponse maps a stored project to the embed widget's view, with the
+// widget's defaults filled in
+func NewPublicProjectResponse(p Project) PublicProjectResponse {
+    return PublicProjectResponse{
+        ID:             p.ID,
+        Name:           p.Name,
+        WelcomeMessage: p.WelcomeMessage,
+        Widget:         p.WidgetConfig.WithDefaults(p.Name),
+    }
+}
+
+// NewProjectResponses maps a list of projects, always returning a non-nil slice
+func NewProjectResponses(projects []Project) []ProjectResponse {
+    responses := make([]ProjectResponse, 0, len(projects))
+    for _, p := range projects {
+        responses = append(responses, NewProjectResponse(p))
+    }
+    return responses
+}
+
+// NewUserResponse maps a stored user to its public view
+func NewUserResponse(u User) UserResponse {
+    return UserResponse{
+        ID:        u.ID,
+        Username:  u.Username,
+        Email:     u.Email,
+        IsActive:  u.IsActive,
+        Role:      u.Role,
+        CreatedAt: u.CreatedAt,
+        UpdatedAt: u.UpdatedAt,
+    }
+}
+
+// NewUserResponses maps a list of users, always returning a non-nil slice
+func NewUserResponses(users []User) []UserResponse {
+    responses := make([]UserResponse, 0, len(users))
+    for _, u := range users {
+        responses = append(responses, NewUserResponse(u))
+    }
+    return responses
+}
+
+// optionalTime turns an unset time into nil so it is omitted from JSON
+func optionalTime(t time.Time) *time.Time {
+    if t.IsZero() {
+        return nil
+    }
+    return &t
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+    "encoding/json"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewPublicProjectResponseExposesOnlyWidgetFields(t *testing.T) {
+    ownerID := primitive.NewObjectID()
+    project := Project{
+        ID:             primitive.NewObjectID(),
+        Name:           "Acme Support",
+        WelcomeMessage: "Hi there!",
+        GeminiAPIKey:   "secret-key",
+        SystemPrompt:   "internal instructions",
+        WebhookURL:     "https://hooks.example.com/acme",
+        OwnerID:        ownerID,
+        PDFContent:     "confidential knowledge",
+        GeminiUsage:    42,
+    }
+
+    raw, err := json.Marshal(NewPublicProjectResponse(project))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var fields map[string]interface{}
+    if err := json.Unmarshal(raw, &fields); err != nil {
+        t.Fatal(err)
+    }
+    keys := make([]string, 0, len(fields))
+    for key := range fields {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    if got := strings.Join(keys, ","); got != "id,name,welcome_message,widget" {
+        t.Fatalf("public project fields = %s", got)
+    }
+    for _, secret := range []string{"secret-key", "internal instructions", "hooks.example.com", ownerID.Hex(), "confidential"} {
+        if strings.Contains(string(raw), secret) {
+            t.Errorf("public project JSON leaks %q: %s", secret, raw)
+        }
+    }
+
+    widget := fields["widget"].(map[string]interface{})
+    if widget["bot_name"] != "Acme Support" || widget["primary_color"] != DefaultWidgetColor {
+        t.Errorf("widget defaults not applied: %v", widget)
+    }
+}
+
+func TestNewProjectResponseHidesAPIKey(t *testing.T) {
+    raw, err := json.Marshal(NewProjectResponse(Project{GeminiAPIKey: "secret-key", PDFContent: "confidential knowledge"}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(string(raw), "secret-key") || strings.Contains(string(raw), "gemini_api_key") {
+        t.Errorf("project response leaks the API key: %s", raw)
+    }
+    if strings.Contains(string(raw), "confidential knowledge") {
+        t.Errorf("project response leaks knowledge content: %s", raw)
+    }
+    if !strings.Contains(string(raw), `"has_api_key":true`) {
+        t.Errorf("project response should report has_api_key: %s", raw)
+    }
+}
+
+func TestProjectJSONOmitsAPIKey(t *testing.T) {
+    raw, err := json.Marshal(Project{Name: "Support", GeminiAPIKey: "secret-key"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(string(raw), "secret-key") || strings.Contains(string(raw), "gemini_api_key") {
+        t.Errorf("project JSON leaks the API key: %s", raw)
+    }
+
+    responses := NewProjectResponses([]Project{{Name: "Keyed", GeminiAPIKey: "secret-key"}, {Name: "Unkeyed"}})
+    if !responses[0].HasAPIKey || responses[1].HasAPIKey {
+        t.Errorf("has_api_key = %v, %v; want true only for the project with a key", responses[0].HasAPIKey, responses[1].HasAPIKey)
+    }
+}
+
+func TestNewProjectResponseReportsSoftDelete(t *testing.T) {
+    live, err := json.Marshal(NewProjectResponse(Project{Name: "Live"}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(string(live), "deleted_at") {
+        t.Errorf("a live project reports deleted_at: %s", live)
+    }
+
+    deletedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+    response := NewProjectResponse(Project{Name: "Gone", DeletedAt: deletedAt})
+    if response.DeletedAt == nil || !response.DeletedAt.Equal(deletedAt) {
+        t.Errorf("DeletedAt = %v, want %v", response.DeletedAt, deletedAt)
+    }
+}
@@ -0,0 +1,59 @@
+package models
+
+import "fmt"
+
+// Safety Category Constants, the harm categories a project can tune
+const (
+    SafetyCategoryHarassment       = "harassment"
+    SafetyCategoryHateSpeech       = "hate_speech"
+    SafetyCategorySexuallyExplicit = "sexually_explicit"
+    SafetyCategoryDangerousContent = "dangerous_content"
+)
+
+// Safety Threshold Constants, from most to least permissive
+const (
+    SafetyBlockNone           = "block_none"
+    SafetyBlockOnlyHigh       = "block_only_high"
+    SafetyBlockMediumAndAbove = "block_medium_and_above"
+    SafetyBlockLowAndAbove    = "block_low_and_above"
+)
+
+// SafetyCategories and SafetyThresholds list the accepted names
+var (
+    SafetyCategories = []string{
+        SafetyCategoryHarassment,
+        SafetyCategoryHateSpeech,
+        SafetyCategorySexuallyExplicit,
+        SafetyCategoryDangerousContent,
+    }
+    SafetyThresholds = []string{
+        SafetyBlockNone,
+        SafetyBlockOnlyHigh,
+        SafetyBlockMediumAndAbove,
+        SafetyBlockLowAndAbove,
+    }
+)
+
+// SafetySetting sets how readily Gemini blocks content in one harm category
+type SafetySetting struct {
+    Category  string `bson:"category" json:"category"`
+    Threshold string `bson:"threshold" json:"threshold"`
+}
+
+// ValidateSafetySettings checks every category and threshold is known and no category repeats
+func ValidateSafetySettings(settings []SafetySetting) error {
+    seen := make(map[string]bool, len(settings))
+    for _, setting := range settings {
+        if !containsString(SafetyCategories, setting.Category) {
+            return fmt.Errorf("unknown safety category %q", setting.Category)
+        }
+        if !containsString(SafetyThresholds, setting.Threshold) {
+            return fmt.Errorf("unknown safety threshold %q for %s", setting.Threshold, setting.Category)
+        }
+        if seen[setting.Category] {
+            return fmt.Errorf("safety category %q is listed more than once", setting.Category)
+        }
+        seen[setting.Category] = true
+    }
+    return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+    "fmt"
+    "net"
+    "net/url"
+    "strings"
+)
+
+// ValidateWebhookURL checks a webhook is an https URL whose host isn't obviously internal.
+// Hostnames can still resolve to internal addresses, so delivery checks the address it
+// connects to as well (see IsPublicIP).
+func ValidateWebhookURL(raw string) error {
+    parsed, err := url.Parse(raw)
+    if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+        return fmt.Errorf("webhook URL must be an https URL")
+    }
+    if parsed.User != nil {
+        return fmt.Errorf("webhook URL must not contain credentials")
+    }
+
+    host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+    if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+        strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+        return fmt.Errorf("webhook URL must not point to a local or internal host")
+    }
+    if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+        return fmt.Errorf("webhook URL must not point to a private or loopback address")
+    }
+    return nil
+}
+
+// IsPublicIP reports whether ip is routable on the public internet, i.e. not loopback,
+// private, link-local (which includes cloud metadata endpoints), multicast or unspecified
+func IsPublicIP(ip net.IP) bool {
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+        ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+        ip.IsUnspecified() || isSharedAddress(ip))
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in practice
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isSharedAddress(ip net.IP) bool {
+    return sharedAddressSpace.Contains(ip)
+}
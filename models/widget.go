@@ -0,0 +1,67 @@
+package models
+
+import (
+    "fmt"
+    "net/url"
+    "regexp"
+)
+
+// Widget Defaults
+const (
+    DefaultWidgetColor      = "#667eea"
+    DefaultWidgetPosition   = "bottom-right"
+    DefaultWidgetHeaderText = "AI Assistant"
+    MaxWidgetTextLength     = 100
+)
+
+// WidgetPositions lists the corners the floating widget can sit in
+var WidgetPositions = []string{"bottom-right", "bottom-left", "top-right", "top-left"}
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// WidgetConfig is a project's branding for the embedded chat. Empty fields fall
+// back to the defaults, and the bot name to the project name.
+type WidgetConfig struct {
+    PrimaryColor string `bson:"primary_color,omitempty" json:"primary_color"` // hex, e.g. "#667eea"
+    BotName      string `bson:"bot_name,omitempty" json:"bot_name"`
+    AvatarURL    string `bson:"avatar_url,omitempty" json:"avatar_url"`
+    HeaderText   string `bson:"header_text,omitempty" json:"header_text"`
+    Position     string `bson:"position,omitempty" json:"position"`
+}
+
+// WithDefaults returns the config with empty fields filled in for projectName
+func (w WidgetConfig) WithDefaults(projectName string) WidgetConfig {
+    if w.PrimaryColor == "" {
+        w.PrimaryColor = DefaultWidgetColor
+    }
+    if w.BotName == "" {
+        w.BotName = projectName
+    }
+    if w.HeaderText == "" {
+        w.HeaderText = DefaultWidgetHeaderText
+    }
+    if w.Position == "" {
+        w.Position = DefaultWidgetPosition
+    }
+    return w
+}
+
+// Validate checks the color is hex, the avatar is an http(s) URL and the position is known
+func (w WidgetConfig) Validate() error {
+    if w.PrimaryColor != "" && !hexColorPattern.MatchString(w.PrimaryColor) {
+        return fmt.Errorf("primary color must be a hex color like #667eea")
+    }
+    if w.AvatarURL != "" {
+        parsed, err := url.Parse(w.AvatarURL)
+        if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+            return fmt.Errorf("avatar URL must be an http or https URL")
+        }
+    }
+    if w.Position != "" && !containsString(WidgetPositions, w.Position) {
+        return fmt.Errorf("unknown widget position %q", w.Position)
+    }
+    if len(w.BotName) > MaxWidgetTextLength || len(w.HeaderText) > MaxWidgetTextLength {
+        return fmt.Errorf("bot name and header text must be at most %d characters", MaxWidgetTextLength)
+    }
+    return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestWidgetConfigWithDefaults(t *testing.T) {
+    widget := WidgetConfig{}.WithDefaults("Acme")
+    want := WidgetConfig{
+        PrimaryColor: DefaultWidgetColor,
+        BotName:      "Acme",
+        HeaderText:   DefaultWidgetHeaderText,
+        Position:     DefaultWidgetPosition,
+    }
+    if widget != want {
+        t.Errorf("WithDefaults = %+v, want %+v", widget, want)
+    }
+
+    custom := WidgetConfig{PrimaryColor: "#000", BotName: "Ava", Position: "top-left"}
+    if got := custom.WithDefaults("Acme"); got.PrimaryColor != "#000" || got.BotName != "Ava" || got.Position != "top-left" {
+        t.Errorf("WithDefaults overwrote chosen values: %+v", got)
+    }
+}
+
+func TestWidgetConfigValidate(t *testing.T) {
+    cases := []struct {
+        name   string
+        widget WidgetConfig
+        valid  bool
+    }{
+        {"zero value", WidgetConfig{}, true},
+        {"full config", WidgetConfig{PrimaryColor: "#1A2b3C", BotName: "Ava", AvatarURL: "https://cdn.example.com/ava.png", Position: "bottom-left"}, true},
+        {"short hex", WidgetConfig{PrimaryColor: "#fff"}, true},
+        {"named color", WidgetConfig{PrimaryColor: "red"}, false},
+        {"hex without hash", WidgetConfig{PrimaryColor: "667eea"}, false},
+        {"script avatar", WidgetConfig{AvatarURL: "javascript:alert(1)"}, false},
+        {"relative avatar", WidgetConfig{AvatarURL: "/ava.png"}, false},
+        {"unknown position", WidgetConfig{Position: "center"}, false},
+        {"long bot name", WidgetConfig{BotName: strings.Repeat("a", MaxWidgetTextLength+1)}, false},
+    }
+    for _, tc := range cases {
+        if err := tc.widget.Validate(); (err == nil) != tc.valid {
+            t.Errorf("%s: Validate() = %v, want valid = %v", tc.name, err, tc.valid)
+        }
+    }
+}
@@ -4,7 +4,7 @@
         constructor(config) {
             this.projectId = config.projectId;
             this.apiUrl = config.apiUrl || 'https://troikabackend.onrender.com';
-            this.position = config.position || 'bottom-right';
+            this.position = config.position || '';
             this.theme = config.theme || 'light';
             this.width = config.width || '400px';
             this.height = config.height || '600px';
@@ -15,13 +15,29 @@
         init() {
             this.createWidget();
             this.attachEvents();
+            this.loadConfig();
+        }
+        
+        loadConfig() {
+            // Apply the project's branding; the widget keeps its defaults if this fails
+            fetch(`${this.apiUrl}/embed/${this.projectId}/config`)
+                .then(response => response.ok ? response.json() : null)
+                .then(data => {
+                    if (!data || !data.widget) return;
+                    if (!this.position) {
+                        this.widgetContainer.classList.replace('bottom-right', data.widget.position);
+                    }
+                    this.chatButton.style.background = data.widget.primary_color;
+                    this.chatButton.title = data.widget.bot_name;
+                })
+                .catch(() => {});
         }
         
         createWidget() {
             // Create widget container
             const widgetContainer = document.createElement('div');
             widgetContainer.id = 'jevi-chat-widget';
-            widgetContainer.className = `jevi-widget ${this.position} ${this.theme}`;
+            widgetContainer.className = `jevi-widget ${this.position || 'bottom-right'} ${this.theme}`;
             
             // Create chat button
             const chatButton = document.createElement('div');
@@ -0,0 +1,200 @@
+package utils
+
+import (
+    "math"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// ChunkText splits text into pieces of about size characters, breaking on paragraph
+// and sentence boundaries where possible. Consecutive chunks share up to overlap
+// characters so a passage cut at a boundary still appears whole in one of them.
+func ChunkText(text string, size, overlap int) []string {
+    text = strings.TrimSpace(text)
+    if text == "" {
+        return nil
+    }
+    if overlap >= size {
+        overlap = size / 4
+    }
+
+    runes := []rune(text)
+    var chunks []string
+    for start := 0; start < len(runes); {
+        end := start + size
+        if end >= len(runes) {
+            chunks = append(chunks, strings.TrimSpace(string(runes[start:])))
+            break
+        }
+        end = chunkBoundary(runes, start+size/2, end)
+        chunks = append(chunks, strings.TrimSpace(string(runes[start:end])))
+
+        next := end - overlap
+        if next <= start {
+            next = end
+        }
+        // Start the next chunk on a word boundary
+        for next < end && !unicode.IsSpace(runes[next-1]) {
+            next++
+        }
+        start = next
+    }
+    return chunks
+}
+
+// chunkBoundary finds the best place to end a chunk between min and max: a paragraph
+// break, then a sentence end, then any whitespace, falling back to max
+func chunkBoundary(runes []rune, min, max int) int {
+    for _, isBreak := range []func(i int) bool{
+        func(i int) bool { return runes[i] == '\n' && runes[i-1] == '\n' },
+        func(i int) bool { return unicode.IsSpace(runes[i]) && strings.ContainsRune(".!?", runes[i-1]) },
+        func(i int) bool { return unicode.IsSpace(runes[i]) },
+    } {
+        for i := max; i > min; i-- {
+            if isBreak(i) {
+                return i
+            }
+        }
+    }
+    return max
+}
+
+// rankingStopwords are ignored when matching questions to chunks
+var rankingStopwords = map[string]bool{
+    "a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+    "but": true, "by": true, "can": true, "do": true, "does": true, "for": true, "from": true,
+    "has": true, "have": true, "how": true, "i": true, "if": true, "in": true, "is": true,
+    "it": true, "its": true, "me": true, "my": true, "not": true, "of": true, "on": true,
+    "or": true, "our": true, "so": true, "that": true, "the": true, "their": true, "there": true,
+    "this": true, "to": true, "was": true, "we": true, "what": true, "when": true, "where": true,
+    "which": true, "who": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// Terms lowercases text and splits it into words, dropping stopwords and single letters
+func Terms(text string) []string {
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+    })
+    terms := words[:0]
+    for _, word := range words {
+        if len([]rune(word)) > 1 && !rankingStopwords[word] {
+            terms = append(terms, word)
+        }
+    }
+    return terms
+}
+
+// RankChunks scores chunks against query with TF-IDF and returns the indexes of
+// those sharing at least one term with it, best first
+func RankChunks(query string, chunks []string) []int {
+    queryTerms := make(map[string]bool)
+    for _, term := range Terms(query) {
+        queryTerms[term] = true
+    }
+    if len(queryTerms) == 0 || len(chunks) == 0 {
+        return nil
+    }
+
+    // Term frequencies per chunk, restricted to the query's terms
+    frequencies := make([]map[string]int, len(chunks))
+    lengths := make([]int, len(chunks))
+    documentFrequency := make(map[string]int)
+    for i, chunk := range chunks {
+        frequencies[i] = make(map[string]int)
+        terms := Terms(chunk)
+        lengths[i] = len(terms)
+        for _, term := range terms {
+            if queryTerms[term] {
+                if frequencies[i][term] == 0 {
+                    documentFrequency[term]++
+                }
+                frequencies[i][term]++
+            }
+        }
+    }
+
+    type scored struct {
+        index int
+        score float64
+    }
+    var results []scored
+    for i := range chunks {
+        score := 0.0
+        for term, count := range frequencies[i] {
+            idf := math.Log(1 + float64(len(chunks))/float64(documentFrequency[term]))
+            tf := float64(count) / math.Sqrt(float64(lengths[i]))
+            score += tf * idf
+        }
+        if score > 0 {
+            results = append(results, scored{i, score})
+        }
+    }
+
+    sort.SliceStable(results, func(a, b int) bool { return results[a].score > results[b].score })
+    indexes := make([]int, len(results))
+    for i, result := range results {
+        indexes[i] = result.index
+    }
+    return indexes
+}
+
+// CosineSimilarity of two vectors; 0 when either is empty or their lengths differ
+func CosineSimilarity(a, b []float32) float64 {
+    if len(a) == 0 || len(a) != len(b) {
+        return 0
+    }
+    var dot, normA, normB float64
+    for i := range a {
+        dot += float64(a[i]) * float64(b[i])
+        normA += float64(a[i]) * float64(a[i])
+        normB += float64(b[i]) * float64(b[i])
+    }
+    if normA == 0 || normB == 0 {
+        return 0
+    }
+    return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// RankBySimilarity returns the indexes of vectors ordered by cosine similarity to query, best first
+func RankBySimilarity(query []float32, vectors [][]float32) []int {
+    scores := make([]float64, len(vectors))
+    indexes := make([]int, len(vectors))
+    for i, vector := range vectors {
+        scores[i] = CosineSimilarity(query, vector)
+        indexes[i] = i
+    }
+    sort.SliceStable(indexes, func(a, b int) bool { return scores[indexes[a]] > scores[indexes[b]] })
+    return indexes
+}
+
+// Truncation strategies for TruncateText
+const (
+    TruncateHead      = "head"       // keep the start
+    TruncateTail      = "tail"       // keep the end
+    TruncateMiddleOut = "middle-out" // keep both ends, dropping the middle
+)
+
+// TruncateText cuts text to at most max runes using strategy, marking the cut so the
+// model knows content is missing. Text within max is returned unchanged.
+func TruncateText(text string, max int, strategy string) string {
+    runes := []rune(text)
+    if len(runes) <= max {
+        return text
+    }
+    const marker = "\n\n[...]\n\n"
+    keep := max - len([]rune(marker))
+    if keep <= 0 {
+        return string(runes[:max])
+    }
+
+    switch strategy {
+    case TruncateTail:
+        return marker + string(runes[len(runes)-keep:])
+    case TruncateMiddleOut:
+        head := keep / 2
+        return string(runes[:head]) + marker + string(runes[len(runes)-(keep-head):])
+    default:
+        return string(runes[:keep]) + marker
+    }
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+    "math"
+    "strings"
+    "testing"
+    "unicode/utf8"
+)
+
+func TestChunkTextRespectsSizeAndBoundaries(t *testing.T) {
+    paragraph := strings.Repeat("Refunds are issued within thirty days. ", 10)
+    text := paragraph + "\n\n" + paragraph + "\n\n" + paragraph
+
+    chunks := ChunkText(text, 300, 50)
+    if len(chunks) < 3 {
+        t.Fatalf("got %d chunks, want the text split into several", len(chunks))
+    }
+    for i, chunk := range chunks {
+        if utf8.RuneCountInString(chunk) > 300 {
+            t.Errorf("chunk %d has %d characters, want at most 300", i, utf8.RuneCountInString(chunk))
+        }
+        if chunk != strings.TrimSpace(chunk) || chunk == "" {
+            t.Errorf("chunk %d is not trimmed: %q", i, chunk)
+        }
+        // Sentences aren't cut mid-word
+        if i < len(chunks)-1 && !strings.HasSuffix(chunk, ".") {
+            t.Errorf("chunk %d ends mid-sentence: %q", i, chunk[len(chunk)-20:])
+        }
+    }
+}
+
+func TestChunkTextOverlap(t *testing.T) {
+    words := make([]string, 200)
+    for i := range words {
+        words[i] = "word"
+    }
+    chunks := ChunkText(strings.Join(words, " "), 100, 20)
+    if len(chunks) < 2 {
+        t.Fatalf("got %d chunks, want several", len(chunks))
+    }
+    // With overlap the chunks cover more than the text itself
+    total := 0
+    for _, chunk := range chunks {
+        total += len(chunk)
+    }
+    if total <= len(strings.Join(words, " ")) {
+        t.Errorf("chunks cover %d characters, want overlap beyond the text's %d", total, len(strings.Join(words, " ")))
+    }
+}
+
+func TestChunkTextEdgeCases(t *testing.T) {
+    if chunks := ChunkText("   ", 100, 10); chunks != nil {
+        t.Errorf("blank text = %v, want no chunks", chunks)
+    }
+    if chunks := ChunkText("short text", 100, 10); len(chunks) != 1 || chunks[0] != "short text" {
+        t.Errorf("short text = %v, want one chunk", chunks)
+    }
+    // An overlap as large as the chunk must not loop forever
+    if chunks := ChunkText(strings.Repeat("abc ", 100), 40, 40); len(chunks) == 0 {
+        t.Error("expected chunks")
+    }
+}
+
+func TestTerms(t *testing.T) {
+    got := strings.Join(Terms("What is the refund policy for order #42, please?"), ",")
+    if got != "refund,policy,order,42,please" {
+        t.Errorf("Terms = %s", got)
+    }
+}
+
+func TestRankChunks(t *testing.T) {
+    chunks := []string{
+        "Our office is open Monday to Friday.",
+        "Refunds are processed within 30 days. Refund requests go to billing.",
+        "Shipping takes three to five days.",
+        "A refund is possible for damaged items.",
+    }
+    ranked := RankChunks("How do I get a refund?", chunks)
+    if len(ranked) != 2 {
+        t.Fatalf("RankChunks = %v, want only the two chunks mentioning refunds", ranked)
+    }
+    if ranked[0] != 1 && ranked[0] != 3 {
+        t.Errorf("best chunk = %d, want a refund chunk", ranked[0])
+    }
+
+    if ranked := RankChunks("the and of", chunks); ranked != nil {
+        t.Errorf("stopword-only query = %v, want nil", ranked)
+    }
+}
+
+func TestCosineSimilarity(t *testing.T) {
+    cases := []struct {
+        name string
+        a, b []float32
+        want float64
+    }{
+        {"same direction", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+        {"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+        {"opposite", []float32{1, 1}, []float32{-1, -1}, -1},
+        {"length mismatch", []float32{1, 2}, []float32{1, 2, 3}, 0},
+        {"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+        {"empty", nil, nil, 0},
+    }
+    for _, tc := range cases {
+        if got := CosineSimilarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 {
+            t.Errorf("%s: CosineSimilarity = %v, want %v", tc.name, got, tc.want)
+        }
+    }
+}
+
+func TestRankBySimilarity(t *testing.T) {
+    vectors := [][]float32{
+        {0, 1},
+        {1, 0.1},
+        {-1, 0},
+        {1, 0},
+    }
+    got := RankBySimilarity([]float32{1, 0}, vectors)
+    want := []int{3, 1, 0, 2}
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("RankBySimilarity = %v, want %v", got, want)
+        }
+    }
+}
+
+func TestTruncateText(t *testing.T) {
+    text := strings.Repeat("a", 20) + strings.Repeat("b", 20) + strings.Repeat("c", 20)
+    const marker = "\n\n[...]\n\n"
+
+    head := TruncateText(text, 30, TruncateHead)
+    if head != strings.Repeat("a", 20)+"b"+marker {
+        t.Errorf("head = %q", head)
+    }
+    tail := TruncateText(text, 30, TruncateTail)
+    if tail != marker+"b"+strings.Repeat("c", 20) {
+        t.Errorf("tail = %q", tail)
+    }
+    middle := TruncateText(text, 30, TruncateMiddleOut)
+    if !strings.HasPrefix(middle, strings.Repeat("a", 10)+marker) || !strings.HasSuffix(middle, marker+strings.Repeat("c", 11)) {
+        t.Errorf("middle-out = %q, want both ends kept", middle)
+    }
+    for _, strategy := range []string{TruncateHead, TruncateTail, TruncateMiddleOut} {
+        if got := len([]rune(TruncateText(text, 30, strategy))); got != 30 {
+            t.Errorf("%s kept %d runes, want 30", strategy, got)
+        }
+    }
+
+    if got := TruncateText("héllo", 5, TruncateHead); got != "héllo" {
+        t.Errorf("text within the budget = %q, want it unchanged", got)
+    }
+    // Too small for the marker: a plain cut, counted in runes
+    if got := TruncateText("ééééé", 3, TruncateTail); got != "ééé" {
+        t.Errorf("tiny budget = %q, want the first 3 runes", got)
+    }
+}
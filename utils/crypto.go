@@ -0,0 +1,110 @@
+package utils
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// encryptedPrefix marks values produced by EncryptSecret so plaintext values
+// stored before encryption was enabled can still be told apart
+const encryptedPrefix = "enc:v1:"
+
+// ErrEncryptionKeyMissing is returned when ENCRYPTION_KEY is not set
+var ErrEncryptionKeyMissing = errors.New("ENCRYPTION_KEY not set")
+
+// encryptionKey reads the 32-byte AES key from ENCRYPTION_KEY, given as base64, hex or raw text
+func encryptionKey() ([]byte, error) {
+    value := os.Getenv("ENCRYPTION_KEY")
+    if value == "" {
+        return nil, ErrEncryptionKeyMissing
+    }
+    if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+        return key, nil
+    }
+    if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+        return key, nil
+    }
+    if len(value) == 32 {
+        return []byte(value), nil
+    }
+    return nil, fmt.Errorf("ENCRYPTION_KEY must be 32 bytes (raw, hex or base64)")
+}
+
+// EncryptionEnabled reports whether a valid ENCRYPTION_KEY is configured
+func EncryptionEnabled() bool {
+    _, err := encryptionKey()
+    return err == nil
+}
+
+// IsEncrypted reports whether value was produced by EncryptSecret
+func IsEncrypted(value string) bool {
+    return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// EncryptSecret encrypts plaintext with AES-GCM. Empty and already encrypted
+// values are returned unchanged.
+func EncryptSecret(plaintext string) (string, error) {
+    if plaintext == "" || IsEncrypted(plaintext) {
+        return plaintext, nil
+    }
+
+    gcm, err := newGCM()
+    if err != nil {
+        return "", err
+    }
+
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return "", err
+    }
+    sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+    return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret. Values without the encrypted prefix are
+// legacy plaintext and returned as-is.
+func DecryptSecret(value string) (string, error) {
+    if !IsEncrypted(value) {
+        return value, nil
+    }
+
+    sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+    if err != nil {
+        return "", fmt.Errorf("invalid encrypted value: %v", err)
+    }
+
+    gcm, err := newGCM()
+    if err != nil {
+        return "", err
+    }
+    if len(sealed) < gcm.NonceSize() {
+        return "", fmt.Errorf("invalid encrypted value: too short")
+    }
+
+    nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+    plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+    if err != nil {
+        return "", fmt.Errorf("failed to decrypt value: %v", err)
+    }
+    return string(plaintext), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+    key, err := encryptionKey()
+    if err != nil {
+        return nil, err
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
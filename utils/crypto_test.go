@@ -0,0 +1,70 @@
+package utils
+
+import (
+    "encoding/base64"
+    "encoding/hex"
+    "strings"
+    "testing"
+)
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+    t.Setenv("ENCRYPTION_KEY", strings.Repeat("k", 32))
+
+    encrypted, err := EncryptSecret("AIza-secret")
+    if err != nil {
+        t.Fatalf("EncryptSecret: %v", err)
+    }
+    if !IsEncrypted(encrypted) || strings.Contains(encrypted, "AIza-secret") {
+        t.Fatalf("EncryptSecret = %q, want an opaque prefixed value", encrypted)
+    }
+    if again, _ := EncryptSecret(encrypted); again != encrypted {
+        t.Error("encrypting an already encrypted value must leave it unchanged")
+    }
+
+    plaintext, err := DecryptSecret(encrypted)
+    if err != nil || plaintext != "AIza-secret" {
+        t.Errorf("DecryptSecret = %q, %v; want the original secret", plaintext, err)
+    }
+}
+
+func TestDecryptSecretLegacyPlaintext(t *testing.T) {
+    t.Setenv("ENCRYPTION_KEY", "")
+    if value, err := DecryptSecret("AIza-plain"); err != nil || value != "AIza-plain" {
+        t.Errorf("DecryptSecret = %q, %v; plaintext stored before encryption must pass through", value, err)
+    }
+}
+
+func TestDecryptSecretWrongKey(t *testing.T) {
+    t.Setenv("ENCRYPTION_KEY", strings.Repeat("a", 32))
+    encrypted, err := EncryptSecret("AIza-secret")
+    if err != nil {
+        t.Fatalf("EncryptSecret: %v", err)
+    }
+
+    t.Setenv("ENCRYPTION_KEY", strings.Repeat("b", 32))
+    if _, err := DecryptSecret(encrypted); err == nil {
+        t.Error("decrypting with a different key must fail")
+    }
+
+    t.Setenv("ENCRYPTION_KEY", "")
+    if _, err := DecryptSecret(encrypted); err != ErrEncryptionKeyMissing {
+        t.Errorf("err = %v, want ErrEncryptionKeyMissing", err)
+    }
+}
+
+func TestEncryptionKeyFormats(t *testing.T) {
+    key := []byte(strings.Repeat("k", 32))
+    cases := map[string]bool{
+        string(key):                            true,
+        hex.EncodeToString(key):                true,
+        base64.StdEncoding.EncodeToString(key): true,
+        "too-short":                            false,
+        "":                                     false,
+    }
+    for value, want := range cases {
+        t.Setenv("ENCRYPTION_KEY", value)
+        if got := EncryptionEnabled(); got != want {
+            t.Errorf("EncryptionEnabled with %q = %v, want %v", value, got, want)
+        }
+    }
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+    "io"
+    "strings"
+
+    "golang.org/x/net/html"
+)
+
+// htmlSkippedElements hold no readable page content
+var htmlSkippedElements = map[string]bool{
+    "script": true, "style": true, "noscript": true, "template": true,
+    "svg": true, "iframe": true, "head": true, "nav": true, "footer": true, "form": true,
+}
+
+// htmlBlockElements start a new line in the extracted text
+var htmlBlockElements = map[string]bool{
+    "p": true, "div": true, "section": true, "article": true, "main": true, "br": true,
+    "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+    "li": true, "ul": true, "ol": true, "tr": true, "table": true, "blockquote": true, "pre": true,
+}
+
+// ExtractHTMLText returns the title and readable text of an HTML page, leaving out
+// scripts, styles and navigation. Paragraphs and list items go on their own lines.
+func ExtractHTMLText(r io.Reader) (string, string, error) {
+    tokenizer := html.NewTokenizer(r)
+    var title string
+    var text strings.Builder
+    skipDepth := 0
+    inTitle := false
+
+    for {
+        switch tokenizer.Next() {
+        case html.ErrorToken:
+            if err := tokenizer.Err(); err != io.EOF {
+                return "", "", err
+            }
+            return strings.TrimSpace(title), collapseBlankLines(text.String()), nil
+        case html.StartTagToken, html.SelfClosingTagToken:
+            name, _ := tokenizer.TagName()
+            tag := string(name)
+            if tag == "title" {
+                inTitle = true
+            }
+            if htmlSkippedElements[tag] && tag != "head" {
+                skipDepth++
+            }
+            if htmlBlockElements[tag] {
+                text.WriteString("\n")
+            }
+        case html.EndTagToken:
+            name, _ := tokenizer.TagName()
+            tag := string(name)
+            if tag == "title" {
+                inTitle = false
+            }
+            if htmlSkippedElements[tag] && tag != "head" && skipDepth > 0 {
+                skipDepth--
+            }
+            if htmlBlockElements[tag] {
+                text.WriteString("\n")
+            }
+        case html.TextToken:
+            content := strings.Join(strings.Fields(string(tokenizer.Text())), " ")
+            if inTitle {
+                title += content
+                continue
+            }
+            if skipDepth > 0 || content == "" {
+                continue
+            }
+            text.WriteString(content)
+            text.WriteString(" ")
+        }
+    }
+}
+
+// collapseBlankLines trims each line and drops empty ones
+func collapseBlankLines(text string) string {
+    var lines []string
+    for _, line := range strings.Split(text, "\n") {
+        if line = strings.TrimSpace(line); line != "" {
+            lines = append(lines, line)
+        }
+    }
+    return strings.Join(lines, "\n")
+}
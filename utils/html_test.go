@@ -0,0 +1,53 @@
+package utils
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestExtractHTMLText(t *testing.T) {
+    page := `<!DOCTYPE html>
+<html>
+<head><title> Acme   Support </title><style>body { color: red }</style></head>
+<body>
+  <nav><a href="/">Home</a> <a href="/shop">Shop</a></nav>
+  <main>
+    <h1>Opening hours</h1>
+    <p>We are open
+       9am to 5pm.</p>
+    <ul><li>Monday</li><li>Friday</li></ul>
+    <script>var tracking = "do not index";</script>
+    <form><input name="q"><button>Search</button></form>
+  </main>
+  <footer>Copyright Acme</footer>
+</body>
+</html>`
+
+    title, text, err := ExtractHTMLText(strings.NewReader(page))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if title != "Acme Support" {
+        t.Errorf("title = %q, want %q", title, "Acme Support")
+    }
+    want := "Opening hours\nWe are open 9am to 5pm.\nMonday\nFriday"
+    if text != want {
+        t.Errorf("text = %q, want %q", text, want)
+    }
+}
+
+func TestExtractHTMLTextNestedSkippedElements(t *testing.T) {
+    _, text, err := ExtractHTMLText(strings.NewReader(`<p>Before</p><nav><form><p>Hidden</p></form><p>Still hidden</p></nav><p>After</p>`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if text != "Before\nAfter" {
+        t.Errorf("text = %q, want only the content outside nav", text)
+    }
+}
+
+func TestCollapseBlankLines(t *testing.T) {
+    if got := collapseBlankLines("  one \n\n \n two\n"); got != "one\ntwo" {
+        t.Errorf("collapseBlankLines = %q, want %q", got, "one\ntwo")
+    }
+}
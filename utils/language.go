@@ -0,0 +1,116 @@
+package utils
+
+import (
+    "strings"
+    "unicode"
+)
+
+// scriptLanguages maps writing systems used by a single major language to that language
+var scriptLanguages = []struct {
+    table    *unicode.RangeTable
+    language string
+}{
+    {unicode.Devanagari, "Hindi"},
+    {unicode.Bengali, "Bengali"},
+    {unicode.Gujarati, "Gujarati"},
+    {unicode.Gurmukhi, "Punjabi"},
+    {unicode.Tamil, "Tamil"},
+    {unicode.Telugu, "Telugu"},
+    {unicode.Kannada, "Kannada"},
+    {unicode.Malayalam, "Malayalam"},
+    {unicode.Arabic, "Arabic"},
+    {unicode.Hebrew, "Hebrew"},
+    {unicode.Cyrillic, "Russian"},
+    {unicode.Greek, "Greek"},
+    {unicode.Thai, "Thai"},
+    {unicode.Hangul, "Korean"},
+    {unicode.Hiragana, "Japanese"},
+    {unicode.Katakana, "Japanese"},
+    {unicode.Han, "Chinese"},
+}
+
+// latinStopwords are frequent short words that tell Latin-script languages apart
+var latinStopwords = map[string][]string{
+    "English":    {"the", "is", "are", "and", "you", "what", "how", "can", "do", "i", "my", "to", "of", "in", "for", "with", "this", "please", "hello", "thanks"},
+    "Spanish":    {"el", "la", "los", "las", "es", "y", "que", "de", "en", "por", "para", "con", "una", "como", "qué", "cómo", "hola", "gracias", "puedo", "está"},
+    "French":     {"le", "la", "les", "est", "et", "que", "de", "des", "en", "pour", "avec", "une", "je", "vous", "comment", "bonjour", "merci", "quel", "pas", "c'est"},
+    "German":     {"der", "die", "das", "ist", "und", "ich", "sie", "nicht", "mit", "für", "ein", "eine", "wie", "was", "hallo", "danke", "bitte", "kann", "zu", "auf"},
+    "Portuguese": {"o", "a", "os", "as", "é", "e", "que", "de", "em", "para", "com", "uma", "como", "não", "olá", "obrigado", "obrigada", "você", "posso", "está"},
+    "Italian":    {"il", "lo", "la", "gli", "è", "e", "che", "di", "per", "con", "una", "come", "non", "ciao", "grazie", "sono", "posso", "cosa", "del", "della"},
+    "Dutch":      {"de", "het", "een", "is", "en", "ik", "je", "niet", "met", "voor", "van", "wat", "hoe", "hallo", "dank", "bedankt", "kan", "zijn", "op", "dat"},
+}
+
+// DetectLanguage makes a lightweight guess at the language of text. Non-Latin scripts
+// are identified by their characters; Latin-script text is scored against common
+// words. It returns "" when the text is too short or ambiguous to call.
+func DetectLanguage(text string) string {
+    counts := make(map[string]int)
+    letters := 0
+    for _, r := range text {
+        if !unicode.IsLetter(r) {
+            continue
+        }
+        letters++
+        for _, script := range scriptLanguages {
+            if unicode.Is(script.table, r) {
+                counts[script.language]++
+                break
+            }
+        }
+    }
+    if letters == 0 {
+        return ""
+    }
+
+    // Any kana means Japanese even when most characters are Han
+    if counts["Japanese"] > 0 {
+        return "Japanese"
+    }
+    best, bestCount := "", 0
+    for language, count := range counts {
+        if count > bestCount || (count == bestCount && language < best) {
+            best, bestCount = language, count
+        }
+    }
+    if bestCount*2 >= letters {
+        return best
+    }
+
+    return detectLatinLanguage(text)
+}
+
+// detectLatinLanguage scores the words of text against each language's stopwords,
+// requiring a clear winner
+func detectLatinLanguage(text string) string {
+    words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && r != '\''
+    })
+    if len(words) < 2 {
+        return ""
+    }
+
+    scores := make(map[string]int)
+    for language, stopwords := range latinStopwords {
+        for _, word := range words {
+            for _, stopword := range stopwords {
+                if word == stopword {
+                    scores[language]++
+                    break
+                }
+            }
+        }
+    }
+
+    best, bestScore, secondScore := "", 0, 0
+    for language, score := range scores {
+        if score > bestScore {
+            best, bestScore, secondScore = language, score, bestScore
+        } else if score > secondScore {
+            secondScore = score
+        }
+    }
+    if bestScore < 2 || bestScore == secondScore {
+        return ""
+    }
+    return best
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+    cases := []struct{ text, want string }{
+        {"What are your opening hours and can I book online?", "English"},
+        {"Hola, ¿cómo puedo cambiar mi pedido por favor?", "Spanish"},
+        {"Bonjour, je voudrais savoir comment payer", "French"},
+        {"Hallo, ich kann das Passwort nicht ändern", "German"},
+        {"नमस्ते, मुझे मदद चाहिए", "Hindi"},
+        {"Здравствуйте, мне нужна помощь", "Russian"},
+        {"注文をキャンセルしたいです", "Japanese"},
+        {"我想取消订单", "Chinese"},
+        {"ok", ""},
+        {"12345 !!", ""},
+        {"", ""},
+    }
+    for _, tc := range cases {
+        if got := DetectLanguage(tc.text); got != tc.want {
+            t.Errorf("DetectLanguage(%q) = %q, want %q", tc.text, got, tc.want)
+        }
+    }
+}
+
+func TestDetectLanguageAmbiguousLatin(t *testing.T) {
+    // "de" and "en" are stopwords in several languages, so there is no clear winner
+    if got := DetectLanguage("de en"); got != "" {
+        t.Errorf("DetectLanguage = %q, want no guess", got)
+    }
+}
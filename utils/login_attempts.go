@@ -0,0 +1,176 @@
+package utils
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+)
+
+// LockoutPolicy decides how long an identity is locked out after repeated failed logins.
+// Reaching Threshold failures locks it for BaseLockout; every further failure doubles the
+// lockout up to MaxLockout. Failures are forgotten Window after the last one.
+type LockoutPolicy struct {
+    Threshold   int
+    BaseLockout time.Duration
+    MaxLockout  time.Duration
+    Window      time.Duration
+}
+
+// LockoutFor returns the lockout earned by the given number of consecutive failures
+func (p LockoutPolicy) LockoutFor(failures int) time.Duration {
+    if p.Threshold <= 0 || failures < p.Threshold {
+        return 0
+    }
+    lockout := p.BaseLockout
+    for i := p.Threshold; i < failures && lockout < p.MaxLockout; i++ {
+        lockout *= 2
+    }
+    if lockout > p.MaxLockout {
+        lockout = p.MaxLockout
+    }
+    return lockout
+}
+
+// LoginAttempts tracks failed logins per key
+type LoginAttempts interface {
+    // LockedFor returns how long key stays locked out, or 0 when it may log in
+    LockedFor(ctx context.Context, key string) (time.Duration, error)
+    // RecordFailure counts a failed login and returns the lockout it triggered, if any
+    RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (time.Duration, error)
+    // Reset forgets key's failures after a successful login
+    Reset(ctx context.Context, key string) error
+}
+
+// MemoryLoginAttempts tracks failed logins in memory for single-instance deployments
+type MemoryLoginAttempts struct {
+    mu       sync.Mutex
+    attempts map[string]*loginAttempt
+}
+
+type loginAttempt struct {
+    failures    int
+    lockedUntil time.Time
+    expiresAt   time.Time
+}
+
+// NewMemoryLoginAttempts creates an in-memory tracker and starts its cleanup loop
+func NewMemoryLoginAttempts() *MemoryLoginAttempts {
+    m := &MemoryLoginAttempts{attempts: make(map[string]*loginAttempt)}
+    go m.cleanup()
+    return m
+}
+
+// LockedFor returns how long key stays locked out
+func (m *MemoryLoginAttempts) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    attempt, exists := m.attempts[key]
+    if !exists {
+        return 0, nil
+    }
+    if remaining := time.Until(attempt.lockedUntil); remaining > 0 {
+        return remaining, nil
+    }
+    return 0, nil
+}
+
+// RecordFailure counts a failed login against key
+func (m *MemoryLoginAttempts) RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (time.Duration, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := time.Now()
+    attempt, exists := m.attempts[key]
+    if !exists || now.After(attempt.expiresAt) {
+        attempt = &loginAttempt{}
+        m.attempts[key] = attempt
+    }
+    attempt.failures++
+    attempt.expiresAt = now.Add(policy.Window)
+
+    lockout := policy.LockoutFor(attempt.failures)
+    if lockout > 0 {
+        attempt.lockedUntil = now.Add(lockout)
+    }
+    return lockout, nil
+}
+
+// Reset forgets key's failures
+func (m *MemoryLoginAttempts) Reset(ctx context.Context, key string) error {
+    m.mu.Lock()
+    delete(m.attempts, key)
+    m.mu.Unlock()
+    return nil
+}
+
+// cleanup drops attempts whose failure window has passed
+func (m *MemoryLoginAttempts) cleanup() {
+    ticker := time.NewTicker(time.Minute)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        now := time.Now()
+        m.mu.Lock()
+        for key, attempt := range m.attempts {
+            if now.After(attempt.expiresAt) && now.After(attempt.lockedUntil) {
+                delete(m.attempts, key)
+            }
+        }
+        m.mu.Unlock()
+    }
+}
+
+// RedisLoginAttempts tracks failed logins in Redis so lockouts apply across instances.
+// It shares the rate limiter's client.
+type RedisLoginAttempts struct {
+    client *redis.Client
+}
+
+// NewRedisLoginAttempts creates a tracker using the rate limiter's Redis client
+func NewRedisLoginAttempts(client *redis.Client) *RedisLoginAttempts {
+    return &RedisLoginAttempts{client: client}
+}
+
+// loginFailureScript counts a failure, refreshes the failure window and returns the new count
+var loginFailureScript = redis.NewScript(`
+local failures = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return failures
+`)
+
+// LockedFor returns how long key stays locked out
+func (r *RedisLoginAttempts) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+    ttl, err := r.client.PTTL(ctx, "login:lock:"+key).Result()
+    if err != nil {
+        return 0, err
+    }
+    if ttl <= 0 {
+        return 0, nil
+    }
+    return ttl, nil
+}
+
+// RecordFailure counts a failed login against key
+func (r *RedisLoginAttempts) RecordFailure(ctx context.Context, key string, policy LockoutPolicy) (time.Duration, error) {
+    failures, err := loginFailureScript.Run(ctx, r.client, []string{"login:failures:" + key},
+        policy.Window.Milliseconds()).Int()
+    if err != nil {
+        return 0, err
+    }
+
+    lockout := policy.LockoutFor(failures)
+    if lockout > 0 {
+        if err := r.client.Set(ctx, "login:lock:"+key, "1", lockout).Err(); err != nil {
+            return 0, err
+        }
+    }
+    return lockout, nil
+}
+
+// Reset forgets key's failures
+func (r *RedisLoginAttempts) Reset(ctx context.Context, key string) error {
+    return r.client.Del(ctx, "login:failures:"+key, "login:lock:"+key).Err()
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+var testLockout = LockoutPolicy{
+    Threshold:   3,
+    BaseLockout: time.Minute,
+    MaxLockout:  10 * time.Minute,
+    Window:      time.Hour,
+}
+
+func TestLockoutFor(t *testing.T) {
+    cases := []struct {
+        failures int
+        want     time.Duration
+    }{
+        {0, 0},
+        {2, 0},
+        {3, time.Minute},
+        {4, 2 * time.Minute},
+        {5, 4 * time.Minute},
+        {6, 8 * time.Minute},
+        {7, 10 * time.Minute},
+        {50, 10 * time.Minute},
+    }
+    for _, tc := range cases {
+        if got := testLockout.LockoutFor(tc.failures); got != tc.want {
+            t.Errorf("LockoutFor(%d) = %s, want %s", tc.failures, got, tc.want)
+        }
+    }
+
+    disabled := testLockout
+    disabled.Threshold = 0
+    if got := disabled.LockoutFor(100); got != 0 {
+        t.Errorf("disabled policy: LockoutFor(100) = %s, want 0", got)
+    }
+}
+
+// exerciseLoginAttempts runs the same lockout sequence against any tracker
+func exerciseLoginAttempts(t *testing.T, attempts LoginAttempts) {
+    t.Helper()
+    ctx := context.Background()
+
+    for i := 1; i < testLockout.Threshold; i++ {
+        if lockout, err := attempts.RecordFailure(ctx, "a@example.com", testLockout); err != nil || lockout != 0 {
+            t.Fatalf("failure %d: lockout = %s, err = %v; want none yet", i, lockout, err)
+        }
+    }
+    if locked, _ := attempts.LockedFor(ctx, "a@example.com"); locked != 0 {
+        t.Fatalf("locked for %s before reaching the threshold", locked)
+    }
+
+    if lockout, err := attempts.RecordFailure(ctx, "a@example.com", testLockout); err != nil || lockout != time.Minute {
+        t.Fatalf("threshold failure: lockout = %s, err = %v; want 1m", lockout, err)
+    }
+    if lockout, _ := attempts.RecordFailure(ctx, "a@example.com", testLockout); lockout != 2*time.Minute {
+        t.Errorf("next failure: lockout = %s, want it doubled to 2m", lockout)
+    }
+    if locked, err := attempts.LockedFor(ctx, "a@example.com"); err != nil || locked <= time.Minute || locked > 2*time.Minute {
+        t.Errorf("LockedFor = %s, err = %v; want the remaining 2m lockout", locked, err)
+    }
+    if locked, _ := attempts.LockedFor(ctx, "b@example.com"); locked != 0 {
+        t.Errorf("another email is locked for %s", locked)
+    }
+
+    if err := attempts.Reset(ctx, "a@example.com"); err != nil {
+        t.Fatal(err)
+    }
+    if locked, _ := attempts.LockedFor(ctx, "a@example.com"); locked != 0 {
+        t.Errorf("locked for %s after a reset", locked)
+    }
+    if lockout, _ := attempts.RecordFailure(ctx, "a@example.com", testLockout); lockout != 0 {
+        t.Errorf("a reset should start counting from zero, got lockout %s", lockout)
+    }
+}
+
+func TestMemoryLoginAttempts(t *testing.T) {
+    exerciseLoginAttempts(t, NewMemoryLoginAttempts())
+}
+
+func TestMemoryLoginAttemptsForgetOldFailures(t *testing.T) {
+    attempts := NewMemoryLoginAttempts()
+    ctx := context.Background()
+    policy := testLockout
+    policy.Window = time.Millisecond
+
+    for i := 0; i < policy.Threshold-1; i++ {
+        attempts.RecordFailure(ctx, "a@example.com", policy)
+    }
+    time.Sleep(5 * time.Millisecond)
+    if lockout, _ := attempts.RecordFailure(ctx, "a@example.com", policy); lockout != 0 {
+        t.Errorf("lockout = %s, want failures outside the window forgotten", lockout)
+    }
+}
+
+func TestRedisLoginAttemptsBackoff(t *testing.T) {
+    _, client := newTestRedis(t)
+    exerciseLoginAttempts(t, NewRedisLoginAttempts(client))
+}
+
+func TestRedisLoginAttemptsWindow(t *testing.T) {
+    server, client := newTestRedis(t)
+    attempts := NewRedisLoginAttempts(client)
+    ctx := context.Background()
+
+    for i := 0; i < testLockout.Threshold; i++ {
+        attempts.RecordFailure(ctx, "a@example.com", testLockout)
+    }
+    server.FastForward(time.Minute + time.Second)
+    if locked, _ := attempts.LockedFor(ctx, "a@example.com"); locked != 0 {
+        t.Errorf("locked for %s after the lockout ran out", locked)
+    }
+    // The failure count outlives the lockout, so the next failure locks again at once
+    if lockout, _ := attempts.RecordFailure(ctx, "a@example.com", testLockout); lockout != 2*time.Minute {
+        t.Errorf("lockout = %s, want 2m while failures are remembered", lockout)
+    }
+
+    server.FastForward(testLockout.Window + time.Second)
+    if lockout, _ := attempts.RecordFailure(ctx, "a@example.com", testLockout); lockout != 0 {
+        t.Errorf("lockout = %s, want failures forgotten after the window", lockout)
+    }
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    dto "github.com/prometheus/client_model/go"
+)
+
+// Metrics registered with the default Prometheus registry and served by promhttp
+var (
+    HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "http_requests_total",
+        Help: "Total HTTP requests by route, method and status code.",
+    }, []string{"route", "method", "status"})
+    GeminiRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "gemini_requests_total",
+        Help: "Total Gemini API requests by model and outcome.",
+    }, []string{"model", "success"})
+    GeminiTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "gemini_tokens_total",
+        Help: "Total Gemini tokens by model and direction (input/output).",
+    }, []string{"model", "type"})
+    RateLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "rate_limit_rejections_total",
+        Help: "Total requests rejected by the rate limiter, by tier.",
+    }, []string{"tier"})
+    ChatResponseLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "chat_response_latency_seconds",
+        Help:    "Chat message handling latency in seconds.",
+        Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+    }, []string{"endpoint"})
+)
+
+// CounterTotal sums a counter across all of its label values
+func CounterTotal(counter *prometheus.CounterVec) float64 {
+    metrics := make(chan prometheus.Metric)
+    go func() {
+        counter.Collect(metrics)
+        close(metrics)
+    }()
+
+    var total float64
+    for metric := range metrics {
+        var sample dto.Metric
+        if metric.Write(&sample) == nil {
+            total += sample.GetCounter().GetValue()
+        }
+    }
+    return total
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+    "regexp"
+    "strings"
+)
+
+// WordFilter matches whole words from a block list, ignoring case
+type WordFilter struct {
+    pattern *regexp.Regexp
+}
+
+// NewWordFilter builds a filter for words. Entries may be phrases; blank ones are ignored.
+func NewWordFilter(words []string) *WordFilter {
+    var quoted []string
+    for _, word := range words {
+        if word = strings.TrimSpace(word); word != "" {
+            quoted = append(quoted, regexp.QuoteMeta(word))
+        }
+    }
+    if len(quoted) == 0 {
+        return &WordFilter{}
+    }
+    return &WordFilter{pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// Matches reports whether text contains a blocked word
+func (f *WordFilter) Matches(text string) bool {
+    return f.pattern != nil && f.pattern.MatchString(text)
+}
+
+// Mask replaces every blocked word in text with asterisks of the same length
+func (f *WordFilter) Mask(text string) string {
+    if f.pattern == nil {
+        return text
+    }
+    return f.pattern.ReplaceAllStringFunc(text, func(match string) string {
+        return strings.Repeat("*", len([]rune(match)))
+    })
+}
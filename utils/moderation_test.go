@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestWordFilter(t *testing.T) {
+    filter := NewWordFilter([]string{"darn", " heck ", "", "c++ sucks"})
+
+    cases := []struct {
+        text    string
+        matches bool
+        masked  string
+    }{
+        {"Darn it", true, "**** it"},
+        {"what the HECK?", true, "what the ****?"},
+        {"darned good", false, "darned good"},
+        {"honestly c++ sucks", true, "honestly *********"},
+        {"all fine here", false, "all fine here"},
+    }
+    for _, tc := range cases {
+        if got := filter.Matches(tc.text); got != tc.matches {
+            t.Errorf("Matches(%q) = %v, want %v", tc.text, got, tc.matches)
+        }
+        if got := filter.Mask(tc.text); got != tc.masked {
+            t.Errorf("Mask(%q) = %q, want %q", tc.text, got, tc.masked)
+        }
+    }
+}
+
+func TestEmptyWordFilter(t *testing.T) {
+    filter := NewWordFilter([]string{" ", ""})
+    if filter.Matches("anything at all") {
+        t.Error("an empty filter matched")
+    }
+    if got := filter.Mask("anything at all"); got != "anything at all" {
+        t.Errorf("Mask = %q, want the text unchanged", got)
+    }
+}
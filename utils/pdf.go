@@ -0,0 +1,71 @@
+package utils
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "github.com/ledongthuc/pdf"
+)
+
+// ExtractPDFText pulls the plain text out of a PDF file without any external service.
+// Parsing is done by ledongthuc/pdf, which reads classic xref tables as well as the
+// compressed xref and object streams of PDF 1.5+; scanned (image-only) documents yield
+// no text.
+func ExtractPDFText(filePath string) (text string, err error) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return "", fmt.Errorf("failed to read PDF: %v", err)
+    }
+    defer file.Close()
+
+    header := make([]byte, 1024)
+    n, _ := io.ReadFull(file, header)
+    if !bytes.Contains(header[:n], []byte("%PDF-")) {
+        return "", fmt.Errorf("file is not a PDF document")
+    }
+    info, err := file.Stat()
+    if err != nil {
+        return "", fmt.Errorf("failed to read PDF: %v", err)
+    }
+
+    // The parser panics on some malformed files rather than returning an error
+    defer func() {
+        if r := recover(); r != nil {
+            text, err = "", fmt.Errorf("failed to parse PDF: %v", r)
+        }
+    }()
+
+    reader, err := pdf.NewReader(file, info.Size())
+    if err != nil {
+        return "", fmt.Errorf("failed to parse PDF: %v", err)
+    }
+
+    var content strings.Builder
+    fonts := make(map[string]*pdf.Font)
+    for i := 1; i <= reader.NumPage(); i++ {
+        page := reader.Page(i)
+        if page.V.IsNull() {
+            continue
+        }
+        // Cache fonts across pages so their character maps are parsed once
+        for _, name := range page.Fonts() {
+            if _, ok := fonts[name]; !ok {
+                font := page.Font(name)
+                fonts[name] = &font
+            }
+        }
+        pageText, err := page.GetPlainText(fonts)
+        if err != nil {
+            return "", fmt.Errorf("failed to extract text from page %d: %v", i, err)
+        }
+        if pageText = strings.TrimSpace(pageText); pageText != "" {
+            content.WriteString(pageText)
+            content.WriteString("\n")
+        }
+    }
+
+    return strings.TrimSpace(content.String()), nil
+}
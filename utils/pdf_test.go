@@ -0,0 +1,64 @@
+package utils
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestExtractPDFText(t *testing.T) {
+    cases := []struct {
+        file string
+        want []string
+    }{
+        {"classic.pdf", []string{"Hello from a classic PDF", "Opening hours are 9am to 5pm."}},
+        {"flate.pdf", []string{"Page one talks about pricing.", "Page two covers refunds (within 30 days)."}},
+        // PDF 1.5: objects packed in a compressed object stream, indexed by a
+        // predictor-encoded xref stream instead of an xref table
+        {"xref-stream.pdf", []string{"Compressed xref streams are read too.", "Support: help@example.com"}},
+    }
+    for _, tc := range cases {
+        text, err := ExtractPDFText(filepath.Join("testdata", tc.file))
+        if err != nil {
+            t.Errorf("%s: %v", tc.file, err)
+            continue
+        }
+        for _, want := range tc.want {
+            if !strings.Contains(text, want) {
+                t.Errorf("%s: extracted text %q is missing %q", tc.file, text, want)
+            }
+        }
+    }
+}
+
+func TestExtractPDFTextKeepsPagesApart(t *testing.T) {
+    text, err := ExtractPDFText(filepath.Join("testdata", "flate.pdf"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(text, "pricing.\nPage two") {
+        t.Errorf("pages should be separated by a newline, got %q", text)
+    }
+}
+
+func TestExtractPDFTextRejectsInvalidFiles(t *testing.T) {
+    dir := t.TempDir()
+
+    notPDF := filepath.Join(dir, "notes.pdf")
+    os.WriteFile(notPDF, []byte("just some text"), 0o644)
+    if _, err := ExtractPDFText(notPDF); err == nil || !strings.Contains(err.Error(), "not a PDF") {
+        t.Errorf("plain text file: err = %v, want a not-a-PDF error", err)
+    }
+
+    truncated := filepath.Join(dir, "truncated.pdf")
+    data, _ := os.ReadFile(filepath.Join("testdata", "classic.pdf"))
+    os.WriteFile(truncated, data[:len(data)/2], 0o644)
+    if _, err := ExtractPDFText(truncated); err == nil {
+        t.Error("a truncated PDF was parsed without error")
+    }
+
+    if _, err := ExtractPDFText(filepath.Join(dir, "missing.pdf")); err == nil {
+        t.Error("a missing file was parsed without error")
+    }
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// Limit is the number of requests allowed per period
+type Limit struct {
+    Rate   int
+    Period time.Duration
+}
+
+// PerMinute returns a limit of rate requests per minute
+func PerMinute(rate int) Limit {
+    return Limit{Rate: rate, Period: time.Minute}
+}
+
+// RateLimitResult describes the outcome of counting a request against a limit
+type RateLimitResult struct {
+    Allowed    bool
+    Remaining  int
+    RetryAfter time.Duration // time until the window resets when the request was rejected
+}
+
+// Limiter decides whether the request identified by key fits within limit
+type Limiter interface {
+    Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// RateLimiter is an in-memory fixed-window limiter for single-instance deployments
+type RateLimiter struct {
+    mu       sync.Mutex
+    visitors map[string]*visitor
+}
+
+type visitor struct {
+    count       int
+    windowStart time.Time
+    lastSeen    time.Time
+}
+
+// NewRateLimiter creates an in-memory limiter and starts its cleanup loop
+func NewRateLimiter() *RateLimiter {
+    rl := &RateLimiter{visitors: make(map[string]*visitor)}
+    go rl.cleanupVisitors()
+    return rl
+}
+
+// Allow counts the request against key's current window
+func (rl *RateLimiter) Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    now := time.Now()
+    v, exists := rl.visitors[key]
+    if !exists || now.Sub(v.windowStart) >= limit.Period {
+        v = &visitor{windowStart: now}
+        rl.visitors[key] = v
+    }
+    v.lastSeen = now
+
+    if v.count >= limit.Rate {
+        return RateLimitResult{RetryAfter: v.windowStart.Add(limit.Period).Sub(now)}, nil
+    }
+    v.count++
+    return RateLimitResult{Allowed: true, Remaining: limit.Rate - v.count}, nil
+}
+
+// cleanupVisitors drops visitors that have been idle for a few minutes
+func (rl *RateLimiter) cleanupVisitors() {
+    ticker := time.NewTicker(time.Minute)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        rl.mu.Lock()
+        for key, v := range rl.visitors {
+            if time.Since(v.lastSeen) > 3*time.Minute {
+                delete(rl.visitors, key)
+            }
+        }
+        rl.mu.Unlock()
+    }
+}
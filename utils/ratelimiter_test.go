@@ -0,0 +1,68 @@
+package utils
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// checkLimitBoundary sends limit.Rate+1 requests for key: every request up to and
+// including the one that exactly reaches the limit must pass, the next must not
+func checkLimitBoundary(t *testing.T, limiter Limiter, key string, limit Limit) {
+    t.Helper()
+    ctx := context.Background()
+
+    for i := 1; i <= limit.Rate; i++ {
+        result, err := limiter.Allow(ctx, key, limit)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !result.Allowed {
+            t.Fatalf("request %d of %d was rejected", i, limit.Rate)
+        }
+        if result.Remaining != limit.Rate-i {
+            t.Errorf("request %d: Remaining = %d, want %d", i, result.Remaining, limit.Rate-i)
+        }
+    }
+
+    result, err := limiter.Allow(ctx, key, limit)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.Allowed {
+        t.Fatalf("request %d exceeded the limit of %d but was allowed", limit.Rate+1, limit.Rate)
+    }
+    if result.RetryAfter <= 0 || result.RetryAfter > limit.Period {
+        t.Errorf("RetryAfter = %s, want within (0, %s]", result.RetryAfter, limit.Period)
+    }
+}
+
+func TestRateLimiterBoundary(t *testing.T) {
+    limiter := &RateLimiter{visitors: make(map[string]*visitor)}
+    checkLimitBoundary(t, limiter, "ip:1.2.3.4", PerMinute(5))
+    checkLimitBoundary(t, limiter, "ip:single", PerMinute(1))
+}
+
+func TestRedisRateLimiterExactLimitVersusExceeded(t *testing.T) {
+    _, client := newTestRedis(t)
+    limiter := NewRedisRateLimiter(client)
+    checkLimitBoundary(t, limiter, "ip:1.2.3.4", PerMinute(5))
+    checkLimitBoundary(t, limiter, "ip:single", PerMinute(1))
+}
+
+func TestRateLimiterWindowResets(t *testing.T) {
+    limiter := &RateLimiter{visitors: make(map[string]*visitor)}
+    limit := Limit{Rate: 1, Period: 20 * time.Millisecond}
+    ctx := context.Background()
+
+    if result, _ := limiter.Allow(ctx, "key", limit); !result.Allowed {
+        t.Fatal("first request rejected")
+    }
+    if result, _ := limiter.Allow(ctx, "key", limit); result.Allowed {
+        t.Fatal("second request in the window allowed")
+    }
+    time.Sleep(limit.Period)
+    if result, _ := limiter.Allow(ctx, "key", limit); !result.Allowed {
+        t.Fatal("request in the next window rejected")
+    }
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/go-redis/redis_rate/v10"
+    "github.com/redis/go-redis/v9"
+)
+
+// RedisRateLimiter is a GCRA limiter (redis_rate) shared by every instance using the same Redis
+type RedisRateLimiter struct {
+    limiter *redis_rate.Limiter
+}
+
+// NewRedisClient creates a client from a redis:// or rediss:// (TLS) URL when url is set,
+// otherwise from addr, password and db, and verifies Redis answers PING
+func NewRedisClient(url, addr, password string, db int) (*redis.Client, error) {
+    options := &redis.Options{Addr: addr, Password: password, DB: db}
+    if url != "" {
+        var err error
+        if options, err = redis.ParseURL(url); err != nil {
+            return nil, fmt.Errorf("invalid Redis URL: %v", err)
+        }
+    }
+
+    client := redis.NewClient(options)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := client.Ping(ctx).Err(); err != nil {
+        client.Close()
+        return nil, fmt.Errorf("failed to connect to Redis: %v", err)
+    }
+    return client, nil
+}
+
+// NewRedisRateLimiter creates a limiter on an existing client
+func NewRedisRateLimiter(client *redis.Client) *RedisRateLimiter {
+    return &RedisRateLimiter{limiter: redis_rate.NewLimiter(client)}
+}
+
+// Allow counts the request against key. Up to limit.Rate requests may arrive at once,
+// after which capacity comes back evenly over limit.Period.
+func (rl *RedisRateLimiter) Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+    res, err := rl.limiter.Allow(ctx, key, redis_rate.Limit{
+        Rate:   limit.Rate,
+        Burst:  limit.Rate,
+        Period: limit.Period,
+    })
+    if err != nil {
+        return RateLimitResult{}, err
+    }
+    // Remaining already excludes this request, so the request taking the last slot has
+    // Remaining == 0 but is still allowed; only Allowed says whether it was
+    if res.Allowed == 0 {
+        return RateLimitResult{RetryAfter: res.RetryAfter}, nil
+    }
+    return RateLimitResult{Allowed: true, Remaining: res.Remaining}, nil
+}